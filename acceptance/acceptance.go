@@ -1,9 +1,11 @@
 package acceptance
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/pkg/errors"
@@ -15,28 +17,22 @@ import (
 
 	"github.com/manifoldco/grafton"
 	"github.com/manifoldco/grafton/connector"
+	"github.com/manifoldco/grafton/contract"
+	"github.com/manifoldco/grafton/har"
+	"github.com/manifoldco/grafton/replay"
 )
 
-var api *grafton.Client
-var uapi *grafton.Client
+const defaultCallbackTimeout = 5 * time.Minute
+const maxTimeout = 24 * time.Hour
 
-var product string
-var plan string
-var planFeatures manifold.FeatureMap
-var region string
-var newPlan string
-var newPlanFeatures manifold.FeatureMap
-var resourceMeasures map[string]int64
-var credentialType string
+// runs holds a test run for every combination the acceptance tests are
+// configured to run against.
+var runs []*testRun
 
-var clientID string
-var clientSecret string
-var connectorPort uint
-var fakeConnector *connector.FakeConnector
-var cbTimeout = time.Minute * 5
-var maxTimeout = 24 * time.Hour
+// parallel is the number of jobs run at the same time.
+var parallel = 1
 
-type visitorFunc func(context.Context, *FeatureImpl) bool
+type visitorFunc func(context.Context, *node) bool
 
 // Configuration defines the config options for the acceptance tests
 type Configuration struct {
@@ -54,25 +50,74 @@ type Configuration struct {
 	CallbackTimeout  string
 	ResourceMeasures string
 	Credential       string
+
+	// Matrix optionally runs the acceptance tests against several plans,
+	// regions and plan features. Values missing from the matrix are taken from
+	// the fields above.
+	Matrix *Matrix
+
+	// Parallel is the number of independent top level features, or matrix
+	// combinations, to run at the same time. Features run one at a time if it
+	// is 0 or 1.
+	Parallel uint
+
+	// Faults are injected into the requests the provider makes to the fake
+	// Connector for the whole run, whichever combination or feature they
+	// are made for, as every job shares the Connector.
+	Faults []connector.Fault
+
+	// Members are added to the teams of the fake Connector before the run,
+	// changing who signs in to resources.
+	Members []connector.Member
+
+	// StrictCallbacks fails the tests on issues with how the provider sends
+	// callbacks, such as retrying them without backing off, which are
+	// otherwise reported as warnings.
+	StrictCallbacks bool
+
+	// StrictContract fails the contract feature on responses which don't
+	// match the provider API spec, which are otherwise reported as
+	// warnings. Responses are only checked when API and UnauthorizedAPI
+	// send their requests through contract.Spec.Transport.
+	StrictContract bool
+
+	// Contract, if set, is the provider API spec the responses to requests
+	// made outside of API and UnauthorizedAPI, such as to the provider's
+	// SSO url, are checked against by the contract feature.
+	Contract *contract.Spec
+
+	// ConnectorContract, if set, is the spec of the Connector API which the
+	// requests the provider makes to the fake Connector are validated
+	// against. Requests which don't match it are listed per route once every
+	// feature has run.
+	ConnectorContract *contract.Spec
+
+	// StrictConnectorContract fails the run on requests to the fake
+	// Connector which don't match ConnectorContract, which are otherwise
+	// reported as warnings.
+	StrictConnectorContract bool
+
+	// Recorder, if set, records the requests received by the fake Connector
+	// and those following the provider's SSO redirects. Requests made
+	// through API and UnauthorizedAPI are recorded through their
+	// grafton.ClientOptions.Transport.
+	Recorder *har.Recorder
+
+	// SessionRecorder, if set, records the callbacks received by the fake
+	// Connector into a session which can be replayed. Requests made through
+	// API are recorded through its grafton.ClientOptions.Transport.
+	SessionRecorder *replay.Recorder
+
+	// Origins, if set, records the requests sent through API on the fake
+	// Connector's callbacks, as the requests they originated from. API
+	// must send its requests through it.
+	Origins *connector.OriginTransport
 }
 
 // Configure configures all the values needed to run the acceptance tests.
 // This should be called before run.
 func Configure(cfg Configuration) error {
-
-	api = cfg.API
-	uapi = cfg.UnauthorizedAPI
-	product = cfg.Product
-	region = cfg.Region
-	plan = cfg.Plan
-	planFeatures = cfg.PlanFeatures
-	newPlan = cfg.NewPlan
-	newPlanFeatures = cfg.NewPlanFeatures
-	credentialType = cfg.Credential
-
-	clientID = cfg.ClientID
-	clientSecret = cfg.ClientSecret
-	connectorPort = cfg.Port
+	cbTimeout := defaultCallbackTimeout
 
 	var err error
 	if cfg.CallbackTimeout != "" {
@@ -86,6 +131,7 @@ func Configure(cfg Configuration) error {
 		}
 	}
 
+	var resourceMeasures map[string]int64
 	if cfg.ResourceMeasures != "" {
 		err := json.Unmarshal([]byte(cfg.ResourceMeasures), &resourceMeasures)
 		if err != nil {
@@ -93,25 +139,220 @@ func Configure(cfg Configuration) error {
 		}
 	}
 
-	fakeConnector, err = connector.New(connectorPort, clientID, clientSecret, product)
-	return err
-}
+	combos, err := cfg.Matrix.Combinations(cfg)
+	if err != nil {
+		return err
+	}
 
-var shouldRunErrorCases = true
+	fakeConnector, err := connector.New(cfg.Port, cfg.ClientID, cfg.ClientSecret, cfg.Product)
+	if err != nil {
+		return err
+	}
+	fakeConnector.Provider = cfg.API
+	fakeConnector.Config.CallbackTimeout = cbTimeout
+	fakeConnector.Contract = cfg.ConnectorContract
+	if cfg.Origins != nil {
+		cfg.Origins.Connector = fakeConnector
+	}
+
+	var transport http.RoundTripper
+	if cfg.SessionRecorder != nil {
+		fakeConnector.Middleware = cfg.SessionRecorder.Middleware
+	}
+	if cfg.Recorder != nil {
+		next := fakeConnector.Middleware
+		fakeConnector.Middleware = func(h http.Handler) http.Handler {
+			if next != nil {
+				h = next(h)
+			}
+			return cfg.Recorder.Middleware("connector", h)
+		}
+		transport = cfg.Recorder.Transport("sso", nil)
+	}
+	if cfg.Contract != nil {
+		transport = cfg.Contract.Transport(transport)
+	}
+
+	for _, f := range cfg.Faults {
+		if _, err := fakeConnector.AddFault(f); err != nil {
+			return errors.Wrap(err, "invalid fault")
+		}
+	}
+
+	for _, m := range cfg.Members {
+		if _, err := fakeConnector.AddMember(m); err != nil {
+			return errors.Wrap(err, "invalid user")
+		}
+	}
+
+	parallel = 1
+	if cfg.Parallel > 1 {
+		parallel = int(cfg.Parallel)
+	}
+
+	runs = make([]*testRun, len(combos))
+	for i, c := range combos {
+		name := "grafton"
+		if cfg.Matrix != nil {
+			name = c.String()
+		}
+
+		runs[i] = &testRun{
+			name:             name,
+			api:              cfg.API,
+			uapi:             cfg.UnauthorizedAPI,
+			product:          cfg.Product,
+			plan:             c.Plan,
+			planFeatures:     c.PlanFeatures,
+			region:           c.Region,
+			newPlan:          c.NewPlan,
+			newPlanFeatures:  c.NewPlanFeatures,
+			resourceMeasures: resourceMeasures,
+			credentialType:   cfg.Credential,
+			clientID:         cfg.ClientID,
+			clientSecret:     cfg.ClientSecret,
+			connector:        fakeConnector,
+			cbTimeout:        cbTimeout,
+			strictCallbacks:  cfg.StrictCallbacks,
+			strictContract:   cfg.StrictContract,
+			transport:        transport,
+
+			strictConnectorContract: cfg.StrictConnectorContract,
+		}
+	}
+
+	return nil
+}
 
 // Run runs the acceptance tests for all features, less the ones with labels
-// in exclude.
+// in exclude, once for every configured combination.
 //
-// run returns a bool indicating success or failure
-func Run(ctx context.Context, runErrorCases bool, exclude []string) bool {
-	shouldRunErrorCases = runErrorCases
+// Run returns a Report holding the outcome of every feature, case and
+// teardown, including those that were skipped, with a suite per combination.
+func Run(ctx context.Context, runErrorCases bool, exclude []string) *Report {
 	gomega.RegisterFailHandler(failHandler)
+
+	fakeConnector := runs[0].connector
 	fakeConnector.Start()
 	defer fakeConnector.Stop()
 
-	walkGraph(ctx, exclude, false, execute)
-	printSummary(failures, success)
-	return failures > 0
+	// Output of jobs running at the same time is buffered, and written out in
+	// the order the jobs would have run one at a time.
+	buffered := parallel > 1
+
+	report := &Report{}
+	resources := make([]*resourceSet, len(runs))
+	var jobs []*job
+	for i, configured := range runs {
+		suite := &Suite{Name: configured.name, Timestamp: time.Now()}
+		report.Suites = append(report.Suites, suite)
+		owned := newResourceSet()
+		resources[i] = owned
+
+		for i, nodes := range independentGroups(buildGraph(features).children) {
+			run := *configured
+			run.resources = owned
+			run.runErrorCases = runErrorCases
+			run.log = &logger{w: std.w}
+			run.rec = newRecorder(run.name)
+
+			j := &job{run: &run, nodes: nodes, suite: suite, done: make(chan struct{})}
+			if buffered {
+				j.out = &bytes.Buffer{}
+				run.log.w = j.out
+			}
+
+			if len(runs) > 1 {
+				if i == 0 {
+					j.heading = run.name
+				}
+				run.log.indent = 2
+			}
+
+			jobs = append(jobs, j)
+		}
+	}
+
+	if buffered {
+		go func() {
+			sem := make(chan struct{}, parallel)
+			for _, j := range jobs {
+				sem <- struct{}{}
+				go func(j *job) {
+					defer func() { <-sem }()
+					j.execute(ctx, exclude)
+				}(j)
+			}
+		}()
+	}
+
+	for _, j := range jobs {
+		if buffered {
+			<-j.done
+			fmt.Fprint(std.w, j.out.String())
+		} else {
+			j.execute(ctx, exclude)
+		}
+
+		j.suite.TestCases = append(j.suite.TestCases, j.run.rec.suite.TestCases...)
+		if d := j.finished.Sub(j.suite.Timestamp); d > j.suite.Duration {
+			j.suite.Duration = d
+		}
+	}
+
+	// The fake Connector is shared by every combination, so each suite only
+	// gets the requests made about the resources of its own. Those about none
+	// of them, such as for client credentials, get a suite of their own.
+	if len(runs) == 1 {
+		checkConnectorRequests(runs[0], report.Suites[0], std, func(manifold.ID) bool { return true })
+	} else if fakeConnector.Contract != nil {
+		l := &logger{w: std.w, indent: 2}
+		for i, configured := range runs {
+			fmt.Fprintln(l.w)
+			fmt.Fprintln(l.w, bold(configured.name))
+			checkConnectorRequests(configured, report.Suites[i], l, resources[i].has)
+		}
+
+		shared := &Suite{Name: "connector", Timestamp: time.Now()}
+		fmt.Fprintln(l.w)
+		fmt.Fprintln(l.w, bold(shared.Name))
+		checkConnectorRequests(runs[0], shared, l, func(ID manifold.ID) bool {
+			for _, r := range resources {
+				if r.has(ID) {
+					return false
+				}
+			}
+			return true
+		})
+		report.Suites = append(report.Suites, shared)
+	}
+
+	std.printSummary(report.Suites)
+	return report
+}
+
+// job is a part of the feature graph, run for a single combination, which
+// does not depend on any other part of it.
+type job struct {
+	run      *testRun
+	nodes    []*node
+	suite    *Suite
+	heading  string
+	out      *bytes.Buffer
+	done     chan struct{}
+	finished time.Time
+}
+
+func (j *job) execute(ctx context.Context, exclude []string) {
+	defer close(j.done)
+
+	if j.heading != "" {
+		fmt.Fprintln(j.run.log.w)
+		fmt.Fprintln(j.run.log.w, bold(j.heading))
+	}
+
+	walkNodes(withRun(ctx, j.run), j.nodes, exclude, false, execute, j.run.skip)
+	j.finished = time.Now()
 }
 
 // Validate checks if the test run has all the required information it needs to run
@@ -121,7 +362,8 @@ func Run(ctx context.Context, runErrorCases bool, exclude []string) bool {
 // testing parameter or setting.
 func Validate(ctx context.Context, cctx *cli.Context, exclude []string) []error {
 	validationErrors := map[string]error{}
-	visitorFunc := func(ctx context.Context, feature *FeatureImpl) bool {
+	visitorFunc := func(ctx context.Context, n *node) bool {
+		feature := n.f
 		for _, flag := range feature.requiredFlags {
 			if !cctx.IsSet(flag) {
 				key := fmt.Sprintf("%s-%s-%s", feature.label, feature.name, flag)
@@ -133,7 +375,7 @@ func Validate(ctx context.Context, cctx *cli.Context, exclude []string) []error
 		return true
 	}
 
-	walkGraph(ctx, exclude, true, visitorFunc)
+	walkGraph(ctx, exclude, true, visitorFunc, nil)
 
 	var i int
 	errs := make([]error, len(validationErrors))
@@ -148,11 +390,22 @@ func Validate(ctx context.Context, cctx *cli.Context, exclude []string) []error
 // the children. If a feature is marked to be excluded, the feature is skipped,
 // otherwise, the visitorFunc is performed with the Feature Implementation.
 //
+// If skipped is not nil, it is called for every feature that will not be
+// visited, either because it was excluded, or is opt-in and was not included,
+// or because a feature it runs inside of failed.
+//
 // walkGraph returns a boolean indicating if there were any errors running
 // the visitorFuncs.
-func walkGraph(ctx context.Context, exclude []string, descendOnErr bool, visitor visitorFunc) bool {
-	root := buildGraph(features)
-	stack := root.children
+func walkGraph(ctx context.Context, exclude []string, descendOnErr bool, visitor visitorFunc, skipped skipFunc) bool {
+	return walkNodes(ctx, buildGraph(features).children, exclude, descendOnErr, visitor, skipped)
+}
+
+// walkNodes walks the given nodes of the feature graph, and their children,
+// like walkGraph.
+func walkNodes(ctx context.Context, nodes []*node, exclude []string, descendOnErr bool,
+	visitor visitorFunc, skipped skipFunc) bool {
+
+	stack := nodes
 	failures := false
 
 	for len(stack) != 0 {
@@ -160,18 +413,28 @@ func walkGraph(ctx context.Context, exclude []string, descendOnErr bool, visitor
 		n, stack = stack[0], stack[1:]
 
 		if !shouldRun(exclude, n.f.label) {
+			if skipped != nil && !n.isTeardown {
+				reason, parent := "excluded from the test run", "excluded feature"
+				if n.f.optIn {
+					reason = fmt.Sprintf("opt-in, not included (use --include %s)", n.f.label)
+					parent = "opt-in feature"
+				}
+
+				skipped(n.f, reason)
+				skipChildren(n, fmt.Sprintf("runs inside %s `%s`", parent, n.f.label), skipped)
+			}
 			continue
 		}
 
-		ok := visitor(ctx, n.f)
-		if !ok {
-			n.f.failed = true
-		}
+		ok := visitor(ctx, n)
+		n.failed = !ok
 
 		// we only run children if the parent passed when descendOnErr is false.
 		// this handles the RunsInside logic.
 		if ok || descendOnErr {
 			stack = append(n.children, stack...)
+		} else if skipped != nil {
+			skipChildren(n, fmt.Sprintf("runs inside failed feature `%s`", n.f.label), skipped)
 		}
 
 		failures = failures || ok
@@ -180,35 +443,50 @@ func walkGraph(ctx context.Context, exclude []string, descendOnErr bool, visitor
 	return failures
 }
 
-const testFailurePanic = "test failed"
+type skipFunc func(f *FeatureImpl, reason string)
 
-func execute(ctx context.Context, f *FeatureImpl) (ok bool) {
-	defer func() {
-		if r := recover(); r == testFailurePanic {
-			ok = false
-		} else if r != nil {
-			panic(r)
+// skipChildren calls skipped for every feature nested inside of n.
+func skipChildren(n *node, reason string, skipped skipFunc) {
+	for _, c := range n.children {
+		if c.isTeardown {
+			continue
 		}
-	}()
 
-	ok = true
+		skipped(c.f, reason)
+		skipChildren(c, reason, skipped)
+	}
+}
+
+func execute(ctx context.Context, n *node) bool {
+	run := runFrom(ctx)
+	f := n.f
 
-	if !f.hasRun {
-		enter(bold(f.label+": ") + f.name)
+	if !n.isTeardown {
+		run.log.enter(bold(f.label+": ") + f.name)
 
-		f.hasRun = true
-		f.fn(ctx)
-	} else {
-		exit()
-		if f.teardown != nil && !f.failed {
-			enter(bold(f.label+": ") + f.teardown.name)
+		tc := run.rec.begin(f.label, f.name, KindFeature)
+		ok := run.protect(func() { f.fn(ctx) }) == nil
+		run.rec.end(tc, ok)
+		return ok
+	}
 
-			f.teardown.fn(ctx)
-			exit()
-		}
+	run.log.exit()
+	if f.teardown == nil {
+		return true
 	}
 
-	return
+	if n.setup.failed {
+		run.rec.skip(f.label, f.teardown.name, KindTearDown, "feature failed")
+		return true
+	}
+
+	run.log.enter(bold(f.label+": ") + f.teardown.name)
+	defer run.log.exit()
+
+	tc := run.rec.begin(f.label, f.teardown.name, KindTearDown)
+	ok := run.protect(func() { f.teardown.fn(ctx) }) == nil
+	run.rec.end(tc, ok)
+	return ok
 }
 
 func shouldRun(excluded []string, label string) bool {
@@ -225,10 +503,9 @@ func failHandler(message string, callerskip ...int) {
 		message = message + "\n"
 	}
 
-	printIndented(message)
-
-	// bounce out of executing the rest of the test flow
-	panic(testFailurePanic)
+	// bounce out of executing the rest of the test flow; the failure is
+	// reported by the test run which recovers it.
+	panic(&testFailure{message: message})
 }
 
 var errFatal = errors.New("Fatal error") //nolint:golint,unused
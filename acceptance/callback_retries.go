@@ -0,0 +1,167 @@
+package acceptance
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/manifoldco/go-manifold"
+
+	"github.com/manifoldco/grafton/connector"
+)
+
+// callbackRejections are the status codes the first attempts to complete a
+// callback are answered with, before it is accepted.
+var callbackRejections = []int{
+	http.StatusInternalServerError,
+	http.StatusServiceUnavailable,
+	http.StatusInternalServerError,
+}
+
+const (
+	// minCallbackRetryDelay is the shortest wait between two attempts to
+	// complete a callback which isn't considered as retrying right away.
+	minCallbackRetryDelay = 100 * time.Millisecond
+
+	// callbackRetryJitter is how much shorter than the previous one a wait
+	// between two attempts to complete a callback may be, as providers may
+	// add some randomness to their backoff.
+	callbackRetryJitter = 250 * time.Millisecond
+
+	// duplicateCallbackWait is how long to wait for duplicate callbacks once
+	// a callback is completed, and duplicateCallbackPoll how often they're
+	// looked for meanwhile.
+	duplicateCallbackWait = time.Second
+	duplicateCallbackPoll = 50 * time.Millisecond
+)
+
+var callbackRetries = Feature("callback-retries", "Retry rejected callbacks with a backoff", func(ctx context.Context) {
+	run := runFrom(ctx)
+
+	var retriedID manifold.ID
+	Default(ctx, func() {
+		var faults []connector.Fault
+		for _, status := range callbackRejections {
+			faults = append(faults, connector.Fault{Count: 1, Status: status})
+		}
+
+		cb, faults := provisionCredentialsWithFaults(ctx, faults, &run.retriesCredID, "retrying it once rejected")
+		retriedID = cb.ID
+
+		var attempts []time.Time
+		for _, f := range faults {
+			attempts = append(attempts, f.InjectedAt...)
+		}
+
+		for _, a := range callbackAttempts(cb) {
+			if a.StatusCode == http.StatusNoContent {
+				attempts = append(attempts, a.ReceivedAt)
+				break
+			}
+		}
+
+		checkBackoff(run, attempts)
+	})
+
+	Case(ctx, "Without conflicting duplicate callbacks", func() {
+		// Only the callback retried by this run is checked, as the Connector
+		// is shared with the runs of other combinations.
+		cb := run.connector.GetCallback(retriedID)
+		if cb == nil {
+			FatalErr("No callback was completed")
+		}
+
+		// Duplicates are usually sent right after the callback they conflict
+		// with, so they're given a moment to arrive.
+		for _, a := range conflictingAttempts(ctx, cb, duplicateCallbackWait) {
+			run.callbackIssuef("Callback %s was completed as '%s', then sent again as '%s': %q",
+				cb.ID, cb.State, a.Request.State, a.Request.Message)
+		}
+	})
+})
+
+var _ = callbackRetries.TearDown("Delete the credential set", func(ctx context.Context) {
+	run := runFrom(ctx)
+
+	if run.retriesCredID.IsEmpty() {
+		return
+	}
+
+	Default(ctx, func() {
+		mustDeprovisionCredentials(ctx, run.api, run.retriesCredID)
+	})
+})
+
+var _ = callbackRetries.RunsInside("provision")
+var _ = callbackRetries.OptIn()
+
+// callbackAttempts returns a copy of the requests made to complete the
+// callback, as they may still be coming in.
+func callbackAttempts(cb *connector.Callback) []connector.CallbackAttempt {
+	cb.Mutex.Lock()
+	defer cb.Mutex.Unlock()
+
+	return append([]connector.CallbackAttempt(nil), cb.Requests...)
+}
+
+// conflictingAttempts returns the attempts to complete the callback which
+// were rejected as it was already completed, looking for them until some come
+// in or wait is over.
+func conflictingAttempts(ctx context.Context, cb *connector.Callback, wait time.Duration) []connector.CallbackAttempt {
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	poll := time.NewTicker(duplicateCallbackPoll)
+	defer poll.Stop()
+
+	for over := false; ; {
+		var conflicts []connector.CallbackAttempt
+		for _, a := range callbackAttempts(cb) {
+			if a.StatusCode == http.StatusConflict {
+				conflicts = append(conflicts, a)
+			}
+		}
+
+		if len(conflicts) > 0 || over {
+			return conflicts
+		}
+
+		select {
+		case <-poll.C:
+		case <-timeout.C:
+			over = true
+		case <-ctx.Done():
+			over = true
+		}
+	}
+}
+
+// checkBackoff reports attempts to complete a callback made right after the
+// previous one, waits shorter than the one before them, give or take
+// callbackRetryJitter, and waits which don't grow overall.
+func checkBackoff(run *testRun, attempts []time.Time) {
+	var waits []time.Duration
+	for i := 1; i < len(attempts); i++ {
+		waits = append(waits, attempts[i].Sub(attempts[i-1]))
+	}
+
+	for i, w := range waits {
+		if w < minCallbackRetryDelay {
+			run.callbackIssuef("Expected the provider to wait before retrying the callback, "+
+				"attempt %d came %s after the previous one", i+2, w)
+			return
+		}
+	}
+
+	for i := 1; i < len(waits); i++ {
+		if waits[i]+callbackRetryJitter < waits[i-1] {
+			run.callbackIssuef("Expected the provider to back off between attempts to complete the callback, "+
+				"attempt %d came %s after the previous one, sooner than the %s before it", i+2, waits[i], waits[i-1])
+			return
+		}
+	}
+
+	if len(waits) > 1 && waits[len(waits)-1] <= waits[0] {
+		run.callbackIssuef("Expected the provider to back off between attempts to complete the callback, "+
+			"waited %s then %s", waits[0], waits[len(waits)-1])
+	}
+}
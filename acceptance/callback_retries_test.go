@@ -0,0 +1,44 @@
+package acceptance
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckBackoff(t *testing.T) {
+	tcs := []struct {
+		name  string
+		waits []time.Duration
+		issue string
+	}{
+		{"growing waits", []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, ""},
+		{"jittered waits", []time.Duration{time.Second, 900 * time.Millisecond, 2 * time.Second}, ""},
+		{"retrying right away", []time.Duration{time.Second, time.Millisecond}, "to wait before retrying"},
+		{"a shorter wait", []time.Duration{time.Second, 4 * time.Second, time.Second, 5 * time.Second},
+			"attempt 4 came 1s after the previous one, sooner than the 4s before it"},
+		{"constant waits", []time.Duration{time.Second, time.Second}, "waited 1s then 1s"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			run := &testRun{log: &logger{w: out}, rec: newRecorder("grafton")}
+
+			attempts := []time.Time{time.Now()}
+			for _, w := range tc.waits {
+				attempts = append(attempts, attempts[len(attempts)-1].Add(w))
+			}
+
+			checkBackoff(run, attempts)
+
+			if tc.issue == "" && out.Len() != 0 {
+				t.Errorf("Expected no issue, got %q", out.String())
+			}
+			if tc.issue != "" && !strings.Contains(out.String(), tc.issue) {
+				t.Errorf("Expected an issue about %q, got %q", tc.issue, out.String())
+			}
+		})
+	}
+}
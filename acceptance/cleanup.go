@@ -6,11 +6,13 @@ import (
 )
 
 var _ = Feature("cleanup", "Can provision and deprovision a resource", func(ctx context.Context) {
-	Default(func() {
+	run := runFrom(ctx)
+
+	Default(ctx, func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 
-		curResource := attemptResourceProvision(ctx, api, product, plan, planFeatures, region)
-		attemptResourceDeprovision(ctx, api, curResource.ID)
+		curResource := attemptResourceProvision(ctx, run.api, run.product, run.plan, run.planFeatures, run.region)
+		attemptResourceDeprovision(ctx, run.api, curResource.ID)
 	})
 })
@@ -0,0 +1,115 @@
+package acceptance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	gm "github.com/onsi/gomega"
+
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/idtype"
+
+	"github.com/manifoldco/grafton/connector"
+	"github.com/manifoldco/grafton/db"
+)
+
+var connectorFaults = Feature("connector-faults", "Complete a callback despite a flaky Connector", func(ctx context.Context) {
+	run := runFrom(ctx)
+
+	Default(ctx, func() {
+		_, faults := provisionCredentialsWithFaults(ctx, []connector.Fault{
+			{Count: 1, Status: http.StatusServiceUnavailable},
+			{Count: 1, Status: http.StatusTooManyRequests, RetryAfter: time.Second},
+			{Count: 1, Drop: true},
+		}, &run.faultsCredID, "retrying it against a flaky Connector")
+
+		for _, f := range faults {
+			gm.Expect(f.Injected).To(gm.Equal(1), "Expected the provider to retry the callback")
+		}
+	})
+})
+
+var _ = connectorFaults.TearDown("Delete the credential set", func(ctx context.Context) {
+	run := runFrom(ctx)
+
+	if run.faultsCredID.IsEmpty() {
+		return
+	}
+
+	Default(ctx, func() {
+		mustDeprovisionCredentials(ctx, run.api, run.faultsCredID)
+	})
+})
+
+var _ = connectorFaults.RunsInside("provision")
+var _ = connectorFaults.OptIn()
+
+// provisionCredentialsWithFaults provisions a credential set through a
+// callback, injecting the given faults into the attempts to complete it, in
+// order. Faults only apply to this callback, leaving features running at the
+// same time alone, and are removed once it is completed.
+//
+// The credential's ID is set through credID right away, so it is
+// deprovisioned on teardown even if the callback never comes, but the
+// credential is only stored once the callback is done. The completed callback
+// is returned along with the faults as they were injected. purpose describes
+// what the callback is provisioned for, as reported if the provider doesn't
+// use one.
+func provisionCredentialsWithFaults(ctx context.Context, faults []connector.Fault,
+	credID *manifold.ID, purpose string) (*connector.Callback, []connector.Fault) {
+
+	run := runFrom(ctx)
+
+	cb, err := run.connector.AddCallbackFor(connector.CredentialProvisionCallback, run.resourceID)
+	if err != nil {
+		FatalErr("Could not create callback: %s", err)
+	}
+
+	added := make([]connector.Fault, len(faults))
+	for i, f := range faults {
+		f.Route = "/v1/callbacks/" + cb.ID.String()
+		f, err := run.connector.AddFault(f)
+		if err != nil {
+			FatalErr("Could not add fault: %s", err)
+		}
+		added[i] = f
+		defer run.connector.RemoveFault(f.ID)
+	}
+
+	ID, err := manifold.NewID(idtype.Credential)
+	if err != nil {
+		FatalErr("Could not generate credential id: %s", err)
+	}
+
+	run.infoln("Attempting to provision credentials for resource:", run.resourceID)
+	_, msg, async, err := run.api.ProvisionCredentials(ctx, cb.ID, run.resourceID, ID)
+	gm.Expect(err).To(notError(), "Expected a successful provision of a new set of Credentials")
+	*credID = ID
+
+	if !async {
+		FatalErr("Expected the credentials to be provisioned through a callback, to test " + purpose)
+	}
+
+	run.infoln(fmt.Sprintf("Waiting for Callback (max: %.1f minutes): %s", run.cbTimeout.Minutes(), msg))
+	cb, err = waitForCallback(ctx, cb.ID, run.cbTimeout)
+	gm.Expect(err).To(notError(), fmt.Sprintf(
+		"Expected the provider to complete the callback despite the %d injected faults", len(faults)))
+	gm.Expect(cb.State).To(gm.Equal(connector.DoneCallbackState), "Expected to receive 'done' as the state")
+
+	run.connector.DB.PutCredential(db.Credential{
+		ID:         ID,
+		Keys:       cb.Credentials,
+		CreatedOn:  time.Now(),
+		ResourceID: run.resourceID,
+	})
+
+	for i, f := range added {
+		f, err := run.connector.GetFault(f.ID)
+		gm.Expect(err).To(notError())
+		added[i] = f
+	}
+
+	return cb, added
+}
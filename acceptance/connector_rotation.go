@@ -0,0 +1,67 @@
+package acceptance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gm "github.com/onsi/gomega"
+
+	"github.com/manifoldco/grafton/connector"
+)
+
+var connectorRotation = Feature("connector-rotation", "Rotate a credential set through the Connector", func(ctx context.Context) {
+	run := runFrom(ctx)
+
+	// The provider decides when to rotate credentials, so Grafton only
+	// provisions one and waits for the provider to ask the Connector to
+	// rotate it, as it would for a leaked or expiring credential.
+	Default(ctx, func() {
+		oldCredID, oldValues := mustProvisionCredentials(ctx, run.api, run.resourceID)
+		run.connectorRotationCredID = oldCredID
+
+		run.infoln(fmt.Sprintf("Waiting for the provider to rotate credential %s (max: %.1f minutes)",
+			oldCredID, run.cbTimeout.Minutes()))
+
+		rot, err := run.connector.WaitForRotationOf(oldCredID, run.cbTimeout)
+		gm.Expect(err).To(notError(),
+			"Expected the provider to rotate the credential with PUT /v1/credential-rotations/{id}")
+		gm.Expect(rot.Request.ResourceID).To(gm.Equal(run.resourceID),
+			"Expected the rotation to name the credential's resource")
+
+		// both the provision and the deprovision may wait for a callback
+		max := 2*run.cbTimeout + 2*time.Minute
+		run.infoln(fmt.Sprintf("Waiting for Rotation %s (max: %.1f minutes)", rot.ID, max.Minutes()))
+
+		rot, err = run.connector.WaitForRotation(rot.ID, max)
+		gm.Expect(err).To(notError(), "Expected the rotation to finish")
+
+		if !rot.NewCredentialID.IsEmpty() {
+			run.connectorRotationCredID = rot.NewCredentialID
+		}
+		gm.Expect(rot.State).To(gm.Equal(connector.DoneRotationState), "Message: %s", rot.Message)
+
+		cred := run.connector.DB.GetCredential(rot.NewCredentialID)
+		gm.Expect(cred).ToNot(gm.BeNil(), "Expected the rotated credential to be stored")
+		gm.Expect(cred.Keys).ToNot(
+			gm.Equal(oldValues), "Different credentials expected for new Credential Set")
+
+		gm.Expect(run.connector.DB.GetCredential(oldCredID)).To(
+			gm.BeNil(), "Expected the old credential to be removed")
+	})
+})
+
+var _ = connectorRotation.TearDown("Remove the rotated credential set", func(ctx context.Context) {
+	run := runFrom(ctx)
+
+	if run.connectorRotationCredID.IsEmpty() || run.connector.DB.GetCredential(run.connectorRotationCredID) == nil {
+		return
+	}
+
+	Default(ctx, func() {
+		mustDeprovisionCredentials(ctx, run.api, run.connectorRotationCredID)
+	})
+})
+
+var _ = connectorRotation.RunsInside("provision")
+var _ = connectorRotation.OptIn()
@@ -0,0 +1,164 @@
+package acceptance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/idtype"
+	"github.com/manifoldco/promptui"
+
+	"github.com/manifoldco/grafton/contract"
+)
+
+var contractFeature = Feature("contract", "Respond as described by the provider API spec", func(ctx context.Context) {
+	run := runFrom(ctx)
+
+	// Only the responses are checked here; whether the requests succeed is
+	// up to the other features. The resource is provisioned for this feature
+	// alone, so its plan can be changed. Every route of the provider API is
+	// called, measures only when they're expected.
+	Default(ctx, func() {
+		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+		ctx, c := contract.WithCollector(ctx)
+
+		r, _, _, err := provisionResource(ctx, run.api, run.product, run.plan, run.planFeatures, run.region)
+		if err == nil {
+			credID, _, _, _, err := provisionCredentials(ctx, run.api, r.ID)
+			if err == nil {
+				deprovisionCredentials(ctx, run.api, credID)
+			}
+
+			if run.resourceMeasures != nil {
+				start, end := measuresPeriod()
+				run.api.PullResourceMeasures(ctx, r.ID, start, end)
+			}
+
+			if code, err := run.connector.CreateCodeFor(r.ID); err == nil {
+				signIn(ctx, run.api.CreateSsoURL(code.Code, r.ID).String())
+			}
+
+			if run.newPlan != "" {
+				changePlan(ctx, run.api, r.ID, run.newPlan, run.newPlanFeatures)
+			}
+
+			deprovisionResource(ctx, run.api, r.ID)
+		}
+
+		reportViolations(run, c)
+	})
+
+	ErrorCase(ctx, "with error responses", func() {
+		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+		ctx, c := contract.WithCollector(ctx)
+
+		fakeResourceID, err := manifold.NewID(idtype.Resource)
+		if err != nil {
+			FatalErr("Could not generate resource id: %s", err)
+		}
+		fakeCredentialID, err := manifold.NewID(idtype.Credential)
+		if err != nil {
+			FatalErr("Could not generate credential id: %s", err)
+		}
+
+		provisionCredentials(ctx, run.uapi, run.resourceID)
+		provisionCredentials(ctx, run.api, fakeResourceID)
+		deprovisionCredentials(ctx, run.api, fakeCredentialID)
+		changePlan(ctx, run.api, fakeResourceID, run.plan, run.planFeatures)
+		deprovisionResource(ctx, run.api, fakeResourceID)
+
+		reportViolations(run, c)
+	})
+})
+
+var _ = contractFeature.RunsInside("provision")
+
+// The feature provisions a resource of its own and changes its plan, on top
+// of those the other features provision, so it only runs when asked for.
+var _ = contractFeature.OptIn()
+
+// reportViolations reports the responses which did not match the spec,
+// failing the test case in strict mode, or warning about each of them
+// otherwise.
+func reportViolations(run *testRun, c *contract.Collector) {
+	if c.Checked() == 0 {
+		FatalErr("No responses were checked against the spec; " +
+			"the API clients must send their requests through contract.Spec.Transport")
+	}
+
+	vs := c.Violations()
+	if len(vs) == 0 {
+		return
+	}
+
+	if run.strictContract {
+		lines := make([]string, len(vs))
+		for i, v := range vs {
+			lines[i] = "  " + v.String()
+		}
+		FatalErr("Expected the responses to match the provider API spec:\n%s", strings.Join(lines, "\n"))
+	}
+
+	for _, v := range vs {
+		run.warnf("Expected the response to match the provider API spec: %s", v)
+	}
+}
+
+// checkConnectorRequests records, as a feature of the suite, whether the
+// requests the provider made to the fake Connector about the resources
+// selected by owns matched the Connector API spec, listing those which did
+// not per route. The feature fails in strict mode, and warns about each of
+// them otherwise. Nothing is recorded unless the requests were validated.
+func checkConnectorRequests(run *testRun, suite *Suite, l *logger, owns func(manifold.ID) bool) {
+	if run.connector.Contract == nil {
+		return
+	}
+
+	const label, name = "connector-contract", "Send requests as described by the Connector API spec"
+
+	rec := newRecorder(suite.Name)
+	feature := rec.begin(label, name, KindFeature)
+	tc := rec.begin("", "Default case", KindCase)
+
+	fmt.Fprintln(l.w)
+	l.enter(bold(label+": ") + name)
+	l.enter(tc.Name)
+
+	var failures []string
+	for _, c := range run.connector.Capturers() {
+		vs := c.ViolationsFor(owns)
+		if len(vs) == 0 {
+			continue
+		}
+
+		l.enter(c.Route)
+		for _, v := range vs {
+			if run.strictConnectorContract {
+				l.printIndented(promptui.IconBad + " " + v.String() + "\n")
+				failures = append(failures, "  "+v.String())
+				continue
+			}
+
+			l.warn(v.String())
+			rec.warn(v.String())
+		}
+		l.exit()
+	}
+
+	ok := len(failures) == 0
+	if !ok {
+		rec.fail("Expected the requests to match the Connector API spec:\n" + strings.Join(failures, "\n"))
+	}
+
+	rec.end(tc, ok)
+	rec.end(feature, ok)
+	suite.TestCases = append(suite.TestCases, rec.suite.TestCases...)
+
+	l.result(tc.Name, ok)
+	l.exit()
+	l.exit()
+}
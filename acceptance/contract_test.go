@@ -0,0 +1,101 @@
+package acceptance
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/manifoldco/go-manifold"
+
+	"github.com/manifoldco/grafton/connector"
+	"github.com/manifoldco/grafton/contract"
+)
+
+func TestCheckConnectorRequests(t *testing.T) {
+	spec, err := contract.Connector()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := connector.New(0, selfTestClientID, selfTestClientSecret, "bonnets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Contract = spec
+
+	srv := httptest.NewServer(connector.ValidHandler(c))
+	defer srv.Close()
+
+	req, err := http.NewRequest("PUT", srv.URL+"/v1/callbacks/2000000000000000000000000000a",
+		strings.NewReader(`{"state": "finished", "message": "Provisioned"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+
+	const violation = "PUT /callbacks/{id}: state in body should be one of [done error]"
+
+	all := func(manifold.ID) bool { return true }
+
+	t.Run("warns about each request", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		suite := &Suite{}
+		checkConnectorRequests(&testRun{connector: c}, suite, &logger{w: out}, all)
+
+		if suite.Count(StatusFailed) != 0 {
+			t.Errorf("Expected no failures, got %d", suite.Count(StatusFailed))
+		}
+
+		if suite.countWarnings() != 1 || suite.TestCases[1].Warnings[0] != violation {
+			t.Errorf("Expected a warning about %q, got %+v", violation, suite.TestCases[1].Warnings)
+		}
+
+		if !strings.Contains(out.String(), "/v1/callbacks/{id}") {
+			t.Errorf("Expected the violations to be listed by route, got %q", out.String())
+		}
+	})
+
+	t.Run("fails in strict mode", func(t *testing.T) {
+		suite := &Suite{}
+		checkConnectorRequests(&testRun{connector: c, strictConnectorContract: true}, suite, &logger{w: &bytes.Buffer{}}, all)
+
+		if suite.Count(StatusFailed) != 2 {
+			t.Fatalf("Expected the feature and its case to fail, got %+v", suite.TestCases)
+		}
+
+		if !strings.Contains(suite.TestCases[1].Message, violation) {
+			t.Errorf("Expected the failure to list %q, got %q", violation, suite.TestCases[1].Message)
+		}
+	})
+
+	t.Run("only lists the requests about the selected resources", func(t *testing.T) {
+		suite := &Suite{}
+		none := func(manifold.ID) bool { return false }
+		checkConnectorRequests(&testRun{connector: c, strictConnectorContract: true}, suite, &logger{w: &bytes.Buffer{}}, none)
+
+		if suite.Count(StatusFailed) != 0 || suite.countWarnings() != 0 {
+			t.Errorf("Expected the feature to pass without warnings, got %+v", suite.TestCases)
+		}
+	})
+
+	t.Run("records nothing unless requests are validated", func(t *testing.T) {
+		suite := &Suite{}
+		unchecked, err := connector.New(0, selfTestClientID, selfTestClientSecret, "bonnets")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkConnectorRequests(&testRun{connector: unchecked}, suite, &logger{w: &bytes.Buffer{}}, all)
+		if len(suite.TestCases) != 0 {
+			t.Errorf("Expected no test cases, got %+v", suite.TestCases)
+		}
+	})
+}
@@ -17,22 +17,22 @@ import (
 	"github.com/manifoldco/grafton/db"
 )
 
-var credentialID manifold.ID
-
 var creds = Feature("credentials", "Create a credential set", func(ctx context.Context) {
-	Default(func() {
-		cID, _ := mustProvisionCredentials(ctx, api, resourceID)
+	run := runFrom(ctx)
+
+	Default(ctx, func() {
+		cID, _ := mustProvisionCredentials(ctx, run.api, run.resourceID)
 
-		credentialID = cID
+		run.credentialID = cID
 	})
 
-	ErrorCase("with an invalid resource ID", func() {
+	ErrorCase(ctx, "with an invalid resource ID", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 		var err error
 
 		fakeResourceID, _ := manifold.NewID(idtype.Resource)
-		_, _, _, async, err := provisionCredentials(ctx, api, fakeResourceID)
+		_, _, _, async, err := provisionCredentials(ctx, run.api, fakeResourceID)
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -51,12 +51,12 @@ var creds = Feature("credentials", "Create a credential set", func(ctx context.C
 		gm.Expect(e.Type).Should(gm.Equal(merrors.NotFoundError), "Message: %s", e.Error())
 	})
 
-	ErrorCase("with already provisioned credentials - same content acts as created", func() {
+	ErrorCase(ctx, "with already provisioned credentials - same content acts as created", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 		var err error
 
-		_, _, _, async, err := provisionCredentialsID(ctx, api, credentialID, resourceID)
+		_, _, _, async, err := provisionCredentialsID(ctx, run.api, run.credentialID, run.resourceID)
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -68,11 +68,11 @@ var creds = Feature("credentials", "Create a credential set", func(ctx context.C
 		)
 	})
 
-	ErrorCase("with a bad signature", func() {
+	ErrorCase(ctx, "with a bad signature", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 
-		_, _, _, async, err := provisionCredentials(ctx, uapi, resourceID)
+		_, _, _, async, err := provisionCredentials(ctx, run.uapi, run.resourceID)
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -93,16 +93,18 @@ var creds = Feature("credentials", "Create a credential set", func(ctx context.C
 })
 
 var _ = creds.TearDown("Delete a credential set", func(ctx context.Context) {
-	Default(func() {
-		mustDeprovisionCredentials(ctx, api, credentialID)
+	run := runFrom(ctx)
+
+	Default(ctx, func() {
+		mustDeprovisionCredentials(ctx, run.api, run.credentialID)
 	})
 
-	ErrorCase("delete credentials that do not exist", func() {
+	ErrorCase(ctx, "delete credentials that do not exist", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 
 		fakeCredentialID, _ := manifold.NewID(idtype.Credential)
-		_, async, err := deprovisionCredentials(ctx, api, fakeCredentialID)
+		_, async, err := deprovisionCredentials(ctx, run.api, fakeCredentialID)
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -125,6 +127,8 @@ var _ = creds.TearDown("Delete a credential set", func(ctx context.Context) {
 var _ = creds.RunsInside("provision")
 
 func mustProvisionCredentials(ctx context.Context, api *grafton.Client, resourceID manifold.ID) (manifold.ID, map[string]string) {
+	run := runFrom(ctx)
+
 	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
@@ -132,7 +136,7 @@ func mustProvisionCredentials(ctx context.Context, api *grafton.Client, resource
 	gm.Expect(err).To(notError(), "Expected a successful provision of a new set of Credentials")
 
 	if async {
-		c := fakeConnector.GetCallback(callbackID)
+		c := run.connector.GetCallback(callbackID)
 		gm.Expect(c.State).To(
 			gm.Equal(connector.DoneCallbackState),
 			"Expected to receive 'done' as the state",
@@ -161,7 +165,9 @@ func mustProvisionCredentials(ctx context.Context, api *grafton.Client, resource
 }
 
 func provisionCredentials(ctx context.Context, api *grafton.Client, resourceID manifold.ID) (manifold.ID, map[string]string, manifold.ID, bool, error) {
-	Infof("Attempting to provision credentials for resource: %s\n", resourceID)
+	run := runFrom(ctx)
+
+	run.infof("Attempting to provision credentials for resource: %s\n", resourceID)
 	ID, err := manifold.NewID(idtype.Credential)
 	if err != nil {
 		return ID, nil, ID, false, FatalErr("Could not generate credential id: %s", err)
@@ -171,7 +177,10 @@ func provisionCredentials(ctx context.Context, api *grafton.Client, resourceID m
 }
 
 func provisionCredentialsID(ctx context.Context, api *grafton.Client, credentialID, resourceID manifold.ID) (manifold.ID, map[string]string, manifold.ID, bool, error) {
-	c, err := fakeConnector.AddCallback(connector.CredentialProvisionCallback)
+	run := runFrom(ctx)
+
+	run.resources.add(resourceID)
+	c, err := run.connector.AddCallbackFor(connector.CredentialProvisionCallback, resourceID)
 	if err != nil {
 		return credentialID, nil, manifold.ID{}, false, err
 	}
@@ -182,9 +191,9 @@ func provisionCredentialsID(ctx context.Context, api *grafton.Client, credential
 	}
 
 	if callback {
-		Infoln(fmt.Sprintf("Waiting for Callback: (max: %.1f minutes): %s", cbTimeout.Minutes(), msg))
+		run.infoln(fmt.Sprintf("Waiting for Callback: (max: %.1f minutes): %s", run.cbTimeout.Minutes(), msg))
 
-		cb, err := waitForCallback(c.ID, cbTimeout)
+		cb, err := waitForCallback(ctx, c.ID, run.cbTimeout)
 		if err != nil {
 			return credentialID, nil, c.ID, callback, err
 		}
@@ -193,17 +202,17 @@ func provisionCredentialsID(ctx context.Context, api *grafton.Client, credential
 		creds = cb.Credentials
 	}
 
-	Infoln("Provisioned Credentials Successfully")
+	run.infoln("Provisioned Credentials Successfully")
 	if msg != "" {
-		Infoln("Message: ", msg)
+		run.infoln("Message: ", msg)
 	}
-	Infoln("Credentials:")
+	run.infoln("Credentials:")
 	for k, v := range creds {
-		Infoln("  ", k, "=", v)
+		run.infoln("  ", k, "=", v)
 	}
 
 	// Store in connector
-	fakeConnector.DB.PutCredential(db.Credential{
+	run.connector.DB.PutCredential(db.Credential{
 		ID:         credentialID,
 		Keys:       creds,
 		CreatedOn:  time.Now(),
@@ -214,6 +223,8 @@ func provisionCredentialsID(ctx context.Context, api *grafton.Client, credential
 }
 
 func mustDeprovisionCredentials(ctx context.Context, api *grafton.Client, credentialID manifold.ID) {
+	run := runFrom(ctx)
+
 	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
@@ -221,7 +232,7 @@ func mustDeprovisionCredentials(ctx context.Context, api *grafton.Client, creden
 	gm.Expect(err).To(notError(), "No error is expected")
 
 	if async {
-		c := fakeConnector.GetCallback(callbackID)
+		c := run.connector.GetCallback(callbackID)
 
 		gm.Expect(c.State).To(
 			gm.Equal(connector.DoneCallbackState),
@@ -239,9 +250,16 @@ func mustDeprovisionCredentials(ctx context.Context, api *grafton.Client, creden
 }
 
 func deprovisionCredentials(ctx context.Context, api *grafton.Client, credentialID manifold.ID) (manifold.ID, bool, error) {
-	Infoln("Attempting to deprovision credentials:", credentialID)
+	run := runFrom(ctx)
+
+	run.infoln("Attempting to deprovision credentials:", credentialID)
+
+	var resourceID manifold.ID
+	if cred := run.connector.DB.GetCredential(credentialID); cred != nil {
+		resourceID = cred.ResourceID
+	}
 
-	c, err := fakeConnector.AddCallback(connector.CredentialDeprovisionCallback)
+	c, err := run.connector.AddCallbackFor(connector.CredentialDeprovisionCallback, resourceID)
 	if err != nil {
 		return manifold.ID{}, false, err
 	}
@@ -252,9 +270,9 @@ func deprovisionCredentials(ctx context.Context, api *grafton.Client, credential
 	}
 
 	if callback {
-		Infoln(fmt.Sprintf("Waiting for Callback(max %.1f minutes): %s", cbTimeout.Minutes(), msg))
+		run.infoln(fmt.Sprintf("Waiting for Callback(max %.1f minutes): %s", run.cbTimeout.Minutes(), msg))
 
-		cb, err := waitForCallback(c.ID, cbTimeout)
+		cb, err := waitForCallback(ctx, c.ID, run.cbTimeout)
 		if err != nil {
 			return c.ID, callback, err
 		}
@@ -262,13 +280,13 @@ func deprovisionCredentials(ctx context.Context, api *grafton.Client, credential
 		msg = cb.Message
 	}
 
-	Infoln("Credential Deprovisioned.")
+	run.infoln("Credential Deprovisioned.")
 	if msg != "" {
-		Infoln("Message: ", msg)
+		run.infoln("Message: ", msg)
 	}
 
 	// Delete in connector
-	if !fakeConnector.DB.DeleteCredential(credentialID) {
+	if !run.connector.DB.DeleteCredential(credentialID) {
 		return c.ID, callback, errors.New("Credential did not exist in database")
 	}
 
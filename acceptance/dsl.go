@@ -2,11 +2,7 @@ package acceptance
 
 import "context"
 
-var (
-	failures int
-	success  int
-	features []*FeatureImpl
-)
+var features []*FeatureImpl
 
 // FeatureFunc is the func type run to test features
 type FeatureFunc func(ctx context.Context)
@@ -18,15 +14,14 @@ type FeatureImpl struct {
 
 	fn FeatureFunc
 
-	hasRun bool
-	failed bool
-
 	teardown *tearDownImpl
 
 	before string
 	inside string
 
 	requiredFlags []string
+
+	optIn bool
 }
 
 type tearDownImpl struct {
@@ -87,6 +82,26 @@ func (f *FeatureImpl) RequiredFlags(flags ...string) interface{} {
 	return nil
 }
 
+// OptIn marks a feature as one providers must ask for to be tested, as it
+// relies on functionality not every provider implements.
+func (f *FeatureImpl) OptIn() interface{} {
+	f.optIn = true
+	return nil
+}
+
+// OptInFeatures returns the labels of all features which are only tested when
+// a provider opts in to them.
+func OptInFeatures() []string {
+	var labels []string
+	for _, f := range features {
+		if f.optIn {
+			labels = append(labels, f.label)
+		}
+	}
+
+	return labels
+}
+
 // NeedsFlag checks if a Feature Implementation needs a specific flag or not.
 func (f *FeatureImpl) NeedsFlag(flag string) bool {
 	for _, rflag := range f.requiredFlags {
@@ -99,13 +114,13 @@ func (f *FeatureImpl) NeedsFlag(flag string) bool {
 }
 
 // Default represents the default test case of a feature.
-func Default(fn func()) {
-	block("Default case", fn)
+func Default(ctx context.Context, fn func()) {
+	block(ctx, "Default case", fn)
 }
 
 // Case represents a test case of a feature.
-func Case(name string, fn func()) {
-	block(name, fn)
+func Case(ctx context.Context, name string, fn func()) {
+	block(ctx, name, fn)
 }
 
 // ErrorCase represents an error case for a feature. These are optionally tested
@@ -113,23 +128,37 @@ func Case(name string, fn func()) {
 //
 // Failure of an error case does not prevent further error cases or RunsInside
 // features from running.
-func ErrorCase(name string, fn func()) {
-	if !shouldRunErrorCases {
+func ErrorCase(ctx context.Context, name string, fn func()) {
+	run := runFrom(ctx)
+	if !run.runErrorCases {
+		run.rec.skip("", "Error case: "+name, KindCase, "error cases are disabled")
 		return
 	}
 
-	defer func() { recover() }()
-	block("Error case: "+name, fn)
-}
-
-func block(name string, fn func()) {
-	res := fail
-	enter(name)
 	defer func() {
-		result(name, res)
-		exit()
+		if r := recover(); r != nil {
+			if _, ok := r.(*testFailure); !ok {
+				panic(r)
+			}
+		}
 	}()
+	block(ctx, "Error case: "+name, fn)
+}
 
-	fn()
-	res = pass
+// block runs a single test case. A failed case aborts the rest of the feature
+// it belongs to, unless it is an error case.
+func block(ctx context.Context, name string, fn func()) {
+	run := runFrom(ctx)
+	run.log.enter(name)
+	tc := run.rec.begin("", name, KindCase)
+
+	failure := run.protect(fn)
+
+	run.rec.end(tc, failure == nil)
+	run.log.result(name, failure == nil)
+	run.log.exit()
+
+	if failure != nil {
+		panic(failure)
+	}
 }
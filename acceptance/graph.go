@@ -8,6 +8,12 @@ type node struct {
 	f          *FeatureImpl
 	children   []*node
 	isTeardown bool
+
+	// setup is the node of the feature a teardown node belongs to.
+	setup *node
+
+	// failed is set once the node has been visited, if it failed.
+	failed bool
 }
 
 func (n *node) addChildren(features []*FeatureImpl) []*FeatureImpl {
@@ -19,8 +25,9 @@ func (n *node) addChildren(features []*FeatureImpl) []*FeatureImpl {
 	var leftover []*FeatureImpl
 	for _, f := range features {
 		if f.inside == label {
-			n.children = append(n.children, &node{f: f})
-			n.children = append(n.children, &node{f: f, isTeardown: true})
+			setup := &node{f: f}
+			n.children = append(n.children, setup)
+			n.children = append(n.children, &node{f: f, isTeardown: true, setup: setup})
 		} else {
 			leftover = append(leftover, f)
 		}
@@ -59,3 +66,48 @@ func (p peerOrder) Less(i, j int) bool {
 
 	return false
 }
+
+// independentGroups splits the top level nodes of the feature graph into
+// groups which can run at the same time. A feature is grouped with its
+// teardown, and with any feature it runs before.
+func independentGroups(nodes []*node) [][]*node {
+	top := map[string]bool{}
+	for _, n := range nodes {
+		top[n.f.label] = true
+	}
+
+	joined := map[string]string{}
+	find := func(label string) string {
+		for joined[label] != "" {
+			label = joined[label]
+		}
+		return label
+	}
+
+	for _, n := range nodes {
+		if !top[n.f.before] {
+			continue
+		}
+
+		a, b := find(n.f.label), find(n.f.before)
+		if a != b {
+			joined[a] = b
+		}
+	}
+
+	var groups [][]*node
+	index := map[string]int{}
+	for _, n := range nodes {
+		label := find(n.f.label)
+		i, ok := index[label]
+		if !ok {
+			i = len(groups)
+			index[label] = i
+			groups = append(groups, nil)
+		}
+
+		groups[i] = append(groups[i], n)
+	}
+
+	return groups
+}
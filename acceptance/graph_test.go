@@ -0,0 +1,41 @@
+package acceptance
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIndependentGroups(t *testing.T) {
+	noop := func(context.Context) {}
+	provision := &FeatureImpl{label: "provision", fn: noop}
+	sso := &FeatureImpl{label: "sso", fn: noop, inside: "provision"}
+	migrate := &FeatureImpl{label: "migrate", fn: noop, before: "provision"}
+	cleanup := &FeatureImpl{label: "cleanup", fn: noop}
+
+	root := buildGraph([]*FeatureImpl{provision, sso, migrate, cleanup})
+	groups := independentGroups(root.children)
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+
+	labels := []string{}
+	for _, n := range groups[0] {
+		labels = append(labels, n.f.label)
+	}
+
+	expected := []string{"migrate", "migrate", "provision", "provision"}
+	if len(labels) != len(expected) {
+		t.Fatalf("Expected %v in the first group, got %v", expected, labels)
+	}
+	for i := range expected {
+		if labels[i] != expected[i] {
+			t.Errorf("Expected %v in the first group, got %v", expected, labels)
+			break
+		}
+	}
+
+	if len(groups[1]) != 2 || groups[1][0].f != cleanup || !groups[1][1].isTeardown {
+		t.Errorf("Expected cleanup and its teardown in the second group")
+	}
+}
@@ -2,6 +2,8 @@ package acceptance
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	"github.com/manifoldco/promptui"
@@ -12,13 +14,6 @@ var (
 	faint = promptui.Styler(promptui.FGFaint)
 )
 
-type resultCode int
-
-const (
-	pass resultCode = iota
-	fail
-)
-
 // LogLevel is the type for setting our informational log level, irrespective of
 // test results.
 type LogLevel string
@@ -49,89 +44,134 @@ func SetLogLevel(level LogLevel) {
 	lvl = level
 }
 
+// std is the logger used outside of test runs.
+var std = &logger{w: os.Stdout}
+
 // Infof prints the given format string and args at the appropriate indentation
 // level, if the  logger is at info level or above.
 func Infof(format string, args ...interface{}) {
-	if lvl.show(LogInfo) {
-		printIndented(fmt.Sprintf(format, args...))
-	}
+	std.infof(format, args...)
 }
 
 // Infoln prints the given args at the appropriate indentation level, if the
 // logger is at info level or above.
 func Infoln(args ...interface{}) {
+	std.infoln(args...)
+}
+
+// logger prints indented test output. Every test run has its own logger, so
+// its output is kept together.
+type logger struct {
+	w       io.Writer
+	indent  int
+	entered bool
+}
+
+func (l *logger) infof(format string, args ...interface{}) {
 	if lvl.show(LogInfo) {
-		printIndented(fmt.Sprintln(args...))
+		l.printIndented(fmt.Sprintf(format, args...))
 	}
 }
 
-var indent = 0
-var entered = false
+func (l *logger) infoln(args ...interface{}) {
+	if lvl.show(LogInfo) {
+		l.printIndented(fmt.Sprintln(args...))
+	}
+}
 
-func enter(msg string) {
-	printIndented(msg)
-	entered = true
-	indent += 2
+func (l *logger) enter(msg string) {
+	l.printIndented(msg)
+	l.entered = true
+	l.indent += 2
 }
 
-func exit() {
-	if entered {
-		fmt.Println()
-		entered = false
+func (l *logger) exit() {
+	if l.entered {
+		fmt.Fprintln(l.w)
+		l.entered = false
 	}
 
-	indent -= 2
+	l.indent -= 2
 }
 
-func result(name string, code resultCode) {
-	if !entered {
-		indent -= 2
-		printIndented(faint(name))
-		indent += 2
+func (l *logger) result(name string, ok bool) {
+	if !l.entered {
+		l.indent -= 2
+		l.printIndented(faint(name))
+		l.indent += 2
 	}
 
-	var msg string
-	switch code {
-	case pass:
-		msg = promptui.IconGood
-		success++
-	case fail:
+	msg := promptui.IconGood
+	if !ok {
 		msg = promptui.IconBad
-		failures++
 	}
 
-	fmt.Println(" " + msg)
-	entered = false
+	fmt.Fprintln(l.w, " "+msg)
+	l.entered = false
 }
 
-func printIndented(msg string) {
-	if entered {
-		fmt.Println()
-		entered = false
+// warn prints a warning, whatever the log level, as failures are.
+func (l *logger) warn(msg string) {
+	l.printIndented(promptui.IconWarn + " Warning: " + msg + "\n")
+}
+
+func (l *logger) printIndented(msg string) {
+	if l.entered {
+		fmt.Fprintln(l.w)
+		l.entered = false
 	}
 
-	prefix := strings.Repeat(" ", indent)
+	prefix := strings.Repeat(" ", l.indent)
 	parts := strings.Split(msg, "\n")
 	for i, part := range parts {
 		if i == len(parts)-1 && part == "" {
 			continue
 		}
 
-		fmt.Print(prefix + part)
+		fmt.Fprint(l.w, prefix+part)
 
 		if i != len(parts)-1 {
-			fmt.Println()
+			fmt.Fprintln(l.w)
 		}
 	}
 }
 
-func printSummary(fails, success int) {
+// printSummary prints the number of cases run and failed, and of warnings
+// raised, for every suite when more than one combination was tested.
+func (l *logger) printSummary(suites []*Suite) {
+	fails, total, warnings := 0, 0, 0
+	for _, s := range suites {
+		fails += s.countCases(StatusFailed)
+		total += s.countCases(StatusPassed) + s.countCases(StatusFailed)
+		warnings += s.countWarnings()
+	}
+
+	fmt.Fprintln(l.w)
+
+	if len(suites) > 1 {
+		for _, s := range suites {
+			f := s.countCases(StatusFailed)
+			l.enter(bold(s.Name+": ") + summary(f+s.countCases(StatusPassed), f, s.countWarnings()))
+			l.exit()
+		}
+	}
+
+	l.enter(summary(total, fails, warnings))
+	l.exit()
+}
+
+// summary describes the number of cases run and failed, in red if any failed,
+// followed by the number of warnings raised, if any.
+func summary(total, fails, warnings int) string {
 	styler := promptui.Styler(promptui.FGGreen)
 	if fails > 0 {
 		styler = promptui.Styler(promptui.FGRed)
 	}
-	msg := fmt.Sprintf("%d features, %d failures", fails+success, fails)
-	fmt.Println()
-	enter(styler(msg))
-	exit()
+
+	msg := styler(fmt.Sprintf("%d features, %d failures", total, fails))
+	if warnings > 0 {
+		msg += promptui.Styler(promptui.FGYellow)(fmt.Sprintf(", %d warnings", warnings))
+	}
+
+	return msg
 }
@@ -0,0 +1,119 @@
+package acceptance
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	manifold "github.com/manifoldco/go-manifold"
+)
+
+// Matrix describes the plans, regions and plan features to run the acceptance
+// tests against. The feature graph is run once for every plan in every region
+// with every set of plan features.
+type Matrix struct {
+	Plans        []string              `json:"plans"`
+	Regions      []string              `json:"regions"`
+	PlanFeatures []manifold.FeatureMap `json:"plan-features"`
+	Resizes      []Resize              `json:"resizes"`
+}
+
+// Resize describes the plan a resource on the given plan is changed to when
+// testing the plan-change feature.
+type Resize struct {
+	Plan            string              `json:"plan"`
+	NewPlan         string              `json:"new-plan"`
+	NewPlanFeatures manifold.FeatureMap `json:"new-plan-features"`
+}
+
+// Combination is a single set of values the feature graph is run with.
+type Combination struct {
+	Plan            string
+	PlanFeatures    manifold.FeatureMap
+	Region          string
+	NewPlan         string
+	NewPlanFeatures manifold.FeatureMap
+}
+
+func (c Combination) String() string {
+	s := c.Plan
+	if len(c.PlanFeatures) > 0 {
+		b, _ := json.Marshal(c.PlanFeatures)
+		s += " " + string(b)
+	}
+
+	return s + ", " + c.Region
+}
+
+// Combinations returns every combination of the matrix. Any dimension left
+// empty in the matrix uses the value given in the configuration, as do plans
+// without a matching resize.
+//
+// A nil matrix has a single combination, made of the configuration values.
+func (m *Matrix) Combinations(cfg Configuration) ([]Combination, error) {
+	if m == nil {
+		m = &Matrix{}
+	}
+
+	plans := m.Plans
+	if len(plans) == 0 {
+		plans = []string{cfg.Plan}
+	}
+
+	regions := m.Regions
+	if len(regions) == 0 {
+		regions = []string{cfg.Region}
+	}
+
+	featureSets := m.PlanFeatures
+	if len(featureSets) == 0 {
+		featureSets = []manifold.FeatureMap{cfg.PlanFeatures}
+	}
+
+	resizes := map[string]Resize{}
+	for _, r := range m.Resizes {
+		if _, ok := resizes[r.Plan]; ok {
+			return nil, fmt.Errorf("matrix has more than one resize for plan `%s`", r.Plan)
+		}
+		if r.Plan == r.NewPlan {
+			return nil, fmt.Errorf("matrix resize for plan `%s` must change to a different plan", r.Plan)
+		}
+		resizes[r.Plan] = r
+	}
+
+	var combos []Combination
+	for _, plan := range plans {
+		newPlan, newPlanFeatures := cfg.NewPlan, cfg.NewPlanFeatures
+		if r, ok := resizes[plan]; ok {
+			newPlan, newPlanFeatures = r.NewPlan, r.NewPlanFeatures
+		} else if plan != "" && plan == newPlan {
+			return nil, fmt.Errorf("plan `%s` is the same as the new plan; add a resize for it to the matrix", plan)
+		}
+
+		for _, region := range regions {
+			for _, features := range featureSets {
+				combos = append(combos, Combination{
+					Plan:            plan,
+					PlanFeatures:    features,
+					Region:          region,
+					NewPlan:         newPlan,
+					NewPlanFeatures: newPlanFeatures,
+				})
+			}
+		}
+	}
+
+	return combos, nil
+}
+
+// ParseMatrix parses a JSON encoded Matrix.
+func ParseMatrix(s string) (*Matrix, error) {
+	m := &Matrix{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,81 @@
+package acceptance
+
+import (
+	"testing"
+
+	manifold "github.com/manifoldco/go-manifold"
+)
+
+func TestMatrixCombinations(t *testing.T) {
+	cfg := Configuration{
+		Plan:         "small",
+		PlanFeatures: manifold.FeatureMap{"size": "1 GB"},
+		Region:       "aws::us-east-1",
+		NewPlan:      "large",
+	}
+
+	t.Run("without a matrix", func(t *testing.T) {
+		var m *Matrix
+		combos, err := m.Combinations(cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if len(combos) != 1 || combos[0].Plan != "small" || combos[0].NewPlan != "large" {
+			t.Errorf("Expected the configured values, got %+v", combos)
+		}
+	})
+
+	t.Run("with plans and regions", func(t *testing.T) {
+		m := &Matrix{
+			Plans:   []string{"small", "large"},
+			Regions: []string{"aws::us-east-1", "gcp::us-west-1", "aws::eu-west-1"},
+			Resizes: []Resize{{Plan: "large", NewPlan: "small"}},
+		}
+
+		combos, err := m.Combinations(cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if len(combos) != 6 {
+			t.Fatalf("Expected 6 combinations, got %d", len(combos))
+		}
+
+		last := combos[5]
+		if last.Plan != "large" || last.Region != "aws::eu-west-1" || last.NewPlan != "small" {
+			t.Errorf("Unexpected combination %+v", last)
+		}
+
+		if combos[0].NewPlan != "large" || combos[0].PlanFeatures["size"] != "1 GB" {
+			t.Errorf("Expected configured values for missing dimensions, got %+v", combos[0])
+		}
+
+		if s := combos[0].String(); s != `small {"size":"1 GB"}, aws::us-east-1` {
+			t.Errorf("Unexpected name %q", s)
+		}
+	})
+
+	t.Run("with a plan resized to itself", func(t *testing.T) {
+		m := &Matrix{Plans: []string{"small", "large"}}
+
+		if _, err := m.Combinations(cfg); err == nil {
+			t.Errorf("Expected an error for plan `large` without a resize")
+		}
+	})
+}
+
+func TestParseMatrix(t *testing.T) {
+	m, err := ParseMatrix(`{"plans": ["small"], "plan-features": [{"size": "1 GB"}, {"size": "2 GB"}]}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(m.Plans) != 1 || len(m.PlanFeatures) != 2 {
+		t.Errorf("Unexpected matrix %+v", m)
+	}
+
+	if _, err := ParseMatrix(`{"plan": "small"}`); err == nil {
+		t.Errorf("Expected an error for an unknown field")
+	}
+}
@@ -10,11 +10,13 @@ import (
 )
 
 var measures = Feature("resource-measures", "Pull usage measures from a Resource", func(ctx context.Context) {
-	Default(func() {
+	run := runFrom(ctx)
+
+	Default(ctx, func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 
-		pullResourceMeasures(ctx, api, resourceID, resourceMeasures)
+		pullResourceMeasures(ctx, run.api, run.resourceID, run.resourceMeasures)
 	})
 })
 
@@ -23,10 +25,7 @@ var _ = measures.RunsInside("provision")
 func pullResourceMeasures(ctx context.Context, api *grafton.Client,
 	rid manifold.ID, measures map[string]int64) {
 
-	year, month, _ := time.Now().UTC().Date()
-	start := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
-	end := start.AddDate(0, 1, 0).Add(-time.Second)
-
+	start, end := measuresPeriod()
 	rm, err := api.PullResourceMeasures(ctx, rid, start, end)
 
 	gm.Expect(err).To(notError(), "No error is expected")
@@ -39,5 +38,12 @@ func pullResourceMeasures(ctx context.Context, api *grafton.Client,
 	gm.Expect(rm.PeriodEnd).ToNot(gm.BeNil())
 	gm.Expect(time.Time(*rm.PeriodEnd)).To(gm.Equal(end))
 
-	gm.Expect(rm.Measures).To(gm.Equal(resourceMeasures))
+	gm.Expect(rm.Measures).To(gm.Equal(measures))
+}
+
+// measuresPeriod returns the current month, which measures are pulled for.
+func measuresPeriod() (time.Time, time.Time) {
+	year, month, _ := time.Now().UTC().Date()
+	start := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0).Add(-time.Second)
 }
@@ -2,7 +2,6 @@ package acceptance
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"time"
 
@@ -18,23 +17,22 @@ import (
 	"github.com/manifoldco/grafton/db"
 )
 
-var errTimeout = errors.New("Exceeded Callback Wait time")
-var resourceID manifold.ID
-
 var provision = Feature("provision", "Provision a resource", func(ctx context.Context) {
-	Default(func() {
+	run := runFrom(ctx)
+
+	Default(ctx, func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 
-		curResource := attemptResourceProvision(ctx, api, product, plan, planFeatures, region)
-		resourceID = curResource.ID
+		curResource := attemptResourceProvision(ctx, run.api, run.product, run.plan, run.planFeatures, run.region)
+		run.resourceID = curResource.ID
 	})
 
-	ErrorCase("with a faulty product name", func() {
+	ErrorCase(ctx, "with a faulty product name", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 		var err error
-		_, _, async, err := provisionResource(ctx, api, "not-your-product", plan, planFeatures, region)
+		_, _, async, err := provisionResource(ctx, run.api, "not-your-product", run.plan, run.planFeatures, run.region)
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -53,11 +51,11 @@ var provision = Feature("provision", "Provision a resource", func(ctx context.Co
 		gm.Expect(e.Type).Should(gm.Equal(merrors.BadRequestError), "Message: %s", e.Error())
 	})
 
-	ErrorCase("with a faulty plan name", func() {
+	ErrorCase(ctx, "with a faulty plan name", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 		var err error
-		_, _, async, err := provisionResource(ctx, api, product, "faulty-plan-name", nil, region)
+		_, _, async, err := provisionResource(ctx, run.api, run.product, "faulty-plan-name", nil, run.region)
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -76,11 +74,11 @@ var provision = Feature("provision", "Provision a resource", func(ctx context.Co
 		gm.Expect(e.Type).Should(gm.Equal(merrors.BadRequestError), "Message: %s", e.Error())
 	})
 
-	ErrorCase("with a faulty region", func() {
+	ErrorCase(ctx, "with a faulty region", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 		var err error
-		_, _, async, err := provisionResource(ctx, api, product, plan, planFeatures, "faulty::region")
+		_, _, async, err := provisionResource(ctx, run.api, run.product, run.plan, run.planFeatures, "faulty::region")
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -99,11 +97,11 @@ var provision = Feature("provision", "Provision a resource", func(ctx context.Co
 		gm.Expect(e.Type).Should(gm.Equal(merrors.BadRequestError), "Message: %s", e.Error())
 	})
 
-	ErrorCase("with a bad signature", func() {
+	ErrorCase(ctx, "with a bad signature", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 		var err error
-		_, _, async, err := provisionResource(ctx, uapi, product, plan, planFeatures, region)
+		_, _, async, err := provisionResource(ctx, run.uapi, run.product, run.plan, run.planFeatures, run.region)
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -123,14 +121,14 @@ var provision = Feature("provision", "Provision a resource", func(ctx context.Co
 		gm.Expect(e.Type).Should(gm.Equal(merrors.UnauthorizedError), "Message: %s", e.Error())
 	})
 
-	ErrorCase("with an already provisioned resource - same content acts as created", func() {
+	ErrorCase(ctx, "with an already provisioned resource - same content acts as created", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 		var err error
-		_, callbackID, async, err := provisionResourceID(ctx, api, resourceID, product, plan, planFeatures, region)
+		_, callbackID, async, err := provisionResourceID(ctx, run.api, run.resourceID, run.product, run.plan, run.planFeatures, run.region)
 
 		if async {
-			c := fakeConnector.GetCallback(callbackID)
+			c := run.connector.GetCallback(callbackID)
 
 			gm.Expect(c.State).To(
 				gm.Equal(connector.DoneCallbackState),
@@ -141,14 +139,14 @@ var provision = Feature("provision", "Provision a resource", func(ctx context.Co
 		gm.Expect(err).To(notError(), "Create response should be returned (Repeatable Action)")
 	})
 
-	ErrorCase("with an already provisioned resource - different content results in conflict", func() {
+	ErrorCase(ctx, "with an already provisioned resource - different content results in conflict", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 		var err error
-		_, callbackID, async, err := provisionResourceID(ctx, api, resourceID, product, newPlan, newPlanFeatures, region)
+		_, callbackID, async, err := provisionResourceID(ctx, run.api, run.resourceID, run.product, run.newPlan, run.newPlanFeatures, run.region)
 
 		if async {
-			c := fakeConnector.GetCallback(callbackID)
+			c := run.connector.GetCallback(callbackID)
 
 			gm.Expect(c.State).To(
 				gm.Equal(connector.ErrorCallbackState),
@@ -171,17 +169,19 @@ var provision = Feature("provision", "Provision a resource", func(ctx context.Co
 })
 
 var _ = provision.TearDown("Deprovision a resource", func(ctx context.Context) {
-	Default(func() {
+	run := runFrom(ctx)
+
+	Default(ctx, func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
-		attemptResourceDeprovision(ctx, api, resourceID)
+		attemptResourceDeprovision(ctx, run.api, run.resourceID)
 	})
 
-	ErrorCase("delete a non existing resource", func() {
+	ErrorCase(ctx, "delete a non existing resource", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 		fakeID, _ := manifold.NewID(idtype.Resource)
-		_, async, err := deprovisionResource(ctx, api, fakeID)
+		_, async, err := deprovisionResource(ctx, run.api, fakeID)
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -204,13 +204,14 @@ var _ = provision.RequiredFlags("product", "plan", "region", "new-plan")
 
 func attemptResourceProvision(ctx context.Context, api *grafton.Client, product, plan string,
 	planFeatures manifold.FeatureMap, region string) *db.Resource {
+	run := runFrom(ctx)
 
 	var err error
 	curResource, callbackID, async, err := provisionResource(ctx, api, product, plan, planFeatures, region)
 	gm.Expect(err).To(notError(), "Expected a successful provision of a resource")
 
 	if async {
-		c := fakeConnector.GetCallback(callbackID)
+		c := run.connector.GetCallback(callbackID)
 
 		gm.Expect(c.State).To(
 			gm.Equal(connector.DoneCallbackState),
@@ -230,11 +231,13 @@ func attemptResourceProvision(ctx context.Context, api *grafton.Client, product,
 }
 
 func attemptResourceDeprovision(ctx context.Context, api *grafton.Client, resourceID manifold.ID) {
+	run := runFrom(ctx)
+
 	callbackID, async, err := deprovisionResource(ctx, api, resourceID)
 
 	gm.Expect(err).To(notError(), "No error is expected")
 	if async {
-		c := fakeConnector.GetCallback(callbackID)
+		c := run.connector.GetCallback(callbackID)
 
 		gm.Expect(c.State).To(
 			gm.Equal(connector.DoneCallbackState),
@@ -251,30 +254,15 @@ func attemptResourceDeprovision(ctx context.Context, api *grafton.Client, resour
 	}
 }
 
-func waitForCallback(ID manifold.ID, max time.Duration) (*connector.Callback, error) {
-	timeout := time.After(max)
-
-waitForCallback:
-	select {
-	case cb := <-fakeConnector.OnCallback:
-		if cb.ID != ID {
-			goto waitForCallback
-		}
-
-		if cb.State == connector.PendingCallbackState {
-			goto waitForCallback
-		}
-
-		return cb, nil
-	case <-timeout:
-		return nil, errTimeout
-	}
+func waitForCallback(ctx context.Context, ID manifold.ID, max time.Duration) (*connector.Callback, error) {
+	return runFrom(ctx).connector.WaitForCallback(ID, max)
 }
 
 func provisionResource(ctx context.Context, api *grafton.Client, product, plan string,
 	planFeatures manifold.FeatureMap, region string) (*db.Resource, manifold.ID, bool, error) {
+	run := runFrom(ctx)
 
-	Infoln("Attempting to provision resource")
+	run.infoln("Attempting to provision resource")
 
 	ID, err := manifold.NewID(idtype.Resource)
 	if err != nil {
@@ -286,8 +274,10 @@ func provisionResource(ctx context.Context, api *grafton.Client, product, plan s
 
 func provisionResourceID(ctx context.Context, api *grafton.Client, id manifold.ID, product, plan string,
 	planFeatures manifold.FeatureMap, region string) (*db.Resource, manifold.ID, bool, error) {
+	run := runFrom(ctx)
 
-	c, err := fakeConnector.AddCallback(connector.ResourceProvisionCallback)
+	run.resources.add(id)
+	c, err := run.connector.AddCallbackFor(connector.ResourceProvisionCallback, id)
 	if err != nil {
 		return nil, c.ID, false, err
 	}
@@ -316,16 +306,19 @@ func provisionResourceID(ctx context.Context, api *grafton.Client, id manifold.I
 	}
 
 	// Ensure we remove the resource from the connector *if* the resource was
-	// not successfully provisioned.
+	// not successfully provisioned. Provisioning an existing resource again
+	// must leave it in place, whatever the outcome.
 	success := false
-	fakeConnector.AddResource(r)
-	defer func() {
-		if success {
-			return
-		}
-
-		fakeConnector.RemoveResource(r.ID)
-	}()
+	if run.connector.GetResource(id) == nil {
+		run.connector.AddResource(r)
+		defer func() {
+			if success {
+				return
+			}
+
+			run.connector.RemoveResource(r.ID)
+		}()
+	}
 
 	model := grafton.ResourceBody{
 		ID:       id,
@@ -341,9 +334,9 @@ func provisionResourceID(ctx context.Context, api *grafton.Client, id manifold.I
 	}
 
 	if callback {
-		Infoln(fmt.Sprintf("Waiting for Callback (max: %.1f minutes): %s", cbTimeout.Minutes(), msg))
+		run.infoln(fmt.Sprintf("Waiting for Callback (max: %.1f minutes): %s", run.cbTimeout.Minutes(), msg))
 
-		cb, err := waitForCallback(c.ID, cbTimeout)
+		cb, err := waitForCallback(ctx, c.ID, run.cbTimeout)
 		if err != nil {
 			return nil, c.ID, callback, err
 		}
@@ -351,9 +344,9 @@ func provisionResourceID(ctx context.Context, api *grafton.Client, id manifold.I
 		msg = cb.Message
 	}
 
-	Infoln("Resource Provisioned Successfully:", id)
+	run.infoln("Resource Provisioned Successfully:", id)
 	if msg != "" {
-		Infoln("Message: ", msg)
+		run.infoln("Message: ", msg)
 	}
 
 	success = true
@@ -361,9 +354,12 @@ func provisionResourceID(ctx context.Context, api *grafton.Client, id manifold.I
 }
 
 func deprovisionResource(ctx context.Context, api *grafton.Client, resourceID manifold.ID) (manifold.ID, bool, error) {
-	Infoln("Attempting to deprovision resource:", resourceID)
+	run := runFrom(ctx)
+
+	run.infoln("Attempting to deprovision resource:", resourceID)
 
-	c, err := fakeConnector.AddCallback(connector.ResourceDeprovisionCallback)
+	run.resources.add(resourceID)
+	c, err := run.connector.AddCallbackFor(connector.ResourceDeprovisionCallback, resourceID)
 	if err != nil {
 		return manifold.ID{}, false, err
 	}
@@ -374,9 +370,9 @@ func deprovisionResource(ctx context.Context, api *grafton.Client, resourceID ma
 	}
 
 	if callback {
-		Infoln(fmt.Sprintf("Waiting for Callback (max: %.1f minutes): %s", cbTimeout.Minutes(), msg))
+		run.infoln(fmt.Sprintf("Waiting for Callback (max: %.1f minutes): %s", run.cbTimeout.Minutes(), msg))
 
-		cb, err := waitForCallback(c.ID, cbTimeout)
+		cb, err := waitForCallback(ctx, c.ID, run.cbTimeout)
 		if err != nil {
 			return c.ID, callback, err
 		}
@@ -384,9 +380,9 @@ func deprovisionResource(ctx context.Context, api *grafton.Client, resourceID ma
 		msg = cb.Message
 	}
 
-	Infoln("Resource Deprovisioned.")
+	run.infoln("Resource Deprovisioned.")
 	if msg != "" {
-		Infoln("Callback Message: ", msg)
+		run.infoln("Callback Message: ", msg)
 	}
 
 	return c.ID, callback, nil
@@ -0,0 +1,336 @@
+package acceptance
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// Status is the outcome of a single test case within a Report.
+type Status string
+
+// Statuses a test case can end up in.
+const (
+	StatusPassed  Status = "passed"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+// Kind describes which part of a feature a TestCase represents.
+type Kind string
+
+// Kinds of test cases recorded while running features.
+const (
+	KindFeature  Kind = "feature"
+	KindTearDown Kind = "teardown"
+	KindCase     Kind = "case"
+)
+
+// TestCase is the recorded result of running a feature, one of its cases, or
+// its teardown.
+type TestCase struct {
+	Feature  string        `json:"feature"`
+	Parent   string        `json:"parent,omitempty"`
+	Name     string        `json:"name"`
+	Kind     Kind          `json:"kind"`
+	Status   Status        `json:"status"`
+	Duration time.Duration `json:"-"`
+	Message  string        `json:"message,omitempty"`
+
+	// Warnings describe issues which were found without failing the case.
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Notes describe what the provider was seen doing, such as where it
+	// redirects users signing in.
+	Notes []string `json:"notes,omitempty"`
+
+	started time.Time
+}
+
+// MarshalJSON encodes the test case, expressing its duration in seconds.
+func (tc *TestCase) MarshalJSON() ([]byte, error) {
+	type alias TestCase
+	return json.Marshal(struct {
+		*alias
+		Duration float64 `json:"duration"`
+	}{
+		alias:    (*alias)(tc),
+		Duration: tc.Duration.Seconds(),
+	})
+}
+
+// Suite holds the test cases of a single acceptance test run.
+type Suite struct {
+	Name      string        `json:"name"`
+	Timestamp time.Time     `json:"timestamp"`
+	Duration  time.Duration `json:"-"`
+	TestCases []*TestCase   `json:"test_cases"`
+}
+
+// MarshalJSON encodes the suite, expressing its duration in seconds.
+func (s *Suite) MarshalJSON() ([]byte, error) {
+	type alias Suite
+	return json.Marshal(struct {
+		*alias
+		Duration float64 `json:"duration"`
+	}{
+		alias:    (*alias)(s),
+		Duration: s.Duration.Seconds(),
+	})
+}
+
+// Count returns the number of test cases in the suite with the given status.
+func (s *Suite) Count(status Status) int {
+	n := 0
+	for _, tc := range s.TestCases {
+		if tc.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// countCases returns the number of feature cases, ignoring features and
+// teardowns themselves, with the given status.
+func (s *Suite) countCases(status Status) int {
+	n := 0
+	for _, tc := range s.TestCases {
+		if tc.Kind == KindCase && tc.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// countWarnings returns the number of warnings raised by feature cases.
+func (s *Suite) countWarnings() int {
+	n := 0
+	for _, tc := range s.TestCases {
+		if tc.Kind == KindCase {
+			n += len(tc.Warnings)
+		}
+	}
+	return n
+}
+
+// Report is the machine readable outcome of an acceptance test run.
+type Report struct {
+	Suites []*Suite `json:"suites"`
+}
+
+// Failed returns true if any test case in the report failed.
+func (r *Report) Failed() bool {
+	for _, s := range r.Suites {
+		if s.Count(StatusFailed) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes the report to w as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report to w in the JUnit XML format understood by
+// most CI systems. Every suite becomes a testsuite, with test cases grouped
+// by feature label as their classname.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	out := junitTestSuites{Name: "grafton"}
+
+	for _, s := range r.Suites {
+		js := junitTestSuite{
+			Name:      s.Name,
+			Tests:     len(s.TestCases),
+			Failures:  s.Count(StatusFailed),
+			Skipped:   s.Count(StatusSkipped),
+			Time:      s.Duration.Seconds(),
+			Timestamp: s.Timestamp.UTC().Format("2006-01-02T15:04:05"),
+		}
+
+		for _, tc := range s.TestCases {
+			name := tc.Name
+			if tc.Parent != "" {
+				name = tc.Parent + " / " + tc.Name
+			}
+
+			jc := junitTestCase{
+				ClassName: tc.Feature,
+				Name:      name,
+				Time:      tc.Duration.Seconds(),
+			}
+
+			switch tc.Status {
+			case StatusFailed:
+				jc.Failure = &junitMessage{Message: firstLine(tc.Message), Body: tc.Message}
+			case StatusSkipped:
+				jc.Skipped = &junitMessage{Message: tc.Message}
+			}
+
+			for _, n := range tc.Notes {
+				jc.SystemOut += n + "\n"
+			}
+			for _, w := range tc.Warnings {
+				jc.SystemOut += "Warning: " + w + "\n"
+			}
+
+			js.Cases = append(js.Cases, jc)
+		}
+
+		out.Tests += js.Tests
+		out.Failures += js.Failures
+		out.Skipped += js.Skipped
+		out.Time += js.Time
+		out.Suites = append(out.Suites, js)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func firstLine(s string) string {
+	for i, c := range s {
+		if c == '\n' {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// recorder tracks the test cases of a running suite. Cases are opened and
+// closed in a strictly nested fashion, mirroring how features execute their
+// blocks.
+type recorder struct {
+	suite *Suite
+	open  []*TestCase
+}
+
+func newRecorder(name string) *recorder {
+	return &recorder{
+		suite: &Suite{
+			Name:      name,
+			Timestamp: time.Now(),
+		},
+	}
+}
+
+// begin opens a new test case. Cases opened while a feature or teardown is
+// open are attributed to it.
+func (r *recorder) begin(feature, name string, kind Kind) *TestCase {
+	tc := &TestCase{
+		Feature: feature,
+		Name:    name,
+		Kind:    kind,
+		started: time.Now(),
+	}
+
+	if len(r.open) > 0 {
+		tc.Feature = r.open[0].Feature
+		tc.Parent = r.open[0].Name
+	}
+
+	r.suite.TestCases = append(r.suite.TestCases, tc)
+	r.open = append(r.open, tc)
+	return tc
+}
+
+// end closes the given test case with the provided outcome.
+func (r *recorder) end(tc *TestCase, ok bool) {
+	tc.Duration = time.Since(tc.started)
+	tc.Status = StatusFailed
+	if ok {
+		tc.Status = StatusPassed
+		tc.Message = ""
+	}
+
+	for i := len(r.open) - 1; i >= 0; i-- {
+		if r.open[i] == tc {
+			r.open = r.open[:i]
+			break
+		}
+	}
+}
+
+// skip records a test case which was not run, and why.
+func (r *recorder) skip(feature, name string, kind Kind, reason string) {
+	tc := r.begin(feature, name, kind)
+	r.end(tc, true)
+	tc.Status = StatusSkipped
+	tc.Message = reason
+}
+
+// fail attaches a failure message to every open test case. Cases which end
+// up passing, like a feature with a failed error case, discard it.
+func (r *recorder) fail(msg string) {
+	for _, tc := range r.open {
+		tc.Message += msg
+	}
+}
+
+// warn attaches a warning to every open test case.
+func (r *recorder) warn(msg string) {
+	for _, tc := range r.open {
+		tc.Warnings = append(tc.Warnings, msg)
+	}
+}
+
+// note attaches a note to the innermost open test case.
+func (r *recorder) note(msg string) {
+	if len(r.open) > 0 {
+		tc := r.open[len(r.open)-1]
+		tc.Notes = append(tc.Notes, msg)
+	}
+}
+
+func (r *recorder) finish() *Suite {
+	r.suite.Duration = time.Since(r.suite.Timestamp)
+	return r.suite
+}
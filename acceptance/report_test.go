@@ -0,0 +1,184 @@
+package acceptance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+)
+
+func TestWalkGraphSkipped(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("children of a failed feature are skipped", func(t *testing.T) {
+		skipped := map[string]string{}
+		visitor := func(_ context.Context, n *node) bool {
+			return n.f.label != "provision"
+		}
+
+		walkGraph(ctx, []string{}, false, visitor, func(f *FeatureImpl, reason string) {
+			skipped[f.label] = reason
+		})
+
+		for _, label := range []string{"credentials", "plan-change", "sso", "resource-measures"} {
+			if skipped[label] != "runs inside failed feature `provision`" {
+				t.Errorf("Expected `%s` to be skipped because provision failed, got %q", label, skipped[label])
+			}
+		}
+
+		if _, ok := skipped["cleanup"]; ok {
+			t.Errorf("Expected `cleanup` not to be skipped")
+		}
+	})
+
+	t.Run("excluded features and their children are skipped", func(t *testing.T) {
+		skipped := map[string]string{}
+		visitor := func(_ context.Context, n *node) bool { return true }
+
+		walkGraph(ctx, []string{"provision"}, false, visitor, func(f *FeatureImpl, reason string) {
+			skipped[f.label] = reason
+		})
+
+		if skipped["provision"] != "excluded from the test run" {
+			t.Errorf("Expected `provision` to be excluded, got %q", skipped["provision"])
+		}
+
+		if skipped["sso"] != "runs inside excluded feature `provision`" {
+			t.Errorf("Expected `sso` to be skipped, got %q", skipped["sso"])
+		}
+	})
+
+	t.Run("opt-in features which are not included are skipped", func(t *testing.T) {
+		skipped := map[string]string{}
+		visitor := func(_ context.Context, n *node) bool { return true }
+
+		walkGraph(ctx, OptInFeatures(), false, visitor, func(f *FeatureImpl, reason string) {
+			skipped[f.label] = reason
+		})
+
+		const reason = "opt-in, not included (use --include connector-faults)"
+		if skipped["connector-faults"] != reason {
+			t.Errorf("Expected `connector-faults` to be skipped with %q, got %q", reason, skipped["connector-faults"])
+		}
+
+		if _, ok := skipped["provision"]; ok {
+			t.Errorf("Expected `provision` not to be skipped")
+		}
+	})
+}
+
+func TestRecorder(t *testing.T) {
+	r := newRecorder("grafton")
+
+	f := r.begin("provision", "Provision a resource", KindFeature)
+	c := r.begin("", "Default case", KindCase)
+	r.warn("Retried too soon")
+	r.note("Redirected with 303 See Other")
+	r.end(c, true)
+	e := r.begin("", "Error case: with a bad signature", KindCase)
+	r.fail("Expected 401\n")
+	r.end(e, false)
+	r.end(f, true)
+	r.skip("sso", "Single Sign-On Flow", KindFeature, "excluded from the test run")
+
+	report := &Report{Suites: []*Suite{r.finish()}}
+	cases := report.Suites[0].TestCases
+
+	if len(cases) != 4 {
+		t.Fatalf("Expected 4 test cases, got %d", len(cases))
+	}
+
+	if cases[1].Feature != "provision" || cases[1].Parent != "Provision a resource" {
+		t.Errorf("Expected case to be attributed to its feature, got %q / %q", cases[1].Feature, cases[1].Parent)
+	}
+
+	if len(cases[1].Warnings) != 1 || len(cases[0].Warnings) != 1 || len(cases[2].Warnings) != 0 {
+		t.Errorf("Expected the warning to be attached to the open cases, got %q, %q and %q",
+			cases[0].Warnings, cases[1].Warnings, cases[2].Warnings)
+	}
+
+	if len(cases[1].Notes) != 1 || len(cases[0].Notes) != 0 {
+		t.Errorf("Expected the note to be attached to the innermost case, got %q and %q",
+			cases[0].Notes, cases[1].Notes)
+	}
+
+	if n := report.Suites[0].countWarnings(); n != 1 {
+		t.Errorf("Expected 1 warning to be counted, got %d", n)
+	}
+
+	if cases[2].Status != StatusFailed || cases[2].Message != "Expected 401\n" {
+		t.Errorf("Expected failed error case with message, got %s %q", cases[2].Status, cases[2].Message)
+	}
+
+	if cases[0].Status != StatusPassed || cases[0].Message != "" {
+		t.Errorf("Expected feature to pass without a message, got %s %q", cases[0].Status, cases[0].Message)
+	}
+
+	if cases[3].Status != StatusSkipped {
+		t.Errorf("Expected skipped feature, got %s", cases[3].Status)
+	}
+
+	if !report.Failed() {
+		t.Errorf("Expected report to have failed")
+	}
+
+	t.Run("as JUnit", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		if err := report.WriteJUnit(buf); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		out := junitTestSuites{}
+		if err := xml.Unmarshal(buf.Bytes(), &out); err != nil {
+			t.Fatalf("Could not parse JUnit output: %s", err)
+		}
+
+		if out.Tests != 4 || out.Failures != 1 || out.Skipped != 1 {
+			t.Errorf("Expected 4 tests, 1 failure, 1 skipped; got %d, %d, %d", out.Tests, out.Failures, out.Skipped)
+		}
+
+		jc := out.Suites[0].Cases[2]
+		if jc.Name != "Provision a resource / Error case: with a bad signature" || jc.Failure == nil {
+			t.Errorf("Unexpected test case %+v", jc)
+		}
+
+		if out := out.Suites[0].Cases[1].SystemOut; out != "Redirected with 303 See Other\nWarning: Retried too soon\n" {
+			t.Errorf("Expected the note and warning in the case's output, got %q", out)
+		}
+	})
+
+	t.Run("as JSON", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		if err := report.WriteJSON(buf); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		out := struct {
+			Suites []struct {
+				TestCases []map[string]interface{} `json:"test_cases"`
+			} `json:"suites"`
+		}{}
+		if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+			t.Fatalf("Could not parse JSON output: %s", err)
+		}
+
+		tc := out.Suites[0].TestCases[2]
+		if tc["status"] != "failed" || tc["kind"] != "case" {
+			t.Errorf("Unexpected test case %v", tc)
+		}
+
+		if _, ok := tc["duration"].(float64); !ok {
+			t.Errorf("Expected duration in seconds, got %v", tc["duration"])
+		}
+
+		if _, ok := tc["warnings"]; ok {
+			t.Errorf("Expected no warnings, got %v", tc["warnings"])
+		}
+
+		warned := out.Suites[0].TestCases[1]["warnings"]
+		if w, ok := warned.([]interface{}); !ok || len(w) != 1 {
+			t.Errorf("Expected a warning, got %v", warned)
+		}
+	})
+}
@@ -16,15 +16,17 @@ import (
 )
 
 var resize = Feature("plan-change", "Change a resource's plan", func(ctx context.Context) {
-	Default(func() {
+	run := runFrom(ctx)
+
+	Default(ctx, func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 
-		attemptResize(ctx, api, resourceID, newPlan, newPlanFeatures)
+		attemptResize(ctx, run.api, run.resourceID, run.newPlan, run.newPlanFeatures)
 	})
 
-	ErrorCase("with existing plan - returns success", func() {
-		_, async, err := changePlan(ctx, api, resourceID, newPlan, newPlanFeatures)
+	ErrorCase(ctx, "with existing plan - returns success", func() {
+		_, async, err := changePlan(ctx, run.api, run.resourceID, run.newPlan, run.newPlanFeatures)
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -34,12 +36,12 @@ var resize = Feature("plan-change", "Change a resource's plan", func(ctx context
 			"If the current plan matches the requested plan a 204 No Content should be returned (Repeatable Action)")
 	})
 
-	ErrorCase("with a non existing resource", func() {
+	ErrorCase(ctx, "with a non existing resource", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 
 		fakeID, _ := manifold.NewID(idtype.Resource)
-		_, async, err := changePlan(ctx, api, fakeID, newPlan, newPlanFeatures)
+		_, async, err := changePlan(ctx, run.api, fakeID, run.newPlan, run.newPlanFeatures)
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -58,11 +60,11 @@ var resize = Feature("plan-change", "Change a resource's plan", func(ctx context
 		gm.Expect(e.Type).Should(gm.Equal(merrors.NotFoundError))
 	})
 
-	ErrorCase("with a non existing plan", func() {
+	ErrorCase(ctx, "with a non existing plan", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 
-		_, async, err := changePlan(ctx, api, resourceID, "non-existing", nil)
+		_, async, err := changePlan(ctx, run.api, run.resourceID, "non-existing", nil)
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -81,11 +83,11 @@ var resize = Feature("plan-change", "Change a resource's plan", func(ctx context
 		gm.Expect(e.Type).Should(gm.Equal(merrors.BadRequestError))
 	})
 
-	ErrorCase("with a bad signature", func() {
+	ErrorCase(ctx, "with a bad signature", func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 
-		_, async, err := changePlan(ctx, uapi, resourceID, newPlan, newPlanFeatures)
+		_, async, err := changePlan(ctx, run.uapi, run.resourceID, run.newPlan, run.newPlanFeatures)
 
 		gm.Expect(async).To(
 			gm.BeFalse(),
@@ -110,23 +112,26 @@ var _ = resize.RunsBefore("credentials")
 var _ = resize.RequiredFlags("new-plan")
 
 var _ = resize.TearDown("Change the resource's plan back to the original", func(ctx context.Context) {
-	Default(func() {
+	run := runFrom(ctx)
+
+	Default(ctx, func() {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 		defer cancel()
 
-		attemptResize(ctx, api, resourceID, plan, planFeatures)
+		attemptResize(ctx, run.api, run.resourceID, run.plan, run.planFeatures)
 	})
 })
 
 func attemptResize(ctx context.Context, api *grafton.Client, resourceID manifold.ID, newPlan string,
 	newPlanFeatures manifold.FeatureMap) {
+	run := runFrom(ctx)
 
 	callbackID, async, err := changePlan(ctx, api, resourceID, newPlan, newPlanFeatures)
 
 	gm.Expect(err).To(notError(), "Expected a successful plan change of a resource")
 
 	if async {
-		c := fakeConnector.GetCallback(callbackID)
+		c := run.connector.GetCallback(callbackID)
 
 		gm.Expect(c.State).To(
 			gm.Equal(connector.DoneCallbackState),
@@ -145,10 +150,12 @@ func attemptResize(ctx context.Context, api *grafton.Client, resourceID manifold
 
 func changePlan(ctx context.Context, api *grafton.Client, resourceID manifold.ID, newPlan string,
 	newPlanFeatures manifold.FeatureMap) (manifold.ID, bool, error) {
+	run := runFrom(ctx)
 
-	Infof("Attempting to resize resource %s to %s, %s\n", resourceID, newPlan, newPlanFeatures)
+	run.infof("Attempting to resize resource %s to %s, %s\n", resourceID, newPlan, newPlanFeatures)
 
-	c, err := fakeConnector.AddCallback(connector.ResourceResizeCallback)
+	run.resources.add(resourceID)
+	c, err := run.connector.AddCallbackFor(connector.ResourceResizeCallback, resourceID)
 	if err != nil {
 		return manifold.ID{}, false, err
 	}
@@ -159,9 +166,9 @@ func changePlan(ctx context.Context, api *grafton.Client, resourceID manifold.ID
 	}
 
 	if callback {
-		Infoln(fmt.Sprintf("Waiting for callback (max: %.1f minutes): %s", cbTimeout.Minutes(), msg))
+		run.infoln(fmt.Sprintf("Waiting for callback (max: %.1f minutes): %s", run.cbTimeout.Minutes(), msg))
 
-		cb, err := waitForCallback(c.ID, cbTimeout)
+		cb, err := waitForCallback(ctx, c.ID, run.cbTimeout)
 		if err != nil {
 			return c.ID, callback, err
 		}
@@ -169,9 +176,9 @@ func changePlan(ctx context.Context, api *grafton.Client, resourceID manifold.ID
 		msg = cb.Message
 	}
 
-	Infoln("Successfully resized!")
+	run.infoln("Successfully resized!")
 	if msg != "" {
-		Infoln("Message: ", msg)
+		run.infoln("Message: ", msg)
 	}
 
 	return c.ID, callback, nil
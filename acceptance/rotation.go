@@ -8,39 +8,43 @@ import (
 	"github.com/manifoldco/go-manifold"
 )
 
-var rotationTearDown func(context.Context)
-
 var rotateCreds = Feature("credential-rotation", "Rotate a credential set", func(ctx context.Context) {
-	switch credentialType {
+	run := runFrom(ctx)
+
+	switch run.credentialType {
 	case "single":
 		featureReplaceRotation(ctx)
 	case "multiple":
 		featureSwapRotation(ctx)
 	default:
-		Default(func() {
-			FatalErr("unknown credentialType %s", credentialType)
+		Default(ctx, func() {
+			FatalErr("unknown credentialType %s", run.credentialType)
 		})
 	}
 })
 
 var _ = rotateCreds.TearDown("Remove rotated credential sets", func(ctx context.Context) {
-	if rotationTearDown == nil {
+	run := runFrom(ctx)
+
+	if run.rotationTearDown == nil {
 		return
 	}
-	rotationTearDown(ctx)
+	run.rotationTearDown(ctx)
 })
 
 var _ = rotateCreds.RunsInside("provision")
 
 func featureReplaceRotation(ctx context.Context) {
+	run := runFrom(ctx)
+
 	var rotatedCredentialID manifold.ID
-	Case("single credential replace", func() {
-		initialCredID, initialValues := mustProvisionCredentials(ctx, api, resourceID)
+	Case(ctx, "single credential replace", func() {
+		initialCredID, initialValues := mustProvisionCredentials(ctx, run.api, run.resourceID)
 
 		// delete initial credential before creating new one
-		mustDeprovisionCredentials(ctx, api, initialCredID)
+		mustDeprovisionCredentials(ctx, run.api, initialCredID)
 
-		rID, rotatedValues := mustProvisionCredentials(ctx, api, resourceID)
+		rID, rotatedValues := mustProvisionCredentials(ctx, run.api, run.resourceID)
 		rotatedCredentialID = rID
 
 		// assert initial and rotated are not the same
@@ -49,18 +53,20 @@ func featureReplaceRotation(ctx context.Context) {
 
 	})
 
-	rotationTearDown = func(ctx context.Context) {
-		Default(func() {
-			mustDeprovisionCredentials(ctx, api, rotatedCredentialID)
+	run.rotationTearDown = func(ctx context.Context) {
+		Default(ctx, func() {
+			mustDeprovisionCredentials(ctx, run.api, rotatedCredentialID)
 		})
 	}
 }
 
 func featureSwapRotation(ctx context.Context) {
+	run := runFrom(ctx)
+
 	var rotatedCredentialID manifold.ID
-	Case("multiple credentials swap", func() {
-		initialCredID, initialValues := mustProvisionCredentials(ctx, api, resourceID)
-		rID, rotatedValues := mustProvisionCredentials(ctx, api, resourceID)
+	Case(ctx, "multiple credentials swap", func() {
+		initialCredID, initialValues := mustProvisionCredentials(ctx, run.api, run.resourceID)
+		rID, rotatedValues := mustProvisionCredentials(ctx, run.api, run.resourceID)
 		rotatedCredentialID = rID
 
 		// assert initial and rotated are not the same
@@ -68,12 +74,12 @@ func featureSwapRotation(ctx context.Context) {
 			gm.Equal(initialValues), "Different credentials expected for new Credential Set")
 
 		// delete initial credential
-		mustDeprovisionCredentials(ctx, api, initialCredID)
+		mustDeprovisionCredentials(ctx, run.api, initialCredID)
 	})
 
-	rotationTearDown = func(ctx context.Context) {
-		Default(func() {
-			mustDeprovisionCredentials(ctx, api, rotatedCredentialID)
+	run.rotationTearDown = func(ctx context.Context) {
+		Default(ctx, func() {
+			mustDeprovisionCredentials(ctx, run.api, rotatedCredentialID)
 		})
 	}
 }
@@ -0,0 +1,190 @@
+package acceptance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	manifold "github.com/manifoldco/go-manifold"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/connector"
+)
+
+// testRun holds the configuration and state of a single walk of the feature
+// graph, against one combination of plan, region and plan features.
+//
+// The run is carried in the context handed to every feature, and retrieved
+// with runFrom.
+type testRun struct {
+	name string
+
+	api  *grafton.Client
+	uapi *grafton.Client
+
+	product          string
+	plan             string
+	planFeatures     manifold.FeatureMap
+	region           string
+	newPlan          string
+	newPlanFeatures  manifold.FeatureMap
+	resourceMeasures map[string]int64
+	credentialType   string
+
+	clientID      string
+	clientSecret  string
+	connector     *connector.FakeConnector
+	cbTimeout     time.Duration
+	runErrorCases bool
+
+	// strictCallbacks fails features on issues with how the provider sends
+	// callbacks, which are otherwise reported as warnings.
+	strictCallbacks bool
+
+	// strictContract fails the contract feature on responses which don't
+	// match the provider API spec, which are otherwise reported as warnings.
+	strictContract bool
+
+	// strictConnectorContract fails the run on requests to the fake
+	// Connector which don't match its spec.
+	strictConnectorContract bool
+
+	// transport sends requests made outside of the API clients, following
+	// the provider's SSO redirects.
+	transport http.RoundTripper
+
+	// values shared between features as they run
+	resourceID       manifold.ID
+	credentialID     manifold.ID
+	rotationTearDown func(context.Context)
+
+	connectorRotationCredID manifold.ID
+	faultsCredID            manifold.ID
+	retriesCredID           manifold.ID
+
+	// resources holds every resource the runs of the combination made
+	// requests about, telling apart the requests the provider makes to the
+	// shared fake Connector for them.
+	resources *resourceSet
+
+	log *logger
+	rec *recorder
+}
+
+type runKey struct{}
+
+func withRun(ctx context.Context, run *testRun) context.Context {
+	return context.WithValue(ctx, runKey{}, run)
+}
+
+// runFrom returns the test run the given context belongs to.
+func runFrom(ctx context.Context) *testRun {
+	return ctx.Value(runKey{}).(*testRun)
+}
+
+func (r *testRun) infof(format string, args ...interface{}) {
+	r.log.infof(format, args...)
+}
+
+func (r *testRun) infoln(args ...interface{}) {
+	r.log.infoln(args...)
+}
+
+// warnf prints a warning and attaches it to the open test cases, without
+// failing them.
+func (r *testRun) warnf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	r.log.warn(msg)
+	r.rec.warn(msg)
+}
+
+// notef prints what the provider was seen doing, and attaches it to the
+// innermost open test case.
+func (r *testRun) notef(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	r.log.infoln(msg)
+	r.rec.note(msg)
+}
+
+// callbackIssuef reports an issue with how the provider sends callbacks,
+// failing the test case in strict mode, or warning about it otherwise.
+func (r *testRun) callbackIssuef(format string, args ...interface{}) {
+	if r.strictCallbacks {
+		FatalErr(format, args...)
+	}
+
+	r.warnf(format, args...)
+}
+
+// skip records a feature which was not run.
+func (r *testRun) skip(f *FeatureImpl, reason string) {
+	r.rec.skip(f.label, f.name, KindFeature, reason)
+}
+
+// resourceSet is a set of resource ids, safe for concurrent use by the jobs
+// of a combination. A nil set is empty.
+type resourceSet struct {
+	mu  sync.Mutex
+	ids map[manifold.ID]bool
+}
+
+func newResourceSet() *resourceSet {
+	return &resourceSet{ids: make(map[manifold.ID]bool)}
+}
+
+func (s *resourceSet) add(ID manifold.ID) {
+	if s == nil || ID.IsEmpty() {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[ID] = true
+}
+
+func (s *resourceSet) has(ID manifold.ID) bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ids[ID]
+}
+
+// testFailure is the value failHandler panics with to abort the rest of a
+// test case or feature.
+type testFailure struct {
+	message  string
+	reported bool
+}
+
+// protect runs fn, returning the failure which aborted it, if any. The
+// failure is printed and attached to the open test cases the first time it
+// is seen.
+func (r *testRun) protect(fn func()) (failure *testFailure) {
+	defer func() {
+		p := recover()
+		if p == nil {
+			return
+		}
+
+		f, ok := p.(*testFailure)
+		if !ok {
+			panic(p)
+		}
+
+		if !f.reported {
+			r.log.printIndented(f.message)
+			r.rec.fail(f.message)
+			f.reported = true
+		}
+
+		failure = f
+	}()
+
+	fn()
+	return nil
+}
@@ -0,0 +1,44 @@
+package acceptance
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	gm "github.com/onsi/gomega"
+)
+
+func TestBlocks(t *testing.T) {
+	gm.RegisterFailHandler(failHandler)
+
+	run := &testRun{
+		runErrorCases: true,
+		log:           &logger{w: &bytes.Buffer{}},
+		rec:           newRecorder("grafton"),
+	}
+	ctx := withRun(context.Background(), run)
+
+	reached := false
+	failure := run.protect(func() {
+		ErrorCase(ctx, "failing error case", func() {
+			gm.Expect(true).To(gm.BeFalse())
+		})
+		Default(ctx, func() {
+			FatalErr("default case failed")
+		})
+		reached = true
+	})
+
+	if failure == nil || failure.message != "default case failed\n" {
+		t.Fatalf("Expected the default case failure, got %+v", failure)
+	}
+
+	if reached {
+		t.Errorf("Expected a failed default case to abort the feature")
+	}
+
+	suite := run.rec.finish()
+	if suite.countCases(StatusFailed) != 2 {
+		t.Errorf("Expected 2 failed cases, got %d", suite.countCases(StatusFailed))
+	}
+}
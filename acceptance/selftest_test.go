@@ -0,0 +1,430 @@
+package acceptance
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	nurl "net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/manifoldco/go-base64"
+	"github.com/manifoldco/go-signature"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/contract"
+	"github.com/manifoldco/grafton/exampleprovider"
+)
+
+const (
+	selfTestClientID     = "21jtaatqj8y5t0kctb2ejr6jev5w8"
+	selfTestClientSecret = "3yTKSiJ6f5V5Bq-kWF0hmdrEUep3m3HKPTcPX7CdBZw"
+)
+
+// selfTestSigner signs requests with a live key endorsed by its master key.
+type selfTestSigner struct {
+	master      ed25519.PublicKey
+	live        ed25519.PrivateKey
+	endorsement []byte
+}
+
+func newSelfTestSigner(t *testing.T) *selfTestSigner {
+	masterPub, masterPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	livePub, livePriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &selfTestSigner{
+		master:      masterPub,
+		live:        livePriv,
+		endorsement: ed25519.Sign(masterPriv, livePub),
+	}
+}
+
+func (s *selfTestSigner) Sign(b []byte) (*signature.Signature, error) {
+	return &signature.Signature{
+		Value:       base64.New(ed25519.Sign(s.live, b)),
+		PublicKey:   base64.New([]byte(s.live.Public().(ed25519.PublicKey))),
+		Endorsement: base64.New(s.endorsement),
+	}, nil
+}
+
+// freePort returns a local port nothing is listening on, for the fake
+// Connector to be started on.
+func freePort(t *testing.T) uint {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return uint(l.Addr().(*net.TCPAddr).Port)
+}
+
+// runAgainst runs every feature, including error cases but only the opt-in
+// features in include, against an example provider with the given
+// configuration, returning the report of the run. Strict runs fail on issues
+// with callbacks and responses not matching the spec instead of warning.
+func runAgainst(t *testing.T, cfg exampleprovider.Config, cbTimeout string, include []string, strict bool) *Suite {
+	signer := newSelfTestSigner(t)
+	port := freePort(t)
+
+	connectorURL, err := nurl.Parse(fmt.Sprintf("http://localhost:%d/v1", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Product = "bonnets"
+	cfg.Plans = []string{"small", "large"}
+	cfg.Regions = []string{"aws::us-east-1"}
+	cfg.MasterKey = signer.master
+	cfg.ConnectorURL = connectorURL
+	cfg.ClientID = selfTestClientID
+	cfg.ClientSecret = selfTestClientSecret
+	cfg.Measures = map[string]int64{"feature-a": 0, "feature-b": 1000}
+
+	srv := httptest.NewServer(exampleprovider.New(cfg).Handler())
+	defer srv.Close()
+
+	providerURL, err := nurl.Parse(srv.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := contract.Provider()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connectorSpec, err := contract.Connector()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opt := grafton.ClientOptions{
+		URL:          providerURL,
+		ConnectorURL: connectorURL,
+		Signer:       signer,
+		Transport:    spec.Transport(nil),
+	}
+	api := grafton.NewClient(opt)
+
+	opt.Signer = newSelfTestSigner(t)
+	uapi := grafton.NewClient(opt)
+
+	err = Configure(Configuration{
+		API:              api,
+		UnauthorizedAPI:  uapi,
+		Product:          "bonnets",
+		Plan:             "small",
+		Region:           "aws::us-east-1",
+		NewPlan:          "large",
+		ClientID:         selfTestClientID,
+		ClientSecret:     selfTestClientSecret,
+		Port:             port,
+		CallbackTimeout:  cbTimeout,
+		ResourceMeasures: `{"feature-a": 0, "feature-b": 1000}`,
+		Credential:       "multiple",
+		StrictCallbacks:  strict,
+		StrictContract:   strict,
+		Contract:         spec,
+
+		ConnectorContract:       connectorSpec,
+		StrictConnectorContract: strict,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	included := map[string]bool{}
+	for _, label := range include {
+		included[label] = true
+	}
+
+	var exclude []string
+	for _, label := range OptInFeatures() {
+		if !included[label] {
+			exclude = append(exclude, label)
+		}
+	}
+
+	return Run(context.Background(), true, exclude).Suites[0]
+}
+
+// withStatus returns a copy of the outcomes, with the feature's status
+// replaced.
+func withStatus(outcomes map[string]Status, label string, status Status) map[string]Status {
+	c := map[string]Status{label: status}
+	for l, s := range outcomes {
+		if l != label {
+			c[l] = s
+		}
+	}
+
+	return c
+}
+
+// TestSelf runs the whole feature graph against an in-process provider
+// switched to each of its behaviors, checking the outcome of every feature.
+func TestSelf(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping end to end acceptance runs in short mode")
+	}
+
+	w, level := std.w, lvl
+	std.w = ioutil.Discard
+	SetLogLevel(LogOff)
+	defer func() {
+		std.w = w
+		SetLogLevel(level)
+	}()
+
+	passed := map[string]Status{
+		"provision":           StatusPassed,
+		"cleanup":             StatusPassed,
+		"credentials":         StatusPassed,
+		"credential-rotation": StatusPassed,
+		"plan-change":         StatusPassed,
+		"resource-measures":   StatusPassed,
+		"sso":                 StatusPassed,
+		"contract":            StatusSkipped,
+		"signature":           StatusPassed,
+		"connector-contract":  StatusPassed,
+		"connector-rotation":  StatusSkipped,
+		"connector-faults":    StatusSkipped,
+		"callback-retries":    StatusSkipped,
+	}
+
+	// Every other feature runs inside a provisioned resource.
+	provisionFailed := map[string]Status{
+		"provision":           StatusFailed,
+		"cleanup":             StatusFailed,
+		"credentials":         StatusSkipped,
+		"credential-rotation": StatusSkipped,
+		"plan-change":         StatusSkipped,
+		"resource-measures":   StatusSkipped,
+		"sso":                 StatusSkipped,
+		"contract":            StatusSkipped,
+		"signature":           StatusPassed,
+		"connector-contract":  StatusPassed,
+		"connector-rotation":  StatusSkipped,
+		"connector-faults":    StatusSkipped,
+		"callback-retries":    StatusSkipped,
+	}
+
+	tcs := []struct {
+		name      string
+		cfg       exampleprovider.Config
+		cbTimeout string
+		include   []string
+		strict    bool
+		expected  map[string]Status
+		failure   string
+		warning   string
+	}{
+		{
+			name:     "sync",
+			cfg:      exampleprovider.Config{},
+			expected: passed,
+		},
+		{
+			name:     "async",
+			cfg:      exampleprovider.Config{Async: true, CallbackDelay: 10 * time.Millisecond},
+			expected: passed,
+		},
+		{
+			name:     "checked responses",
+			cfg:      exampleprovider.Config{},
+			include:  []string{"contract"},
+			strict:   true,
+			expected: withStatus(passed, "contract", StatusPassed),
+		},
+		{
+			name:     "rotated credentials",
+			cfg:      exampleprovider.Config{RotateAfter: time.Second},
+			include:  []string{"connector-rotation"},
+			expected: withStatus(passed, "connector-rotation", StatusPassed),
+		},
+		{
+			name:      "unrotated credentials",
+			cfg:       exampleprovider.Config{},
+			cbTimeout: "500ms",
+			include:   []string{"connector-rotation"},
+			expected:  withStatus(passed, "connector-rotation", StatusFailed),
+			failure:   "Expected the provider to rotate the credential",
+		},
+		{
+			name:     "flaky connector",
+			cfg:      exampleprovider.Config{Async: true},
+			include:  []string{"connector-faults"},
+			expected: withStatus(passed, "connector-faults", StatusPassed),
+		},
+		{
+			name:     "flaky connector, sync",
+			cfg:      exampleprovider.Config{},
+			include:  []string{"connector-faults"},
+			expected: withStatus(passed, "connector-faults", StatusFailed),
+			failure:  "Expected the credentials to be provisioned through a callback",
+		},
+		{
+			name:     "retried callbacks",
+			cfg:      exampleprovider.Config{Async: true},
+			include:  []string{"callback-retries"},
+			strict:   true,
+			expected: withStatus(passed, "callback-retries", StatusPassed),
+		},
+		{
+			name:     "retried callbacks, sync",
+			cfg:      exampleprovider.Config{},
+			include:  []string{"callback-retries"},
+			expected: withStatus(passed, "callback-retries", StatusFailed),
+			failure:  "Expected the credentials to be provisioned through a callback",
+		},
+		{
+			name:     "no backoff",
+			cfg:      exampleprovider.Config{Behavior: exampleprovider.BehaviorNoBackoff, Async: true},
+			include:  []string{"callback-retries"},
+			expected: withStatus(passed, "callback-retries", StatusPassed),
+			warning:  "Expected the provider to wait before retrying the callback",
+		},
+		{
+			name:     "no backoff, strict",
+			cfg:      exampleprovider.Config{Behavior: exampleprovider.BehaviorNoBackoff, Async: true},
+			include:  []string{"callback-retries"},
+			strict:   true,
+			expected: withStatus(passed, "callback-retries", StatusFailed),
+			failure:  "Expected the provider to wait before retrying the callback",
+		},
+		{
+			name:     "conflicting callbacks",
+			cfg:      exampleprovider.Config{Behavior: exampleprovider.BehaviorConflictingCallbacks, Async: true},
+			include:  []string{"callback-retries"},
+			expected: withStatus(passed, "callback-retries", StatusPassed),
+			warning:  "then sent again as 'error'",
+		},
+		{
+			name:     "conflicting callbacks, strict",
+			cfg:      exampleprovider.Config{Behavior: exampleprovider.BehaviorConflictingCallbacks, Async: true},
+			include:  []string{"callback-retries"},
+			strict:   true,
+			expected: withStatus(passed, "callback-retries", StatusFailed),
+			failure:  "then sent again as 'error'",
+		},
+		{
+			name:     "always failing",
+			cfg:      exampleprovider.Config{Behavior: exampleprovider.BehaviorFail},
+			expected: provisionFailed,
+			failure:  "The provider is failing on purpose",
+		},
+		{
+			name:     "slow",
+			cfg:      exampleprovider.Config{Behavior: exampleprovider.BehaviorSlow, Latency: 20 * time.Millisecond},
+			expected: passed,
+		},
+		{
+			name:      "slow callbacks",
+			cfg:       exampleprovider.Config{Async: true, CallbackDelay: 2 * time.Second},
+			cbTimeout: "500ms",
+			expected:  provisionFailed,
+			failure:   "Exceeded Callback Wait time",
+		},
+		{
+			name:     "wrong status codes",
+			cfg:      exampleprovider.Config{Behavior: exampleprovider.BehaviorWrongStatus},
+			expected: provisionFailed,
+			failure:  "unexpected status code '200'",
+		},
+		{
+			name:     "missing messages, sync",
+			cfg:      exampleprovider.Config{Behavior: exampleprovider.BehaviorMissingMessage},
+			include:  []string{"contract"},
+			expected: withStatus(passed, "contract", StatusPassed),
+			warning:  "message in body should be at least 3 chars long",
+		},
+		{
+			name:     "missing messages, strict",
+			cfg:      exampleprovider.Config{Behavior: exampleprovider.BehaviorMissingMessage},
+			include:  []string{"contract"},
+			strict:   true,
+			expected: withStatus(passed, "contract", StatusFailed),
+			failure:  "message in body should be at least 3 chars long",
+		},
+		{
+			name:     "missing messages, async",
+			cfg:      exampleprovider.Config{Behavior: exampleprovider.BehaviorMissingMessage, Async: true},
+			expected: provisionFailed,
+			failure:  "Message must be between 3 and 256 characters long.",
+			warning:  "PUT /callbacks/{id}: message in body should be at least 3 chars long",
+		},
+		{
+			name:     "stale requests",
+			cfg:      exampleprovider.Config{Behavior: exampleprovider.BehaviorStaleRequests},
+			expected: passed,
+			failure:  "dated",
+		},
+		{
+			name:     "trusting SSO",
+			cfg:      exampleprovider.Config{Behavior: exampleprovider.BehaviorTrustingSSO},
+			expected: withStatus(passed, "sso", StatusFailed),
+			failure:  "GET /v1/resources/{id}",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			cbTimeout := tc.cbTimeout
+			if cbTimeout == "" {
+				cbTimeout = "5s"
+			}
+
+			suite := runAgainst(t, tc.cfg, cbTimeout, tc.include, tc.strict)
+
+			outcomes := map[string]Status{}
+			for _, c := range suite.TestCases {
+				if c.Kind == KindFeature {
+					outcomes[c.Feature] = c.Status
+				}
+			}
+
+			// Other tests may register features of their own, which are left
+			// out of the comparison.
+			for label, status := range tc.expected {
+				if outcomes[label] != status {
+					t.Errorf("Expected %s to be %s, got %q", label, status, outcomes[label])
+				}
+			}
+
+			for _, c := range suite.TestCases {
+				if c.Status == StatusFailed && (tc.failure == "" || !strings.Contains(c.Message, tc.failure)) {
+					t.Errorf("Expected %q to fail with %q, got %q", c.Name, tc.failure, c.Message)
+				}
+
+				for _, w := range c.Warnings {
+					if tc.warning == "" || !strings.Contains(w, tc.warning) {
+						t.Errorf("Expected %q to warn about %q, got %q", c.Name, tc.warning, w)
+					}
+				}
+			}
+
+			// Failed error cases leave their feature passed, so they're
+			// only checked by their message.
+			if tc.failure != "" && suite.Count(StatusFailed) == 0 {
+				t.Errorf("Expected a failure with %q", tc.failure)
+			}
+
+			if tc.warning != "" && suite.countWarnings() == 0 {
+				t.Errorf("Expected a warning about %q", tc.warning)
+			}
+		})
+	}
+}
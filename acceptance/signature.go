@@ -0,0 +1,306 @@
+package acceptance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	gm "github.com/onsi/gomega"
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/manifoldco/go-base64"
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/idtype"
+	"github.com/manifoldco/go-signature"
+
+	"github.com/manifoldco/grafton"
+)
+
+// signedHeaders are the headers signed by Manifold on a request with a body
+// and a callback, in the order it lists them in X-Signed-Headers.
+var signedHeaders = []string{"host", "date", "x-callback-id", "x-callback-url", "content-type", "content-length"}
+
+// The requests sent by this feature provision credentials for a resource
+// which doesn't exist, so they change nothing even when a provider wrongly
+// accepts them.
+var signatureFeature = Feature("signature", "Reject requests with invalid signatures", func(ctx context.Context) {
+	run := runFrom(ctx)
+
+	Default(ctx, func() {
+		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+
+		r := newSignedRequest(ctx, run)
+		r.sign(run.api.Signer(), time.Now())
+
+		r.expectAccepted(ctx, run)
+	})
+
+	ErrorCase(ctx, "with a date outside the allowed skew", func() {
+		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+
+		skew := signature.PermittedTimeSkew + time.Minute
+		for _, date := range []time.Time{time.Now().Add(-skew), time.Now().Add(skew)} {
+			r := newSignedRequest(ctx, run)
+			r.sign(run.api.Signer(), date)
+
+			r.expectRejected(ctx, run, nil, "dated "+date.UTC().Format(time.RFC3339))
+		}
+	})
+
+	ErrorCase(ctx, "with a replayed request", func() {
+		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+
+		r := newSignedRequest(ctx, run)
+		r.sign(run.api.Signer(), time.Now())
+
+		r.expectAccepted(ctx, run)
+		r.expectRejected(ctx, run, nil, "sent a second time")
+	})
+
+	ErrorCase(ctx, "with a body changed after signing", func() {
+		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+
+		r := newSignedRequest(ctx, run)
+		r.sign(run.api.Signer(), time.Now())
+
+		// The other resource ID is just as long, so the signed Content-Length
+		// still matches the body.
+		otherResourceID, err := manifold.NewID(idtype.Resource)
+		if err != nil {
+			FatalErr("Could not generate resource id: %s", err)
+		}
+		body := bytes.Replace(r.body, []byte(r.resourceID.String()), []byte(otherResourceID.String()), 1)
+
+		r.expectRejected(ctx, run, body, "with its body changed")
+	})
+
+	ErrorCase(ctx, "with a host changed after signing", func() {
+		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+
+		// The request is signed for another host, and sent to the provider,
+		// as if it had been redirected there.
+		r := newSignedRequest(ctx, run)
+		host := r.req.Host
+		r.req.Host = "provider.invalid"
+		r.sign(run.api.Signer(), time.Now())
+		r.req.Host = host
+
+		r.expectRejected(ctx, run, nil, "signed for another host")
+	})
+
+	ErrorCase(ctx, "with a callback URL changed after signing", func() {
+		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+
+		r := newSignedRequest(ctx, run)
+		r.sign(run.api.Signer(), time.Now())
+
+		cbID, err := manifold.NewID(idtype.Callback)
+		if err != nil {
+			FatalErr("Could not generate callback id: %s", err)
+		}
+		cbURL, err := run.api.CallbackURL(cbID)
+		if err != nil {
+			FatalErr("Could not derive callback url: %s", err)
+		}
+		r.req.Header.Set("X-Callback-URL", cbURL)
+
+		r.expectRejected(ctx, run, nil, "with its callback URL changed")
+	})
+
+	ErrorCase(ctx, "with headers left out of X-Signed-Headers", func() {
+		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+
+		for i, dropped := range signedHeaders {
+			headers := append(append([]string{}, signedHeaders[:i]...), signedHeaders[i+1:]...)
+
+			r := newSignedRequest(ctx, run)
+			r.sign(run.api.Signer(), time.Now(), headers...)
+
+			r.expectRejected(ctx, run, nil, "without "+dropped+" signed")
+		}
+	})
+
+	ErrorCase(ctx, "with a key endorsed by another master key", func() {
+		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+
+		signer, err := newForeignSigner()
+		if err != nil {
+			FatalErr("Could not generate signing keys: %s", err)
+		}
+
+		r := newSignedRequest(ctx, run)
+		r.sign(signer, time.Now())
+
+		r.expectRejected(ctx, run, nil, "signed with a key endorsed by another master key")
+	})
+})
+
+// signedRequest is a request to provision credentials, signed by the feature
+// rather than the API client, so it can be tampered with once signed.
+type signedRequest struct {
+	req        *http.Request
+	body       []byte
+	resourceID manifold.ID
+}
+
+func newSignedRequest(ctx context.Context, run *testRun) *signedRequest {
+	credID, err := manifold.NewID(idtype.Credential)
+	if err != nil {
+		FatalErr("Could not generate credential id: %s", err)
+	}
+	resourceID, err := manifold.NewID(idtype.Resource)
+	if err != nil {
+		FatalErr("Could not generate resource id: %s", err)
+	}
+	cbID, err := manifold.NewID(idtype.Callback)
+	if err != nil {
+		FatalErr("Could not generate callback id: %s", err)
+	}
+
+	cbURL, err := run.api.CallbackURL(cbID)
+	if err != nil {
+		FatalErr("Could not derive callback url: %s", err)
+	}
+
+	body, err := json.Marshal(map[string]manifold.ID{
+		"id":          credID,
+		"resource_id": resourceID,
+	})
+	if err != nil {
+		FatalErr("Could not encode request body: %s", err)
+	}
+
+	req, err := run.api.NewRequest(ctx, http.MethodPut, "/credentials/"+credID.String(), body)
+	if err != nil {
+		FatalErr("Could not create request: %s", err)
+	}
+	req.Header.Set("X-Callback-ID", cbID.String())
+	req.Header.Set("X-Callback-URL", cbURL)
+
+	return &signedRequest{req: req, body: body, resourceID: resourceID}
+}
+
+// sign signs the request as of the given date, as Manifold does, listing the
+// given headers in X-Signed-Headers, or every header it signs if none are
+// given.
+func (r *signedRequest) sign(signer grafton.Signer, date time.Time, headers ...string) {
+	if len(headers) == 0 {
+		headers = signedHeaders
+	}
+
+	r.req.Header.Set("Date", date.UTC().Format(time.RFC3339))
+	r.req.Header.Set("Content-Type", "application/json")
+	r.req.Header.Set("Content-Length", fmt.Sprintf("%d", len(r.body)))
+	r.req.Header.Set("X-Signed-Headers", strings.Join(headers, " "))
+
+	canonical, err := signature.Canonize(r.req, bytes.NewReader(r.body))
+	if err != nil {
+		FatalErr("Could not canonize request: %s", err)
+	}
+
+	sig, err := signer.Sign(canonical)
+	if err != nil {
+		FatalErr("Could not sign request: %s", err)
+	}
+
+	r.req.Header.Set("X-Signature", sig.String())
+}
+
+// send sends the request as it was signed, with the given body in place of
+// the signed one if it isn't nil, returning the status code and message of
+// the response. It can be sent several times.
+func (r *signedRequest) send(ctx context.Context, run *testRun, body []byte) (int, string) {
+	if body == nil {
+		body = r.body
+	}
+
+	req := r.req.Clone(ctx)
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	rsp, err := run.api.Do(req)
+	if err != nil {
+		FatalErr("Could not send request: %s", err)
+	}
+	defer rsp.Body.Close()
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		FatalErr("Could not read response: %s", err)
+	}
+
+	e := struct {
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal(b, &e); err != nil || e.Message == "" {
+		return rsp.StatusCode, strings.TrimSpace(string(b))
+	}
+
+	return rsp.StatusCode, e.Message
+}
+
+// expectAccepted sends the request, failing unless it is let through,
+// whichever way the provider answers it otherwise.
+func (r *signedRequest) expectAccepted(ctx context.Context, run *testRun) {
+	status, message := r.send(ctx, run, nil)
+	gm.Expect(status).ToNot(
+		gm.Equal(http.StatusUnauthorized),
+		"Expected a correctly signed request to be accepted, got 401: %s", message,
+	)
+}
+
+// expectRejected sends the request, with the given body if it isn't nil,
+// failing unless it is rejected with 401 Unauthorized. how describes what is
+// wrong with its signature.
+func (r *signedRequest) expectRejected(ctx context.Context, run *testRun, body []byte, how string) {
+	status, message := r.send(ctx, run, body)
+	gm.Expect(status).To(
+		gm.Equal(http.StatusUnauthorized),
+		"Expected a request %s to be rejected with 401, got %d: %s", how, status, message,
+	)
+}
+
+// foreignSigner signs requests with a live key endorsed by a master key of
+// its own, rather than the one the provider trusts.
+type foreignSigner struct {
+	live        ed25519.PrivateKey
+	endorsement []byte
+}
+
+func newForeignSigner() (*foreignSigner, error) {
+	_, masterKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	livePub, liveKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &foreignSigner{
+		live:        liveKey,
+		endorsement: ed25519.Sign(masterKey, livePub),
+	}, nil
+}
+
+func (s *foreignSigner) Sign(b []byte) (*signature.Signature, error) {
+	return &signature.Signature{
+		Value:       base64.New(ed25519.Sign(s.live, b)),
+		PublicKey:   base64.New([]byte(s.live.Public().(ed25519.PublicKey))),
+		Endorsement: base64.New(s.endorsement),
+	}, nil
+}
@@ -10,42 +10,25 @@ import (
 
 	gm "github.com/onsi/gomega"
 
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/idtype"
+
 	"github.com/manifoldco/grafton/connector"
+	"github.com/manifoldco/grafton/db"
 )
 
 var sso = Feature("sso", "Single Sign-On Flow", func(ctx context.Context) {
-	Default(func() {
-		authCode, err := fakeConnector.CreateCode()
-		if err != nil {
-			FatalErr("could not create auth code %s", err)
-		}
-
-		url := api.CreateSsoURL(authCode.Code, resourceID)
-		Infoln("Attempting to SSO into URL:", url)
+	run := runFrom(ctx)
 
-		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
-		defer cancel()
-
-		req, err := http.NewRequest("GET", url.String(), nil)
+	Default(ctx, func() {
+		authCode, err := run.connector.CreateCodeFor(run.resourceID)
 		if err != nil {
-			FatalErr("got error building new request %s", err)
-		}
-
-		client := http.Client{
-			// don't follow redirects.
-			CheckRedirect: func(_ *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
+			FatalErr("could not create auth code %s", err)
 		}
-		req = req.WithContext(ctx)
-		resp, err := client.Do(req)
-
-		logRequest(req)
-		logResponse(resp)
 
-		gm.Expect(err).To(notError())
+		resp := signIn(ctx, run.api.CreateSsoURL(authCode.Code, run.resourceID).String())
 
-		capturer, err := fakeConnector.GetCapturer("/v1/oauth/tokens")
+		capturer, err := run.connector.GetCapturer("/v1/oauth/tokens")
 		if err != nil {
 			FatalErr("Could not find request capturer %s", err)
 		}
@@ -58,16 +41,14 @@ var sso = Feature("sso", "Single Sign-On Flow", func(ctx context.Context) {
 				FatalErr("Could not cast request body to TokenRequest %s", err)
 			}
 
-			if req.GrantType == connector.AuthorizationCodeGrantType {
+			// the connector is shared by every test run, so only count the
+			// requests made for this code.
+			if req.GrantType == connector.AuthorizationCodeGrantType && req.Code == authCode.Code {
 				reqs = append(reqs, req)
 			}
 		}
 
-		gm.Expect(resp.StatusCode).To(gm.SatisfyAny(
-			gm.BeNumerically("==", 200),
-			gm.BeNumerically("==", 302),
-			gm.BeNumerically("==", 303),
-		), "Status code should be success (200) or redirect (302 or 303)")
+		expectSignedIn(run, resp, "Status code should be success (200) or redirect (302 or 303)")
 
 		gm.Expect(len(reqs)).To(
 			gm.Equal(1), "Zero or more than one token request should be received")
@@ -78,213 +59,135 @@ var sso = Feature("sso", "Single Sign-On Flow", func(ctx context.Context) {
 			GrantType:    "authorization_code",
 			Code:         authCode.Code,
 			AuthHeader:   tokReq.AuthHeader,
-			ClientID:     clientID,
-			ClientSecret: clientSecret,
+			ClientID:     run.clientID,
+			ClientSecret: run.clientSecret,
 		}), "Invalid token request")
-	})
-
-	ErrorCase("with wrong client id", func() {
-		fakeConnector.Config.ClientID = "fake-client"
-		defer func() {
-			fakeConnector.Config.ClientID = clientID
-		}()
-		authCode, err := fakeConnector.CreateCode()
-		if err != nil {
-			FatalErr("could not create auth code %s", err)
-		}
 
-		url := api.CreateSsoURL(authCode.Code, resourceID)
-		Infoln("Attempting to SSO into URL:", url)
+		gm.Expect(userRequests(run, "/v1/resources/{id}", authCode.Code)).To(gm.ContainElement(
+			&connector.UserRequest{Code: authCode.Code, ResourceID: run.resourceID},
+		), "Expected the provider to check the user can access the resource with GET /v1/resources/{id}, using their access token")
 
-		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
-		defer cancel()
+		gm.Expect(userRequests(run, "/v1/self", authCode.Code)).ToNot(gm.BeEmpty(),
+			"Expected the provider to look up the user with GET /v1/self, using their access token")
+	})
 
-		req, err := http.NewRequest("GET", url.String(), nil)
+	ErrorCase(ctx, "with wrong client id", func() {
+		authCode, err := run.connector.CreateCodeWith(connector.AuthorizationCode{
+			ClientID:   "fake-client",
+			ResourceID: run.resourceID,
+		})
 		if err != nil {
-			FatalErr("got error building new request %s", err)
-		}
-
-		client := http.Client{
-			// don't follow redirects.
-			CheckRedirect: func(_ *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
+			FatalErr("could not create auth code %s", err)
 		}
-		req = req.WithContext(ctx)
-		resp, err := client.Do(req)
 
-		logRequest(req)
-		logResponse(resp)
-
-		gm.Expect(err).To(notError())
-		defer resp.Body.Close()
+		resp := signIn(ctx, run.api.CreateSsoURL(authCode.Code, run.resourceID).String())
 
 		gm.Expect(resp.StatusCode).To(gm.SatisfyAll(
 			gm.BeNumerically("==", 401),
 		), "Status code should be 401 unauthorized")
 	})
 
-	ErrorCase("with wrong client secret", func() {
-		fakeConnector.Config.ClientSecret = "fake-secret"
-		defer func() {
-			fakeConnector.Config.ClientSecret = clientSecret
-		}()
-
-		authCode, err := fakeConnector.CreateCode()
+	ErrorCase(ctx, "with wrong client secret", func() {
+		authCode, err := run.connector.CreateCodeWith(connector.AuthorizationCode{
+			ClientSecret: "fake-secret",
+			ResourceID:   run.resourceID,
+		})
 		if err != nil {
 			FatalErr("could not create auth code %s", err)
 		}
 
-		url := api.CreateSsoURL(authCode.Code, resourceID)
-		Infoln("Attempting to SSO into URL:", url)
-
-		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
-		defer cancel()
-
-		req, err := http.NewRequest("GET", url.String(), nil)
-		if err != nil {
-			FatalErr("got error building new request %s", err)
-		}
-
-		client := http.Client{
-			// don't follow redirects.
-			CheckRedirect: func(_ *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-		}
-		req = req.WithContext(ctx)
-		resp, err := client.Do(req)
-
-		logRequest(req)
-		logResponse(resp)
-
-		gm.Expect(err).To(notError())
-		defer resp.Body.Close()
+		resp := signIn(ctx, run.api.CreateSsoURL(authCode.Code, run.resourceID).String())
 
 		gm.Expect(resp.StatusCode).To(gm.SatisfyAll(
 			gm.BeNumerically("==", 401),
 		), "Status code should be 401 unauthorized")
 	})
 
-	ErrorCase("with expired token", func() {
-		authCode, err := fakeConnector.CreateCode()
-		authCode.ExpiresAt = time.Now().Add(-1 * time.Minute)
+	ErrorCase(ctx, "with expired token", func() {
+		authCode, err := run.connector.CreateCodeWith(connector.AuthorizationCode{
+			ExpiresAt:  time.Now().Add(-1 * time.Minute),
+			ResourceID: run.resourceID,
+		})
 		if err != nil {
 			FatalErr("could not create auth code %s", err)
 		}
 
-		url := api.CreateSsoURL(authCode.Code, resourceID)
-		Infoln("Attempting to SSO into URL:", url)
-
-		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
-		defer cancel()
-
-		req, err := http.NewRequest("GET", url.String(), nil)
-		if err != nil {
-			FatalErr("got error building new request %s", err)
-		}
-
-		client := http.Client{
-			// don't follow redirects.
-			CheckRedirect: func(_ *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-		}
-		req = req.WithContext(ctx)
-		resp, err := client.Do(req)
-
-		logRequest(req)
-		logResponse(resp)
-
-		gm.Expect(err).To(notError())
-		defer resp.Body.Close()
+		resp := signIn(ctx, run.api.CreateSsoURL(authCode.Code, run.resourceID).String())
 
 		gm.Expect(resp.StatusCode).To(gm.SatisfyAll(
 			gm.BeNumerically("==", 401),
 		), "Status code should be 401 unauthorized")
 	})
 
-	ErrorCase("with non-existing code", func() {
-		if _, err := fakeConnector.CreateCode(); err != nil {
+	ErrorCase(ctx, "with non-existing code", func() {
+		if _, err := run.connector.CreateCode(); err != nil {
 			FatalErr("could not create auth code %s", err)
 		}
 
+		// The code is as long as real ones, so it is valid per the spec.
 		wrongCode := &connector.AuthorizationCode{
-			Code:      "non-existing",
+			Code:      "nonexisting00",
 			ExpiresAt: time.Now().Add(3600 * time.Second),
 		}
 
-		url := uapi.CreateSsoURL(wrongCode.Code, resourceID)
-		Infoln("Attempting to SSO into URL:", url)
+		resp := signIn(ctx, run.uapi.CreateSsoURL(wrongCode.Code, run.resourceID).String())
 
-		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
-		defer cancel()
+		gm.Expect(resp.StatusCode).To(gm.SatisfyAll(
+			gm.BeNumerically("==", 401),
+		), "Status code should be 401 unauthorized")
+	})
 
-		req, err := http.NewRequest("GET", url.String(), nil)
+	ErrorCase(ctx, "with reused code", func() {
+		authCode, err := run.connector.CreateCodeFor(run.resourceID)
 		if err != nil {
-			FatalErr("got error building new request %s", err)
-		}
-
-		client := http.Client{
-			// don't follow redirects.
-			CheckRedirect: func(_ *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
+			FatalErr("could not create auth code %s", err)
 		}
-		req = req.WithContext(ctx)
-		resp, err := client.Do(req)
 
-		logRequest(req)
-		logResponse(resp)
+		url := run.api.CreateSsoURL(authCode.Code, run.resourceID).String()
 
-		gm.Expect(err).To(notError())
-		defer resp.Body.Close()
+		resp := signIn(ctx, url)
+		expectSignedIn(run, resp, "The first sign in with the code should succeed")
 
+		// Codes can only be exchanged once, so a code leaked by the user's
+		// browser can't be used to sign in as them.
+		resp = signIn(ctx, url)
 		gm.Expect(resp.StatusCode).To(gm.SatisfyAll(
 			gm.BeNumerically("==", 401),
-		), "Status code should be 401 unauthorized")
+		), "Status code should be 401 unauthorized when the code was already used")
 	})
 
-	ErrorCase("with connector response error", func() {
-		fakeConnector.Server.Handler = connector.ErrorHandler(fakeConnector)
-		defer func() {
-			fakeConnector.Server.Handler = connector.ValidHandler(fakeConnector)
-		}()
-
-		authCode, err := fakeConnector.CreateCode()
+	ErrorCase(ctx, "with tampered resource_id", func() {
+		// The resource exists, but the user signing in doesn't have access
+		// to it, which only the Connector knows.
+		id, err := manifold.NewID(idtype.Resource)
 		if err != nil {
-			FatalErr("could not create auth code %s", err)
+			FatalErr("Could not generate resource id: %s", err)
 		}
 
-		url := api.CreateSsoURL(authCode.Code, resourceID)
-		Infoln("Attempting to SSO into URL:", url)
-
-		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
-		defer cancel()
+		run.connector.AddResource(&db.Resource{
+			ID:      id,
+			Product: manifold.Label(run.product),
+			Plan:    manifold.Label(run.plan),
+			Region:  run.region,
+		})
+		defer run.connector.RemoveResource(id)
 
-		req, err := http.NewRequest("GET", url.String(), nil)
+		authCode, err := run.connector.CreateCodeFor(run.resourceID)
 		if err != nil {
-			FatalErr("got error building new request %s", err)
-		}
-
-		client := http.Client{
-			// don't follow redirects.
-			CheckRedirect: func(_ *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
+			FatalErr("could not create auth code %s", err)
 		}
-		req = req.WithContext(ctx)
-		resp, err := client.Do(req)
 
-		logRequest(req)
-		logResponse(resp)
+		resp := signIn(ctx, run.api.CreateSsoURL(authCode.Code, id).String())
 
-		gm.Expect(err).To(notError())
-		defer resp.Body.Close()
-
-		gm.Expect(resp.StatusCode).To(gm.SatisfyAll(
+		gm.Expect(resp.StatusCode).To(gm.SatisfyAny(
 			gm.BeNumerically("==", 401),
-		), "Status code should be 401 unauthorized")
+			gm.BeNumerically("==", 403),
+			gm.BeNumerically("==", 404),
+		), "Status code should be 401 unauthorized, 403 forbidden or 404 not found for a resource the user can't access")
+
+		gm.Expect(userRequests(run, "/v1/resources/{id}", authCode.Code)).To(gm.ContainElement(
+			&connector.UserRequest{Code: authCode.Code, ResourceID: id},
+		), "Expected the provider to check the user can access the resource with GET /v1/resources/{id}, using their access token")
 	})
 })
 
@@ -348,12 +251,84 @@ func (e expectedTokenRequestMatcher) NegatedFailureMessage(actual interface{}) s
 	return "Token should not have matched expected values"
 }
 
-func logRequest(req *http.Request) {
+// signIn sends the user to the provider's SSO url, as their browser would
+// when redirected by the marketplace, without following the redirect the
+// provider answers with.
+func signIn(ctx context.Context, url string) *http.Response {
+	run := runFrom(ctx)
+	run.infoln("Attempting to SSO into URL:", url)
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		FatalErr("got error building new request %s", err)
+	}
+
+	client := http.Client{
+		Transport: run.transport,
+		// don't follow redirects.
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req = req.WithContext(ctx)
+	resp, err := client.Do(req)
+
+	logRequest(ctx, req)
+	gm.Expect(err).To(notError())
+
+	logResponse(ctx, resp)
+	resp.Body.Close()
+
+	return resp
+}
+
+// expectSignedIn expects the provider to have signed the user in, recording
+// where it sent them.
+func expectSignedIn(run *testRun, resp *http.Response, msg string) {
+	gm.Expect(resp.StatusCode).To(gm.SatisfyAny(
+		gm.BeNumerically("==", 200),
+		gm.BeNumerically("==", 302),
+		gm.BeNumerically("==", 303),
+	), msg)
+
+	if resp.StatusCode == 200 {
+		run.notef("Signed in users are answered with %s, without a redirect", resp.Status)
+		return
+	}
+
+	location := resp.Header.Get("Location")
+	run.notef("Signed in users are redirected with %s to %s", resp.Status, location)
+	gm.Expect(location).ToNot(gm.BeEmpty(), "Redirects should have a Location")
+}
+
+// userRequests returns the requests made to the fake Connector's route with
+// the access token granted for the code. The connector is shared by every
+// test run, so requests made with other codes are left out.
+func userRequests(run *testRun, route, code string) []*connector.UserRequest {
+	capturer, err := run.connector.GetCapturer(route)
+	if err != nil {
+		FatalErr("Could not find request capturer %s", err)
+	}
+
+	var reqs []*connector.UserRequest
+	for _, v := range capturer.Get() {
+		if req, ok := v.(*connector.UserRequest); ok && req.Code == code {
+			reqs = append(reqs, req)
+		}
+	}
+
+	return reqs
+}
+
+func logRequest(ctx context.Context, req *http.Request) {
 	rq, _ := httputil.DumpRequest(req, true)
-	Infoln(string(rq))
+	runFrom(ctx).infoln(string(rq))
 }
 
-func logResponse(rsp *http.Response) {
+func logResponse(ctx context.Context, rsp *http.Response) {
 	resp, _ := httputil.DumpResponse(rsp, true)
-	Infoln(string(resp))
+	runFrom(ctx).infoln(string(resp))
 }
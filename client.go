@@ -4,10 +4,13 @@
 package grafton
 
 import (
+	"bytes"
 	"context"
 	"io/ioutil"
+	"net/http"
 	nurl "net/url"
 	"path"
+	"strings"
 	"time"
 
 	httptransport "github.com/go-openapi/runtime/client"
@@ -37,6 +40,10 @@ type Client struct {
 	connectorURL *nurl.URL
 	api          *client.ManifoldProvider
 	log          *logrus.Entry
+
+	// transport sends requests which are already signed.
+	transport http.RoundTripper
+	signer    Signer
 }
 
 // ResourceBody is an exported type that enables external users to pass data
@@ -71,35 +78,82 @@ type ClientOptions struct {
 	Debug        bool
 	Signer       Signer
 	Log          *logrus.Entry
+
+	// Retry retries requests failing with a transient error. Requests are
+	// sent once if it is left empty.
+	Retry RetryPolicy
+
+	// Transport sends requests once they are signed, such as to record them.
+	// It defaults to http.DefaultTransport.
+	Transport http.RoundTripper
 }
 
 // NewClient creates a new Client for Grafton.
 func NewClient(opt ClientOptions) *Client {
 	tp := httptransport.New(opt.URL.Host, opt.URL.Path, []string{opt.URL.Scheme})
+	if opt.Transport != nil {
+		tp.Transport = opt.Transport
+	}
 
 	if opt.Debug {
-		debug := newDebugRoundTripper(tp.Transport)
-		signing := newSigningRoundTripper(debug, opt.Signer)
-		tp.Transport = signing
-	} else {
-		signing := newSigningRoundTripper(tp.Transport, opt.Signer)
-		tp.Transport = signing
+		tp.Transport = newDebugRoundTripper(tp.Transport)
 	}
-
-	api := client.New(tp, strfmt.Default)
+	transport := tp.Transport
+	tp.Transport = newSigningRoundTripper(transport, opt.Signer)
 
 	if opt.Log == nil {
 		opt.Log = logrus.NewEntry(nullLogger)
 	}
 
+	if opt.Retry.enabled() {
+		tp.Transport = newRetryRoundTripper(tp.Transport, opt.Retry, opt.Log)
+	}
+
+	api := client.New(tp, strfmt.Default)
+
 	return &Client{
 		url:          opt.URL,
 		api:          api,
 		connectorURL: opt.ConnectorURL,
 		log:          opt.Log,
+		transport:    transport,
+		signer:       opt.Signer,
 	}
 }
 
+// NewRequest returns a request to the provider for the given path, relative to
+// the provider URL, such as /resources/{id}. It isn't signed; requests are
+// only signed by the Client when made through its other methods.
+func (c *Client) NewRequest(ctx context.Context, method, p string, body []byte) (*http.Request, error) {
+	u := *c.url
+	u.Path = strings.TrimSuffix(u.Path, "/") + p
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+// Do sends a request as is, without signing or retrying it, through the
+// Client's transport. It is used to send requests signed, or tampered with,
+// by the caller, such as to check how the provider verifies signatures.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	return c.transport.RoundTrip(req)
+}
+
+// Signer returns the signer the Client signs its requests with.
+func (c *Client) Signer() Signer {
+	return c.signer
+}
+
+// CallbackURL returns the URL the provider is asked to complete the callback
+// with the given ID at.
+func (c *Client) CallbackURL(cbID manifold.ID) (string, error) {
+	return deriveCallbackURL(c.connectorURL, cbID)
+}
+
 // ProvisionResource makes a resource provisioning call.
 //
 // A message will be returned if a callback was used *or* a provider returned
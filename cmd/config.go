@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// configFileNames are the names of the configuration files discovered next
+// to masterkey.json, in order of preference.
+var configFileNames = []string{"grafton.yaml", "grafton.yml", "grafton.json"}
+
+var configFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "config",
+		Usage:   "Path to a grafton.yaml or grafton.json configuration file (default: discovered next to masterkey.json)",
+		EnvVars: []string{"GRAFTON_CONFIG"},
+	},
+	&cli.StringFlag{
+		Name:    "profile",
+		Usage:   "Name of the profile to use from the configuration file",
+		EnvVars: []string{"GRAFTON_PROFILE"},
+	},
+}
+
+type configKind int
+
+const (
+	stringConfig configKind = iota
+	numberConfig
+	boolConfig
+	listConfig
+	objectConfig
+)
+
+// configKeys lists every key accepted in a configuration file, along with the
+// kind of value it holds. Keys share their names with the command line flags
+// they populate; objects are passed on to flags as JSON.
+var configKeys = map[string]configKind{
+	"url":                       stringConfig,
+	"product":                   stringConfig,
+	"plan":                      stringConfig,
+	"plan-features":             objectConfig,
+	"new-plan":                  stringConfig,
+	"new-plan-features":         objectConfig,
+	"region":                    stringConfig,
+	"import-code":               stringConfig,
+	"exclude":                   listConfig,
+	"include":                   listConfig,
+	"no-error-cases":            boolConfig,
+	"log":                       stringConfig,
+	"client-id":                 stringConfig,
+	"client-secret":             stringConfig,
+	"connector-port":            numberConfig,
+	"marketplace-port":          numberConfig,
+	"callback-timeout":          stringConfig,
+	"resource-measures":         objectConfig,
+	"credential":                stringConfig,
+	"matrix":                    objectConfig,
+	"parallel":                  numberConfig,
+	"report":                    listConfig,
+	"data-dir":                  stringConfig,
+	"fault":                     listConfig,
+	"user":                      listConfig,
+	"strict-callbacks":          boolConfig,
+	"strict-contract":           boolConfig,
+	"strict-connector-contract": boolConfig,
+	"record":                    stringConfig,
+	"record-session":            stringConfig,
+	"replay":                    stringConfig,
+	"keyring":                   stringConfig,
+	"master-key":                stringConfig,
+	"signer":                    stringConfig,
+}
+
+// configFile is a parsed configuration file, holding the values for a single
+// profile as flag values, keyed by flag name.
+type configFile struct {
+	Path   string
+	values map[string][]string
+}
+
+// Get returns the first value for the given key, or an empty string.
+func (c *configFile) Get(key string) string {
+	if c == nil || len(c.values[key]) == 0 {
+		return ""
+	}
+	return c.values[key][0]
+}
+
+// findConfigFile returns the path of the configuration file to use, or an
+// empty string if none was given and none could be discovered.
+func findConfigFile(ctx *cli.Context) (string, error) {
+	if file := ctx.String("config"); file != "" {
+		return file, nil
+	}
+
+	keyFile, err := getKeyFilePath()
+	if err != nil {
+		return "", err
+	}
+
+	dir := path.Dir(keyFile)
+	for _, name := range configFileNames {
+		file := path.Join(dir, name)
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+
+	return "", nil
+}
+
+// loadConfigFile reads and validates the configuration file at the given path,
+// returning the values of the top level merged with those of the named
+// profile.
+func loadConfigFile(file, profile string) (*configFile, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := map[string]interface{}{}
+	if strings.ToLower(filepath.Ext(file)) == ".json" {
+		err = json.Unmarshal(b, &raw)
+	} else {
+		err = yaml.Unmarshal(b, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	profiles := map[string]interface{}{}
+	if p, ok := raw["profiles"]; ok {
+		profiles, ok = normalizeConfigValue(p).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: `profiles` must be an object of named profiles", file)
+		}
+		delete(raw, "profiles")
+	}
+
+	cfg := &configFile{Path: file, values: map[string][]string{}}
+	if err := cfg.merge(raw, ""); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	if profile == "" {
+		return cfg, nil
+	}
+
+	p, ok := profiles[profile]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("%s: profile `%s` does not exist; available profiles: %s",
+			file, profile, strings.Join(names, ", "))
+	}
+
+	values, ok := p.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: profile `%s` must be an object", file, profile)
+	}
+
+	if err := cfg.merge(values, profile); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	return cfg, nil
+}
+
+// merge validates the given values and stores them, replacing any existing
+// values for the same keys.
+func (c *configFile) merge(values map[string]interface{}, profile string) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	where := ""
+	if profile != "" {
+		where = fmt.Sprintf(" in profile `%s`", profile)
+	}
+
+	for _, k := range keys {
+		kind, ok := configKeys[k]
+		if !ok {
+			return fmt.Errorf("unknown key `%s`%s", k, where)
+		}
+
+		v, err := configValue(kind, normalizeConfigValue(values[k]))
+		if err != nil {
+			return fmt.Errorf("invalid value for `%s`%s: %s", k, where, err)
+		}
+
+		c.values[k] = v
+	}
+
+	return nil
+}
+
+func configValue(kind configKind, v interface{}) ([]string, error) {
+	switch kind {
+	case stringConfig:
+		switch t := v.(type) {
+		case string:
+			return []string{t}, nil
+		case int, float64:
+			return []string{fmt.Sprint(t)}, nil
+		}
+		return nil, fmt.Errorf("expected a string")
+	case numberConfig:
+		switch t := v.(type) {
+		case int:
+			if t >= 0 {
+				return []string{strconv.Itoa(t)}, nil
+			}
+		case float64:
+			if t >= 0 && t == float64(int64(t)) {
+				return []string{strconv.FormatInt(int64(t), 10)}, nil
+			}
+		}
+		return nil, fmt.Errorf("expected a positive whole number")
+	case boolConfig:
+		if t, ok := v.(bool); ok {
+			return []string{strconv.FormatBool(t)}, nil
+		}
+		return nil, fmt.Errorf("expected true or false")
+	case listConfig:
+		switch t := v.(type) {
+		case string:
+			return []string{t}, nil
+		case []interface{}:
+			list := make([]string, len(t))
+			for i, e := range t {
+				s, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("expected a list of strings")
+				}
+				list[i] = s
+			}
+			return list, nil
+		}
+		return nil, fmt.Errorf("expected a list of strings")
+	case objectConfig:
+		if _, ok := v.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("expected an object")
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{string(b)}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value")
+}
+
+// normalizeConfigValue converts the maps produced by the YAML decoder into
+// maps with string keys, so they can be encoded as JSON.
+func normalizeConfigValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = normalizeConfigValue(e)
+		}
+		return m
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = normalizeConfigValue(e)
+		}
+		return t
+	case []interface{}:
+		for i, e := range t {
+			t[i] = normalizeConfigValue(e)
+		}
+		return t
+	}
+
+	return v
+}
+
+// applyConfigFile loads the configuration file for the command, if any, and
+// uses its values for every flag of the command that was not set on the
+// command line or through the environment.
+//
+// The loaded configuration is returned so commands can read values which are
+// not flags, like the provider url. nil is returned if there is no file.
+func applyConfigFile(ctx *cli.Context) (*configFile, error) {
+	file, err := findConfigFile(ctx)
+	if err != nil {
+		return nil, cli.NewExitError("Could not determine working directory: "+err.Error(), -1)
+	}
+
+	profile := ctx.String("profile")
+	if file == "" {
+		if profile != "" {
+			return nil, cli.NewExitError("--profile was given, but no configuration file was found", -1)
+		}
+		return nil, nil
+	}
+
+	cfg, err := loadConfigFile(file, profile)
+	if err != nil {
+		return nil, cli.NewExitError("Could not load configuration file "+err.Error(), -1)
+	}
+
+	for _, f := range ctx.Command.Flags {
+		name := f.Names()[0]
+		values, ok := cfg.values[name]
+		if !ok || ctx.IsSet(name) {
+			continue
+		}
+
+		for _, v := range values {
+			if err := ctx.Set(name, v); err != nil {
+				return nil, cli.NewExitError(fmt.Sprintf("Could not load configuration file %s: `%s`: %s",
+					file, name, err), -1)
+			}
+		}
+	}
+
+	return cfg, nil
+}
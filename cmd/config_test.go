@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	gm "github.com/onsi/gomega"
+	"github.com/urfave/cli/v2"
+)
+
+const testConfigYAML = `
+product: bonnets
+plan: small
+plan-features:
+  size: 40 GB
+  read-replica: true
+region: aws::us-east-1
+connector-port: 3001
+exclude: [sso]
+profiles:
+  staging:
+    url: https://staging.example.com
+    plan: large
+`
+
+func writeTestConfig(t *testing.T, name, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "grafton")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := path.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	file, cleanup := writeTestConfig(t, "grafton.yaml", testConfigYAML)
+	defer cleanup()
+
+	t.Run("without a profile", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		cfg, err := loadConfigFile(file, "")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(cfg.Get("plan")).To(gm.Equal("small"))
+		gm.Expect(cfg.Get("url")).To(gm.Equal(""))
+		gm.Expect(cfg.Get("connector-port")).To(gm.Equal("3001"))
+		gm.Expect(cfg.Get("plan-features")).To(gm.MatchJSON(`{"size": "40 GB", "read-replica": true}`))
+	})
+
+	t.Run("with a profile", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		cfg, err := loadConfigFile(file, "staging")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(cfg.Get("plan")).To(gm.Equal("large"))
+		gm.Expect(cfg.Get("product")).To(gm.Equal("bonnets"))
+		gm.Expect(cfg.Get("url")).To(gm.Equal("https://staging.example.com"))
+	})
+
+	t.Run("with a missing profile", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		_, err := loadConfigFile(file, "local")
+		gm.Expect(err).To(gm.MatchError(file + ": profile `local` does not exist; available profiles: staging"))
+	})
+
+	t.Run("with an unknown key", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		file, cleanup := writeTestConfig(t, "grafton.json", `{
+			"product": "bonnets",
+			"profiles": {"local": {"produt": "bonnets"}}
+		}`)
+		defer cleanup()
+
+		_, err := loadConfigFile(file, "local")
+		gm.Expect(err).To(gm.MatchError(file + ": unknown key `produt` in profile `local`"))
+	})
+
+	t.Run("with a value of the wrong kind", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		file, cleanup := writeTestConfig(t, "grafton.yaml", "connector-port: local\n")
+		defer cleanup()
+
+		_, err := loadConfigFile(file, "")
+		gm.Expect(err).To(gm.MatchError(file + ": invalid value for `connector-port`: expected a positive whole number"))
+	})
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	file, cleanup := writeTestConfig(t, "grafton.yaml", testConfigYAML)
+	defer cleanup()
+
+	flags := append([]cli.Flag{
+		&cli.StringFlag{Name: "plan"},
+		&cli.StringFlag{Name: "product"},
+		&cli.UintFlag{Name: "connector-port"},
+		&cli.StringSliceFlag{Name: "exclude"},
+	}, configFlags...)
+
+	set := flag.NewFlagSet("test", 0)
+	for _, f := range flags {
+		gm.Expect(f.Apply(set)).To(gm.Succeed())
+	}
+	gm.Expect(set.Parse([]string{"--plan", "tiny", "--config", file, "--profile", "staging"})).To(gm.Succeed())
+
+	ctx := cli.NewContext(nil, set, nil)
+	ctx.Command = &cli.Command{Flags: flags}
+
+	cfg, err := applyConfigFile(ctx)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(cfg.Get("url")).To(gm.Equal("https://staging.example.com"))
+
+	gm.Expect(ctx.String("plan")).To(gm.Equal("tiny"), "flags override the configuration file")
+	gm.Expect(ctx.String("product")).To(gm.Equal("bonnets"))
+	gm.Expect(ctx.Uint("connector-port")).To(gm.Equal(uint(3001)))
+	gm.Expect(ctx.StringSlice("exclude")).To(gm.Equal([]string{"sso"}))
+	gm.Expect(ctx.IsSet("product")).To(gm.BeTrue())
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -38,12 +41,29 @@ func apiURLPattern() string {
 	return fmt.Sprintf("%s://api.%s.%s/v1", scheme, "%s", hostname)
 }
 
-var credentialFlags = []cli.Flag{
+var localConnectorFlags = []cli.Flag{
+	&cli.UintFlag{
+		Name:  "connector-port",
+		Usage: "Manage the credentials of a local fake Connector started by grafton serve instead of Manifold",
+	},
+	&cli.StringFlag{
+		Name:    "client-id",
+		Usage:   "Client ID of a live credential, to authenticate with a local Connector",
+		EnvVars: []string{"OAUTH2_CLIENT_ID"},
+	},
+	&cli.StringFlag{
+		Name:    "client-secret",
+		Usage:   "Client secret of a live credential, to authenticate with a local Connector",
+		EnvVars: []string{"OAUTH2_CLIENT_SECRET"},
+	},
+}
+
+var credentialFlags = append([]cli.Flag{
 	&cli.StringFlag{
 		Name:  "provider",
 		Usage: "The label of the provider to rotate the credentials for",
 	},
-}
+}, localConnectorFlags...)
 
 func init() {
 	cmd := &cli.Command{
@@ -66,6 +86,7 @@ func init() {
 				Name:      "delete",
 				ArgsUsage: "id",
 				Usage:     "Delete a credential",
+				Flags:     localConnectorFlags,
 				Action:    deleteCredentialsCmd,
 			},
 		},
@@ -77,19 +98,9 @@ func init() {
 func createCredentialsCmd(cliCtx *cli.Context) error {
 	ctx := context.Background()
 
-	client, token, err := login(ctx)
+	connector, providerID, err := credentialsConnector(ctx, cliCtx, true)
 	if err != nil {
-		return cli.NewExitError(err.Error(), -1)
-	}
-
-	provider, err := findProvider(ctx, cliCtx, client)
-	if err != nil {
-		return cli.NewExitError("Failed to find product: "+err.Error(), -1)
-	}
-
-	connector, err := NewConnector(token)
-	if err != nil {
-		return cli.NewExitError("Failed to create connector client: "+err.Error(), -1)
+		return err
 	}
 
 	params := o_auth.NewPostCredentialsParamsWithContext(ctx)
@@ -97,7 +108,7 @@ func createCredentialsCmd(cliCtx *cli.Context) error {
 
 	body := &models.OAuthCredentialCreateRequest{
 		Description: &desc,
-		ProviderID:  &provider.ID,
+		ProviderID:  providerID,
 	}
 	params.SetBody(body)
 
@@ -119,24 +130,16 @@ func createCredentialsCmd(cliCtx *cli.Context) error {
 func listCredentialsCmd(cliCtx *cli.Context) error {
 	ctx := context.Background()
 
-	client, token, err := login(ctx)
+	connector, providerID, err := credentialsConnector(ctx, cliCtx, true)
 	if err != nil {
-		return cli.NewExitError(err.Error(), -1)
-	}
-
-	provider, err := findProvider(ctx, cliCtx, client)
-	if err != nil {
-		return cli.NewExitError("Failed to find provider "+err.Error(), -1)
-	}
-
-	connector, err := NewConnector(token)
-	if err != nil {
-		return cli.NewExitError("Failed to create connector client "+err.Error(), -1)
+		return err
 	}
 
 	params := o_auth.NewGetCredentialsParamsWithContext(ctx)
-	pID := provider.ID.String()
-	params.SetProviderID(&pID)
+	if providerID != nil {
+		pID := providerID.String()
+		params.SetProviderID(&pID)
+	}
 
 	res, err := connector.OAuth.GetCredentials(params, nil)
 	if err != nil {
@@ -178,19 +181,14 @@ func deleteCredentialsCmd(cliCtx *cli.Context) error {
 
 	id := args.First()
 
-	_, token, err := login(ctx)
+	connector, _, err := credentialsConnector(ctx, cliCtx, false)
 	if err != nil {
-		return cli.NewExitError(err.Error(), -1)
+		return err
 	}
 
 	params := o_auth.NewDeleteCredentialsIDParamsWithContext(ctx)
 	params.SetID(id)
 
-	connector, err := NewConnector(token)
-	if err != nil {
-		return cli.NewExitError("Failed to create connector client: "+err.Error(), -1)
-	}
-
 	_, err = connector.OAuth.DeleteCredentialsID(params, nil)
 	if err != nil {
 		return cli.NewExitError("Failed to delete credential "+err.Error(), -1)
@@ -201,6 +199,80 @@ func deleteCredentialsCmd(cliCtx *cli.Context) error {
 	return nil
 }
 
+// credentialsConnector returns a client for the connector managing the
+// credentials, and the ID of the provider they belong to if asked for.
+//
+// With --connector-port, a local fake Connector is used instead of Manifold.
+// It has no users to log in as, so a live credential authenticates instead,
+// and credentials are not scoped to a provider.
+func credentialsConnector(ctx context.Context, cliCtx *cli.Context, withProvider bool) (*client.Connector, *manifold.ID, error) {
+	if cliCtx.IsSet("connector-port") {
+		u := deriveConnectorURL(cliCtx.Uint("connector-port"))
+		token, err := localConnectorToken(ctx, u, cliCtx.String("client-id"), cliCtx.String("client-secret"))
+		if err != nil {
+			return nil, nil, cli.NewExitError("Failed to authenticate with the local connector: "+err.Error(), -1)
+		}
+
+		return newConnectorClient(u, token), nil, nil
+	}
+
+	mClient, token, err := login(ctx)
+	if err != nil {
+		return nil, nil, cli.NewExitError(err.Error(), -1)
+	}
+
+	var providerID *manifold.ID
+	if withProvider {
+		provider, err := findProvider(ctx, cliCtx, mClient)
+		if err != nil {
+			return nil, nil, cli.NewExitError("Failed to find provider: "+err.Error(), -1)
+		}
+		providerID = &provider.ID
+	}
+
+	connector, err := NewConnector(token)
+	if err != nil {
+		return nil, nil, cli.NewExitError("Failed to create connector client: "+err.Error(), -1)
+	}
+
+	return connector, providerID, nil
+}
+
+// localConnectorToken exchanges a client id and secret for an access token
+// granted by a local fake Connector.
+func localConnectorToken(ctx context.Context, u *url.URL, clientID, clientSecret string) (string, error) {
+	if clientID == "" || clientSecret == "" {
+		return "", errors.New("--client-id and --client-secret are required")
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequest("POST", u.String()+"/oauth/tokens", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, clientSecret)
+
+	rsp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("received status code %d", rsp.StatusCode)
+	}
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(rsp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
 // NewConnector creates a new connector client with the provided 'token'
 func NewConnector(token string) (*client.Connector, error) {
 	u, err := url.Parse(fmt.Sprintf(apiURLPattern(), "connector"))
@@ -208,6 +280,10 @@ func NewConnector(token string) (*client.Connector, error) {
 		return nil, err
 	}
 
+	return newConnectorClient(u, token), nil
+}
+
+func newConnectorClient(u *url.URL, token string) *client.Connector {
 	c := client.DefaultTransportConfig()
 	c.WithHost(u.Host)
 	c.WithBasePath(u.Path)
@@ -217,7 +293,7 @@ func NewConnector(token string) (*client.Connector, error) {
 
 	transport.DefaultAuthentication = httptransport.BearerToken(token)
 
-	return client.New(transport, strfmt.Default), nil
+	return client.New(transport, strfmt.Default)
 }
 
 func login(ctx context.Context) (*manifold.Client, string, error) {
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/manifoldco/grafton/exampleprovider"
+	"github.com/manifoldco/grafton/verify"
+)
+
+func init() {
+	cmd := &cli.Command{
+		Name:   "example-provider",
+		Usage:  "Serves an example provider implementing the provider API, which passes grafton test",
+		Action: exampleProviderCmd,
+		Flags: []cli.Flag{
+			&cli.UintFlag{
+				Name:    "port",
+				Usage:   "Local port to serve the provider API on",
+				EnvVars: []string{"PORT"},
+				Value:   3000,
+			},
+			&cli.StringFlag{
+				Name:    "product",
+				Usage:   "The label of the product resources can be provisioned for",
+				EnvVars: []string{"PRODUCT"},
+				Value:   "bonnets",
+			},
+			&cli.StringSliceFlag{
+				Name:    "plan",
+				Usage:   "The labels of the plans resources can be provisioned with",
+				EnvVars: []string{"PLAN"},
+				Value:   cli.NewStringSlice("small", "large"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "region",
+				Usage:   "The labels of the regions resources can be provisioned in",
+				EnvVars: []string{"REGION"},
+				Value:   cli.NewStringSlice("aws::us-east-1"),
+			},
+			&cli.StringFlag{
+				Name:    "client-id",
+				Usage:   "Client ID to authenticate with the Connector API for SSO and callbacks",
+				EnvVars: []string{"OAUTH2_CLIENT_ID"},
+			},
+			&cli.StringFlag{
+				Name:    "client-secret",
+				Usage:   "Client secret to authenticate with the Connector API for SSO and callbacks",
+				EnvVars: []string{"OAUTH2_CLIENT_SECRET"},
+			},
+			&cli.UintFlag{
+				Name:    "connector-port",
+				Usage:   "Local port of the fake Connector API started by grafton test or grafton serve",
+				EnvVars: []string{"CONNECTOR_PORT"},
+				Value:   3001,
+			},
+			&cli.BoolFlag{
+				Name:    "async",
+				Usage:   "Complete requests through callbacks to the Connector, instead of right away",
+				EnvVars: []string{"ASYNC"},
+			},
+			&cli.DurationFlag{
+				Name:    "callback-delay",
+				Usage:   "Time to wait before completing a request through its callback",
+				EnvVars: []string{"CALLBACK_DELAY"},
+			},
+			&cli.StringFlag{
+				Name:    "behavior",
+				Usage:   "Simulate a faulty provider: correct, fail, slow, wrong-status, missing-message, no-backoff, conflicting-callbacks, stale-requests or trusting-sso",
+				EnvVars: []string{"BEHAVIOR"},
+				Value:   string(exampleprovider.BehaviorCorrect),
+			},
+			&cli.DurationFlag{
+				Name:    "latency",
+				Usage:   "Time to wait before handling each request when the behavior is slow",
+				EnvVars: []string{"LATENCY"},
+				Value:   5 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:    "rotate-after",
+				Usage:   "Rotate every credential set through the Connector once provisioned for this long (default: never)",
+				EnvVars: []string{"ROTATE_AFTER"},
+			},
+			&cli.StringFlag{
+				Name:  "resource-measures",
+				Usage: "Measures map to report as the usage of every resource",
+				Value: `{"feature-a": 0, "feature-b": 1000}`,
+			},
+			keyringFlag,
+		},
+	}
+
+	cmds = append(cmds, cmd)
+}
+
+func exampleProviderCmd(ctx *cli.Context) error {
+	masterKey, otherKeys, err := verifyingKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	var measures map[string]int64
+	if m := ctx.String("resource-measures"); m != "" {
+		if err := json.Unmarshal([]byte(m), &measures); err != nil {
+			return cli.NewExitError("The supplied resource-measures does not appear to be valid JSON: "+err.Error(), -1)
+		}
+	}
+
+	behavior := exampleprovider.Behavior(ctx.String("behavior"))
+	if !behavior.Valid() {
+		return cli.NewExitError("Unknown behavior: "+string(behavior), -1)
+	}
+
+	clientID := ctx.String("client-id")
+	clientSecret := ctx.String("client-secret")
+	if clientID == "" || clientSecret == "" {
+		fmt.Println("'client-id' and 'client-secret' were not defined; single sign-on and callbacks will fail")
+	}
+
+	p := exampleprovider.New(exampleprovider.Config{
+		Port:          ctx.Uint("port"),
+		Product:       ctx.String("product"),
+		Plans:         ctx.StringSlice("plan"),
+		Regions:       ctx.StringSlice("region"),
+		MasterKey:     masterKey,
+		ConnectorURL:  deriveConnectorURL(ctx.Uint("connector-port")),
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		Async:         ctx.Bool("async"),
+		CallbackDelay: ctx.Duration("callback-delay"),
+		RotateAfter:   ctx.Duration("rotate-after"),
+		Measures:      measures,
+		Behavior:      behavior,
+		Latency:       ctx.Duration("latency"),
+		Log:           logrus.NewEntry(logrus.StandardLogger()),
+
+		OtherMasterKeys: otherKeys,
+	})
+
+	fmt.Printf("Serving the %s product with plans %s in regions %s\n", p.Config.Product,
+		strings.Join(p.Config.Plans, ", "), strings.Join(p.Config.Regions, ", "))
+	if behavior != exampleprovider.BehaviorCorrect {
+		fmt.Printf("Simulating a faulty provider: %s\n", behavior)
+	}
+	if len(otherKeys) > 0 {
+		fmt.Printf("Accepting requests endorsed by %d master keys\n", len(otherKeys)+1)
+	}
+	fmt.Printf("Starting example provider on http://localhost:%d\n", p.Config.Port)
+	if err := p.StartSync(); err != nil {
+		return cli.NewExitError("Could not serve the example provider: "+err.Error(), -1)
+	}
+
+	return nil
+}
+
+// verifyingKeys returns the master keys requests are verified against: the
+// keyring's current key along with its other keys which haven't retired, or
+// the one in masterkey.json if the keyring has none.
+func verifyingKeys(ctx *cli.Context) (ed25519.PublicKey, []ed25519.PublicKey, error) {
+	r := &keyring{dir: ctx.String("keyring")}
+
+	current, err := r.current()
+	switch {
+	case err == errNoCurrentKey:
+		keyFile, err := getKeyFilePath()
+		if err != nil {
+			return nil, nil, cli.NewExitError("Could not determine working directory: "+err.Error(), -1)
+		}
+
+		if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+			return nil, nil, cli.NewExitError(
+				"Master key file does not exist; generate one using 'grafton generate'", -1)
+		}
+
+		masterKey, err := verify.LoadMasterKey(keyFile)
+		if err != nil {
+			return nil, nil, cli.NewExitError("Could not load master key file: "+err.Error(), -1)
+		}
+
+		return masterKey, nil, nil
+	case err != nil:
+		return nil, nil, cli.NewExitError("Could not load master key: "+err.Error(), -1)
+	}
+
+	keys, err := r.keys()
+	if err != nil {
+		return nil, nil, cli.NewExitError("Could not read the keyring: "+err.Error(), -1)
+	}
+
+	var others []ed25519.PublicKey
+	now := time.Now()
+	for _, k := range keys {
+		if k.ID != current.ID && k.valid(now) {
+			others = append(others, k.PublicKey)
+		}
+	}
+
+	return current.PublicKey, others, nil
+}
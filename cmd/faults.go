@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+
+	"github.com/manifoldco/grafton/connector"
+)
+
+// faultFlag injects faults into the fake Connector started by grafton test and
+// grafton serve.
+var faultFlag = &cli.StringSliceFlag{
+	Name: "fault",
+	Usage: "Inject a fault into the fake Connector's responses, such as " +
+		"'route=/v1/callbacks/{id},status=503,rate=0.5' or 'status=429,retry-after=5s,count=3'",
+	EnvVars: []string{"FAULT"},
+}
+
+// parseFaults returns the faults passed through faultFlag.
+func parseFaults(ctx *cli.Context) ([]connector.Fault, error) {
+	var faults []connector.Fault
+	for _, s := range ctx.StringSlice("fault") {
+		f, err := connector.ParseFault(s)
+		if err != nil {
+			return nil, cli.NewExitError("Invalid fault '"+s+"': "+err.Error(), -1)
+		}
+
+		faults = append(faults, f)
+	}
+
+	return faults, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/urfave/cli/v2"
 )
@@ -11,6 +12,12 @@ func init() {
 		Name:   "generate",
 		Usage:  "Generates public and private signing keys for testing Manifold API integrations locally",
 		Action: generateCmd,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Overwrite an existing masterkey.json",
+			},
+		},
 	}
 
 	cmds = append(cmds, cmd)
@@ -22,6 +29,11 @@ func generateCmd(ctx *cli.Context) error {
 		return cli.NewExitError("Could not determine working directory: "+err.Error(), -1)
 	}
 
+	if _, err := os.Stat(keyFile); err == nil && !ctx.Bool("force") {
+		return cli.NewExitError("Master key file already exists; pass --force to overwrite it, "+
+			"or use 'grafton keys rotate' to replace keys while keeping the old one valid", -1)
+	}
+
 	fmt.Println("Generating Master Keypair")
 	k, err := newKeypair()
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 
 	"golang.org/x/crypto/ed25519"
 
@@ -18,7 +19,7 @@ import (
 // Live Keypairs which sign HTTP Requests
 type keypair struct {
 	PublicKey  ed25519.PublicKey  `json:"public_key"`
-	PrivateKey ed25519.PrivateKey `json:"private_key"`
+	PrivateKey ed25519.PrivateKey `json:"private_key,omitempty"`
 }
 
 // liveKeypair represents an endorsed keypair used for signing requests
@@ -83,14 +84,45 @@ func loadKeypair(file string) (*keypair, error) {
 	return k, err
 }
 
-// Save writes the Keypair to a file in JSON
+// Save writes the Keypair to a file in JSON, readable by its owner alone
 func (k *keypair) save(file string) error {
 	b, err := json.Marshal(k)
 	if err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(file, b, 0644)
+	return writePrivateFile(file, b)
+}
+
+// writePrivateFile writes a file readable by its owner alone, even if it
+// already existed with wider permissions. It's written to a new file which is
+// then renamed over it, so its contents are never readable by others, nor
+// left truncated by a failed write.
+func writePrivateFile(file string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return err
+	}
+
+	tmp := f.Name()
+	err = f.Chmod(0600)
+	if err == nil {
+		_, err = f.Write(b)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+
+	return err
 }
 
 // LiveKeypair creates and endorses a Keypair for signing requests
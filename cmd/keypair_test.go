@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	nurl "net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	gm "github.com/onsi/gomega"
+
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/idtype"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/verify"
+)
+
+// verifyingProvider is a provider which verifies every request it receives,
+// recording the result.
+type verifyingProvider struct {
+	v *verify.Verifier
+
+	mu     sync.Mutex
+	errors []error
+}
+
+func (p *verifyingProvider) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	err := p.v.Verify(r)
+
+	p.mu.Lock()
+	p.errors = append(p.errors, err)
+	p.mu.Unlock()
+
+	if err != nil {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write([]byte(`{"message":"provisioned"}`))
+	default:
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (p *verifyingProvider) results() []error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]error(nil), p.errors...)
+}
+
+func newID(t idtype.Type) manifold.ID {
+	id, err := manifold.NewID(t)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	return id
+}
+
+func TestLiveKeypairVerifies(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "grafton-keypair")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	k, err := newKeypair()
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	file := filepath.Join(dir, "masterkey.json")
+	gm.Expect(k.save(file)).To(gm.Succeed())
+
+	masterKey, err := verify.LoadMasterKey(file)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	newClient := func(t *testing.T, signer grafton.Signer) (*grafton.Client, *verifyingProvider, func()) {
+		p := &verifyingProvider{v: verify.New(masterKey)}
+		srv := httptest.NewServer(p)
+
+		u, err := nurl.Parse(srv.URL + "/v1")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		cu, err := nurl.Parse("http://connector.test/v1")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		return grafton.NewClient(grafton.ClientOptions{
+			URL:          u,
+			ConnectorURL: cu,
+			Signer:       signer,
+		}), p, srv.Close
+	}
+
+	t.Run("requests signed by an endorsed live key verify", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		lkp, err := k.liveKeypair()
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		c, p, done := newClient(t, lkp)
+		defer done()
+
+		ctx := context.Background()
+		resID := newID(idtype.Resource)
+
+		_, _, err = c.ProvisionResource(ctx, newID(idtype.Callback), grafton.ResourceBody{
+			ID:      resID,
+			Product: "product",
+			Plan:    "plan",
+			Region:  "aws::us-east-1",
+		})
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		_, err = c.PullResourceMeasures(ctx, resID, time.Now().Add(-time.Hour), time.Now())
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		_, _, err = c.DeprovisionResource(ctx, newID(idtype.Callback), resID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		gm.Expect(p.results()).To(gm.Equal([]error{nil, nil, nil}))
+	})
+
+	t.Run("requests signed by an unendorsed key are rejected", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		lkp, err := emptyKeypair()
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		c, p, done := newClient(t, lkp)
+		defer done()
+
+		_, err = c.PullResourceMeasures(context.Background(), newID(idtype.Resource), time.Now().Add(-time.Hour), time.Now())
+		gm.Expect(err).To(gm.HaveOccurred())
+
+		gm.Expect(p.results()).To(gm.Equal([]error{verify.ErrUnendorsedKey}))
+	})
+}
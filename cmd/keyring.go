@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// defaultKeyringDir is where master keys are kept, relative to the working
+// directory, unless another keyring is given with --keyring.
+const defaultKeyringDir = ".grafton/keys"
+
+// currentKeyFile holds the ID of the keyring's current key, which endorses
+// live keypairs unless another one is picked.
+const currentKeyFile = "current"
+
+var (
+	errKeyNotFound     = errors.New("no such key in the keyring")
+	errNoCurrentKey    = errors.New("the keyring has no current key")
+	errWrongPassphrase = errors.New("wrong passphrase for the key")
+	errKeyNotEncrypted = errors.New("the key is not encrypted")
+)
+
+// ringKey is a master keypair kept in a keyring, identified by an ID derived
+// from its public key. Its private key may be encrypted with a passphrase, in
+// which case it must be decrypted before endorsing live keypairs.
+//
+// Key files share the public_key field of masterkey.json, so
+// verify.LoadMasterKey can read them.
+type ringKey struct {
+	keypair
+	ID        string        `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	RetiresAt *time.Time    `json:"retires_at,omitempty"`
+	Encrypted *encryptedKey `json:"encrypted_private_key,omitempty"`
+}
+
+// encryptedKey is a private key sealed with a key derived from a passphrase
+// through scrypt.
+type encryptedKey struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Box   []byte `json:"box"`
+}
+
+// keyID returns the ID of the master key with the given public key: the
+// first 8 bytes of its SHA-256 hash, in hex.
+func keyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// newRingKey generates a new master keypair, created at the given time.
+func newRingKey(now time.Time) (*ringKey, error) {
+	k, err := newKeypair()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ringKey{keypair: *k, ID: keyID(k.PublicKey), CreatedAt: now.UTC().Truncate(time.Second)}, nil
+}
+
+// valid returns whether the key can still endorse live keypairs at the given
+// time, which it can until it retires.
+func (k *ringKey) valid(now time.Time) bool {
+	return k.RetiresAt == nil || now.Before(*k.RetiresAt)
+}
+
+// encrypt replaces the private key with one encrypted with the passphrase.
+func (k *ringKey) encrypt(passphrase string) error {
+	e := &encryptedKey{Salt: make([]byte, 16), Nonce: make([]byte, 24)}
+	if _, err := rand.Read(e.Salt); err != nil {
+		return err
+	}
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return err
+	}
+
+	secret, err := deriveSecret(passphrase, e.Salt)
+	if err != nil {
+		return err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], e.Nonce)
+	e.Box = secretbox.Seal(nil, k.PrivateKey, &nonce, secret)
+
+	k.Encrypted = e
+	k.PrivateKey = nil
+	return nil
+}
+
+// decrypt decrypts the private key with the passphrase. The key is left
+// encrypted on disk.
+func (k *ringKey) decrypt(passphrase string) error {
+	if k.Encrypted == nil {
+		return errKeyNotEncrypted
+	}
+
+	secret, err := deriveSecret(passphrase, k.Encrypted.Salt)
+	if err != nil {
+		return err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], k.Encrypted.Nonce)
+	priv, ok := secretbox.Open(nil, k.Encrypted.Box, &nonce, secret)
+	if !ok || len(priv) != ed25519.PrivateKeySize {
+		return errWrongPassphrase
+	}
+
+	k.PrivateKey = ed25519.PrivateKey(priv)
+	return nil
+}
+
+func deriveSecret(passphrase string, salt []byte) (*[32]byte, error) {
+	b, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret [32]byte
+	copy(secret[:], b)
+	return &secret, nil
+}
+
+// keyring is a directory of master keys, one file per key, readable by its
+// owner alone.
+type keyring struct {
+	dir string
+}
+
+func (r *keyring) path(id string) string {
+	return filepath.Join(r.dir, id+".json")
+}
+
+// keys returns every key of the keyring, oldest first. A keyring which
+// doesn't exist yet has no keys.
+func (r *keyring) keys() ([]*ringKey, error) {
+	files, err := ioutil.ReadDir(r.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*ringKey
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+
+		k, err := r.get(strings.TrimSuffix(f.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// get returns the key with the given ID.
+func (r *keyring) get(id string) (*ringKey, error) {
+	if b, err := hex.DecodeString(id); err != nil || len(b) != 8 {
+		return nil, errKeyNotFound
+	}
+
+	b, err := ioutil.ReadFile(r.path(id))
+	if os.IsNotExist(err) {
+		return nil, errKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	k := &ringKey{}
+	if err := json.Unmarshal(b, k); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// save writes the key to the keyring, creating the keyring if needed.
+func (r *keyring) save(k *ringKey) error {
+	b, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return r.write(r.path(k.ID), b)
+}
+
+// current returns the key which endorses live keypairs by default.
+func (r *keyring) current() (*ringKey, error) {
+	b, err := ioutil.ReadFile(filepath.Join(r.dir, currentKeyFile))
+	if os.IsNotExist(err) {
+		return nil, errNoCurrentKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.get(strings.TrimSpace(string(b)))
+}
+
+// setCurrent makes the key with the given ID the current one.
+func (r *keyring) setCurrent(id string) error {
+	return r.write(filepath.Join(r.dir, currentKeyFile), []byte(id+"\n"))
+}
+
+// importKeypair adds a master keypair kept outside the keyring, such as the
+// one in masterkey.json, to the keyring as its current key, so it can be
+// rotated like the keyring's own keys.
+func (r *keyring) importKeypair(kp *keypair, now time.Time) (*ringKey, error) {
+	k := &ringKey{keypair: *kp, ID: keyID(kp.PublicKey), CreatedAt: now.UTC().Truncate(time.Second)}
+	if err := r.save(k); err != nil {
+		return nil, err
+	}
+
+	return k, r.setCurrent(k.ID)
+}
+
+// rotate makes the given key the current one, and retires the key it
+// replaces once the overlap has passed, so requests endorsed by either are
+// valid until then.
+func (r *keyring) rotate(k *ringKey, overlap time.Duration, now time.Time) (*ringKey, error) {
+	old, err := r.current()
+	if err != nil && err != errNoCurrentKey {
+		return nil, err
+	}
+
+	if err := r.save(k); err != nil {
+		return nil, err
+	}
+
+	if old != nil {
+		retires := now.Add(overlap).UTC().Truncate(time.Second)
+		if old.RetiresAt == nil || retires.Before(*old.RetiresAt) {
+			old.RetiresAt = &retires
+		}
+
+		if err := r.save(old); err != nil {
+			return nil, err
+		}
+	}
+
+	return old, r.setCurrent(k.ID)
+}
+
+// write writes a file of the keyring, leaving it readable by its owner alone
+// even if it already existed with wider permissions.
+func (r *keyring) write(file string, b []byte) error {
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		return err
+	}
+
+	return writePrivateFile(file, b)
+}
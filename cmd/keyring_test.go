@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gm "github.com/onsi/gomega"
+
+	"github.com/manifoldco/grafton/verify"
+)
+
+func TestKeyring(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "grafton-keyring")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("keeps keys readable by their owner alone", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		r := &keyring{dir: filepath.Join(dir, "private")}
+
+		k, err := newRingKey(now)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(r.save(k)).To(gm.Succeed())
+
+		info, err := os.Stat(r.dir)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(info.Mode().Perm()).To(gm.Equal(os.FileMode(0700)))
+
+		info, err = os.Stat(r.path(k.ID))
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(info.Mode().Perm()).To(gm.Equal(os.FileMode(0600)))
+
+		pub, err := verify.LoadMasterKey(r.path(k.ID))
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(pub).To(gm.Equal(k.PublicKey))
+	})
+
+	t.Run("replaces files which were readable by others", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		r := &keyring{dir: filepath.Join(dir, "widened")}
+
+		k, err := newRingKey(now)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(os.MkdirAll(r.dir, 0700)).To(gm.Succeed())
+		gm.Expect(ioutil.WriteFile(r.path(k.ID), []byte("{}"), 0644)).To(gm.Succeed())
+		gm.Expect(os.Chmod(r.path(k.ID), 0644)).To(gm.Succeed())
+
+		gm.Expect(r.save(k)).To(gm.Succeed())
+
+		info, err := os.Stat(r.path(k.ID))
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(info.Mode().Perm()).To(gm.Equal(os.FileMode(0600)))
+
+		loaded, err := r.get(k.ID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(loaded.PrivateKey).To(gm.Equal(k.PrivateKey))
+
+		files, err := ioutil.ReadDir(r.dir)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(files).To(gm.HaveLen(1))
+	})
+
+	t.Run("encrypts private keys with a passphrase", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		r := &keyring{dir: filepath.Join(dir, "encrypted")}
+
+		k, err := newRingKey(now)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		priv := k.PrivateKey
+
+		gm.Expect(k.encrypt("correct horse")).To(gm.Succeed())
+		gm.Expect(r.save(k)).To(gm.Succeed())
+
+		b, err := ioutil.ReadFile(r.path(k.ID))
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(string(b)).ToNot(gm.ContainSubstring(`"private_key"`))
+
+		loaded, err := r.get(k.ID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(loaded.decrypt("battery staple")).To(gm.Equal(errWrongPassphrase))
+		gm.Expect(loaded.decrypt("correct horse")).To(gm.Succeed())
+		gm.Expect(loaded.PrivateKey).To(gm.Equal(priv))
+	})
+
+	t.Run("rotates the current key, keeping the old one valid for the overlap", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		r := &keyring{dir: filepath.Join(dir, "rotated")}
+
+		_, err := r.current()
+		gm.Expect(err).To(gm.Equal(errNoCurrentKey))
+
+		first, err := newRingKey(now)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		old, err := r.rotate(first, time.Hour, now)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(old).To(gm.BeNil())
+
+		second, err := newRingKey(now.Add(time.Minute))
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		old, err = r.rotate(second, time.Hour, now.Add(time.Minute))
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(old.ID).To(gm.Equal(first.ID))
+
+		current, err := r.current()
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(current.ID).To(gm.Equal(second.ID))
+
+		keys, err := r.keys()
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(keys).To(gm.HaveLen(2))
+		gm.Expect(keys[0].ID).To(gm.Equal(first.ID))
+		gm.Expect(*keys[0].RetiresAt).To(gm.Equal(now.Add(time.Hour + time.Minute)))
+
+		gm.Expect(keys[0].valid(now.Add(time.Hour))).To(gm.BeTrue())
+		gm.Expect(keys[0].valid(now.Add(2 * time.Hour))).To(gm.BeFalse())
+		gm.Expect(keys[1].valid(now.Add(2 * time.Hour))).To(gm.BeTrue())
+	})
+
+	t.Run("keeps an imported masterkey.json valid for the first rotation's overlap", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		r := &keyring{dir: filepath.Join(dir, "imported")}
+
+		file := filepath.Join(dir, "masterkey.json")
+		mk, err := newKeypair()
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(mk.save(file)).To(gm.Succeed())
+
+		loaded, err := loadKeypair(file)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		imported, err := r.importKeypair(loaded, now)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(imported.ID).To(gm.Equal(keyID(mk.PublicKey)))
+
+		next, err := newRingKey(now)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		old, err := r.rotate(next, time.Hour, now)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(old.ID).To(gm.Equal(imported.ID))
+		gm.Expect(*old.RetiresAt).To(gm.Equal(now.Add(time.Hour)))
+
+		k, err := r.get(imported.ID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(k.PrivateKey).To(gm.Equal(mk.PrivateKey))
+		gm.Expect(k.valid(now.Add(time.Minute))).To(gm.BeTrue())
+
+		current, err := r.current()
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(current.ID).To(gm.Equal(next.ID))
+	})
+
+	t.Run("only reads keys by their ID", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		r := &keyring{dir: filepath.Join(dir, "private")}
+
+		_, err := r.get("../" + strings.Repeat("0", 16))
+		gm.Expect(err).To(gm.Equal(errKeyNotFound))
+
+		_, err = r.get(strings.Repeat("0", 16))
+		gm.Expect(err).To(gm.Equal(errKeyNotFound))
+	})
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ed25519"
+)
+
+const defaultOverlap = 24 * time.Hour
+
+var keyringFlag = &cli.StringFlag{
+	Name:    "keyring",
+	Usage:   "Directory holding the master keys managed with grafton keys",
+	EnvVars: []string{"GRAFTON_KEYRING"},
+	Value:   defaultKeyringDir,
+}
+
+var passphraseFlag = &cli.StringFlag{
+	Name:    "passphrase",
+	Usage:   "Passphrase of encrypted master keys (default: prompted for)",
+	EnvVars: []string{"GRAFTON_KEY_PASSPHRASE"},
+}
+
+var encryptFlag = &cli.BoolFlag{
+	Name:  "encrypt",
+	Usage: "Encrypt the private key with a passphrase",
+}
+
+// masterKeyFlags pick the master key which endorses the live keypairs
+// requests are signed with.
+var masterKeyFlags = []cli.Flag{
+	keyringFlag,
+	&cli.StringFlag{
+		Name:    "master-key",
+		Usage:   "ID of the keyring's master key to sign with (default: its current key, or masterkey.json if it has none)",
+		EnvVars: []string{"GRAFTON_MASTER_KEY"},
+	},
+	passphraseFlag,
+}
+
+func init() {
+	cmd := &cli.Command{
+		Name:  "keys",
+		Usage: "Manage the master keys which endorse the keys requests are signed with",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "generate",
+				Usage:  "Generates a master key, which becomes the current one if the keyring has none",
+				Flags:  []cli.Flag{keyringFlag, encryptFlag, passphraseFlag},
+				Action: generateKeyCmd,
+			},
+			{
+				Name:   "list",
+				Usage:  "Lists the master keys of the keyring",
+				Flags:  []cli.Flag{keyringFlag},
+				Action: listKeysCmd,
+			},
+			{
+				Name:  "rotate",
+				Usage: "Generates a master key to replace the current one, which stays valid for an overlap",
+				Flags: []cli.Flag{
+					keyringFlag,
+					&cli.DurationFlag{
+						Name:  "overlap",
+						Usage: "How long the replaced master key stays valid for",
+						Value: defaultOverlap,
+					},
+					encryptFlag,
+					passphraseFlag,
+				},
+				Action: rotateKeyCmd,
+			},
+			{
+				Name:      "export",
+				ArgsUsage: "[id]",
+				Usage:     "Exports the public part of a master key (default: the current one), for providers to verify requests with",
+				Flags: []cli.Flag{
+					keyringFlag,
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "File to write the public key to, instead of the standard output",
+					},
+				},
+				Action: exportKeyCmd,
+			},
+		},
+	}
+
+	cmds = append(cmds, cmd)
+}
+
+// publicKey is the public part of a master key, as exported. It can be read
+// with verify.LoadMasterKey.
+type publicKey struct {
+	ID        string            `json:"id"`
+	PublicKey ed25519.PublicKey `json:"public_key"`
+	RetiresAt *time.Time        `json:"retires_at,omitempty"`
+}
+
+func generateKeyCmd(ctx *cli.Context) error {
+	r := &keyring{dir: ctx.String("keyring")}
+
+	k, err := newEncryptedRingKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := r.save(k); err != nil {
+		return cli.NewExitError("Could not write to the keyring: "+err.Error(), -1)
+	}
+
+	_, err = r.current()
+	switch err {
+	case errNoCurrentKey:
+		if err := r.setCurrent(k.ID); err != nil {
+			return cli.NewExitError("Could not write to the keyring: "+err.Error(), -1)
+		}
+		fmt.Printf("Generated master key %s, which is now the current key\n", k.ID)
+	case nil:
+		fmt.Printf("Generated master key %s; sign with it with --master-key %s\n", k.ID, k.ID)
+	default:
+		return cli.NewExitError("Could not read the keyring: "+err.Error(), -1)
+	}
+
+	return nil
+}
+
+func rotateKeyCmd(ctx *cli.Context) error {
+	r := &keyring{dir: ctx.String("keyring")}
+
+	// While the keyring is empty, requests are signed with the key in
+	// masterkey.json, which must stay valid for the overlap too.
+	_, err := r.current()
+	switch err {
+	case errNoCurrentKey:
+		keyFile, err := getKeyFilePath()
+		if err != nil {
+			return cli.NewExitError("Could not determine working directory: "+err.Error(), -1)
+		}
+
+		if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+			return cli.NewExitError(
+				"The keyring has no current key to rotate; generate one using 'grafton keys generate'", -1)
+		}
+
+		mk, err := loadKeypair(keyFile)
+		if err != nil {
+			return cli.NewExitError("Could not load master key file: "+err.Error(), -1)
+		}
+
+		imported, err := r.importKeypair(mk, time.Now())
+		if err != nil {
+			return cli.NewExitError("Could not write to the keyring: "+err.Error(), -1)
+		}
+		fmt.Printf("Imported master key %s from %s\n", imported.ID, keyFile)
+	case nil:
+	default:
+		return cli.NewExitError("Could not read the keyring: "+err.Error(), -1)
+	}
+
+	k, err := newEncryptedRingKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	old, err := r.rotate(k, ctx.Duration("overlap"), time.Now())
+	if err != nil {
+		return cli.NewExitError("Could not rotate the master key: "+err.Error(), -1)
+	}
+
+	fmt.Printf("Generated master key %s, which is now the current key\n", k.ID)
+	if old != nil {
+		fmt.Printf("Master key %s stays valid until %s\n", old.ID, old.RetiresAt.Format("2006-01-02 15:04:05 MST"))
+	}
+
+	return nil
+}
+
+func listKeysCmd(ctx *cli.Context) error {
+	r := &keyring{dir: ctx.String("keyring")}
+
+	keys, err := r.keys()
+	if err != nil {
+		return cli.NewExitError("Could not read the keyring: "+err.Error(), -1)
+	}
+
+	current, err := r.current()
+	if err != nil && err != errNoCurrentKey {
+		return cli.NewExitError("Could not read the keyring: "+err.Error(), -1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 8, ' ', 0)
+
+	fmt.Fprintln(w, "ID\tCreated\tRetires\tStatus")
+
+	now := time.Now()
+	for _, k := range keys {
+		retires := "-"
+		if k.RetiresAt != nil {
+			retires = k.RetiresAt.Format("2006-01-02 15:04:05 MST")
+		}
+
+		status := "valid"
+		switch {
+		case current != nil && k.ID == current.ID:
+			status = "current"
+		case !k.valid(now):
+			status = "retired"
+		}
+		if k.Encrypted != nil {
+			status += ", encrypted"
+		}
+
+		created := k.CreatedAt.Format("2006-01-02 15:04:05 MST")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", k.ID, created, retires, status)
+	}
+
+	w.Flush()
+
+	return nil
+}
+
+func exportKeyCmd(ctx *cli.Context) error {
+	r := &keyring{dir: ctx.String("keyring")}
+
+	var k *ringKey
+	var err error
+	if id := ctx.Args().First(); id != "" {
+		k, err = r.get(id)
+	} else {
+		k, err = r.current()
+	}
+	if err != nil {
+		return cli.NewExitError("Could not load master key: "+err.Error(), -1)
+	}
+
+	b, err := json.MarshalIndent(publicKey{ID: k.ID, PublicKey: k.PublicKey, RetiresAt: k.RetiresAt}, "", "  ")
+	if err != nil {
+		return cli.NewExitError("Could not export master key: "+err.Error(), -1)
+	}
+
+	out := ctx.String("output")
+	if out == "" {
+		fmt.Println(string(b))
+		return nil
+	}
+
+	if err := ioutil.WriteFile(out, append(b, '\n'), 0644); err != nil {
+		return cli.NewExitError("Could not write to file: "+err.Error(), -1)
+	}
+
+	fmt.Printf("Wrote the public key of master key %s to %s\n", k.ID, out)
+	return nil
+}
+
+// newEncryptedRingKey generates a master key, encrypted with a passphrase if
+// --encrypt was given.
+func newEncryptedRingKey(ctx *cli.Context) (*ringKey, error) {
+	k, err := newRingKey(time.Now())
+	if err != nil {
+		return nil, cli.NewExitError("Could not generate keypair: "+err.Error(), -1)
+	}
+
+	if !ctx.Bool("encrypt") {
+		return k, nil
+	}
+
+	p, err := passphrase(ctx, "Passphrase for master key "+k.ID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.encrypt(p); err != nil {
+		return nil, cli.NewExitError("Could not encrypt master key: "+err.Error(), -1)
+	}
+
+	return k, nil
+}
+
+// masterKeypair returns the master keypair which endorses the live keypairs
+// requests are signed with: the keyring's key picked with --master-key, or
+// its current key, or the one in masterkey.json if the keyring has none.
+// Keys which have retired can't be picked, and encrypted keys are decrypted.
+func masterKeypair(ctx *cli.Context) (*ringKey, error) {
+	r := &keyring{dir: ctx.String("keyring")}
+
+	var k *ringKey
+	var err error
+	if id := ctx.String("master-key"); id != "" {
+		k, err = r.get(id)
+	} else {
+		k, err = r.current()
+	}
+
+	switch {
+	case err == errNoCurrentKey:
+		mk, err := getKeypair()
+		if err != nil {
+			return nil, err
+		}
+		return &ringKey{keypair: *mk, ID: keyID(mk.PublicKey)}, nil
+	case err != nil:
+		return nil, cli.NewExitError("Could not load master key: "+err.Error(), -1)
+	}
+
+	if !k.valid(time.Now()) {
+		return nil, cli.NewExitError(fmt.Sprintf("Master key %s retired at %s",
+			k.ID, k.RetiresAt.Format("2006-01-02 15:04:05 MST")), -1)
+	}
+
+	if k.Encrypted != nil {
+		p, err := passphrase(ctx, "Passphrase for master key "+k.ID, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := k.decrypt(p); err != nil {
+			return nil, cli.NewExitError("Could not decrypt master key: "+err.Error(), -1)
+		}
+	}
+
+	return k, nil
+}
+
+// passphrase returns the passphrase given with --passphrase, or prompts for
+// it, twice if it is being chosen.
+func passphrase(ctx *cli.Context, label string, confirm bool) (string, error) {
+	if p := ctx.String("passphrase"); p != "" {
+		return p, nil
+	}
+
+	p := promptui.Prompt{
+		Label: label,
+		Mask:  passwordMask,
+		Validate: func(input string) error {
+			if confirm && len(input) < 8 {
+				return errors.New("Passphrases must be at least 8 characters")
+			}
+
+			return nil
+		},
+	}
+
+	first, err := p.Run()
+	if err != nil {
+		return "", cli.NewExitError("Could not read passphrase: "+err.Error(), -1)
+	}
+
+	if !confirm {
+		return first, nil
+	}
+
+	p = promptui.Prompt{
+		Label: "Confirm passphrase",
+		Mask:  passwordMask,
+		Validate: func(input string) error {
+			if input != first {
+				return errors.New("Passphrases do not match")
+			}
+
+			return nil
+		},
+	}
+
+	if _, err := p.Run(); err != nil {
+		return "", cli.NewExitError("Could not read passphrase: "+err.Error(), -1)
+	}
+
+	return first, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/manifoldco/grafton/config"
+	"github.com/manifoldco/grafton/har"
+	"github.com/manifoldco/grafton/replay"
+)
+
+// recordFlag records the traffic of grafton test and grafton serve to a HAR
+// file.
+var recordFlag = &cli.StringFlag{
+	Name: "record",
+	Usage: "Record requests to the provider, the fake Connector and SSO redirects to a HAR file, " +
+		"such as 'traffic.har', with credentials and secrets redacted",
+	EnvVars: []string{"RECORD"},
+}
+
+// newRecorder returns a recorder saving to the file passed through
+// recordFlag, or nil if it wasn't.
+func newRecorder(ctx *cli.Context) (*har.Recorder, error) {
+	path := ctx.String("record")
+	if path == "" {
+		return nil, nil
+	}
+
+	rec := har.NewRecorder()
+	rec.Creator.Version = config.Version
+	if err := rec.SaveTo(path); err != nil {
+		return nil, cli.NewExitError("Could not write HAR file: "+err.Error(), -1)
+	}
+
+	return rec, nil
+}
+
+// recordingMiddleware returns a middleware recording the requests received
+// by a server, labelled with the server's name.
+func recordingMiddleware(rec *har.Recorder, label string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return rec.Middleware(label, h)
+	}
+}
+
+// recordSessionFlag records the requests grafton test makes to the provider
+// into a session which replayFlag replays.
+var recordSessionFlag = &cli.StringFlag{
+	Name:    "record-session",
+	Usage:   "Record requests to the provider and its callbacks to a session file, such as 'session.json', to --replay later on",
+	EnvVars: []string{"RECORD_SESSION"},
+}
+
+// replayFlag replays a session recorded with recordSessionFlag instead of
+// sending requests to the provider.
+var replayFlag = &cli.StringFlag{
+	Name:    "replay",
+	Usage:   "Answer requests with the responses and callbacks of a session recorded with --record-session, without a provider",
+	EnvVars: []string{"REPLAY"},
+}
+
+// unreplayableFeatures need the provider itself, as they follow its SSO
+// redirects, send requests signed anew which were never recorded, or check
+// how it talks to the Connector, which a replayed session only mimics.
+var unreplayableFeatures = []string{"sso", "signature", "connector-faults", "callback-retries"}
+
+// newSessionRecorder returns a session recorder saving to the file passed
+// through recordSessionFlag, or nil if it wasn't.
+func newSessionRecorder(ctx *cli.Context) (*replay.Recorder, error) {
+	path := ctx.String("record-session")
+	if path == "" {
+		return nil, nil
+	}
+
+	rec := replay.NewRecorder()
+	if err := rec.SaveTo(path); err != nil {
+		return nil, cli.NewExitError("Could not write session file: "+err.Error(), -1)
+	}
+
+	return rec, nil
+}
+
+// newPlayer returns a player replaying the session passed through
+// replayFlag, or nil if it wasn't.
+func newPlayer(ctx *cli.Context, clientID, clientSecret string) (*replay.Player, error) {
+	path := ctx.String("replay")
+	if path == "" {
+		return nil, nil
+	}
+
+	if ctx.String("record-session") != "" {
+		return nil, cli.NewExitError("Cannot record a session while replaying one", -1)
+	}
+
+	session, err := replay.LoadSession(path)
+	if err != nil {
+		return nil, cli.NewExitError("Could not read session file: "+err.Error(), -1)
+	}
+
+	return replay.NewPlayer(session, clientID, clientSecret), nil
+}
@@ -3,12 +3,14 @@ package main
 import (
 	"encoding/base64"
 	"fmt"
+	"net/http"
 	"net/url"
 	"regexp"
 
 	"github.com/urfave/cli/v2"
 
 	"github.com/manifoldco/grafton/connector"
+	"github.com/manifoldco/grafton/db"
 	"github.com/manifoldco/grafton/marketplace"
 	"github.com/manifoldco/grafton/marketplace/primitives"
 )
@@ -61,13 +63,34 @@ func init() {
 				Usage:   "Local port for running the fake Marketplace Web Server for SSO and Async testing",
 				EnvVars: []string{"MARKETPLACE_PORT"},
 			},
+			&cli.StringFlag{
+				Name:    "data-dir",
+				Usage:   "Directory to persist the Marketplace and Connector state in, kept in memory if not set",
+				EnvVars: []string{"DATA_DIR"},
+			},
+			faultFlag,
+			userFlag,
+			recordFlag,
 		},
 	}
+	cmd.Flags = append(cmd.Flags, configFlags...)
+	cmd.Flags = append(cmd.Flags, signingFlags...)
 
 	cmds = append(cmds, cmd)
 }
 
 func serveCmd(ctx *cli.Context) error {
+	file, err := applyConfigFile(ctx)
+	if err != nil {
+		return err
+	}
+
+	if u := file.Get("url"); u != "" && !ctx.IsSet("provider-api") {
+		if err := ctx.Set("provider-api", u); err != nil {
+			return cli.NewExitError("Could not use url from configuration file: "+err.Error(), -1)
+		}
+	}
+
 	product := ctx.String("product")
 	if product == "" {
 		return cli.NewExitError("The 'product' flag is required and was not provided", -1)
@@ -138,28 +161,91 @@ func serveCmd(ctx *cli.Context) error {
 		return cli.NewExitError("The 'client-secret' flag is required and was not provided", -1)
 	}
 
-	k, err := getKeypair()
+	faults, err := parseFaults(ctx)
+	if err != nil {
+		return err
+	}
+
+	members, err := parseMembers(ctx)
+	if err != nil {
+		return err
+	}
+
+	rec, err := newRecorder(ctx)
+	if err != nil {
+		return err
+	}
+
+	signer, signedBy, err := newSigner(ctx)
 	if err != nil {
 		return err
 	}
-	lkp, err := k.liveKeypair()
+	fmt.Printf("Signing requests with %s\n", signedBy)
+
+	d, err := openDB(ctx.String("data-dir"))
 	if err != nil {
-		return cli.NewExitError("Could not create request signing keypair: "+err.Error(), -1)
+		return cli.NewExitError("Could not open data directory: "+err.Error(), -1)
 	}
+	defer d.Close()
 
-	fakeConnector, err := connector.New(connectorPort, clientID, clientSecret, product)
+	fakeConnector, err := connector.NewWithDB(d, connectorPort, clientID, clientSecret, product)
 	if err != nil {
 		return cli.NewExitError("Error while configuring connector service: "+err.Error(), -1)
 	}
-	fakeMarketplace := marketplace.New(fakeConnector, marketplacePort, pAPI, lkp,
+
+	for _, f := range faults {
+		if _, err := fakeConnector.AddFault(f); err != nil {
+			return cli.NewExitError("Invalid fault: "+err.Error(), -1)
+		}
+	}
+
+	for _, m := range members {
+		if _, err := fakeConnector.AddMember(m); err != nil {
+			return cli.NewExitError("Invalid user: "+err.Error(), -1)
+		}
+	}
+
+	var transport http.RoundTripper
+	if rec != nil {
+		transport = rec.Transport("provider", nil)
+		fakeConnector.Middleware = recordingMiddleware(rec, "connector")
+		fmt.Printf("Recording requests to %s\n", ctx.String("record"))
+	}
+	transport = &connector.OriginTransport{Connector: fakeConnector, Transport: transport}
+
+	fakeMarketplace := marketplace.NewWithTransport(fakeConnector, marketplacePort, pAPI, signer,
 		&primitives.FakeProductData{
 			Product: product,
 			Plan:    plan,
 			Region:  region,
-		})
+		}, transport)
+	if rec != nil {
+		fakeMarketplace.Middleware = recordingMiddleware(rec, "marketplace")
+	}
+
+	// Credential rotations started by the provider go through the same client
+	// as the marketplace.
+	fakeConnector.Provider = fakeMarketplace.GC
 
 	fmt.Printf("Starting Connector server on http://localhost:%d\n", connectorPort)
 	fakeConnector.Start()
+	fakeMarketplace.Resume()
 	fmt.Printf("Starting Marketplace server on http://localhost:%d\n", marketplacePort)
 	return fakeMarketplace.StartSync()
 }
+
+// openDB opens the database persisted in dir, or an in-memory one if dir is
+// empty.
+func openDB(dir string) (*db.DB, error) {
+	if dir == "" {
+		return db.New(), nil
+	}
+
+	s, err := db.OpenFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Persisting state in %s\n", dir)
+	return db.Open(s)
+}
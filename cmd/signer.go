@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/signer"
+)
+
+const defaultAgentSocket = ".grafton/agent.sock"
+
+var signerFlag = &cli.StringFlag{
+	Name:    "signer",
+	Usage:   "Sign requests through agent:<socket> or command:<program and arguments>, instead of with a master key read by grafton",
+	EnvVars: []string{"GRAFTON_SIGNER"},
+}
+
+// signingFlags pick how requests are signed: by an external signer, or with
+// a live keypair endorsed by a master key.
+var signingFlags = append([]cli.Flag{signerFlag}, masterKeyFlags...)
+
+func init() {
+	cmd := &cli.Command{
+		Name:   "signing-agent",
+		Usage:  "Serves a signing agent on a Unix socket, for use with --signer agent:<socket>",
+		Action: signingAgentCmd,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    "socket",
+				Usage:   "Path of the Unix socket to listen on",
+				EnvVars: []string{"GRAFTON_AGENT_SOCKET"},
+				Value:   defaultAgentSocket,
+			},
+			&cli.BoolFlag{
+				Name:  "stdin",
+				Usage: "Sign the bytes read from the standard input once, for use with --signer command:<program>",
+			},
+		}, masterKeyFlags...),
+	}
+
+	cmds = append(cmds, cmd)
+}
+
+// newSigner returns the signer requests are signed with, along with a
+// description of it: the one given with --signer, or a live keypair endorsed
+// by the master key picked with masterKeyFlags.
+func newSigner(ctx *cli.Context) (grafton.Signer, string, error) {
+	spec := ctx.String("signer")
+	if spec == "" {
+		k, err := masterKeypair(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+
+		lkp, err := k.liveKeypair()
+		if err != nil {
+			return nil, "", cli.NewExitError("Could not create request signing keypair: "+err.Error(), -1)
+		}
+
+		return lkp, "master key " + k.ID, nil
+	}
+
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return nil, "", cli.NewExitError("Invalid signer '"+spec+"'; expected agent:<socket> or command:<program>", -1)
+	}
+
+	switch parts[0] {
+	case "agent":
+		return &signer.Agent{Socket: parts[1]}, spec, nil
+	case "command":
+		args, err := splitCommand(parts[1])
+		if err != nil {
+			return nil, "", cli.NewExitError("Invalid signer command '"+parts[1]+"': "+err.Error(), -1)
+		}
+		return signer.NewCommand(args[0], args[1:]...), spec, nil
+	default:
+		return nil, "", cli.NewExitError("Unknown signer '"+parts[0]+"'; expected agent or command", -1)
+	}
+}
+
+// splitCommand splits a command into its program and arguments on
+// whitespace, except within single or double quotes, so paths containing
+// spaces can be quoted.
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("no program given")
+	}
+
+	return args, nil
+}
+
+func signingAgentCmd(ctx *cli.Context) error {
+	k, err := masterKeypair(ctx)
+	if err != nil {
+		return err
+	}
+
+	lkp, err := k.liveKeypair()
+	if err != nil {
+		return cli.NewExitError("Could not create request signing keypair: "+err.Error(), -1)
+	}
+
+	if ctx.Bool("stdin") {
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return cli.NewExitError("Could not read from standard input: "+err.Error(), -1)
+		}
+
+		sig, err := lkp.Sign(b)
+		if err != nil {
+			return cli.NewExitError("Could not sign: "+err.Error(), -1)
+		}
+
+		fmt.Println(sig.String())
+		return nil
+	}
+
+	socket := ctx.String("socket")
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return cli.NewExitError("Could not create socket directory: "+err.Error(), -1)
+	}
+
+	// A socket left behind by an agent which didn't stop cleanly would
+	// prevent listening again.
+	if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if _, err := net.Dial("unix", socket); err == nil {
+			return cli.NewExitError("Another signing agent is listening on "+socket, -1)
+		}
+		os.Remove(socket)
+	}
+
+	l, err := listenPrivate(socket)
+	if err != nil {
+		return cli.NewExitError("Could not listen on socket: "+err.Error(), -1)
+	}
+
+	stop := make(chan os.Signal, 1)
+	stopped := make(chan struct{})
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		close(stopped)
+		l.Close()
+		os.Remove(socket)
+	}()
+
+	fmt.Printf("Signing requests with a live key endorsed by master key %s\n", k.ID)
+	fmt.Printf("Listening on %s; sign with --signer agent:%s\n", socket, socket)
+
+	err = signer.Serve(l, lkp)
+	select {
+	case <-stopped:
+		return nil
+	default:
+		os.Remove(socket)
+		return cli.NewExitError("Could not serve signing requests: "+err.Error(), -1)
+	}
+}
+
+// listenPrivate listens on a Unix socket at the given path which only its
+// owner can connect to. The socket is created in a new directory only the
+// owner can access, then moved into place, so others can't connect to it
+// before its permissions are restricted, whatever the umask or the
+// permissions of the directory it ends up in. It isn't removed when the
+// listener is closed.
+func listenPrivate(socket string) (*net.UnixListener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(socket), ".grafton-agent")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "agent.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(false)
+
+	err = os.Chmod(tmp, 0600)
+	if err == nil {
+		err = os.Rename(tmp, socket)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
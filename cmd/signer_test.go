@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gm "github.com/onsi/gomega"
+)
+
+func TestSplitCommand(t *testing.T) {
+	t.Run("splits on whitespace", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		args, err := splitCommand("grafton  signing-agent\t--stdin")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(args).To(gm.Equal([]string{"grafton", "signing-agent", "--stdin"}))
+	})
+
+	t.Run("keeps quoted spaces", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		args, err := splitCommand(`"/opt/my signer/sign" --name 'a b' ""`)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(args).To(gm.Equal([]string{"/opt/my signer/sign", "--name", "a b", ""}))
+	})
+
+	t.Run("rejects an unterminated quote", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		_, err := splitCommand(`"/opt/my signer/sign`)
+		gm.Expect(err).To(gm.HaveOccurred())
+	})
+
+	t.Run("rejects an empty command", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		_, err := splitCommand("  ")
+		gm.Expect(err).To(gm.HaveOccurred())
+	})
+}
+
+func TestListenPrivate(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "grafton-agent")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := listenPrivate(socket)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer l.Close()
+
+	info, err := os.Stat(socket)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(info.Mode() & os.ModeSocket).ToNot(gm.BeZero())
+	gm.Expect(info.Mode().Perm()).To(gm.Equal(os.FileMode(0600)))
+
+	files, err := ioutil.ReadDir(dir)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(files).To(gm.HaveLen(1))
+
+	conn, err := net.Dial("unix", socket)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	conn.Close()
+}
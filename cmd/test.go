@@ -5,9 +5,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	nurl "net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"text/tabwriter"
 
@@ -18,6 +20,8 @@ import (
 
 	"github.com/manifoldco/grafton"
 	"github.com/manifoldco/grafton/acceptance"
+	"github.com/manifoldco/grafton/connector"
+	"github.com/manifoldco/grafton/contract"
 )
 
 var (
@@ -71,6 +75,11 @@ func init() {
 				Usage:   "Exclude running these feature tests (and those that depend on it)",
 				EnvVars: []string{"EXCLUDE"},
 			},
+			&cli.StringSliceFlag{
+				Name:    "include",
+				Usage:   "Include these opt-in feature tests, for functionality not every provider supports",
+				EnvVars: []string{"INCLUDE"},
+			},
 			&cli.BoolFlag{
 				Name:    "no-error-cases",
 				Usage:   "Skip running the error case tests",
@@ -112,9 +121,47 @@ func init() {
 				Usage: "Describes the credential type that is supported by this product. One of (single, multiple)",
 				Value: "multiple",
 			},
+			&cli.StringFlag{
+				Name:    "matrix",
+				Usage:   "A JSON object listing the plans, regions, plan-features and resizes to run the tests against",
+				EnvVars: []string{"MATRIX"},
+			},
+			&cli.UintFlag{
+				Name:    "parallel",
+				Usage:   "Number of independent features and matrix combinations to test at the same time",
+				EnvVars: []string{"PARALLEL"},
+				Value:   1,
+			},
+			&cli.StringSliceFlag{
+				Name:    "report",
+				Usage:   "Write a test report to the given file; .xml files are written as JUnit XML and .json files as JSON",
+				EnvVars: []string{"REPORT"},
+			},
+			faultFlag,
+			userFlag,
+			recordFlag,
+			recordSessionFlag,
+			replayFlag,
+			&cli.BoolFlag{
+				Name:    "strict-callbacks",
+				Usage:   "Fail instead of warning about issues with how callbacks are retried",
+				EnvVars: []string{"STRICT_CALLBACKS"},
+			},
+			&cli.BoolFlag{
+				Name:    "strict-contract",
+				Usage:   "Fail instead of warning about responses which don't match the provider API spec, with --include contract",
+				EnvVars: []string{"STRICT_CONTRACT"},
+			},
+			&cli.BoolFlag{
+				Name:    "strict-connector-contract",
+				Usage:   "Fail instead of warning about requests to the fake Connector which don't match the Connector API spec",
+				EnvVars: []string{"STRICT_CONNECTOR_CONTRACT"},
+			},
 		},
 		Action: testCmd,
 	}
+	cmd.Flags = append(cmd.Flags, configFlags...)
+	cmd.Flags = append(cmd.Flags, signingFlags...)
 
 	cmds = append(cmds, cmd)
 }
@@ -122,7 +169,16 @@ func init() {
 func testCmd(ctx *cli.Context) error {
 	args := ctx.Args()
 
+	file, err := applyConfigFile(ctx)
+	if err != nil {
+		return err
+	}
+
 	url := "http://localhost:3000"
+	if u := file.Get("url"); u != "" {
+		url = u
+	}
+
 	plan := ctx.String("plan")
 	sPlanFeatures := ctx.String("plan-features")
 	newPlan := ctx.String("new-plan")
@@ -130,6 +186,7 @@ func testCmd(ctx *cli.Context) error {
 	product := ctx.String("product")
 	region := ctx.String("region")
 	excludeFeatures := ctx.StringSlice("exclude")
+	includeFeatures := ctx.StringSlice("include")
 
 	clientID := ctx.String("client-id")
 	clientSecret := ctx.String("client-secret")
@@ -140,7 +197,58 @@ func testCmd(ctx *cli.Context) error {
 
 	credential := ctx.String("credential")
 
-	if plan != "" && plan == newPlan {
+	reports := ctx.StringSlice("report")
+	for _, r := range reports {
+		if _, err := reportWriter(r); err != nil {
+			return cli.NewExitError(err.Error(), -1)
+		}
+	}
+
+	// Opt-in features are skipped just like excluded ones, unless included,
+	// and reported as not included
+	optIns := acceptance.OptInFeatures()
+	skipFeatures := append([]string{}, excludeFeatures...)
+	for _, f := range includeFeatures {
+		if !contains(optIns, f) {
+			return cli.NewExitError(fmt.Sprintf("Cannot include `%s`; opt-in features are: %s",
+				f, strings.Join(optIns, ", ")), -1)
+		}
+	}
+	for _, f := range optIns {
+		if !contains(includeFeatures, f) {
+			skipFeatures = append(skipFeatures, f)
+		}
+	}
+
+	player, err := newPlayer(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	// Replayed sessions have no provider behind them for some features to
+	// test, so those are skipped like excluded ones.
+	if player != nil {
+		for _, f := range unreplayableFeatures {
+			if contains(includeFeatures, f) {
+				return cli.NewExitError(fmt.Sprintf("Cannot include `%s` when replaying a session", f), -1)
+			}
+			if !contains(skipFeatures, f) {
+				skipFeatures = append(skipFeatures, f)
+			}
+		}
+
+		if len(ctx.StringSlice("fault")) > 0 {
+			return cli.NewExitError("Cannot inject faults when replaying a session", -1)
+		}
+	}
+
+	var matrix *acceptance.Matrix
+	if sMatrix := ctx.String("matrix"); sMatrix != "" {
+		matrix, err = acceptance.ParseMatrix(sMatrix)
+		if err != nil {
+			return cli.NewExitError("The supplied matrix does not appear to be valid JSON: "+err.Error(), -1)
+		}
+	} else if plan != "" && plan == newPlan {
 		return cli.NewExitError("--new-plan value must be different than --plan", -1)
 	}
 
@@ -173,6 +281,50 @@ func testCmd(ctx *cli.Context) error {
 		}
 	}
 
+	cfg := acceptance.Configuration{
+		Product:          product,
+		Region:           region,
+		Plan:             plan,
+		PlanFeatures:     planFeatures,
+		NewPlan:          newPlan,
+		NewPlanFeatures:  newPlanFeatures,
+		ClientID:         clientID,
+		ClientSecret:     clientSecret,
+		Port:             connectorPort,
+		CallbackTimeout:  callbackTimeout,
+		ResourceMeasures: resourceMeasures,
+		Credential:       credential,
+		Matrix:           matrix,
+		Parallel:         ctx.Uint("parallel"),
+		StrictCallbacks:  ctx.Bool("strict-callbacks"),
+		StrictContract:   ctx.Bool("strict-contract"),
+
+		StrictConnectorContract: ctx.Bool("strict-connector-contract"),
+	}
+
+	cfg.Faults, err = parseFaults(ctx)
+	if err != nil {
+		return err
+	}
+
+	cfg.Members, err = parseMembers(ctx)
+	if err != nil {
+		return err
+	}
+
+	combos, err := matrix.Combinations(cfg)
+	if err != nil {
+		return cli.NewExitError("Invalid matrix: "+err.Error(), -1)
+	}
+
+	if matrix != nil {
+		// Features require these flags; the matrix provides them instead when
+		// every combination has a value.
+		if err := setFromCombinations(ctx, combos); err != nil {
+			return err
+		}
+	}
+
 	if args.Len() > 0 {
 		url = args.First()
 	}
@@ -187,22 +339,59 @@ func testCmd(ctx *cli.Context) error {
 		purl.Path = path.Join(purl.Path, "/v1")
 	}
 
-	k, err := getKeypair()
+	signer, signedBy, err := newSigner(ctx)
+	if err != nil {
+		return err
+	}
+
+	rec, err := newRecorder(ctx)
 	if err != nil {
 		return err
 	}
 
-	lkp, err := k.liveKeypair()
+	sessionRec, err := newSessionRecorder(ctx)
 	if err != nil {
-		return cli.NewExitError("Could not create request signing keypair: "+err.Error(), -1)
+		return err
 	}
 
 	opt := grafton.ClientOptions{
 		URL:          purl,
 		ConnectorURL: deriveConnectorURL(connectorPort),
-		Signer:       lkp,
+		Signer:       signer,
 		Debug:        logLevel == acceptance.LogVerbose,
 	}
+	switch {
+	case player != nil:
+		opt.Transport = player.Transport()
+	case sessionRec != nil:
+		opt.Transport = sessionRec.Transport(nil)
+		cfg.SessionRecorder = sessionRec
+	}
+	if rec != nil {
+		opt.Transport = rec.Transport("provider", opt.Transport)
+		cfg.Recorder = rec
+	}
+
+	// Responses are checked against the spec by the contract feature,
+	// including those to requests made outside of the API clients. Outside
+	// of it, nothing collects the results, so only --include contract
+	// checks any.
+	spec, err := contract.Provider()
+	if err != nil {
+		return cli.NewExitError("Could not load the provider API spec: "+err.Error(), -1)
+	}
+	opt.Transport = spec.Transport(opt.Transport)
+	cfg.Contract = spec
+
+	// The fake Connector records the requests its callbacks originate from.
+	cfg.Origins = &connector.OriginTransport{Transport: opt.Transport}
+	opt.Transport = cfg.Origins
+
+	// Requests to the fake Connector are checked against its own spec.
+	cfg.ConnectorContract, err = contract.Connector()
+	if err != nil {
+		return cli.NewExitError("Could not load the Connector API spec: "+err.Error(), -1)
+	}
 
 	api := grafton.NewClient(opt)
 
@@ -228,27 +417,68 @@ func testCmd(ctx *cli.Context) error {
 	w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
 	fmt.Fprintf(w, "\tURL:\t%s\n", faint(url))
 	fmt.Fprintf(w, "\tProduct:\t%s\n", faint(product))
-	fmt.Fprintf(w, "\tPlan:\t%s\n", faint(plan))
-	fmt.Fprintf(w, "\tRegion:\t%s\n", faint(region))
-	fmt.Fprintf(w, "\tResizing?\t%s\n", faint(yn(willChangePlan)))
 
-	if willChangePlan {
-		fmt.Fprintf(w, "\tNew Plan:\t%s\n", faint(newPlan))
+	if matrix != nil {
+		fmt.Fprintf(w, "\tCombinations:\t%s\n", faint(fmt.Sprintf("%d", len(combos))))
+		for _, c := range combos {
+			resize := ""
+			if c.NewPlan != "" {
+				resize = " -> " + c.NewPlan
+			}
+			fmt.Fprintf(w, "\t\t%s\n", faint(c.String()+resize))
+		}
+	} else {
+		fmt.Fprintf(w, "\tPlan:\t%s\n", faint(plan))
+		fmt.Fprintf(w, "\tRegion:\t%s\n", faint(region))
+		fmt.Fprintf(w, "\tResizing?\t%s\n", faint(yn(willChangePlan)))
+
+		if willChangePlan {
+			fmt.Fprintf(w, "\tNew Plan:\t%s\n", faint(newPlan))
+		}
 	}
 
 	if len(excludeFeatures) > 0 {
 		fmt.Fprintf(w, "\tExcluded Features:\t%s\n", faint(strings.Join(excludeFeatures, " ")))
 	}
 
+	if len(includeFeatures) > 0 {
+		fmt.Fprintf(w, "\tIncluded Features:\t%s\n", faint(strings.Join(includeFeatures, " ")))
+	}
+
 	fmt.Fprintf(w, "\tClient ID:\t%s\n", faint(clientID))
 	fmt.Fprintf(w, "\tClient Secret:\t%s\n", faint(clientSecret))
 	fmt.Fprintf(w, "\tConnector Port:\t%s\n", faint(fmt.Sprintf("%d", connectorPort)))
+	fmt.Fprintf(w, "\tSigned By:\t%s\n", faint(signedBy))
+
+	if cfg.Parallel > 1 {
+		fmt.Fprintf(w, "\tParallel:\t%s\n", faint(fmt.Sprintf("%d", cfg.Parallel)))
+	}
+
+	for _, f := range ctx.StringSlice("fault") {
+		fmt.Fprintf(w, "\tFault:\t%s\n", faint(f))
+	}
 
-	if !contains(excludeFeatures, "resource-measures") {
+	for _, u := range ctx.StringSlice("user") {
+		fmt.Fprintf(w, "\tUser:\t%s\n", faint(u))
+	}
+
+	if r := ctx.String("record"); r != "" {
+		fmt.Fprintf(w, "\tRecording:\t%s\n", faint(r))
+	}
+
+	if r := ctx.String("record-session"); r != "" {
+		fmt.Fprintf(w, "\tRecording Session:\t%s\n", faint(r))
+	}
+
+	if r := ctx.String("replay"); r != "" {
+		fmt.Fprintf(w, "\tReplaying:\t%s\n", faint(r))
+	}
+
+	if !contains(skipFeatures, "resource-measures") {
 		fmt.Fprintf(w, "\tResource Measures:\t%s\n", faint(resourceMeasures))
 	}
 
-	if errs := acceptance.Validate(c, ctx, excludeFeatures); len(errs) != 0 {
+	if errs := acceptance.Validate(c, ctx, skipFeatures); len(errs) != 0 {
 		// format errors into a single string
 		errString := []string{}
 		for _, err := range errs {
@@ -261,35 +491,88 @@ func testCmd(ctx *cli.Context) error {
 
 	acceptance.Infoln(buf.String())
 
-	cfg := acceptance.Configuration{
-		API:              api,
-		UnauthorizedAPI:  unauthorizedAPI,
-		Product:          product,
-		Region:           region,
-		Plan:             plan,
-		PlanFeatures:     planFeatures,
-		NewPlan:          newPlan,
-		NewPlanFeatures:  newPlanFeatures,
-		ClientID:         clientID,
-		ClientSecret:     clientSecret,
-		Port:             connectorPort,
-		CallbackTimeout:  callbackTimeout,
-		ResourceMeasures: resourceMeasures,
-		Credential:       credential,
-	}
+	cfg.API = api
+	cfg.UnauthorizedAPI = unauthorizedAPI
 
 	if err := acceptance.Configure(cfg); err != nil {
 		return cli.NewExitError("Error: "+err.Error(), -1)
 	}
 
-	failed := acceptance.Run(c, !ctx.Bool("no-error-cases"), excludeFeatures)
-	if failed {
+	report := acceptance.Run(c, !ctx.Bool("no-error-cases"), skipFeatures)
+	for _, r := range reports {
+		if err := writeReport(report, r); err != nil {
+			return cli.NewExitError("Could not write report: "+err.Error(), -1)
+		}
+	}
+
+	if report.Failed() {
 		os.Exit(1)
 	}
 
 	return nil
 }
 
+// setFromCombinations sets the plan, region and new-plan flags, when they
+// were not given, if every combination of the matrix has a value for them.
+func setFromCombinations(ctx *cli.Context, combos []acceptance.Combination) error {
+	values := map[string]func(acceptance.Combination) string{
+		"plan":     func(c acceptance.Combination) string { return c.Plan },
+		"region":   func(c acceptance.Combination) string { return c.Region },
+		"new-plan": func(c acceptance.Combination) string { return c.NewPlan },
+	}
+
+	for name, value := range values {
+		if ctx.IsSet(name) {
+			continue
+		}
+
+		complete := true
+		for _, c := range combos {
+			complete = complete && value(c) != ""
+		}
+
+		if complete {
+			if err := ctx.Set(name, value(combos[0])); err != nil {
+				return cli.NewExitError(err.Error(), -1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// reportWriter returns the Report method used to write a report to the given
+// file, based on its extension.
+func reportWriter(file string) (func(*acceptance.Report, io.Writer) error, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".xml":
+		return (*acceptance.Report).WriteJUnit, nil
+	case ".json":
+		return (*acceptance.Report).WriteJSON, nil
+	default:
+		return nil, fmt.Errorf("unknown report format for %q; use a .xml or .json file", file)
+	}
+}
+
+func writeReport(report *acceptance.Report, file string) error {
+	write, err := reportWriter(file)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if err := write(report, f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
 func deriveConnectorURL(port uint) *nurl.URL {
 	return &nurl.URL{
 		Scheme: "http",
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+
+	"github.com/manifoldco/grafton/connector"
+)
+
+// userFlag adds users to the teams of the fake Connector started by grafton
+// test and grafton serve.
+var userFlag = &cli.StringSliceFlag{
+	Name: "user",
+	Usage: "Add a user to a team of the fake Connector, such as " +
+		"'name=Ada Lovelace,email=ada@example.com,role=admin' or 'email=ada@example.com,team=Design'",
+	EnvVars: []string{"GRAFTON_USER"},
+}
+
+// parseMembers returns the users passed through userFlag.
+func parseMembers(ctx *cli.Context) ([]connector.Member, error) {
+	var members []connector.Member
+	for _, s := range ctx.StringSlice("user") {
+		m, err := connector.ParseMember(s)
+		if err != nil {
+			return nil, cli.NewExitError("Invalid user '"+s+"': "+err.Error(), -1)
+		}
+
+		members = append(members, m)
+	}
+
+	return members, nil
+}
@@ -0,0 +1,294 @@
+package connector
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-zoo/bone"
+
+	"github.com/manifoldco/go-manifold"
+	merrors "github.com/manifoldco/go-manifold/errors"
+
+	"github.com/manifoldco/grafton"
+)
+
+// The admin API, served under /_grafton/, lets providers inspect and control
+// the connector's callbacks, the faults it injects, and the users and teams
+// signing in to resources, while developing. It is not part of Manifold's
+// Connector API, and requires no authentication.
+
+var (
+	errInvalidCallbackType = grafton.NewError(merrors.BadRequestError, "Invalid Callback Type Provided")
+	errInvalidResourceID   = grafton.NewError(merrors.BadRequestError, "Invalid Resource ID Provided")
+	errInvalidFaultID      = grafton.NewError(merrors.BadRequestError, "Invalid Fault ID Provided")
+	errFaultNotFound       = grafton.NewError(merrors.NotFoundError, "Fault Not Found")
+	errInvalidTeamID       = grafton.NewError(merrors.BadRequestError, "Invalid Team ID Provided")
+	errTeamNotFound        = grafton.NewError(merrors.NotFoundError, "Team Not Found")
+)
+
+var callbackTypes = map[CallbackType]bool{
+	ResourceProvisionCallback:     true,
+	CredentialProvisionCallback:   true,
+	ResourceDeprovisionCallback:   true,
+	CredentialDeprovisionCallback: true,
+	ResourceResizeCallback:        true,
+}
+
+// AdminCallback represents a callback as listed by the admin API, along with
+// the request it originated from, if known, and the requests made by the
+// provider to complete it
+type AdminCallback struct {
+	ID          manifold.ID       `json:"id"`
+	Type        CallbackType      `json:"type"`
+	State       CallbackState     `json:"state"`
+	Message     string            `json:"message"`
+	ResourceID  *manifold.ID      `json:"resource_id,omitempty"`
+	CallbackURL string            `json:"callback_url"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Origin      *CallbackOrigin   `json:"origin,omitempty"`
+	Requests    []CallbackAttempt `json:"requests"`
+}
+
+// AdminCallbackCreateRequest represents a request to create a pending
+// callback through the admin API
+type AdminCallbackCreateRequest struct {
+	Type       CallbackType `json:"type"`
+	ResourceID *manifold.ID `json:"resource_id,omitempty"`
+}
+
+func listCallbacksHandler(c *FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		cbs := c.GetCallbacks()
+		list := make([]AdminCallback, 0, len(cbs))
+		for _, cb := range cbs {
+			list = append(list, adminCallback(r, cb))
+		}
+
+		respondWithJSON(rw, list, 200)
+	}
+}
+
+func getCallbackHandler(c *FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		cb, err := callbackFromRequest(c, r)
+		if err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		respondWithJSON(rw, adminCallback(r, cb), 200)
+	}
+}
+
+func createCallbackHandler(c *FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		req := &AdminCallbackCreateRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			respondWithError(rw, errBadReqBody)
+			return
+		}
+
+		if !callbackTypes[req.Type] {
+			respondWithError(rw, errInvalidCallbackType)
+			return
+		}
+
+		var resourceID manifold.ID
+		if req.ResourceID != nil {
+			resourceID = *req.ResourceID
+			if c.GetResource(resourceID) == nil {
+				respondWithError(rw, errInvalidResourceID)
+				return
+			}
+		}
+
+		cb, err := c.AddCallbackFor(req.Type, resourceID)
+		if err != nil {
+			respondWithError(rw, errISE)
+			return
+		}
+
+		respondWithJSON(rw, adminCallback(r, cb), 201)
+	}
+}
+
+func expireCallbackHandler(c *FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		cb, err := callbackFromRequest(c, r)
+		if err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		switch c.ExpireCallback(cb.ID) {
+		case nil:
+		case ErrCallbackAlreadyResolved:
+			respondWithError(rw, errCBResolved)
+			return
+		default:
+			respondWithError(rw, errISE)
+			return
+		}
+
+		respondWithJSON(rw, adminCallback(r, cb), 200)
+	}
+}
+
+func callbackFromRequest(c *FakeConnector, r *http.Request) (*Callback, error) {
+	ID, err := manifold.DecodeIDFromString(bone.GetValue(r, "id"))
+	if err != nil {
+		return nil, errInvalidCBID
+	}
+
+	cb := c.GetCallback(ID)
+	if cb == nil {
+		return nil, errCBNotFound
+	}
+
+	return cb, nil
+}
+
+// adminCallback returns a copy of the callback for the admin API, with the
+// url the provider completes it at on the connector serving the request.
+func adminCallback(r *http.Request, cb *Callback) AdminCallback {
+	cb.Mutex.Lock()
+	defer cb.Mutex.Unlock()
+
+	a := AdminCallback{
+		ID:          cb.ID,
+		Type:        cb.Type,
+		State:       cb.State,
+		Message:     cb.Message,
+		CallbackURL: "http://" + r.Host + "/v1/callbacks/" + cb.ID.String(),
+		CreatedAt:   cb.CreatedAt,
+		UpdatedAt:   cb.UpdatedAt,
+		Origin:      cb.Origin,
+		Requests:    append([]CallbackAttempt{}, cb.Requests...),
+	}
+	if !cb.ResourceID.IsEmpty() {
+		ID := cb.ResourceID
+		a.ResourceID = &ID
+	}
+
+	return a
+}
+
+// AdminResourceTeamRequest represents a request to assign a resource to a
+// team through the admin API
+type AdminResourceTeamRequest struct {
+	TeamID manifold.ID `json:"team_id"`
+}
+
+func listUsersHandler(c *FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		respondWithJSON(rw, c.GetUsers(), 200)
+	}
+}
+
+func addMemberHandler(c *FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		req := Member{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(rw, errBadReqBody)
+			return
+		}
+
+		u, err := c.AddMember(req)
+		if err != nil {
+			respondWithError(rw, grafton.NewError(merrors.BadRequestError, "Invalid user: "+err.Error()))
+			return
+		}
+
+		respondWithJSON(rw, u, 201)
+	}
+}
+
+func listTeamsHandler(c *FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		respondWithJSON(rw, c.GetTeams(), 200)
+	}
+}
+
+func assignResourceHandler(c *FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		ID, err := manifold.DecodeIDFromString(bone.GetValue(r, "id"))
+		if err != nil {
+			respondWithError(rw, errInvalidResourceID)
+			return
+		}
+
+		if c.GetResource(ID) == nil {
+			respondWithError(rw, errMissingResource)
+			return
+		}
+
+		req := AdminResourceTeamRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(rw, errBadReqBody)
+			return
+		}
+		if req.TeamID.IsEmpty() {
+			respondWithError(rw, errInvalidTeamID)
+			return
+		}
+
+		t, err := c.AssignResource(ID, req.TeamID)
+		if err != nil {
+			respondWithError(rw, errTeamNotFound)
+			return
+		}
+
+		respondWithJSON(rw, t, 200)
+	}
+}
+
+func listFaultsHandler(c *FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		respondWithJSON(rw, c.GetFaults(), 200)
+	}
+}
+
+func createFaultHandler(c *FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		req := Fault{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(rw, grafton.NewError(merrors.BadRequestError, "Invalid fault: "+err.Error()))
+			return
+		}
+
+		f, err := c.AddFault(req)
+		if err != nil {
+			respondWithError(rw, grafton.NewError(merrors.BadRequestError, "Invalid fault: "+err.Error()))
+			return
+		}
+
+		respondWithJSON(rw, f, 201)
+	}
+}
+
+func deleteFaultHandler(c *FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		ID, err := strconv.ParseUint(bone.GetValue(r, "id"), 10, 64)
+		if err != nil {
+			respondWithError(rw, errInvalidFaultID)
+			return
+		}
+
+		if err := c.RemoveFault(ID); err != nil {
+			respondWithError(rw, errFaultNotFound)
+			return
+		}
+
+		rw.WriteHeader(204)
+	}
+}
+
+func clearFaultsHandler(c *FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		c.ClearFaults()
+		rw.WriteHeader(204)
+	}
+}
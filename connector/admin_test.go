@@ -0,0 +1,148 @@
+package connector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	gm "github.com/onsi/gomega"
+)
+
+func TestAdminCallbacks(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	c, err := New(0, clientID, clientSecret, product)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	srv := httptest.NewServer(ValidHandler(c))
+	defer srv.Close()
+
+	token := getToken(t, srv.URL, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	})
+
+	r := makeResource(t, "high", "aws::us-east-1")
+	c.AddResource(r)
+
+	var created AdminCallback
+
+	t.Run("creates a pending callback", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		rsp := adminRequest(t, "POST", srv.URL+"/_grafton/callbacks",
+			`{"type": "resource:provision", "resource_id": "`+r.ID.String()+`"}`, &created)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(201))
+		gm.Expect(created.State).To(gm.Equal(PendingCallbackState))
+		gm.Expect(*created.ResourceID).To(gm.Equal(r.ID))
+		gm.Expect(created.CallbackURL).To(gm.Equal(srv.URL + "/v1/callbacks/" + created.ID.String()))
+
+		rsp = adminRequest(t, "POST", srv.URL+"/_grafton/callbacks", `{"type": "resource:explode"}`, nil)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(400))
+	})
+
+	t.Run("lists callbacks with the requests made to complete them", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		putCallback(t, created.CallbackURL, token, `{"state": "done", "message": "provisioned"}`)
+		putCallback(t, created.CallbackURL, token, `{"state": "error", "message": "failed"}`)
+
+		var list []AdminCallback
+		rsp := adminRequest(t, "GET", srv.URL+"/_grafton/callbacks", "", &list)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(200))
+		gm.Expect(list).To(gm.HaveLen(1))
+
+		cb := list[0]
+		gm.Expect(cb.State).To(gm.Equal(DoneCallbackState))
+		gm.Expect(cb.UpdatedAt).To(gm.BeTemporally(">=", cb.CreatedAt))
+		gm.Expect(cb.Requests).To(gm.HaveLen(2))
+		gm.Expect(cb.Requests[0].StatusCode).To(gm.Equal(204))
+		gm.Expect(cb.Requests[1].StatusCode).To(gm.Equal(409))
+		gm.Expect(cb.Requests[1].Request.Message).To(gm.Equal("failed"))
+	})
+
+	t.Run("lists the request a callback originated from", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		provider := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(202)
+		}))
+		defer provider.Close()
+
+		cb, err := c.AddCallbackFor(ResourceProvisionCallback, r.ID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		client := &http.Client{Transport: &OriginTransport{Connector: c}}
+		for _, body := range []string{`{"plan":"high"}`, `{"plan":"retried"}`} {
+			req, err := http.NewRequest("PUT", provider.URL+"/v1/resources/"+r.ID.String(), strings.NewReader(body))
+			gm.Expect(err).ToNot(gm.HaveOccurred())
+			req.Header.Set("X-Callback-ID", cb.ID.String())
+
+			rsp, err := client.Do(req)
+			gm.Expect(err).ToNot(gm.HaveOccurred())
+			rsp.Body.Close()
+			gm.Expect(rsp.StatusCode).To(gm.Equal(202))
+		}
+
+		var got AdminCallback
+		rsp := adminRequest(t, "GET", srv.URL+"/_grafton/callbacks/"+cb.ID.String(), "", &got)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(200))
+		gm.Expect(got.Origin).ToNot(gm.BeNil())
+		gm.Expect(got.Origin.Method).To(gm.Equal("PUT"))
+		gm.Expect(got.Origin.Path).To(gm.Equal("/v1/resources/" + r.ID.String()))
+		gm.Expect(string(got.Origin.Body)).To(gm.Equal(`{"plan":"high"}`))
+	})
+
+	t.Run("expires a pending callback", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		cb, err := c.AddCallback(CredentialProvisionCallback)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		var expired AdminCallback
+		rsp := adminRequest(t, "POST", srv.URL+"/_grafton/callbacks/"+cb.ID.String()+"/expire", "", &expired)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(200))
+		gm.Expect(expired.State).To(gm.Equal(ExpiredCallbackState))
+
+		_, err = c.WaitForCallback(cb.ID, time.Second)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		rsp = putCallback(t, expired.CallbackURL, token, `{"state": "done", "message": "too late"}`)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(404))
+
+		rsp = adminRequest(t, "POST", srv.URL+"/_grafton/callbacks/"+cb.ID.String()+"/expire", "", nil)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(409))
+	})
+}
+
+func adminRequest(t *testing.T, method, u, body string, v interface{}) *http.Response {
+	req, err := http.NewRequest(method, u, strings.NewReader(body))
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := http.DefaultClient.Do(req)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer rsp.Body.Close()
+
+	if v != nil {
+		gm.Expect(json.NewDecoder(rsp.Body).Decode(v)).To(gm.Succeed())
+	}
+	return rsp
+}
+
+func putCallback(t *testing.T, u, token, body string) *http.Response {
+	req, err := http.NewRequest("PUT", u, strings.NewReader(body))
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rsp, err := http.DefaultClient.Do(req)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	rsp.Body.Close()
+	return rsp
+}
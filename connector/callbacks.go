@@ -18,6 +18,7 @@ var (
 	errInvalidCBID        = grafton.NewError(errors.BadRequestError, "Invalid Callback ID Provided")
 	errCBNotFound         = grafton.NewError(errors.NotFoundError, "Callback not found")
 	errCBResolved         = grafton.NewError(errors.ConflictError, "Callback already complete")
+	errCBExpired          = grafton.NewError(errors.NotFoundError, "Callback expired")
 	errBadReqBody         = grafton.NewError(errors.BadRequestError, "Could not parse request")
 )
 
@@ -64,19 +65,24 @@ func processCallbackHandler(c *FakeConnector, capturer *RequestCapturer) http.Ha
 		capturer.capture(cbReq)
 		err = c.TriggerCallback(ID, cbReq.State, cbReq.Message, cbReq.Credentials)
 		if err == nil {
+			c.recordCallbackAttempt(cb, cbReq, 204, nil)
 			respondWithJSON(rw, nil, 204)
 			return
 		}
 
+		var rspErr error
 		switch err {
 		case ErrCallbackNotFound:
-			respondWithError(rw, errCBNotFound)
-			return
+			rspErr = errCBNotFound
 		case ErrCallbackAlreadyResolved:
-			respondWithError(rw, errCBResolved)
-			return
+			rspErr = errCBResolved
+		case ErrCallbackExpired:
+			rspErr = errCBExpired
 		default:
-			respondWithError(rw, errISE)
+			rspErr = errISE
 		}
+
+		c.recordCallbackAttempt(cb, cbReq, manifold.ToError(rspErr).StatusCode(), rspErr)
+		respondWithError(rw, rspErr)
 	})
 }
@@ -1,10 +1,16 @@
 package connector
 
 import (
+	"bytes"
 	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +21,8 @@ import (
 	cerrors "github.com/manifoldco/go-connector/errors"
 	"github.com/manifoldco/go-manifold"
 	"github.com/manifoldco/go-manifold/idtype"
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/contract"
 	"github.com/manifoldco/grafton/db"
 )
 
@@ -26,25 +34,87 @@ var ErrCallbackNotFound = errors.New("Callback Not Found")
 // has already been resolved
 var ErrCallbackAlreadyResolved = errors.New("Callback Already Resolved")
 
+// ErrCallbackTimeout represents an error which occurs if a callback was not
+// resolved in time
+var ErrCallbackTimeout = errors.New("Exceeded Callback Wait time")
+
+// ErrCallbackExpired represents an error which occurs if the callback was
+// expired before the provider completed it
+var ErrCallbackExpired = errors.New("Callback Expired")
+
 // ErrResourceNotFound represents an error which occurrs if the resource does
 // not exist
 var ErrResourceNotFound = errors.New("Resource Not Found")
 
 // RequestCapturer represents functionality for capturing and storing requests
-// for a specific route
+// for a specific route, along with the ways they did not match the Connector
+// API spec. It is safe for concurrent use.
 type RequestCapturer struct {
-	Route    string
-	requests []interface{}
+	Route      string
+	mu         sync.Mutex
+	requests   []interface{}
+	violations []violation
+}
+
+// violation is a way a request did not match the spec, along with the
+// resource the request was about, if any.
+type violation struct {
+	contract.Violation
+	resourceID manifold.ID
 }
 
 // capture holds onto a captured requests
 func (r *RequestCapturer) capture(v interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.requests = append(r.requests, v)
 }
 
-// Get returns the requests captured by this Capturer
+// Get returns a copy of the requests captured by this Capturer
 func (r *RequestCapturer) Get() []interface{} {
-	return r.requests
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	requests := make([]interface{}, len(r.requests))
+	copy(requests, r.requests)
+	return requests
+}
+
+// violate holds onto the ways a request about the resource did not match the
+// spec
+func (r *RequestCapturer) violate(resourceID manifold.ID, vs []contract.Violation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range vs {
+		r.violations = append(r.violations, violation{Violation: v, resourceID: resourceID})
+	}
+}
+
+// Violations returns the ways the requests made to the route did not match
+// the Connector API spec, in the order they were received. Requests are only
+// validated when the FakeConnector has a Contract.
+func (r *RequestCapturer) Violations() []contract.Violation {
+	return r.ViolationsFor(func(manifold.ID) bool { return true })
+}
+
+// ViolationsFor returns the ways the requests made to the route about the
+// resources selected by owns did not match the Connector API spec, in the
+// order they were received. Requests which aren't about any resource, such as
+// those for client credentials, are selected by passing owns an empty ID.
+func (r *RequestCapturer) ViolationsFor(owns func(resourceID manifold.ID) bool) []contract.Violation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var vs []contract.Violation
+	for _, v := range r.violations {
+		if owns(v.resourceID) {
+			vs = append(vs, v.Violation)
+		}
+	}
+
+	return vs
 }
 
 // FakeConnectorConfig represents the values used to Configure a FakeConnector
@@ -54,24 +124,63 @@ type FakeConnectorConfig struct {
 	ClientID     string
 	ClientSecret string
 	SigningKey   string
+
+	// CallbackTimeout is how long to wait for the provider's callbacks while
+	// rotating credentials. It defaults to five minutes.
+	CallbackTimeout time.Duration
 }
 
+const defaultCallbackTimeout = 5 * time.Minute
+
 // FakeConnector represents a fake connector api server run by Grafton for use
 // by providers to integrate with Manifold.
+//
+// A FakeConnector is safe for concurrent use, so several test runs can share
+// it, each waiting on its own callbacks. The ways requests don't match its
+// Contract are told apart by the resource the requests are about, so each
+// run can check those made for the resources it provisioned.
 type FakeConnector struct {
-	Config     *FakeConnectorConfig
-	DB         *db.DB
-	OnCallback chan *Callback
-	capturers  map[string]*RequestCapturer
-	codes      []*AuthorizationCode
-	tokens     []*AccessToken
-	callbacks  []*Callback
-	Server     *http.Server
+	Config *FakeConnectorConfig
+	DB     *db.DB
+	Server *http.Server
+
+	// Provider is the client used to provision and deprovision credentials
+	// when the provider asks for a credential rotation.
+	Provider *grafton.Client
+
+	// Middleware, if set, wraps the handler serving the Connector API once
+	// started, such as to record the requests it receives.
+	Middleware func(http.Handler) http.Handler
+
+	// Contract, if set, is the spec of the Connector API which requests are
+	// validated against before they're handled, with the ways they do not
+	// match it held by the RequestCapturer of their route.
+	Contract *contract.Spec
+
+	mu        sync.Mutex
+	capturers map[string]*RequestCapturer
+	codes     []*AuthorizationCode
+	tokens    []*AccessToken
+	callbacks []*Callback
+	rotations map[manifold.ID]*CredentialRotation
+	faults    []*Fault
+	faultSeq  uint64
+	users     []*User
+	teams     []*Team
+
+	oauthCredentials []*OAuthCredential
+
+	// rotationStarted is closed once the next rotation starts, if anyone is
+	// waiting for one.
+	rotationStarted chan struct{}
+
+	// now returns the time authorization codes are created and exchanged at.
+	now func() time.Time
 }
 
 // StartSync starts the server or returns an error if it couldn't be started
 func (c *FakeConnector) StartSync() error {
-	h := ValidHandler(c)
+	h := c.handler()
 	c.Server = &http.Server{
 		Addr:    fmt.Sprintf("localhost:%d", c.Config.Port),
 		Handler: h,
@@ -82,7 +191,7 @@ func (c *FakeConnector) StartSync() error {
 
 // Start the server or return an error if it couldn't be started
 func (c *FakeConnector) Start() {
-	h := ValidHandler(c)
+	h := c.handler()
 	c.Server = &http.Server{
 		Addr:    fmt.Sprintf("localhost:%d", c.Config.Port),
 		Handler: h,
@@ -91,19 +200,30 @@ func (c *FakeConnector) Start() {
 	go c.Server.ListenAndServe()
 }
 
+func (c *FakeConnector) handler() http.Handler {
+	h := ValidHandler(c)
+	if c.Middleware != nil {
+		return c.Middleware(h)
+	}
+
+	return h
+}
+
 // Stop the server or return an error if it couldn't be stopped
 func (c *FakeConnector) Stop() error {
 	if c.Server == nil {
 		return errors.New("Cannot not stop a server that has not started")
 	}
 
-	close(c.OnCallback)
 	return c.Server.Close()
 }
 
 // GetCapturer returns a RequestCapturer for the given route, if no capturer
 // exists, an error is returned.
 func (c *FakeConnector) GetCapturer(route string) (*RequestCapturer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	capturer, ok := c.capturers[route]
 	if !ok {
 		return nil, errors.New("No Capturer found")
@@ -112,6 +232,23 @@ func (c *FakeConnector) GetCapturer(route string) (*RequestCapturer, error) {
 	return capturer, nil
 }
 
+// Capturers returns the RequestCapturer of every route, sorted by route.
+func (c *FakeConnector) Capturers() []*RequestCapturer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	capturers := make([]*RequestCapturer, 0, len(c.capturers))
+	for _, capturer := range c.capturers {
+		capturers = append(capturers, capturer)
+	}
+
+	sort.Slice(capturers, func(i, j int) bool {
+		return capturers[i].Route < capturers[j].Route
+	})
+
+	return capturers
+}
+
 // AddResource stores a resource inside the connector
 func (c *FakeConnector) AddResource(r *db.Resource) {
 	c.DB.PutResource(*r)
@@ -120,6 +257,9 @@ func (c *FakeConnector) AddResource(r *db.Resource) {
 // RemoveResource deletes a resource stored inside the connector
 func (c *FakeConnector) RemoveResource(ID manifold.ID) error {
 	if c.DB.DeleteResource(ID) {
+		c.mu.Lock()
+		c.unassignResource(ID)
+		c.mu.Unlock()
 		return nil
 	}
 	return ErrResourceNotFound
@@ -132,6 +272,12 @@ func (c *FakeConnector) GetResource(id manifold.ID) *db.Resource {
 
 // AddCallback stores the callback inside the FakeConnector
 func (c *FakeConnector) AddCallback(t CallbackType) (*Callback, error) {
+	return c.AddCallbackFor(t, manifold.ID{})
+}
+
+// AddCallbackFor stores the callback for the given resource inside the
+// FakeConnector
+func (c *FakeConnector) AddCallbackFor(t CallbackType, resourceID manifold.ID) (*Callback, error) {
 	ID, err := manifold.NewID(idtype.Callback)
 	if err != nil {
 		return nil, err
@@ -144,15 +290,27 @@ func (c *FakeConnector) AddCallback(t CallbackType) (*Callback, error) {
 		Type:        t,
 		Message:     "",
 		Credentials: make(map[string]string),
+		ResourceID:  resourceID,
+		CreatedAt:   time.Now().UTC(),
+		resolved:    make(chan struct{}),
 	}
+	cb.UpdatedAt = cb.CreatedAt
+
+	// Persist before the callback can be seen, and so triggered, by others
+	c.persistCallback(cb)
 
+	c.mu.Lock()
 	c.callbacks = append(c.callbacks, cb)
+	c.mu.Unlock()
 
 	return cb, nil
 }
 
 // GetCallback returns a callback for the given id if it exists
 func (c *FakeConnector) GetCallback(ID manifold.ID) *Callback {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	for _, v := range c.callbacks {
 		if v.ID == ID {
 			return v
@@ -162,8 +320,24 @@ func (c *FakeConnector) GetCallback(ID manifold.ID) *Callback {
 	return nil
 }
 
-// TriggerCallback updates the callback if it's still pending, and notifies any
-// listeners
+// WaitForCallback blocks until the callback with the given ID is no longer
+// pending, returning ErrCallbackTimeout if it is not resolved in time.
+func (c *FakeConnector) WaitForCallback(ID manifold.ID, timeout time.Duration) (*Callback, error) {
+	cb := c.GetCallback(ID)
+	if cb == nil {
+		return nil, ErrCallbackNotFound
+	}
+
+	select {
+	case <-cb.resolved:
+		return cb, nil
+	case <-time.After(timeout):
+		return nil, ErrCallbackTimeout
+	}
+}
+
+// TriggerCallback updates the callback if it's still pending, and notifies
+// anyone waiting on it
 func (c *FakeConnector) TriggerCallback(ID manifold.ID, state CallbackState, msg string, creds map[string]string) error {
 	cb := c.GetCallback(ID)
 	if cb == nil {
@@ -173,6 +347,10 @@ func (c *FakeConnector) TriggerCallback(ID manifold.ID, state CallbackState, msg
 	cb.Mutex.Lock()
 	defer cb.Mutex.Unlock()
 
+	if cb.State == ExpiredCallbackState {
+		return ErrCallbackExpired
+	}
+
 	if cb.State != PendingCallbackState {
 		if callbackEqual(cb, state, msg, creds) {
 			return nil
@@ -183,15 +361,73 @@ func (c *FakeConnector) TriggerCallback(ID manifold.ID, state CallbackState, msg
 
 	cb.State = state
 	cb.Message = msg
+	cb.UpdatedAt = time.Now().UTC()
 
 	for k, v := range creds {
 		cb.Credentials[k] = v
 	}
 
-	c.OnCallback <- cb
+	c.persistCallback(cb)
+
+	if state != PendingCallbackState {
+		close(cb.resolved)
+	}
+
 	return nil
 }
 
+// ExpireCallback fails the callback if it's still pending, so the provider
+// can no longer complete it, and notifies anyone waiting on it
+func (c *FakeConnector) ExpireCallback(ID manifold.ID) error {
+	cb := c.GetCallback(ID)
+	if cb == nil {
+		return ErrCallbackNotFound
+	}
+
+	cb.Mutex.Lock()
+	defer cb.Mutex.Unlock()
+
+	if cb.State != PendingCallbackState {
+		return ErrCallbackAlreadyResolved
+	}
+
+	cb.State = ExpiredCallbackState
+	cb.Message = "Callback expired"
+	cb.UpdatedAt = time.Now().UTC()
+
+	c.persistCallback(cb)
+	close(cb.resolved)
+
+	return nil
+}
+
+// GetCallbacks returns every callback, oldest first
+func (c *FakeConnector) GetCallbacks() []*Callback {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]*Callback(nil), c.callbacks...)
+}
+
+// recordCallbackAttempt stores a request the provider made to complete the
+// callback, along with the status code it was answered with.
+func (c *FakeConnector) recordCallbackAttempt(cb *Callback, req *CallbackRequest, status int, err error) {
+	cb.Mutex.Lock()
+	defer cb.Mutex.Unlock()
+
+	attempt := CallbackAttempt{
+		ReceivedAt: time.Now().UTC(),
+		Request:    *req,
+		StatusCode: status,
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	cb.Requests = append(cb.Requests, attempt)
+	c.persistCallback(cb)
+}
+
 func callbackEqual(cb *Callback, s CallbackState, msg string, creds map[string]string) bool {
 	if cb.Message != msg || cb.State != s || len(creds) != len(cb.Credentials) {
 		return false
@@ -206,18 +442,113 @@ func callbackEqual(cb *Callback, s CallbackState, msg string, creds map[string]s
 	return true
 }
 
+// capturer returns the RequestCapturer for the route, creating it if needed,
+// so the methods of a route share one.
 func (c *FakeConnector) capturer(route string) *RequestCapturer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if r, ok := c.capturers[route]; ok {
+		return r
+	}
+
 	r := &RequestCapturer{
 		Route:    route,
 		requests: make([]interface{}, 0),
 	}
-
 	c.capturers[route] = r
 
 	return r
 }
 
+// maxValidatedBody is the largest request body read to be validated against
+// the connector's Contract.
+const maxValidatedBody = 1 << 20
+
+// validated validates the requests made to the route against the connector's
+// Contract, if it has one, before they reach h. Requests are handled whether
+// they match or not, unless their body is larger than maxValidatedBody.
+func (c *FakeConnector) validated(capturer *RequestCapturer, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if c.Contract != nil {
+			body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxValidatedBody))
+			r.Body.Close()
+			if err != nil {
+				respondWithError(rw, errBadReqBody)
+				return
+			}
+
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			if vs := c.Contract.ValidateRequest(r, body); len(vs) > 0 {
+				capturer.violate(c.resourceOf(capturer.Route, r, body), vs)
+			}
+		}
+
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// resourceOf returns the resource the request made to route is about, if it
+// can tell, so the requests made while testing different resources can be
+// told apart: those about a callback are about the callback's resource, and
+// those made on behalf of a user about the resource the user signed in to.
+func (c *FakeConnector) resourceOf(route string, r *http.Request, body []byte) manifold.ID {
+	switch {
+	case strings.HasPrefix(route, "/v1/resources/"):
+		ID, _ := manifold.DecodeIDFromString(bone.GetValue(r, "id"))
+		return ID
+	case route == "/v1/callbacks/{id}":
+		ID, err := manifold.DecodeIDFromString(bone.GetValue(r, "id"))
+		if err != nil {
+			return manifold.ID{}
+		}
+		if cb := c.GetCallback(ID); cb != nil {
+			return cb.ResourceID
+		}
+		return manifold.ID{}
+	case route == "/v1/credential-rotations/{id}":
+		req := CredentialRotationRequest{}
+		json.Unmarshal(body, &req)
+		return req.ResourceID
+	case route == "/v1/oauth/tokens":
+		var code string
+		if hasFormValues(r) {
+			form, _ := url.ParseQuery(string(body))
+			code = form.Get("code")
+		} else {
+			data := CreateAccessTokenJSON{}
+			json.Unmarshal(body, &data)
+			code = data.Code
+		}
+		return c.resourceOfCode(code)
+	}
+
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return manifold.ID{}
+	}
+	if t := c.getToken(parts[1]); t != nil {
+		return c.resourceOfCode(t.Code)
+	}
+	return manifold.ID{}
+}
+
+// resourceOfCode returns the resource the authorization code signs in to, if
+// any.
+func (c *FakeConnector) resourceOfCode(code string) manifold.ID {
+	if code == "" {
+		return manifold.ID{}
+	}
+	if ac := c.getCode(code); ac != nil {
+		return ac.ResourceID
+	}
+	return manifold.ID{}
+}
+
 func (c *FakeConnector) getToken(token string) *AccessToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	for _, v := range c.tokens {
 		if v.AccessToken == token {
 			return v
@@ -228,39 +559,134 @@ func (c *FakeConnector) getToken(token string) *AccessToken {
 }
 
 func (c *FakeConnector) addToken(t *AccessToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.tokens = append(c.tokens, t)
+	c.persistToken(t)
 }
 
 // CreateCode returns an AuthorizationCode method
 func (c *FakeConnector) CreateCode() (*AuthorizationCode, error) {
+	return c.CreateCodeWith(AuthorizationCode{})
+}
+
+// CreateCodeFor returns a new AuthorizationCode for a user signing in to the
+// resource, which is the only one the access token granted for it may access.
+// The user is the first owner of the team owning the resource.
+func (c *FakeConnector) CreateCodeFor(resourceID manifold.ID) (*AuthorizationCode, error) {
+	return c.CreateCodeWith(AuthorizationCode{ResourceID: resourceID})
+}
+
+// CreateCodeForUser returns a new AuthorizationCode for the given user
+// signing in to the resource, whether they can access it or not.
+func (c *FakeConnector) CreateCodeForUser(resourceID, userID manifold.ID) (*AuthorizationCode, error) {
+	return c.CreateCodeWith(AuthorizationCode{ResourceID: resourceID, UserID: userID})
+}
+
+// codeLifetime is how long authorization codes can be exchanged for, unless
+// created with an expiry of their own.
+const codeLifetime = 5 * time.Minute
+
+// CreateCodeWith returns a new AuthorizationCode with the options set on the
+// given code, used to test how providers handle failed code exchanges. The
+// code itself is always generated, the expiry defaults to five minutes, and
+// the user to the one CreateCodeFor picks.
+func (c *FakeConnector) CreateCodeWith(opts AuthorizationCode) (*AuthorizationCode, error) {
+	if opts.UserID.IsEmpty() {
+		opts.UserID = c.defaultUser(opts.ResourceID)
+	} else if c.GetUser(opts.UserID) == nil {
+		return nil, ErrUserNotFound
+	}
+
 	b := make([]byte, 8)
 	_, err := rand.Read(b)
 	if err != nil {
 		return nil, err
 	}
 
-	code := base32.EncodeToString(b)
-	authCode := &AuthorizationCode{
-		Code:      code,
-		ExpiresAt: time.Now().Add(3600 * time.Second),
+	authCode := &opts
+	authCode.Code = base32.EncodeToString(b)
+	authCode.UsedAt = nil
+	if authCode.ExpiresAt.IsZero() {
+		authCode.ExpiresAt = c.now().Add(codeLifetime)
 	}
 
+	c.mu.Lock()
 	c.codes = append(c.codes, authCode)
+	c.mu.Unlock()
+
+	c.persist(codesBucket, authCode.Code, authCode)
+
 	return authCode, nil
 }
 
+// getCode returns a copy of the code, so it can be read as it's being
+// redeemed.
 func (c *FakeConnector) getCode(code string) *AuthorizationCode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	for _, v := range c.codes {
 		if v.Code == code {
-			return v
+			cp := *v
+			return &cp
 		}
 	}
 
 	return nil
 }
 
-// New creates and configures a FakeConnector
+// redeemCode marks the code as exchanged for an access token, returning
+// false if it already was. The access tokens granted for a code redeemed
+// twice are revoked, as it may have been intercepted.
+func (c *FakeConnector) redeemCode(code string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, v := range c.codes {
+		if v.Code != code {
+			continue
+		}
+
+		if v.UsedAt != nil {
+			c.revokeTokens(code)
+			return false
+		}
+
+		now := time.Now()
+		v.UsedAt = &now
+		c.persist(codesBucket, v.Code, v)
+		return true
+	}
+
+	return false
+}
+
+// revokeTokens removes the access tokens granted for the code. The caller
+// must hold the connector's lock.
+func (c *FakeConnector) revokeTokens(code string) {
+	tokens := c.tokens[:0]
+	for _, t := range c.tokens {
+		if t.Code == code {
+			c.unpersist(tokensBucket, t.AccessToken)
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	c.tokens = tokens
+}
+
+// New creates and configures a FakeConnector, holding its state in memory
 func New(port uint, clientID string, clientSecret string, product string) (*FakeConnector, error) {
+	return NewWithDB(db.New(), port, clientID, clientSecret, product)
+}
+
+// NewWithDB creates and configures a FakeConnector storing its state in the
+// given DB. The callbacks, credential rotations, authorization codes, access
+// tokens, OAuth credentials, users and teams already held by the DB's Store
+// are restored.
+func NewWithDB(d *db.DB, port uint, clientID string, clientSecret string, product string) (*FakeConnector, error) {
 	c := &FakeConnector{
 		Config: &FakeConnectorConfig{
 			Product:      product,
@@ -269,9 +695,22 @@ func New(port uint, clientID string, clientSecret string, product string) (*Fake
 			ClientSecret: clientSecret,
 			SigningKey:   "hello",
 		},
-		DB:         db.New(),
-		OnCallback: make(chan *Callback, 100),
-		capturers:  make(map[string]*RequestCapturer),
+		DB:        d,
+		capturers: make(map[string]*RequestCapturer),
+		rotations: make(map[manifold.ID]*CredentialRotation),
+		now:       time.Now,
+	}
+
+	if err := c.restore(); err != nil {
+		return nil, err
+	}
+
+	if err := c.addConfigCredential(); err != nil {
+		return nil, err
+	}
+
+	if err := c.addDefaultMember(); err != nil {
+		return nil, err
 	}
 
 	return c, nil
@@ -279,20 +718,42 @@ func New(port uint, clientID string, clientSecret string, product string) (*Fake
 
 // ValidHandler returns a set of endpoints that are valid and in use by the
 // production connector.
+//
+// Faults added to the connector are injected into every endpoint, except for
+// those of the admin API, and requests to them are validated against the
+// connector's Contract, if it has one, faulted or not.
 func ValidHandler(c *FakeConnector) *bone.Mux {
+	route := func(route string, h func(*FakeConnector, *RequestCapturer) http.HandlerFunc) http.Handler {
+		capturer := c.capturer(route)
+		return c.validated(capturer, c.faulty(route, h(c, capturer)))
+	}
+
 	mux := bone.New()
-	mux.PostFunc("/v1/oauth/tokens", createAccessTokenHandler(c, c.capturer("/v1/oauth/tokens")))
-	mux.GetFunc("/v1/self", getSelfHandler(c, c.capturer("/v1/self")))
-	mux.PutFunc("/v1/callbacks/:id", processCallbackHandler(c, c.capturer("/v1/callbacks/{id}")))
-	mux.GetFunc("/v1/resources/:id", getResourceHandler(c, c.capturer("/v1/resources/{id}")))
-	mux.GetFunc("/v1/resources/:id/users", getResourceUsersHandler(c,
-		c.capturer("/v1/resources/{id}/users")))
-	mux.GetFunc("/v1/resources/:id/credentials", getResourceCredentialsHandler(c,
-		c.capturer("/v1/resources/{id}/credentials")))
-	mux.GetFunc("/v1/resources/:id/measures", getResourceMeasuresHandler(c,
-		c.capturer("/v1/resources/{id}/measures")))
-	mux.PutFunc("/v1/resources/:id/measures", putResourceMeasuresHandler(c,
-		c.capturer("/v1/resources/{id}/measures")))
+	mux.Post("/v1/oauth/tokens", route("/v1/oauth/tokens", createAccessTokenHandler))
+	mux.Get("/v1/self", route("/v1/self", getSelfHandler))
+	mux.Put("/v1/callbacks/:id", route("/v1/callbacks/{id}", processCallbackHandler))
+	mux.Get("/v1/resources/:id", route("/v1/resources/{id}", getResourceHandler))
+	mux.Get("/v1/resources/:id/users", route("/v1/resources/{id}/users", getResourceUsersHandler))
+	mux.Get("/v1/resources/:id/credentials", route("/v1/resources/{id}/credentials", getResourceCredentialsHandler))
+	mux.Get("/v1/resources/:id/measures", route("/v1/resources/{id}/measures", getResourceMeasuresHandler))
+	mux.Put("/v1/resources/:id/measures", route("/v1/resources/{id}/measures", putResourceMeasuresHandler))
+	// bone routes paths ending in a slash by prefix, whatever the method
+	mux.Handle("/v1/credentials/", route("/v1/credentials/", oauthCredentialsHandler))
+	mux.Delete("/v1/credentials/:id", route("/v1/credentials/{id}", deleteOAuthCredentialHandler))
+	mux.Put("/v1/credential-rotations/:id", route("/v1/credential-rotations/{id}", putCredentialRotationHandler))
+
+	mux.GetFunc("/_grafton/callbacks", listCallbacksHandler(c))
+	mux.PostFunc("/_grafton/callbacks", createCallbackHandler(c))
+	mux.GetFunc("/_grafton/callbacks/:id", getCallbackHandler(c))
+	mux.PostFunc("/_grafton/callbacks/:id/expire", expireCallbackHandler(c))
+	mux.GetFunc("/_grafton/faults", listFaultsHandler(c))
+	mux.PostFunc("/_grafton/faults", createFaultHandler(c))
+	mux.DeleteFunc("/_grafton/faults", clearFaultsHandler(c))
+	mux.DeleteFunc("/_grafton/faults/:id", deleteFaultHandler(c))
+	mux.GetFunc("/_grafton/users", listUsersHandler(c))
+	mux.PostFunc("/_grafton/users", addMemberHandler(c))
+	mux.GetFunc("/_grafton/teams", listTeamsHandler(c))
+	mux.PutFunc("/_grafton/resources/:id/team", assignResourceHandler(c))
 	return mux
 }
 
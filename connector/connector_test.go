@@ -1,6 +1,12 @@
 package connector
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -9,6 +15,7 @@ import (
 	"github.com/manifoldco/go-manifold"
 	"github.com/manifoldco/go-manifold/idtype"
 	"github.com/manifoldco/go-manifold/names"
+	"github.com/manifoldco/grafton/contract"
 	"github.com/manifoldco/grafton/db"
 )
 
@@ -84,3 +91,158 @@ func TestConnector(t *testing.T) {
 		gm.Expect(found).To(gm.BeNil())
 	})
 }
+
+func TestWaitForCallback(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	c := getConnectorInstance()
+
+	t.Run("callbacks are delivered to the run waiting on them", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		cbs := make([]*Callback, 10)
+		for i := range cbs {
+			cb, err := c.AddCallback(ResourceProvisionCallback)
+			gm.Expect(err).ToNot(gm.HaveOccurred())
+			cbs[i] = cb
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, len(cbs))
+		for i, cb := range cbs {
+			wg.Add(2)
+			go func(cb *Callback) {
+				defer wg.Done()
+				got, err := c.WaitForCallback(cb.ID, 5*time.Second)
+				if err == nil && got.ID != cb.ID {
+					err = fmt.Errorf("expected callback %s, got %s", cb.ID, got.ID)
+				}
+				errs <- err
+			}(cb)
+
+			go func(i int, cb *Callback) {
+				defer wg.Done()
+				c.TriggerCallback(cb.ID, DoneCallbackState, fmt.Sprintf("done %d", i), nil)
+			}(i, cb)
+		}
+
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			gm.Expect(err).ToNot(gm.HaveOccurred())
+		}
+	})
+
+	t.Run("times out if the callback is never resolved", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		cb, err := c.AddCallback(ResourceProvisionCallback)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		_, err = c.WaitForCallback(cb.ID, 10*time.Millisecond)
+		gm.Expect(err).To(gm.Equal(ErrCallbackTimeout))
+	})
+}
+
+func TestContract(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	c, err := New(0, clientID, clientSecret, product)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	c.Contract, err = contract.Connector()
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	srv := httptest.NewServer(ValidHandler(c))
+	defer srv.Close()
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	}
+	token := getToken(t, srv.URL, form)
+
+	tokens, err := c.GetCapturer("/v1/oauth/tokens")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(tokens.Violations()).To(gm.BeEmpty())
+
+	t.Run("records the ways callbacks do not match the spec", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		cb, err := c.AddCallback(ResourceProvisionCallback)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		path := srv.URL + "/v1/callbacks/" + cb.ID.String()
+		putCallback(t, path, token, `{"state": "finished", "message": "provisioned", "extra": 1}`)
+
+		capturer, err := c.GetCapturer("/v1/callbacks/{id}")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(capturer.Violations()).To(gm.Equal([]contract.Violation{
+			{Method: "PUT", Route: "/callbacks/{id}", Message: "extra in body is a forbidden property"},
+			{Method: "PUT", Route: "/callbacks/{id}", Message: "state in body should be one of [done error]"},
+		}))
+	})
+
+	t.Run("tells apart the requests about each resource", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		r := makeResource(t, "high", "aws::us-east-1")
+		c.AddResource(r)
+
+		cb, err := c.AddCallbackFor(ResourceProvisionCallback, r.ID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		putCallback(t, srv.URL+"/v1/callbacks/"+cb.ID.String(), token, `{"state": "finished", "message": "provisioned"}`)
+
+		capturer, err := c.GetCapturer("/v1/callbacks/{id}")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(capturer.Violations()).To(gm.HaveLen(3))
+
+		own := capturer.ViolationsFor(func(ID manifold.ID) bool { return ID == r.ID })
+		gm.Expect(own).To(gm.Equal([]contract.Violation{
+			{Method: "PUT", Route: "/callbacks/{id}", Message: "state in body should be one of [done error]"},
+		}))
+
+		unowned := capturer.ViolationsFor(func(ID manifold.ID) bool { return ID.IsEmpty() })
+		gm.Expect(unowned).To(gm.HaveLen(2))
+	})
+
+	t.Run("rejects bodies too large to validate", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		cb, err := c.AddCallback(ResourceProvisionCallback)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		body := `{"state": "done", "message": "` + strings.Repeat("a", maxValidatedBody) + `"}`
+		rsp := putCallback(t, srv.URL+"/v1/callbacks/"+cb.ID.String(), token, body)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(http.StatusBadRequest))
+		gm.Expect(c.GetCallback(cb.ID).State).To(gm.Equal(PendingCallbackState))
+	})
+
+	t.Run("accepts measures as described by the spec", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		r := makeResource(t, "high", "aws::us-east-1")
+		c.AddResource(r)
+
+		body := `{"body": {"resource_id": "` + r.ID.String() + `", "period_start": "2019-01-01T00:00:00Z",
+			"period_end": "2019-01-31T23:59:59Z", "measures": {"storage": 10}}}`
+		req, err := http.NewRequest("PUT", srv.URL+"/v1/resources/"+r.ID.String()+"/measures", strings.NewReader(body))
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rsp, err := http.DefaultClient.Do(req)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		rsp.Body.Close()
+		gm.Expect(rsp.StatusCode).To(gm.Equal(204))
+
+		capturer, err := c.GetCapturer("/v1/resources/{id}/measures")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(capturer.Violations()).To(gm.BeEmpty())
+
+		measures := c.DB.GetMeasuresByResource(r.ID)
+		gm.Expect(measures).To(gm.HaveLen(1))
+		gm.Expect(measures[0].Measures).To(gm.Equal(map[string]int64{"storage": 10}))
+	})
+}
@@ -0,0 +1,283 @@
+package connector
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-zoo/bone"
+
+	"github.com/manifoldco/go-manifold"
+	merrors "github.com/manifoldco/go-manifold/errors"
+	"github.com/manifoldco/go-manifold/idtype"
+
+	"github.com/manifoldco/grafton"
+)
+
+// ErrOAuthCredentialNotFound represents an error which occurs if an OAuth
+// credential does not exist
+var ErrOAuthCredentialNotFound = errors.New("OAuth Credential Not Found")
+
+// credentialExpiry is how long credentials remain usable once a new
+// credential has been created, giving providers time to roll it out.
+const credentialExpiry = 24 * time.Hour
+
+var (
+	errInvalidCredentialID    = grafton.NewError(merrors.BadRequestError, "Invalid Credential ID Provided")
+	errInvalidDescription     = grafton.NewError(merrors.BadRequestError, "Description must be between 3 and 256 characters long")
+	errMissingOAuthCredential = grafton.NewError(merrors.NotFoundError, "Credential Not Found")
+	errMethodNotAllowed       = grafton.NewError(merrors.MethodNotAllowedError, "Method Not Allowed")
+)
+
+// CreateOAuthCredential creates a new OAuth credential pair. Every credential
+// still live is set to expire in 24 hours, like Manifold does.
+//
+// The fake connector serves a single product, so all credentials share the
+// same scope.
+func (c *FakeConnector) CreateOAuthCredential(req OAuthCredentialCreateRequest) (*OAuthCredential, error) {
+	ID, err := manifold.NewID(idtype.OAuthCredential)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	cred := &OAuthCredential{
+		ID:          ID,
+		Description: req.Description,
+		ProductID:   req.ProductID,
+		ProviderID:  req.ProviderID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		ClientID:    ID.String(),
+		Secret:      base64.RawURLEncoding.EncodeToString(b),
+	}
+
+	expiresAt := now.Add(credentialExpiry)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, o := range c.oauthCredentials {
+		if o.ExpiresAt == nil {
+			o.ExpiresAt = &expiresAt
+			o.UpdatedAt = now
+			c.persistOAuthCredential(o)
+		}
+	}
+	c.oauthCredentials = append(c.oauthCredentials, cred)
+	c.persistOAuthCredential(cred)
+
+	r := *cred
+	return &r, nil
+}
+
+// GetOAuthCredentials returns copies of all the OAuth credentials which have
+// not expired
+func (c *FakeConnector) GetOAuthCredentials() []OAuthCredential {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	creds := []OAuthCredential{}
+	for _, o := range c.oauthCredentials {
+		if o.Live(now) {
+			creds = append(creds, *o)
+		}
+	}
+
+	return creds
+}
+
+// DeleteOAuthCredential removes the OAuth credential with the given ID
+func (c *FakeConnector) DeleteOAuthCredential(ID manifold.ID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, o := range c.oauthCredentials {
+		if o.ID == ID {
+			c.oauthCredentials = append(c.oauthCredentials[:i], c.oauthCredentials[i+1:]...)
+			c.unpersist(oauthCredentialsBucket, ID.String())
+			return nil
+		}
+	}
+
+	return ErrOAuthCredentialNotFound
+}
+
+// getOAuthCredential returns the credential matching the given client id and
+// secret, whether it expired or not, or nil.
+func (c *FakeConnector) getOAuthCredential(clientID, secret string) *OAuthCredential {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, o := range c.oauthCredentials {
+		if o.ClientID == clientID && o.Secret == secret {
+			r := *o
+			return &r
+		}
+	}
+
+	return nil
+}
+
+// addConfigCredential stores the client id and secret the connector is
+// configured with as its first OAuth credential. If a credential for the
+// client id was restored, its secret is replaced with the configured one, and
+// it no longer expires: Grafton keeps accepting what it is configured with,
+// even if a credential created before the restart was meant to replace it.
+func (c *FakeConnector) addConfigCredential() error {
+	c.mu.Lock()
+	for _, o := range c.oauthCredentials {
+		if o.ClientID != c.Config.ClientID {
+			continue
+		}
+
+		if o.Secret != c.Config.ClientSecret || o.ExpiresAt != nil {
+			o.Secret = c.Config.ClientSecret
+			o.ExpiresAt = nil
+			o.UpdatedAt = time.Now().UTC()
+			c.persistOAuthCredential(o)
+		}
+
+		c.mu.Unlock()
+		return nil
+	}
+	c.mu.Unlock()
+
+	ID, err := manifold.DecodeIDFromString(c.Config.ClientID)
+	if err != nil {
+		// The configured client id can be any string, so it may not be a
+		// valid ID to list the credential under.
+		ID, err = manifold.NewID(idtype.OAuthCredential)
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	cred := &OAuthCredential{
+		ID:          ID,
+		Description: "grafton configured credential",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		ClientID:    c.Config.ClientID,
+		Secret:      c.Config.ClientSecret,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.oauthCredentials = append(c.oauthCredentials, cred)
+	c.persistOAuthCredential(cred)
+
+	return nil
+}
+
+func oauthCredentialsHandler(c *FakeConnector, capturer *RequestCapturer) http.HandlerFunc {
+	list := listOAuthCredentialsHandler(c, capturer)
+	create := createOAuthCredentialHandler(c, capturer)
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/v1/credentials/":
+			http.NotFound(rw, r)
+		case r.Method == "GET":
+			list(rw, r)
+		case r.Method == "POST":
+			create(rw, r)
+		default:
+			respondWithError(rw, errMethodNotAllowed)
+		}
+	}
+}
+
+func listOAuthCredentialsHandler(c *FakeConnector, _ *RequestCapturer) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if _, err := authorizeCredentialRequest(c, r); err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		respondWithJSON(rw, c.GetOAuthCredentials(), 200)
+	}
+}
+
+func createOAuthCredentialHandler(c *FakeConnector, capturer *RequestCapturer) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if _, err := authorizeCredentialRequest(c, r); err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		req := &OAuthCredentialCreateRequest{}
+		dec := json.NewDecoder(r.Body)
+		if err := dec.Decode(req); err != nil {
+			respondWithError(rw, errBadReqBody)
+			return
+		}
+
+		capturer.capture(req)
+
+		if len(req.Description) < 3 || len(req.Description) > 256 {
+			respondWithError(rw, errInvalidDescription)
+			return
+		}
+
+		cred, err := c.CreateOAuthCredential(*req)
+		if err != nil {
+			respondWithError(rw, errISE)
+			return
+		}
+
+		respondWithJSON(rw, &OAuthCredentialCreateResponse{
+			OAuthCredential: cred,
+			Secret:          cred.Secret,
+		}, 200)
+	}
+}
+
+func deleteOAuthCredentialHandler(c *FakeConnector, _ *RequestCapturer) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if _, err := authorizeCredentialRequest(c, r); err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		ID, err := manifold.DecodeIDFromString(bone.GetValue(r, "id"))
+		if err != nil {
+			respondWithError(rw, errInvalidCredentialID)
+			return
+		}
+
+		if err := c.DeleteOAuthCredential(ID); err != nil {
+			respondWithError(rw, errMissingOAuthCredential)
+			return
+		}
+
+		rw.WriteHeader(204)
+	}
+}
+
+// authorizeCredentialRequest authorizes requests managing OAuth credentials.
+// Manifold requires a user to be logged in; without users, the fake connector
+// requires a token granted through a live credential instead.
+func authorizeCredentialRequest(c *FakeConnector, r *http.Request) (*AccessToken, error) {
+	token, err := authorizeRequest(c, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.GrantType != ClientCredentialsGrantType {
+		return nil, errInvalidGrant
+	}
+
+	return token, nil
+}
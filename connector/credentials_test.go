@@ -0,0 +1,133 @@
+package connector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	gm "github.com/onsi/gomega"
+)
+
+func TestOAuthCredentials(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	c, err := New(0, clientID, clientSecret, product)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	srv := httptest.NewServer(ValidHandler(c))
+	defer srv.Close()
+
+	token := getToken(t, srv.URL, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	})
+
+	var created OAuthCredentialCreateResponse
+
+	t.Run("lists the configured credential", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		creds := listOAuthCredentials(t, srv.URL, token)
+		gm.Expect(creds).To(gm.HaveLen(1))
+		gm.Expect(creds[0].ID.String()).To(gm.Equal(clientID))
+		gm.Expect(creds[0].ExpiresAt).To(gm.BeNil())
+	})
+
+	t.Run("rejects a credential without a description", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		rsp := doCredentialRequest(t, "POST", srv.URL+"/v1/credentials/", token, `{"description": ""}`)
+		rsp.Body.Close()
+		gm.Expect(rsp.StatusCode).To(gm.Equal(400))
+	})
+
+	t.Run("creates a credential, expiring the others", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		rsp := doCredentialRequest(t, "POST", srv.URL+"/v1/credentials/", token, `{"description": "rotation"}`)
+		defer rsp.Body.Close()
+		gm.Expect(rsp.StatusCode).To(gm.Equal(200))
+		gm.Expect(json.NewDecoder(rsp.Body).Decode(&created)).To(gm.Succeed())
+		gm.Expect(created.Secret).ToNot(gm.BeEmpty())
+
+		creds := listOAuthCredentials(t, srv.URL, token)
+		gm.Expect(creds).To(gm.HaveLen(2))
+		gm.Expect(creds[0].ExpiresAt).ToNot(gm.BeNil())
+		gm.Expect(*creds[0].ExpiresAt).To(gm.BeTemporally("~", time.Now().Add(24*time.Hour), time.Minute))
+		gm.Expect(creds[1].ExpiresAt).To(gm.BeNil())
+
+		rsp = postToken(t, srv.URL, clientID, clientSecret)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(201), "the old credential is live until it expires")
+
+		rsp = postToken(t, srv.URL, created.ID.String(), created.Secret)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(201))
+	})
+
+	t.Run("rejects expired credentials", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		past := time.Now().Add(-time.Minute)
+		c.mu.Lock()
+		c.oauthCredentials[0].ExpiresAt = &past
+		c.mu.Unlock()
+
+		rsp := postToken(t, srv.URL, clientID, clientSecret)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(401))
+
+		creds := listOAuthCredentials(t, srv.URL, token)
+		gm.Expect(creds).To(gm.HaveLen(1))
+		gm.Expect(creds[0].ID).To(gm.Equal(created.ID))
+	})
+
+	t.Run("deletes a credential", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		rsp := doCredentialRequest(t, "DELETE", srv.URL+"/v1/credentials/"+created.ID.String(), token, "")
+		rsp.Body.Close()
+		gm.Expect(rsp.StatusCode).To(gm.Equal(204))
+
+		rsp = doCredentialRequest(t, "DELETE", srv.URL+"/v1/credentials/"+created.ID.String(), token, "")
+		rsp.Body.Close()
+		gm.Expect(rsp.StatusCode).To(gm.Equal(404))
+
+		rsp = postToken(t, srv.URL, created.ID.String(), created.Secret)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(401))
+	})
+}
+
+func postToken(t *testing.T, base, id, secret string) *http.Response {
+	rsp, err := http.PostForm(base+"/v1/oauth/tokens", url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {id},
+		"client_secret": {secret},
+	})
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	rsp.Body.Close()
+	return rsp
+}
+
+func listOAuthCredentials(t *testing.T, base, token string) []OAuthCredential {
+	rsp := doCredentialRequest(t, "GET", base+"/v1/credentials/", token, "")
+	defer rsp.Body.Close()
+	gm.Expect(rsp.StatusCode).To(gm.Equal(200))
+
+	var creds []OAuthCredential
+	gm.Expect(json.NewDecoder(rsp.Body).Decode(&creds)).To(gm.Succeed())
+	return creds
+}
+
+func doCredentialRequest(t *testing.T, method, u, token, body string) *http.Response {
+	req, err := http.NewRequest(method, u, strings.NewReader(body))
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rsp, err := http.DefaultClient.Do(req)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	return rsp
+}
@@ -0,0 +1,350 @@
+package connector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrFaultNotFound represents an error which occurs if a fault does not exist
+var ErrFaultNotFound = errors.New("Fault Not Found")
+
+// AnyRoute matches requests to every route of the Connector API.
+const AnyRoute = "*"
+
+const defaultRetryAfter = time.Second
+
+// Fault describes a failure injected into the requests the connector
+// receives, to test how providers cope with a flaky Connector. Faults are not
+// injected into the admin API.
+type Fault struct {
+	ID uint64 `json:"id"`
+
+	// Route is the route faults are injected into, as named by the request
+	// capturers, such as /v1/callbacks/{id}, or the path of a single
+	// request, such as the one completing a given callback. Faults are
+	// injected into every route if it is empty or AnyRoute.
+	Route string `json:"route"`
+
+	// Rate is the share of matching requests the fault is injected into,
+	// between 0 and 1. Faults are injected into every request if it is 0.
+	Rate float64 `json:"rate,omitempty"`
+
+	// Count is the number of requests the fault is injected into before it
+	// no longer applies, if not 0.
+	Count int `json:"count,omitempty"`
+
+	// Latency delays requests before they are handled, or failed.
+	Latency time.Duration `json:"latency,omitempty"`
+
+	// Status answers requests with the status code instead of handling them.
+	// Requests answered with 429 Too Many Requests are told to retry after
+	// RetryAfter, rounded up to the second, or a second if it is not set.
+	Status     int           `json:"status,omitempty"`
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+
+	// Drop closes the connection instead of answering requests.
+	Drop bool `json:"drop,omitempty"`
+
+	// Injected is the number of requests the fault was injected into, and
+	// InjectedAt when each of them was received.
+	Injected   int         `json:"injected"`
+	InjectedAt []time.Time `json:"injected_at,omitempty"`
+}
+
+// MarshalJSON encodes the fault, expressing its durations as strings such as
+// "1.5s".
+func (f Fault) MarshalJSON() ([]byte, error) {
+	type alias Fault
+	v := struct {
+		alias
+		Latency    string `json:"latency,omitempty"`
+		RetryAfter string `json:"retry_after,omitempty"`
+	}{alias: alias(f)}
+
+	if f.Latency != 0 {
+		v.Latency = f.Latency.String()
+	}
+	if f.RetryAfter != 0 {
+		v.RetryAfter = f.RetryAfter.String()
+	}
+
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a fault, parsing its durations from strings such as
+// "1.5s".
+func (f *Fault) UnmarshalJSON(b []byte) error {
+	type alias Fault
+	v := struct {
+		*alias
+		Latency    string `json:"latency"`
+		RetryAfter string `json:"retry_after"`
+	}{alias: (*alias)(f)}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	var err error
+	if f.Latency, err = parseFaultDuration(v.Latency); err != nil {
+		return fmt.Errorf("invalid latency: %s", err)
+	}
+	if f.RetryAfter, err = parseFaultDuration(v.RetryAfter); err != nil {
+		return fmt.Errorf("invalid retry_after: %s", err)
+	}
+
+	return nil
+}
+
+func parseFaultDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// ParseFault parses a fault from a comma separated list of key=value pairs,
+// as passed on the command line:
+//
+//	route=/v1/callbacks/{id},status=503,rate=0.5
+//	status=429,retry-after=5s,count=3
+//	route=/v1/oauth/tokens,latency=2s,drop
+//
+// Keys are named after the fields of a Fault.
+func ParseFault(s string) (Fault, error) {
+	f := Fault{}
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		key, value := kv[0], ""
+		if len(kv) == 2 {
+			value = kv[1]
+		}
+
+		var err error
+		switch key {
+		case "route":
+			f.Route = value
+		case "rate":
+			f.Rate, err = strconv.ParseFloat(value, 64)
+		case "count":
+			f.Count, err = strconv.Atoi(value)
+		case "latency":
+			f.Latency, err = time.ParseDuration(value)
+		case "status":
+			f.Status, err = strconv.Atoi(value)
+		case "retry-after":
+			f.RetryAfter, err = time.ParseDuration(value)
+		case "drop":
+			f.Drop = true
+			if value != "" {
+				f.Drop, err = strconv.ParseBool(value)
+			}
+		default:
+			return f, fmt.Errorf("unknown fault option %q", key)
+		}
+
+		if err != nil {
+			return f, fmt.Errorf("invalid fault option %q: %s", pair, err)
+		}
+	}
+
+	return f, f.Validate()
+}
+
+// Validate returns an error if the fault can't be injected.
+func (f *Fault) Validate() error {
+	switch {
+	case f.Route != "" && f.Route != AnyRoute && !strings.HasPrefix(f.Route, "/v1/"):
+		return errors.New("route must be * or start with /v1/")
+	case f.Rate < 0 || f.Rate > 1:
+		return errors.New("rate must be between 0 and 1")
+	case f.Count < 0:
+		return errors.New("count must not be negative")
+	case f.Latency < 0 || f.RetryAfter < 0:
+		return errors.New("durations must not be negative")
+	case f.Status != 0 && (f.Status < 400 || f.Status > 599):
+		return errors.New("status must be an error status code")
+	case f.Status != 0 && f.Drop:
+		return errors.New("a fault can't both answer with a status code and drop the connection")
+	case f.Status == 0 && !f.Drop && f.Latency == 0:
+		return errors.New("a fault must answer with a status code, drop the connection or add latency")
+	}
+
+	return nil
+}
+
+// matches returns whether the fault applies to the request made to route.
+func (f *Fault) matches(route string, r *http.Request) bool {
+	if f.Count != 0 && f.Injected >= f.Count {
+		return false
+	}
+
+	return f.Route == "" || f.Route == AnyRoute || f.Route == route || f.Route == r.URL.Path
+}
+
+// copy returns a copy of the fault which doesn't share its injection times.
+func (f *Fault) copy() Fault {
+	c := *f
+	c.InjectedAt = append([]time.Time(nil), f.InjectedAt...)
+	return c
+}
+
+// AddFault starts injecting the fault into the requests the connector
+// receives, returning it along with the ID it can be removed with.
+func (c *FakeConnector) AddFault(f Fault) (Fault, error) {
+	if err := f.Validate(); err != nil {
+		return f, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.faultSeq++
+	f.ID = c.faultSeq
+	f.Injected = 0
+	f.InjectedAt = nil
+	c.faults = append(c.faults, &f)
+
+	return f, nil
+}
+
+// GetFault returns a copy of the fault with the given ID, or
+// ErrFaultNotFound.
+func (c *FakeConnector) GetFault(ID uint64) (Fault, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, f := range c.faults {
+		if f.ID == ID {
+			return f.copy(), nil
+		}
+	}
+
+	return Fault{}, ErrFaultNotFound
+}
+
+// GetFaults returns a copy of every fault, in the order they were added.
+func (c *FakeConnector) GetFaults() []Fault {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	faults := make([]Fault, len(c.faults))
+	for i, f := range c.faults {
+		faults[i] = f.copy()
+	}
+
+	return faults
+}
+
+// RemoveFault stops injecting the fault with the given ID.
+func (c *FakeConnector) RemoveFault(ID uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, f := range c.faults {
+		if f.ID == ID {
+			c.faults = append(c.faults[:i], c.faults[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrFaultNotFound
+}
+
+// ClearFaults stops injecting every fault.
+func (c *FakeConnector) ClearFaults() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.faults = nil
+}
+
+// nextFault returns the fault to inject into the request made to route, if
+// any. Faults are considered in the order they were added, and the first one
+// matching the request, and not skipped given its rate, is injected.
+func (c *FakeConnector) nextFault(route string, r *http.Request) *Fault {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, f := range c.faults {
+		if !f.matches(route, r) {
+			continue
+		}
+
+		if f.Rate != 0 && rand.Float64() >= f.Rate {
+			continue
+		}
+
+		f.Injected++
+		f.InjectedAt = append(f.InjectedAt, time.Now().UTC())
+		injected := f.copy()
+		return &injected
+	}
+
+	return nil
+}
+
+// faulty injects the connector's faults into the requests made to route
+// before they reach h.
+func (c *FakeConnector) faulty(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		f := c.nextFault(route, r)
+		if f == nil {
+			h.ServeHTTP(rw, r)
+			return
+		}
+
+		if f.Latency > 0 {
+			select {
+			case <-time.After(f.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		switch {
+		case f.Drop:
+			// Closes the connection without writing a response
+			panic(http.ErrAbortHandler)
+		case f.Status != 0:
+			writeFault(rw, f)
+		default:
+			h.ServeHTTP(rw, r)
+		}
+	})
+}
+
+type faultResponse struct {
+	Type    string   `json:"type"`
+	Message []string `json:"message"`
+}
+
+func writeFault(rw http.ResponseWriter, f *Fault) {
+	if f.Status == http.StatusTooManyRequests {
+		wait := f.RetryAfter
+		if wait == 0 {
+			wait = defaultRetryAfter
+		}
+
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+
+	respondWithJSON(rw, faultResponse{
+		Type:    "injected_fault",
+		Message: []string{fmt.Sprintf("Fault %d injected by Grafton: %s", f.ID, http.StatusText(f.Status))},
+	}, f.Status)
+}
@@ -0,0 +1,146 @@
+package connector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	gm "github.com/onsi/gomega"
+)
+
+func TestParseFault(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	f, err := ParseFault("route=/v1/callbacks/{id},status=429,retry-after=2s,rate=0.5,count=3")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(f).To(gm.Equal(Fault{
+		Route:      "/v1/callbacks/{id}",
+		Status:     429,
+		RetryAfter: 2 * time.Second,
+		Rate:       0.5,
+		Count:      3,
+	}))
+
+	f, err = ParseFault("latency=1s, drop")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(f).To(gm.Equal(Fault{Latency: time.Second, Drop: true}))
+
+	for _, invalid := range []string{
+		"",
+		"route=/_grafton/callbacks,status=500",
+		"status=200",
+		"status=500,drop",
+		"status=500,rate=2",
+		"status=500,explode=yes",
+		"latency=soon",
+	} {
+		_, err := ParseFault(invalid)
+		gm.Expect(err).To(gm.HaveOccurred(), invalid)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	c, err := New(0, clientID, clientSecret, product)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	srv := httptest.NewServer(ValidHandler(c))
+	defer srv.Close()
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	}
+	token := getToken(t, srv.URL, form)
+
+	t.Run("answers with the status code for as many requests as asked", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		defer c.ClearFaults()
+
+		cb, err := c.AddCallback(ResourceProvisionCallback)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		path := "/v1/callbacks/" + cb.ID.String()
+		f, err := c.AddFault(Fault{Route: path, Status: 503, Count: 2})
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		for i := 0; i < 2; i++ {
+			rsp := putCallback(t, srv.URL+path, token, `{"state": "done", "message": "provisioned"}`)
+			gm.Expect(rsp.StatusCode).To(gm.Equal(503))
+		}
+
+		rsp := putCallback(t, srv.URL+path, token, `{"state": "done", "message": "provisioned"}`)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(204))
+
+		f, err = c.GetFault(f.ID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(f.Injected).To(gm.Equal(2))
+		gm.Expect(f.InjectedAt).To(gm.HaveLen(2))
+		gm.Expect(f.InjectedAt[0]).ToNot(gm.BeTemporally(">", f.InjectedAt[1]))
+		gm.Expect(c.GetCallback(cb.ID).Requests).To(gm.HaveLen(1))
+	})
+
+	t.Run("asks to retry later", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		defer c.ClearFaults()
+
+		_, err := c.AddFault(Fault{Route: "/v1/oauth/tokens", Status: 429, RetryAfter: 1500 * time.Millisecond})
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		rsp, err := http.PostForm(srv.URL+"/v1/oauth/tokens", form)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		rsp.Body.Close()
+
+		gm.Expect(rsp.StatusCode).To(gm.Equal(429))
+		gm.Expect(rsp.Header.Get("Retry-After")).To(gm.Equal("2"))
+	})
+
+	t.Run("drops connections after the latency", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		defer c.ClearFaults()
+
+		_, err := c.AddFault(Fault{Route: AnyRoute, Latency: 50 * time.Millisecond, Drop: true})
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		start := time.Now()
+		_, err = http.Get(srv.URL + "/v1/self")
+		gm.Expect(err).To(gm.HaveOccurred())
+		gm.Expect(time.Since(start)).To(gm.BeNumerically(">=", 50*time.Millisecond))
+	})
+
+	t.Run("is controlled through the admin API", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		var created Fault
+		rsp := adminRequest(t, "POST", srv.URL+"/_grafton/faults",
+			`{"route": "/v1/self", "status": 502, "latency": "10ms"}`, &created)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(201))
+		gm.Expect(created.Latency).To(gm.Equal(10 * time.Millisecond))
+
+		rsp = adminRequest(t, "POST", srv.URL+"/_grafton/faults", `{"route": "/v1/self", "status": 200}`, nil)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(400))
+
+		self, err := http.Get(srv.URL + "/v1/self")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		self.Body.Close()
+		gm.Expect(self.StatusCode).To(gm.Equal(502))
+
+		var list []Fault
+		rsp = adminRequest(t, "GET", srv.URL+"/_grafton/faults", "", &list)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(200))
+		gm.Expect(list).To(gm.HaveLen(1))
+		gm.Expect(list[0].Injected).To(gm.Equal(1))
+
+		rsp = adminRequest(t, "DELETE", srv.URL+"/_grafton/faults/"+strconv.FormatUint(created.ID, 10), "", nil)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(204))
+		gm.Expect(c.GetFaults()).To(gm.BeEmpty())
+
+		rsp = adminRequest(t, "DELETE", srv.URL+"/_grafton/faults/"+strconv.FormatUint(created.ID, 10), "", nil)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(404))
+	})
+}
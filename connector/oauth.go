@@ -33,9 +33,13 @@ var (
 
 	errInvalidOAuthContentType = connector.NewOAuthError(cerrors.InvalidRequestErrorType, "Invalid content type")
 	errInvalidClientCreds      = connector.NewOAuthError(cerrors.InvalidClientErrorType, "Invalid client credentials")
+	errExpiredClientCreds      = connector.NewOAuthError(cerrors.InvalidClientErrorType, "Client credentials have expired")
 
 	errMissingCode = connector.NewOAuthError(cerrors.InvalidGrantErrorType, "No code provided")
 	errExpiredCode = connector.NewOAuthError(cerrors.InvalidGrantErrorType, "Authorization code has expired")
+	errUsedCode    = connector.NewOAuthError(cerrors.InvalidGrantErrorType, "Authorization code has already been used")
+
+	errCodeServerError = connector.NewOAuthError(cerrors.ServerErrorErrorType, "Internal server error")
 )
 
 type claims struct {
@@ -97,15 +101,21 @@ func getSelfHandler(c *FakeConnector, capturer *RequestCapturer) http.HandlerFun
 			return
 		}
 
+		if token.Code != "" {
+			capturer.capture(&UserRequest{Code: token.Code})
+		}
+
 		var body interface{}
 		switch token.GrantType {
 		case AuthorizationCodeGrantType:
+			user := c.codeUser(token.Code)
+			if user == nil {
+				respondWithError(rw, errUnauthorized)
+				return
+			}
 			body = UserProfile{
-				Type: "user",
-				Target: &UserTarget{
-					Name:  "joe user",
-					Email: "joe@user.com",
-				},
+				Type:   "user",
+				Target: user,
 			}
 		case ClientCredentialsGrantType:
 			body = ProductProfile{
@@ -220,7 +230,7 @@ func createAccessTokenHandler(c *FakeConnector, capturer *RequestCapturer) http.
 		}
 
 		jwtString, _, err := jwt.New(c.Config.SigningKey, &claims{
-			ClientID: c.Config.ClientID,
+			ClientID: id,
 			TokenID:  tokenID,
 		}, nil)
 		if err != nil {
@@ -236,6 +246,9 @@ func createAccessTokenHandler(c *FakeConnector, capturer *RequestCapturer) http.
 			GrantType:   tokReq.GrantType,
 			ID:          tokenID,
 		}
+		if t.GrantType == AuthorizationCodeGrantType {
+			t.Code = tokReq.Code
+		}
 
 		c.addToken(t)
 		respondWithJSON(rw, t, 201)
@@ -243,29 +256,66 @@ func createAccessTokenHandler(c *FakeConnector, capturer *RequestCapturer) http.
 }
 
 func validateAuthCodeGrant(c *FakeConnector, t *TokenRequest) *connector.OAuthError {
-	err := validateClientCredentialGrant(c, t)
+	code := c.getCode(t.Code)
+
+	var err *connector.OAuthError
+	if code != nil && (code.ClientID != "" || code.ClientSecret != "") {
+		clientID, clientSecret := c.Config.ClientID, c.Config.ClientSecret
+		if code.ClientID != "" {
+			clientID = code.ClientID
+		}
+		if code.ClientSecret != "" {
+			clientSecret = code.ClientSecret
+		}
+
+		err = validateClientCredentials(t, clientID, clientSecret)
+	} else {
+		err = validateClientCredentialGrant(c, t)
+	}
 	if err != nil {
 		return err
 	}
 
 	switch {
-	case c.getCode(t.Code) == nil:
+	case code == nil:
 		err = errMissingCode
-	case c.getCode(t.Code).ExpiresAt.Unix()-time.Now().UTC().Unix() < 1:
+	case code.ExpiresAt.Unix()-c.now().UTC().Unix() < 1:
 		err = errExpiredCode
+	case code.ServerError:
+		err = errCodeServerError
+	case !c.redeemCode(code.Code):
+		err = errUsedCode
 	}
 
 	return err
 }
 
+// validateClientCredentialGrant accepts any of the connector's OAuth
+// credentials which has not expired.
 func validateClientCredentialGrant(c *FakeConnector, t *TokenRequest) *connector.OAuthError {
+	if t.ContentType != "application/x-www-form-urlencoded" {
+		return errInvalidOAuthContentType
+	}
+
+	cred := c.getOAuthCredential(t.ClientID, t.ClientSecret)
+	switch {
+	case cred == nil:
+		return errInvalidClientCreds
+	case !cred.Live(time.Now()):
+		return errExpiredClientCreds
+	}
+
+	return nil
+}
+
+func validateClientCredentials(t *TokenRequest, clientID, clientSecret string) *connector.OAuthError {
 	var err *connector.OAuthError
 	switch {
 	case t.ContentType != "application/x-www-form-urlencoded":
 		err = errInvalidOAuthContentType
-	case t.ClientID != c.Config.ClientID:
+	case t.ClientID != clientID:
 		fallthrough
-	case t.ClientSecret != c.Config.ClientSecret:
+	case t.ClientSecret != clientSecret:
 		err = errInvalidClientCreds
 	}
 
@@ -2,10 +2,12 @@ package connector
 
 import (
 	"encoding/base64"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	gm "github.com/onsi/gomega"
 )
@@ -176,4 +178,145 @@ func TestCreateAccessTokenHandler(t *testing.T) {
 			handler.ServeHTTP(rec, req)
 			gm.Expect(rec.Code).To(gm.Equal(400))
 		})
+
+	t.Run("create access token [authorization_code] uses the client credentials of the code",
+		func(t *testing.T) {
+			gm.RegisterTestingT(t)
+
+			authCode, err := c.CreateCodeWith(AuthorizationCode{ClientID: "fake-client"})
+			gm.Expect(err).ToNot(gm.HaveOccurred())
+
+			req := httptest.NewRequest("POST", "/oauth/tokens", strings.NewReader(`{
+				"grant_type": "authorization_code",
+				"client_id": "`+clientID+`",
+				"client_secret": "`+clientSecret+`",
+				"code": "`+authCode.Code+`"
+			}`))
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+			gm.Expect(rec.Code).To(gm.Equal(401))
+		})
+
+	t.Run("create access token [authorization_code] fails for a code set to error",
+		func(t *testing.T) {
+			gm.RegisterTestingT(t)
+
+			authCode, err := c.CreateCodeWith(AuthorizationCode{ServerError: true})
+			gm.Expect(err).ToNot(gm.HaveOccurred())
+
+			req := httptest.NewRequest("POST", "/oauth/tokens", strings.NewReader(`{
+				"grant_type": "authorization_code",
+				"client_id": "`+clientID+`",
+				"client_secret": "`+clientSecret+`",
+				"code": "`+authCode.Code+`"
+			}`))
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+			gm.Expect(rec.Body.String()).To(gm.ContainSubstring("server_error"))
+		})
+}
+
+func TestSingleSignOn(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	c, err := New(0, clientID, clientSecret, product)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	srv := httptest.NewServer(ValidHandler(c))
+	defer srv.Close()
+
+	r := makeResource(t, "high", "aws::us-east-1")
+	c.AddResource(r)
+	other := makeResource(t, "high", "aws::us-east-1")
+	c.AddResource(other)
+
+	exchange := func(code string) *http.Response {
+		rsp, err := http.PostForm(srv.URL+"/v1/oauth/tokens", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+		})
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		rsp.Body.Close()
+		return rsp
+	}
+
+	get := func(path, token string) int {
+		req, err := http.NewRequest("GET", srv.URL+path, nil)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rsp, err := http.DefaultClient.Do(req)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		rsp.Body.Close()
+		return rsp.StatusCode
+	}
+
+	t.Run("codes expire after five minutes", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		now := time.Now()
+		c.now = func() time.Time { return now }
+		defer func() { c.now = time.Now }()
+
+		code, err := c.CreateCode()
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(code.ExpiresAt).To(gm.BeTemporally("==", now.Add(5*time.Minute)))
+		expiring, err := c.CreateCode()
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		now = now.Add(5*time.Minute - 2*time.Second)
+		gm.Expect(exchange(code.Code).StatusCode).To(gm.Equal(201))
+
+		now = now.Add(3 * time.Second)
+		gm.Expect(exchange(expiring.Code).StatusCode).To(gm.Equal(400))
+	})
+
+	t.Run("codes can only be exchanged once", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		code, err := c.CreateCodeFor(r.ID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		token := getToken(t, srv.URL, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code.Code},
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+		})
+		gm.Expect(get("/v1/self", token)).To(gm.Equal(200))
+
+		gm.Expect(exchange(code.Code).StatusCode).To(gm.Equal(400))
+		gm.Expect(get("/v1/self", token)).To(gm.Equal(401), "the token granted for a reused code is revoked")
+	})
+
+	t.Run("tokens only access the resource their code was created for", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		code, err := c.CreateCodeFor(r.ID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		token := getToken(t, srv.URL, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code.Code},
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+		})
+
+		gm.Expect(get("/v1/resources/"+r.ID.String(), token)).To(gm.Equal(200))
+		gm.Expect(get("/v1/resources/"+other.ID.String(), token)).To(gm.Equal(404))
+		gm.Expect(get("/v1/resources/"+other.ID.String()+"/credentials", token)).To(gm.Equal(404))
+
+		capturer, err := c.GetCapturer("/v1/resources/{id}")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(capturer.Get()).To(gm.ConsistOf(
+			&UserRequest{Code: code.Code, ResourceID: r.ID},
+			&UserRequest{Code: code.Code, ResourceID: other.ID},
+		))
+	})
 }
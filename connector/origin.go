@@ -0,0 +1,76 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/manifoldco/go-manifold"
+)
+
+// OriginTransport is an http.RoundTripper recording the requests sent to a
+// provider along with a callback, named by their X-Callback-ID header, as the
+// request the Connector's callback originated from. Only the first attempt
+// at a request is recorded when it is retried.
+//
+// The Connector may be set once the transport is in use, such as when the
+// provider's client is created first; requests are sent without being
+// recorded until then.
+type OriginTransport struct {
+	// Connector holds the callbacks requests are recorded on.
+	Connector *FakeConnector
+
+	// Transport sends the requests. It defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *OriginTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt := t.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	ID, err := manifold.DecodeIDFromString(req.Header.Get("X-Callback-ID"))
+	if t.Connector == nil || err != nil {
+		return rt.RoundTrip(req)
+	}
+
+	o := CallbackOrigin{SentAt: time.Now().UTC(), Method: req.Method, Path: req.URL.Path}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if json.Valid(body) {
+			o.Body = body
+		}
+	}
+
+	t.Connector.recordOrigin(ID, o)
+	return rt.RoundTrip(req)
+}
+
+// recordOrigin sets the request the callback originated from, unless it is
+// unknown or already has one.
+func (c *FakeConnector) recordOrigin(ID manifold.ID, o CallbackOrigin) {
+	cb := c.GetCallback(ID)
+	if cb == nil {
+		return
+	}
+
+	cb.Mutex.Lock()
+	defer cb.Mutex.Unlock()
+
+	if cb.Origin != nil {
+		return
+	}
+
+	cb.Origin = &o
+	c.persistCallback(cb)
+}
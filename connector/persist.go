@@ -0,0 +1,271 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/manifoldco/go-manifold"
+)
+
+// Buckets of the DB's Store holding the connector's own state
+const (
+	callbacksBucket        = "connector-callbacks"
+	rotationsBucket        = "connector-rotations"
+	codesBucket            = "connector-codes"
+	tokensBucket           = "connector-tokens"
+	oauthCredentialsBucket = "connector-oauth-credentials"
+	usersBucket            = "connector-users"
+	teamsBucket            = "connector-teams"
+)
+
+// callbackRecord, tokenRecord and oauthCredentialRecord are the documents
+// written to the Store, including the fields hidden from the API.
+type callbackRecord struct {
+	ID          manifold.ID       `json:"id"`
+	Type        CallbackType      `json:"type"`
+	State       CallbackState     `json:"state"`
+	Message     string            `json:"message"`
+	Credentials map[string]string `json:"credentials"`
+	ResourceID  manifold.ID       `json:"resource_id"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Requests    []CallbackAttempt `json:"requests,omitempty"`
+	Origin      *CallbackOrigin   `json:"origin,omitempty"`
+}
+
+type tokenRecord struct {
+	AccessToken
+	ID        manifold.ID `json:"id"`
+	GrantType GrantType   `json:"grant_type"`
+	Code      string      `json:"code,omitempty"`
+}
+
+type oauthCredentialRecord struct {
+	OAuthCredential
+	ClientID string `json:"client_id"`
+	Secret   string `json:"secret"`
+}
+
+// persistCallback writes the callback to the store. The caller must hold the
+// callback's Mutex, or own the callback before it is added.
+func (c *FakeConnector) persistCallback(cb *Callback) {
+	c.persist(callbacksBucket, cb.ID.String(), callbackRecord{
+		ID:          cb.ID,
+		Type:        cb.Type,
+		State:       cb.State,
+		Message:     cb.Message,
+		Credentials: cb.Credentials,
+		ResourceID:  cb.ResourceID,
+		CreatedAt:   cb.CreatedAt,
+		UpdatedAt:   cb.UpdatedAt,
+		Requests:    cb.Requests,
+		Origin:      cb.Origin,
+	})
+}
+
+// persistRotation writes the rotation to the store. The caller must hold the
+// connector's lock.
+func (c *FakeConnector) persistRotation(rot *CredentialRotation) {
+	c.persist(rotationsBucket, rot.ID.String(), rot)
+}
+
+func (c *FakeConnector) persistToken(t *AccessToken) {
+	c.persist(tokensBucket, t.AccessToken, tokenRecord{
+		AccessToken: *t,
+		ID:          t.ID,
+		GrantType:   t.GrantType,
+		Code:        t.Code,
+	})
+}
+
+func (c *FakeConnector) persistOAuthCredential(o *OAuthCredential) {
+	c.persist(oauthCredentialsBucket, o.ID.String(), oauthCredentialRecord{
+		OAuthCredential: *o,
+		ClientID:        o.ClientID,
+		Secret:          o.Secret,
+	})
+}
+
+// persist writes the document to the DB's store. The connector keeps serving
+// from memory if the write fails, so the error is only logged.
+func (c *FakeConnector) persist(bucket, key string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err == nil {
+		err = c.DB.Store().Put(bucket, key, b)
+	}
+	if err != nil {
+		logrus.WithError(err).Errorf("could not persist %s %s", bucket, key)
+	}
+}
+
+func (c *FakeConnector) unpersist(bucket, key string) {
+	if err := c.DB.Store().Delete(bucket, key); err != nil {
+		logrus.WithError(err).Errorf("could not delete %s %s", bucket, key)
+	}
+}
+
+// restore loads the state persisted in the DB's store. Callbacks resolved
+// before a restart can still be waited on, while pending ones can be
+// triggered by the provider once the connector is back. Rotations still
+// pending were interrupted, and fail; the provider can start a new one.
+func (c *FakeConnector) restore() error {
+	s := c.DB.Store()
+
+	callbacks, err := s.All(callbacksBucket)
+	if err != nil {
+		return err
+	}
+	for k, v := range callbacks {
+		var rec callbackRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return fmt.Errorf("could not restore callback %s: %s", k, err)
+		}
+
+		cb := &Callback{
+			ID:          rec.ID,
+			Mutex:       &sync.Mutex{},
+			Type:        rec.Type,
+			State:       rec.State,
+			Message:     rec.Message,
+			Credentials: rec.Credentials,
+			ResourceID:  rec.ResourceID,
+			CreatedAt:   rec.CreatedAt,
+			UpdatedAt:   rec.UpdatedAt,
+			Requests:    rec.Requests,
+			Origin:      rec.Origin,
+			resolved:    make(chan struct{}),
+		}
+		if cb.Credentials == nil {
+			cb.Credentials = make(map[string]string)
+		}
+		if cb.State != PendingCallbackState {
+			close(cb.resolved)
+		}
+		c.callbacks = append(c.callbacks, cb)
+	}
+	sort.Slice(c.callbacks, func(i, j int) bool {
+		return c.callbacks[i].CreatedAt.Before(c.callbacks[j].CreatedAt)
+	})
+
+	rotations, err := s.All(rotationsBucket)
+	if err != nil {
+		return err
+	}
+	for k, v := range rotations {
+		rot := &CredentialRotation{}
+		if err := json.Unmarshal(v, rot); err != nil {
+			return fmt.Errorf("could not restore credential rotation %s: %s", k, err)
+		}
+
+		if rot.State == PendingRotationState {
+			rot.State = ErrorRotationState
+			rot.Message = "Interrupted by a restart of the Connector"
+			c.persistRotation(rot)
+		}
+		rot.finished = make(chan struct{})
+		close(rot.finished)
+		c.rotations[rot.ID] = rot
+	}
+
+	codes, err := s.All(codesBucket)
+	if err != nil {
+		return err
+	}
+	for k, v := range codes {
+		code := &AuthorizationCode{}
+		if err := json.Unmarshal(v, code); err != nil {
+			return fmt.Errorf("could not restore authorization code %s: %s", k, err)
+		}
+		c.codes = append(c.codes, code)
+	}
+
+	tokens, err := s.All(tokensBucket)
+	if err != nil {
+		return err
+	}
+	for k, v := range tokens {
+		var rec tokenRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return fmt.Errorf("could not restore access token %s: %s", k, err)
+		}
+		t := rec.AccessToken
+		t.ID = rec.ID
+		t.GrantType = rec.GrantType
+		t.Code = rec.Code
+		c.tokens = append(c.tokens, &t)
+	}
+
+	creds, err := s.All(oauthCredentialsBucket)
+	if err != nil {
+		return err
+	}
+	for k, v := range creds {
+		var rec oauthCredentialRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return fmt.Errorf("could not restore OAuth credential %s: %s", k, err)
+		}
+		o := rec.OAuthCredential
+		o.ClientID = rec.ClientID
+		o.Secret = rec.Secret
+		c.oauthCredentials = append(c.oauthCredentials, &o)
+	}
+	sort.Slice(c.oauthCredentials, func(i, j int) bool {
+		return c.oauthCredentials[i].CreatedAt.Before(c.oauthCredentials[j].CreatedAt)
+	})
+
+	users, err := s.All(usersBucket)
+	if err != nil {
+		return err
+	}
+	for k, v := range users {
+		u := &User{}
+		if err := json.Unmarshal(v, u); err != nil {
+			return fmt.Errorf("could not restore user %s: %s", k, err)
+		}
+		c.users = append(c.users, u)
+	}
+	sort.Slice(c.users, func(i, j int) bool {
+		return c.users[i].CreatedAt.Before(c.users[j].CreatedAt)
+	})
+
+	// The first team owns the resources not assigned to another one, so
+	// teams are kept in the order they were created.
+	teams, err := s.All(teamsBucket)
+	if err != nil {
+		return err
+	}
+	for k, v := range teams {
+		t := &Team{}
+		if err := json.Unmarshal(v, t); err != nil {
+			return fmt.Errorf("could not restore team %s: %s", k, err)
+		}
+		c.teams = append(c.teams, t)
+	}
+	sort.Slice(c.teams, func(i, j int) bool {
+		return c.teams[i].CreatedAt.Before(c.teams[j].CreatedAt)
+	})
+
+	return nil
+}
+
+// PendingCallbacks returns the callbacks which have not been resolved yet
+func (c *FakeConnector) PendingCallbacks() []*Callback {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var pending []*Callback
+	for _, cb := range c.callbacks {
+		cb.Mutex.Lock()
+		if cb.State == PendingCallbackState {
+			pending = append(pending, cb)
+		}
+		cb.Mutex.Unlock()
+	}
+
+	return pending
+}
@@ -0,0 +1,181 @@
+package connector
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	gm "github.com/onsi/gomega"
+
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/idtype"
+
+	"github.com/manifoldco/grafton/db"
+)
+
+func TestRestore(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	d := db.New()
+	c, err := NewWithDB(d, 0, clientID, clientSecret, product)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	r := makeResource(t, "high", "aws::us-east-1")
+	c.AddResource(r)
+
+	pending, err := c.AddCallbackFor(ResourceProvisionCallback, r.ID)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	done, err := c.AddCallback(CredentialProvisionCallback)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(c.TriggerCallback(done.ID, DoneCallbackState, "done", map[string]string{"A": "B"})).To(gm.Succeed())
+
+	code, err := c.CreateCode()
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	cred, err := c.CreateOAuthCredential(OAuthCredentialCreateRequest{Description: "rotated"})
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	user, err := c.AddMember(Member{Name: "Ada Lovelace", Email: "ada@example.com", Team: "Design"})
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	var rotations []*CredentialRotation
+	for _, state := range []RotationState{DoneRotationState, PendingRotationState} {
+		ID, err := manifold.NewID(idtype.Operation)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		credID, err := manifold.NewID(idtype.Credential)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		rotations = append(rotations, &CredentialRotation{
+			ID:      ID,
+			Request: CredentialRotationRequest{ResourceID: r.ID, CredentialID: credID, Reason: "leaked"},
+			State:   state,
+		})
+	}
+	c.mu.Lock()
+	for _, rot := range rotations {
+		c.rotations[rot.ID] = rot
+		c.persistRotation(rot)
+	}
+	c.mu.Unlock()
+
+	srv := httptest.NewServer(ValidHandler(c))
+	token := getToken(t, srv.URL, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {cred.ClientID},
+		"client_secret": {cred.Secret},
+	})
+	srv.Close()
+
+	// A new connector over the same store picks up where the first left off
+	restarted, err := NewWithDB(d, 0, clientID, clientSecret, product)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	t.Run("restores pending callbacks", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		callbacks := restarted.PendingCallbacks()
+		gm.Expect(callbacks).To(gm.HaveLen(1))
+		gm.Expect(callbacks[0].ID).To(gm.Equal(pending.ID))
+		gm.Expect(callbacks[0].ResourceID).To(gm.Equal(r.ID))
+
+		gm.Expect(restarted.TriggerCallback(pending.ID, DoneCallbackState, "provisioned", nil)).To(gm.Succeed())
+		cb, err := restarted.WaitForCallback(pending.ID, time.Second)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(cb.State).To(gm.Equal(DoneCallbackState))
+	})
+
+	t.Run("restores resolved callbacks", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		cb, err := restarted.WaitForCallback(done.ID, time.Second)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(cb.Credentials).To(gm.Equal(map[string]string{"A": "B"}))
+	})
+
+	t.Run("restores rotations, failing those interrupted", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		rot, err := restarted.WaitForRotation(rotations[0].ID, time.Second)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(rot.State).To(gm.Equal(DoneRotationState))
+		gm.Expect(rot.Request).To(gm.Equal(rotations[0].Request))
+
+		rot, err = restarted.WaitForRotation(rotations[1].ID, time.Second)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(rot.State).To(gm.Equal(ErrorRotationState))
+
+		rot, err = restarted.WaitForRotationOf(rotations[1].Request.CredentialID, time.Second)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(rot.ID).To(gm.Equal(rotations[1].ID))
+	})
+
+	t.Run("restores codes, tokens and credentials", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		gm.Expect(restarted.getCode(code.Code)).ToNot(gm.BeNil())
+
+		tok := restarted.getToken(token)
+		gm.Expect(tok).ToNot(gm.BeNil())
+		gm.Expect(tok.GrantType).To(gm.Equal(ClientCredentialsGrantType))
+
+		creds := restarted.GetOAuthCredentials()
+		gm.Expect(creds).To(gm.HaveLen(2))
+		gm.Expect(creds[0].ClientID).To(gm.Equal(clientID))
+		gm.Expect(creds[0].ExpiresAt).To(gm.BeNil())
+		gm.Expect(creds[1].Secret).To(gm.Equal(cred.Secret))
+	})
+
+	t.Run("restores users and teams", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		users := restarted.GetUsers()
+		gm.Expect(users).To(gm.HaveLen(2))
+		gm.Expect(users[0].Email).To(gm.Equal(defaultUserEmail))
+		gm.Expect(users[1]).To(gm.Equal(*user))
+
+		teams := restarted.GetTeams()
+		gm.Expect(teams).To(gm.HaveLen(2))
+		gm.Expect(teams[0].Name).To(gm.Equal(defaultTeamName))
+		gm.Expect(teams[1].Members).To(gm.Equal([]TeamMember{{UserID: user.ID, Role: UserTargetRoleMember}}))
+	})
+
+	t.Run("replaces the configured secret", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		reconfigured, err := NewWithDB(d, 0, clientID, "a new secret", product)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		creds := reconfigured.GetOAuthCredentials()
+		gm.Expect(creds).To(gm.HaveLen(2))
+		gm.Expect(creds[0].ClientID).To(gm.Equal(clientID))
+		gm.Expect(creds[0].Secret).To(gm.Equal("a new secret"))
+		gm.Expect(reconfigured.getOAuthCredential(clientID, clientSecret)).To(gm.BeNil())
+
+		restarted, err := NewWithDB(d, 0, clientID, "a new secret", product)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(restarted.GetOAuthCredentials()[0].Secret).To(gm.Equal("a new secret"))
+	})
+
+	t.Run("keeps the configured credential once it would have expired", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		expiring, err := NewWithDB(d, 0, clientID, clientSecret, product)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		expired := time.Now().Add(-time.Minute).UTC()
+		for _, o := range expiring.oauthCredentials {
+			if o.ClientID == clientID {
+				o.ExpiresAt = &expired
+				expiring.persistOAuthCredential(o)
+			}
+		}
+		gm.Expect(expiring.GetOAuthCredentials()).To(gm.HaveLen(1))
+
+		restarted, err := NewWithDB(d, 0, clientID, clientSecret, product)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		creds := restarted.GetOAuthCredentials()
+		gm.Expect(creds).To(gm.HaveLen(2))
+		gm.Expect(creds[0].ClientID).To(gm.Equal(clientID))
+		gm.Expect(creds[0].ExpiresAt).To(gm.BeNil())
+	})
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"net/http"
 
-	"github.com/manifoldco/go-manifold/idtype"
 	"github.com/manifoldco/grafton/db"
 
 	"github.com/go-zoo/bone"
@@ -21,9 +20,30 @@ var (
 	errMissingResource = grafton.NewError(errors.NotFoundError, "Resource Not Found")
 )
 
-func getResourceHandler(c *FakeConnector, _ *RequestCapturer) http.HandlerFunc {
+// getResourceFor returns the resource if the access token may access it.
+// Access tokens granted for a code bound to a resource, as when a user signs
+// in to it, may only access that one, and only if the user is a member of the
+// team owning it.
+func (c *FakeConnector) getResourceFor(t *AccessToken, id manifold.ID) *db.Resource {
+	if t.Code != "" {
+		code := c.getCode(t.Code)
+		if code == nil || (!code.ResourceID.IsEmpty() && code.ResourceID != id) {
+			return nil
+		}
+
+		if !code.UserID.IsEmpty() {
+			if _, ok := c.role(code.UserID, id); !ok {
+				return nil
+			}
+		}
+	}
+
+	return c.GetResource(id)
+}
+
+func getResourceHandler(c *FakeConnector, capturer *RequestCapturer) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
-		_, err := authorizeRequest(c, r)
+		token, err := authorizeRequest(c, r)
 		if err != nil {
 			respondWithError(rw, err)
 			return
@@ -41,7 +61,11 @@ func getResourceHandler(c *FakeConnector, _ *RequestCapturer) http.HandlerFunc {
 			return
 		}
 
-		resource := c.GetResource(ID)
+		if token.Code != "" {
+			capturer.capture(&UserRequest{Code: token.Code, ResourceID: ID})
+		}
+
+		resource := c.getResourceFor(token, ID)
 		if resource == nil {
 			respondWithError(rw, errMissingResource)
 			return
@@ -53,7 +77,7 @@ func getResourceHandler(c *FakeConnector, _ *RequestCapturer) http.HandlerFunc {
 
 func getResourceUsersHandler(c *FakeConnector, _ *RequestCapturer) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
-		_, err := authorizeRequest(c, r)
+		token, err := authorizeRequest(c, r)
 		if err != nil {
 			respondWithError(rw, err)
 			return
@@ -71,34 +95,19 @@ func getResourceUsersHandler(c *FakeConnector, _ *RequestCapturer) http.HandlerF
 			return
 		}
 
-		resource := c.GetResource(ID)
+		resource := c.getResourceFor(token, ID)
 		if resource == nil {
 			respondWithError(rw, errMissingResource)
 			return
 		}
 
-		uid, err := manifold.NewID(idtype.User)
-		if err != nil {
-			respondWithError(rw, err)
-			return
-		}
-
-		users := []UserTarget{
-			{
-				ID:    uid,
-				Name:  "Manny Fold",
-				Email: "manny@manifold.co",
-				Role:  UserTargetRoleOwner,
-			},
-		}
-
-		respondWithJSON(rw, users, 200)
+		respondWithJSON(rw, c.resourceUsers(resource.ID), 200)
 	}
 }
 
 func getResourceCredentialsHandler(c *FakeConnector, _ *RequestCapturer) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
-		_, err := authorizeRequest(c, r)
+		token, err := authorizeRequest(c, r)
 		if err != nil {
 			respondWithError(rw, err)
 			return
@@ -116,7 +125,7 @@ func getResourceCredentialsHandler(c *FakeConnector, _ *RequestCapturer) http.Ha
 			return
 		}
 
-		resource := c.GetResource(ID)
+		resource := c.getResourceFor(token, ID)
 		if resource == nil {
 			respondWithError(rw, errMissingResource)
 			return
@@ -130,7 +139,7 @@ func getResourceCredentialsHandler(c *FakeConnector, _ *RequestCapturer) http.Ha
 
 func getResourceMeasuresHandler(c *FakeConnector, _ *RequestCapturer) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
-		_, err := authorizeRequest(c, r)
+		token, err := authorizeRequest(c, r)
 		if err != nil {
 			respondWithError(rw, err)
 			return
@@ -148,7 +157,7 @@ func getResourceMeasuresHandler(c *FakeConnector, _ *RequestCapturer) http.Handl
 			return
 		}
 
-		resource := c.GetResource(ID)
+		resource := c.getResourceFor(token, ID)
 		if resource == nil {
 			respondWithError(rw, errMissingResource)
 			return
@@ -185,7 +194,7 @@ func getResourceMeasuresHandler(c *FakeConnector, _ *RequestCapturer) http.Handl
 
 func putResourceMeasuresHandler(c *FakeConnector, _ *RequestCapturer) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
-		_, err := authorizeRequest(c, r)
+		token, err := authorizeRequest(c, r)
 		if err != nil {
 			respondWithError(rw, err)
 			return
@@ -203,22 +212,32 @@ func putResourceMeasuresHandler(c *FakeConnector, _ *RequestCapturer) http.Handl
 			return
 		}
 
-		resource := c.GetResource(ID)
+		resource := c.getResourceFor(token, ID)
 		if resource == nil {
 			respondWithError(rw, errMissingResource)
 			return
 		}
 
-		inboundMeasure := &db.Measure{}
+		// The spec wraps measures in a body, while they've long been
+		// accepted on their own.
+		var req struct {
+			Body *db.Measure `json:"body"`
+			db.Measure
+		}
 		dec := json.NewDecoder(r.Body)
-		err = dec.Decode(inboundMeasure)
+		err = dec.Decode(&req)
 		if err != nil {
 			respondWithError(rw, errBadReqBody)
 			return
 		}
 
+		inboundMeasure := req.Measure
+		if req.Body != nil {
+			inboundMeasure = *req.Body
+		}
+
 		inboundMeasure.ResourceID = resource.ID
-		c.DB.PutMeasure(*inboundMeasure)
+		c.DB.PutMeasure(inboundMeasure)
 
 		rw.WriteHeader(204)
 	}
@@ -0,0 +1,320 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-zoo/bone"
+
+	"github.com/manifoldco/go-manifold"
+	merrors "github.com/manifoldco/go-manifold/errors"
+	"github.com/manifoldco/go-manifold/idtype"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/db"
+)
+
+// ErrRotationNotFound represents an error which occurs if a credential
+// rotation does not exist
+var ErrRotationNotFound = errors.New("Rotation Not Found")
+
+// ErrRotationTimeout represents an error which occurs if a credential
+// rotation did not finish in time
+var ErrRotationTimeout = errors.New("Exceeded Rotation Wait time")
+
+const providerRequestTimeout = 60 * time.Second
+
+var (
+	errInvalidRotationID = grafton.NewError(merrors.BadRequestError, "Invalid Rotation ID Provided")
+	errInvalidReason     = grafton.NewError(merrors.BadRequestError, "Reason must be between 3 and 256 characters long")
+	errRotationConflict  = grafton.NewError(merrors.BadRequestError,
+		"Rotation already started with a different payload")
+	errMissingCredential = grafton.NewError(merrors.NotFoundError, "Credential Not Found")
+	errNoProvider        = grafton.NewError(merrors.InternalServerError,
+		"Credential rotation is not available without a provider to rotate against")
+)
+
+func putCredentialRotationHandler(c *FakeConnector, capturer *RequestCapturer) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		token, err := authorizeRequest(c, r)
+		if err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		// Rotations are started by the provider itself, so only client
+		// credentials grant access to them
+		if token.GrantType != ClientCredentialsGrantType {
+			respondWithError(rw, errInvalidGrant)
+			return
+		}
+
+		if r.Header.Get("content-type") != "application/json" {
+			respondWithError(rw, errInvalidContentType)
+			return
+		}
+
+		ID, err := manifold.DecodeIDFromString(bone.GetValue(r, "id"))
+		if err != nil {
+			respondWithError(rw, errInvalidRotationID)
+			return
+		}
+
+		req := &CredentialRotationRequest{}
+		dec := json.NewDecoder(r.Body)
+		err = dec.Decode(req)
+		if err != nil {
+			respondWithError(rw, errBadReqBody)
+			return
+		}
+
+		capturer.capture(req)
+
+		if len(req.Reason) < 3 || len(req.Reason) > 256 {
+			respondWithError(rw, errInvalidReason)
+			return
+		}
+
+		_, err = c.StartRotation(ID, *req)
+		if err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		respondWithJSON(rw, nil, 202)
+	}
+}
+
+// StartRotation starts rotating the credential named in the request,
+// provisioning a new credential against the Provider before deprovisioning the
+// old one. The rotation runs in the background; use WaitForRotation to block
+// until it finishes.
+//
+// Starting a rotation again with the same ID and request returns the existing
+// rotation instead of starting a new one.
+func (c *FakeConnector) StartRotation(ID manifold.ID, req CredentialRotationRequest) (*CredentialRotation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if rot, ok := c.rotations[ID]; ok {
+		if rot.Request != req {
+			return nil, errRotationConflict
+		}
+
+		r := *rot
+		return &r, nil
+	}
+
+	if c.DB.GetResource(req.ResourceID) == nil {
+		return nil, errMissingResource
+	}
+
+	cred := c.DB.GetCredential(req.CredentialID)
+	if cred == nil || cred.ResourceID != req.ResourceID {
+		return nil, errMissingCredential
+	}
+
+	if c.Provider == nil {
+		return nil, errNoProvider
+	}
+
+	rot := &CredentialRotation{
+		ID:       ID,
+		Request:  req,
+		State:    PendingRotationState,
+		finished: make(chan struct{}),
+	}
+	c.rotations[ID] = rot
+	c.persistRotation(rot)
+
+	if c.rotationStarted != nil {
+		close(c.rotationStarted)
+		c.rotationStarted = nil
+	}
+
+	go c.rotate(rot)
+
+	r := *rot
+	return &r, nil
+}
+
+// GetRotation returns a copy of the rotation for the given id if it exists
+func (c *FakeConnector) GetRotation(ID manifold.ID) *CredentialRotation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rot, ok := c.rotations[ID]
+	if !ok {
+		return nil
+	}
+
+	r := *rot
+	return &r
+}
+
+// WaitForRotation blocks until the rotation with the given ID is no longer
+// pending, returning ErrRotationTimeout if it does not finish in time.
+func (c *FakeConnector) WaitForRotation(ID manifold.ID, timeout time.Duration) (*CredentialRotation, error) {
+	c.mu.Lock()
+	rot, ok := c.rotations[ID]
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, ErrRotationNotFound
+	}
+
+	select {
+	case <-rot.finished:
+		return c.GetRotation(ID), nil
+	case <-time.After(timeout):
+		return nil, ErrRotationTimeout
+	}
+}
+
+// WaitForRotationOf blocks until the provider starts rotating the credential
+// with the given ID, returning the rotation, which may still be pending. It
+// returns ErrRotationTimeout if no rotation of the credential starts in time.
+func (c *FakeConnector) WaitForRotationOf(credentialID manifold.ID, timeout time.Duration) (*CredentialRotation, error) {
+	deadline := time.After(timeout)
+
+	for {
+		c.mu.Lock()
+		for _, rot := range c.rotations {
+			if rot.Request.CredentialID == credentialID {
+				r := *rot
+				c.mu.Unlock()
+				return &r, nil
+			}
+		}
+
+		if c.rotationStarted == nil {
+			c.rotationStarted = make(chan struct{})
+		}
+		started := c.rotationStarted
+		c.mu.Unlock()
+
+		select {
+		case <-started:
+		case <-deadline:
+			return nil, ErrRotationTimeout
+		}
+	}
+}
+
+// rotate drives a rotation the same way Manifold does: a new credential is
+// provisioned and stored, then the old one is deprovisioned and removed.
+func (c *FakeConnector) rotate(rot *CredentialRotation) {
+	newID, err := manifold.NewID(idtype.Credential)
+	if err != nil {
+		c.finishRotation(rot, ErrorRotationState, newID, "Could not generate credential id: "+err.Error())
+		return
+	}
+
+	creds, err := c.provisionCredentials(rot.Request.ResourceID, newID)
+	if err != nil {
+		c.finishRotation(rot, ErrorRotationState, newID, "Could not provision new credential: "+err.Error())
+		return
+	}
+
+	c.DB.PutCredential(db.Credential{
+		ID:         newID,
+		Keys:       creds,
+		CreatedOn:  time.Now(),
+		ResourceID: rot.Request.ResourceID,
+	})
+
+	if err := c.deprovisionCredentials(rot.Request.ResourceID, rot.Request.CredentialID); err != nil {
+		c.finishRotation(rot, ErrorRotationState, newID, "Could not deprovision old credential: "+err.Error())
+		return
+	}
+
+	c.DB.DeleteCredential(rot.Request.CredentialID)
+	c.finishRotation(rot, DoneRotationState, newID, "Credential rotated")
+}
+
+func (c *FakeConnector) finishRotation(rot *CredentialRotation, state RotationState, newID manifold.ID, msg string) {
+	c.mu.Lock()
+	rot.State = state
+	rot.Message = msg
+	rot.NewCredentialID = newID
+	c.persistRotation(rot)
+	c.mu.Unlock()
+
+	close(rot.finished)
+}
+
+func (c *FakeConnector) provisionCredentials(resourceID, credentialID manifold.ID) (map[string]string, error) {
+	cb, err := c.AddCallbackFor(CredentialProvisionCallback, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), providerRequestTimeout)
+	defer cancel()
+
+	creds, _, async, err := c.Provider.ProvisionCredentials(ctx, cb.ID, resourceID, credentialID)
+	if err != nil {
+		return nil, err
+	}
+
+	if async {
+		cb, err = c.waitForDoneCallback(cb.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		creds = cb.Credentials
+	}
+
+	if len(creds) == 0 {
+		return nil, errors.New("no credentials were returned")
+	}
+
+	return creds, nil
+}
+
+func (c *FakeConnector) deprovisionCredentials(resourceID, credentialID manifold.ID) error {
+	cb, err := c.AddCallbackFor(CredentialDeprovisionCallback, resourceID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), providerRequestTimeout)
+	defer cancel()
+
+	_, async, err := c.Provider.DeprovisionCredentials(ctx, cb.ID, credentialID)
+	if err != nil {
+		return err
+	}
+
+	if async {
+		_, err = c.waitForDoneCallback(cb.ID)
+	}
+
+	return err
+}
+
+func (c *FakeConnector) waitForDoneCallback(ID manifold.ID) (*Callback, error) {
+	cb, err := c.WaitForCallback(ID, c.callbackTimeout())
+	if err != nil {
+		return nil, err
+	}
+
+	if cb.State != DoneCallbackState {
+		return nil, fmt.Errorf("callback finished in state %s: %s", cb.State, cb.Message)
+	}
+
+	return cb, nil
+}
+
+func (c *FakeConnector) callbackTimeout() time.Duration {
+	if c.Config.CallbackTimeout > 0 {
+		return c.Config.CallbackTimeout
+	}
+
+	return defaultCallbackTimeout
+}
@@ -0,0 +1,189 @@
+package connector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gm "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/idtype"
+	"github.com/manifoldco/go-signature"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/db"
+)
+
+type stubSigner struct{}
+
+func (stubSigner) Sign([]byte) (*signature.Signature, error) { return &signature.Signature{}, nil }
+
+func TestCredentialRotation(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	var provisioned int32
+	provider := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PUT":
+			atomic.AddInt32(&provisioned, 1)
+			respondWithJSON(rw, map[string]interface{}{
+				"message":     "provisioned",
+				"credentials": map[string]string{"PASSWORD": "rotated"},
+			}, 201)
+		case "DELETE":
+			rw.WriteHeader(204)
+		}
+	}))
+	defer provider.Close()
+
+	c, err := New(0, clientID, clientSecret, product)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	pURL, _ := url.Parse(provider.URL + "/v1")
+	c.Provider = grafton.New(pURL, &url.URL{}, stubSigner{}, logrus.NewEntry(logrus.New()))
+
+	srv := httptest.NewServer(ValidHandler(c))
+	defer srv.Close()
+
+	token := getToken(t, srv.URL, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	})
+
+	r := makeResource(t, "high", "aws::us-east-1")
+	c.AddResource(r)
+
+	credID, err := manifold.NewID(idtype.Credential)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	c.DB.PutCredential(db.Credential{
+		ID:         credID,
+		Keys:       map[string]string{"PASSWORD": "initial"},
+		ResourceID: r.ID,
+	})
+
+	rotationID, err := manifold.NewID(idtype.Operation)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	body := `{"resource_id": "` + r.ID.String() + `", "credential_id": "` + credID.String() + `", "reason": "leaked"}`
+
+	t.Run("rejects an invalid access token", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		rsp := putRotation(t, srv.URL, rotationID.String(), "invalid", body)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(400))
+	})
+
+	t.Run("requires a client credentials token", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		code, err := c.CreateCode()
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		userToken := getToken(t, srv.URL, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code.Code},
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+		})
+
+		rsp := putRotation(t, srv.URL, rotationID.String(), userToken, body)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(401))
+	})
+
+	t.Run("rejects an invalid rotation", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		rsp := putRotation(t, srv.URL, "not-an-id", token, body)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(400))
+
+		short := strings.Replace(body, "leaked", "no", 1)
+		rsp = putRotation(t, srv.URL, rotationID.String(), token, short)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(400))
+	})
+
+	t.Run("responds with not found for an unknown credential", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		unknown, err := manifold.NewID(idtype.Credential)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		missing := strings.Replace(body, credID.String(), unknown.String(), 1)
+		rsp := putRotation(t, srv.URL, rotationID.String(), token, missing)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(404))
+	})
+
+	t.Run("times out waiting for a rotation which isn't started", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		_, err := c.WaitForRotationOf(credID, 10*time.Millisecond)
+		gm.Expect(err).To(gm.Equal(ErrRotationTimeout))
+	})
+
+	t.Run("replaces the credential", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		started := make(chan manifold.ID, 1)
+		go func() {
+			rot, err := c.WaitForRotationOf(credID, 5*time.Second)
+			if err == nil {
+				started <- rot.ID
+			}
+			close(started)
+		}()
+
+		rsp := putRotation(t, srv.URL, rotationID.String(), token, body)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(202))
+		gm.Eventually(started, 5*time.Second).Should(gm.Receive(gm.Equal(rotationID)))
+
+		rot, err := c.WaitForRotation(rotationID, 5*time.Second)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(rot.State).To(gm.Equal(DoneRotationState), rot.Message)
+
+		gm.Expect(c.DB.GetCredential(credID)).To(gm.BeNil())
+		cred := c.DB.GetCredential(rot.NewCredentialID)
+		gm.Expect(cred).ToNot(gm.BeNil())
+		gm.Expect(cred.Keys).To(gm.Equal(map[string]string{"PASSWORD": "rotated"}))
+	})
+
+	t.Run("is idempotent on the rotation id", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		rsp := putRotation(t, srv.URL, rotationID.String(), token, body)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(202))
+		gm.Expect(atomic.LoadInt32(&provisioned)).To(gm.Equal(int32(1)))
+
+		changed := strings.Replace(body, "leaked", "expired", 1)
+		rsp = putRotation(t, srv.URL, rotationID.String(), token, changed)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(400))
+	})
+}
+
+func getToken(t *testing.T, base string, form url.Values) string {
+	rsp, err := http.PostForm(base+"/v1/oauth/tokens", form)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer rsp.Body.Close()
+
+	tok := &AccessToken{}
+	gm.Expect(json.NewDecoder(rsp.Body).Decode(tok)).To(gm.Succeed())
+	return tok.AccessToken
+}
+
+func putRotation(t *testing.T, base, ID, token, body string) *http.Response {
+	req, err := http.NewRequest("PUT", base+"/v1/credential-rotations/"+ID, strings.NewReader(body))
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rsp, err := http.DefaultClient.Do(req)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	rsp.Body.Close()
+	return rsp
+}
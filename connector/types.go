@@ -1,6 +1,7 @@
 package connector
 
 import (
+	"encoding/json"
 	"sync"
 	"time"
 
@@ -33,6 +34,26 @@ type TokenRequest struct {
 type AuthorizationCode struct {
 	Code      string
 	ExpiresAt time.Time
+
+	// ClientID and ClientSecret, when set, replace the client credentials
+	// the code must be exchanged with.
+	ClientID     string
+	ClientSecret string
+
+	// ServerError makes exchanging the code fail with a server error.
+	ServerError bool
+
+	// ResourceID, when set, is the only resource the access token granted
+	// for the code may access, like the resource a user signs in to.
+	ResourceID manifold.ID
+
+	// UserID is the user signing in with the code, whom the access token
+	// granted for it acts on behalf of.
+	UserID manifold.ID
+
+	// UsedAt is when the code was exchanged for an access token, which can
+	// only happen once.
+	UsedAt *time.Time
 }
 
 // AccessToken represents an access token granted by the fake connector for
@@ -43,6 +64,18 @@ type AccessToken struct {
 	ExpiresIn   int         `json:"expires_in"`
 	TokenType   string      `json:"token_type"`
 	GrantType   GrantType   `json:"-"`
+
+	// Code is the authorization code the token was granted for, if any.
+	Code string `json:"-"`
+}
+
+// UserRequest represents a request made by a provider on behalf of a user,
+// with an access token granted for an authorization code.
+type UserRequest struct {
+	Code string
+
+	// ResourceID is the resource requested, if any.
+	ResourceID manifold.ID
 }
 
 // UserProfile represents the data returned on GET /v1/self when the target
@@ -58,7 +91,7 @@ type UserTarget struct {
 	ID    manifold.ID    `json:"id"`
 	Name  string         `json:"name"`
 	Email string         `json:"email"`
-	Role  UserTargetRole `json:"role"`
+	Role  UserTargetRole `json:"role,omitempty"`
 }
 
 // UserTargetRole defines an enum type of valid roles
@@ -109,6 +142,10 @@ var (
 	PendingCallbackState CallbackState = "pending"
 	DoneCallbackState    CallbackState = "done"
 	ErrorCallbackState   CallbackState = "error"
+
+	// ExpiredCallbackState represents a callback expired through the admin
+	// API, which the provider can no longer complete
+	ExpiredCallbackState CallbackState = "expired"
 )
 
 // Callback represents a callback that is either pending or has been received
@@ -120,6 +157,41 @@ type Callback struct {
 	State       CallbackState     `json:"state"`
 	Message     string            `json:"message"`
 	Credentials map[string]string `json:"-"`
+
+	// ResourceID is the resource the callback was issued for, if any, so
+	// callbacks still pending after a restart can be resumed.
+	ResourceID manifold.ID `json:"-"`
+
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+
+	// Requests holds every request the provider made to complete the
+	// callback, whether it was accepted or not.
+	Requests []CallbackAttempt `json:"-"`
+
+	// Origin is the request the provider was sent along with the callback,
+	// if it went through an OriginTransport.
+	Origin *CallbackOrigin `json:"-"`
+
+	resolved chan struct{}
+}
+
+// CallbackOrigin represents the request sent to a provider which it is asked
+// to complete a callback for
+type CallbackOrigin struct {
+	SentAt time.Time       `json:"sent_at"`
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// CallbackAttempt represents a request made by a provider to complete a
+// callback, along with the status code it was answered with
+type CallbackAttempt struct {
+	ReceivedAt time.Time       `json:"received_at"`
+	Request    CallbackRequest `json:"request"`
+	StatusCode int             `json:"status_code"`
+	Error      string          `json:"error,omitempty"`
 }
 
 // CallbackRequest represents a received callback from a provider
@@ -158,3 +230,70 @@ type ResourceMeasureFeatureValue struct {
 	Name  manifold.Name              `json:"name"`
 	Label manifold.FeatureValueLabel `json:"label"`
 }
+
+// RotationState represents the state of a credential rotation
+type RotationState string
+
+// PendingRotationState represents a rotation which is still in progress
+var (
+	PendingRotationState RotationState = "pending"
+	DoneRotationState    RotationState = "done"
+	ErrorRotationState   RotationState = "error"
+)
+
+// CredentialRotationRequest represents a request by a provider to rotate a
+// credential of one of its resources
+type CredentialRotationRequest struct {
+	ResourceID   manifold.ID `json:"resource_id"`
+	CredentialID manifold.ID `json:"credential_id"`
+	Reason       string      `json:"reason"`
+}
+
+// CredentialRotation represents a rotation started by a provider, replacing a
+// credential with a newly provisioned one
+type CredentialRotation struct {
+	ID              manifold.ID               `json:"id"`
+	Request         CredentialRotationRequest `json:"request"`
+	State           RotationState             `json:"state"`
+	Message         string                    `json:"message"`
+	NewCredentialID manifold.ID               `json:"new_credential_id"`
+
+	finished chan struct{}
+}
+
+// OAuthCredential represents an OAuth 2.0 client id and secret pair providers
+// use to authenticate with the connector
+type OAuthCredential struct {
+	ID          manifold.ID  `json:"id"`
+	Description string       `json:"description"`
+	ProductID   *manifold.ID `json:"product_id,omitempty"`
+	ProviderID  *manifold.ID `json:"provider_id,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	ExpiresAt   *time.Time   `json:"expires_at,omitempty"`
+
+	// ClientID is the id exchanged for access tokens. It is the ID of the
+	// credential, except for the credential the connector is configured with.
+	ClientID string `json:"-"`
+	Secret   string `json:"-"`
+}
+
+// Live returns whether or not the credential can be used at the given time
+func (o *OAuthCredential) Live(t time.Time) bool {
+	return o.ExpiresAt == nil || t.Before(*o.ExpiresAt)
+}
+
+// OAuthCredentialCreateRequest represents a request to create a new OAuth
+// credential pair
+type OAuthCredentialCreateRequest struct {
+	Description string       `json:"description"`
+	ProductID   *manifold.ID `json:"product_id,omitempty"`
+	ProviderID  *manifold.ID `json:"provider_id,omitempty"`
+}
+
+// OAuthCredentialCreateResponse represents a newly created OAuth credential
+// pair, the only time its secret is returned
+type OAuthCredentialCreateResponse struct {
+	*OAuthCredential
+	Secret string `json:"secret"`
+}
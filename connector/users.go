@@ -0,0 +1,444 @@
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/idtype"
+)
+
+// ErrUserNotFound represents an error which occurs if a user does not exist
+var ErrUserNotFound = errors.New("User Not Found")
+
+// ErrTeamNotFound represents an error which occurs if a team does not exist
+var ErrTeamNotFound = errors.New("Team Not Found")
+
+// The team and user every connector starts with, unless restored from its
+// DB's Store.
+const (
+	defaultTeamName  = "Manifold"
+	defaultUserName  = "Manny Fold"
+	defaultUserEmail = "manny@manifold.co"
+)
+
+// User represents a Manifold user, who can sign in to the resources owned by
+// the teams they are a member of.
+type User struct {
+	ID        manifold.ID `json:"id"`
+	Name      string      `json:"name"`
+	Email     string      `json:"email"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Team represents a Manifold team. Its members access the resources it owns
+// with the role they have in it.
+//
+// Resources are owned by the connector's first team, unless assigned to
+// another one with AssignResource.
+type Team struct {
+	ID        manifold.ID   `json:"id"`
+	Name      string        `json:"name"`
+	Members   []TeamMember  `json:"members"`
+	Resources []manifold.ID `json:"resources"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// TeamMember represents the role a user has in a team.
+type TeamMember struct {
+	UserID manifold.ID    `json:"user_id"`
+	Role   UserTargetRole `json:"role"`
+}
+
+// Member describes a user and the role they have in a team, as added to the
+// connector with AddMember. Users are identified by their email, and teams
+// by their name.
+type Member struct {
+	Name  string         `json:"name"`
+	Email string         `json:"email"`
+	Team  string         `json:"team,omitempty"`
+	Role  UserTargetRole `json:"role,omitempty"`
+}
+
+// ParseMember parses a member from a comma separated list of key=value pairs,
+// as passed on the command line:
+//
+//	name=Ada Lovelace,email=ada@example.com,role=admin
+//	email=manny@manifold.co,team=Design,role=member
+//
+// Keys are named after the fields of a Member.
+func ParseMember(s string) (Member, error) {
+	m := Member{}
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return m, fmt.Errorf("invalid user option %q", pair)
+		}
+
+		switch kv[0] {
+		case "name":
+			m.Name = kv[1]
+		case "email":
+			m.Email = kv[1]
+		case "team":
+			m.Team = kv[1]
+		case "role":
+			m.Role = UserTargetRole(kv[1])
+		default:
+			return m, fmt.Errorf("unknown user option %q", kv[0])
+		}
+	}
+
+	return m, m.Validate()
+}
+
+// Validate returns an error if the member can't be added.
+func (m *Member) Validate() error {
+	switch {
+	case m.Email == "":
+		return errors.New("email is required")
+	case m.Role != "" && !m.Role.Valid():
+		return errors.New("role must be owner, admin or member")
+	}
+
+	return nil
+}
+
+// Valid returns whether r is one of the roles defined by the Connector API.
+func (r UserTargetRole) Valid() bool {
+	switch r {
+	case UserTargetRoleOwner, UserTargetRoleAdmin, UserTargetRoleMember:
+		return true
+	}
+
+	return false
+}
+
+// AddMember adds the user to the team with the given role, creating either
+// of them if they don't exist yet, or changing the user's role if they're
+// already a member. Members are added to the connector's first team if they
+// don't name one, as a member unless they're given another role.
+func (c *FakeConnector) AddMember(m Member) (*User, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	if m.Role == "" {
+		m.Role = UserTargetRoleMember
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	u, err := c.findOrCreateUser(m.Name, m.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := c.findOrCreateTeam(m.Team)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for i, mb := range t.Members {
+		if mb.UserID == u.ID {
+			t.Members[i].Role = m.Role
+			found = true
+		}
+	}
+	if !found {
+		t.Members = append(t.Members, TeamMember{UserID: u.ID, Role: m.Role})
+	}
+	c.persist(teamsBucket, t.ID.String(), t)
+
+	r := *u
+	return &r, nil
+}
+
+// findOrCreateUser returns the user with the given email, renaming them if a
+// name is given, or creates them. The caller must hold the connector's lock.
+func (c *FakeConnector) findOrCreateUser(name, email string) (*User, error) {
+	for _, u := range c.users {
+		if strings.EqualFold(u.Email, email) {
+			if name != "" && name != u.Name {
+				u.Name = name
+				c.persist(usersBucket, u.ID.String(), u)
+			}
+			return u, nil
+		}
+	}
+
+	if name == "" {
+		return nil, errors.New("name is required for new users")
+	}
+
+	ID, err := manifold.NewID(idtype.User)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &User{ID: ID, Name: name, Email: email, CreatedAt: time.Now().UTC()}
+	c.users = append(c.users, u)
+	c.persist(usersBucket, u.ID.String(), u)
+
+	return u, nil
+}
+
+// findOrCreateTeam returns the team with the given name, or the first team if
+// it's empty, or creates it. The caller must hold the connector's lock.
+func (c *FakeConnector) findOrCreateTeam(name string) (*Team, error) {
+	if name == "" && len(c.teams) > 0 {
+		return c.teams[0], nil
+	}
+
+	for _, t := range c.teams {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+
+	ID, err := manifold.NewID(idtype.Team)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Team{ID: ID, Name: name, CreatedAt: time.Now().UTC()}
+	c.teams = append(c.teams, t)
+	c.persist(teamsBucket, t.ID.String(), t)
+
+	return t, nil
+}
+
+// addDefaultMember gives a connector without any team its default team, with
+// a single owner.
+func (c *FakeConnector) addDefaultMember() error {
+	c.mu.Lock()
+	n := len(c.teams)
+	c.mu.Unlock()
+
+	if n > 0 {
+		return nil
+	}
+
+	_, err := c.AddMember(Member{
+		Name:  defaultUserName,
+		Email: defaultUserEmail,
+		Team:  defaultTeamName,
+		Role:  UserTargetRoleOwner,
+	})
+	return err
+}
+
+// GetUsers returns copies of every user, oldest first
+func (c *FakeConnector) GetUsers() []User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	users := make([]User, len(c.users))
+	for i, u := range c.users {
+		users[i] = *u
+	}
+
+	return users
+}
+
+// GetUser returns a copy of the user with the given ID, or nil
+func (c *FakeConnector) GetUser(ID manifold.ID) *User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	u := c.findUser(ID)
+	if u == nil {
+		return nil
+	}
+
+	r := *u
+	return &r
+}
+
+// findUser returns the user with the given ID, or nil. The caller must hold
+// the connector's lock.
+func (c *FakeConnector) findUser(ID manifold.ID) *User {
+	for _, u := range c.users {
+		if u.ID == ID {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// GetTeams returns copies of every team, oldest first
+func (c *FakeConnector) GetTeams() []Team {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	teams := make([]Team, len(c.teams))
+	for i, t := range c.teams {
+		teams[i] = t.copy()
+	}
+
+	return teams
+}
+
+func (t *Team) copy() Team {
+	r := *t
+	r.Members = append([]TeamMember{}, t.Members...)
+	r.Resources = append([]manifold.ID{}, t.Resources...)
+	return r
+}
+
+// AssignResource makes the team the owner of the resource, so only its
+// members can access it.
+func (c *FakeConnector) AssignResource(resourceID, teamID manifold.ID) (*Team, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var team *Team
+	for _, t := range c.teams {
+		if t.ID == teamID {
+			team = t
+		}
+	}
+	if team == nil {
+		return nil, ErrTeamNotFound
+	}
+
+	c.unassignResource(resourceID)
+	team.Resources = append(team.Resources, resourceID)
+	c.persist(teamsBucket, team.ID.String(), team)
+
+	r := team.copy()
+	return &r, nil
+}
+
+// unassignResource removes the resource from the team it's assigned to, if
+// any. The caller must hold the connector's lock.
+func (c *FakeConnector) unassignResource(resourceID manifold.ID) {
+	for _, t := range c.teams {
+		for i, ID := range t.Resources {
+			if ID == resourceID {
+				t.Resources = append(t.Resources[:i], t.Resources[i+1:]...)
+				c.persist(teamsBucket, t.ID.String(), t)
+				break
+			}
+		}
+	}
+}
+
+// resourceTeam returns the team owning the resource. The caller must hold
+// the connector's lock.
+func (c *FakeConnector) resourceTeam(resourceID manifold.ID) *Team {
+	for _, t := range c.teams {
+		for _, ID := range t.Resources {
+			if ID == resourceID {
+				return t
+			}
+		}
+	}
+
+	if len(c.teams) == 0 {
+		return nil
+	}
+
+	return c.teams[0]
+}
+
+// resourceUsers returns the users who can access the resource, along with
+// their role.
+func (c *FakeConnector) resourceUsers(resourceID manifold.ID) []UserTarget {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	users := []UserTarget{}
+	t := c.resourceTeam(resourceID)
+	if t == nil {
+		return users
+	}
+
+	for _, m := range t.Members {
+		if u := c.findUser(m.UserID); u != nil {
+			users = append(users, UserTarget{
+				ID:    u.ID,
+				Name:  u.Name,
+				Email: u.Email,
+				Role:  m.Role,
+			})
+		}
+	}
+
+	return users
+}
+
+// role returns the role the user has for the resource, or false if they
+// can't access it.
+func (c *FakeConnector) role(userID, resourceID manifold.ID) (UserTargetRole, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := c.resourceTeam(resourceID)
+	if t == nil {
+		return "", false
+	}
+
+	for _, m := range t.Members {
+		if m.UserID == userID {
+			return m.Role, true
+		}
+	}
+
+	return "", false
+}
+
+// defaultUser returns the user signing in to the resource unless another one
+// is picked: the first owner of the team owning it, or its first member.
+func (c *FakeConnector) defaultUser(resourceID manifold.ID) manifold.ID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := c.resourceTeam(resourceID)
+	if t == nil || len(t.Members) == 0 {
+		return manifold.ID{}
+	}
+
+	for _, m := range t.Members {
+		if m.Role == UserTargetRoleOwner {
+			return m.UserID
+		}
+	}
+
+	return t.Members[0].UserID
+}
+
+// codeUser returns the user signing in with the code, along with their role
+// for the resource it was created for, or nil. Codes created without a user
+// sign in as the one CreateCodeFor picks.
+func (c *FakeConnector) codeUser(code string) *UserTarget {
+	var resourceID, userID manifold.ID
+	if ac := c.getCode(code); ac != nil {
+		resourceID, userID = ac.ResourceID, ac.UserID
+	}
+	if userID.IsEmpty() {
+		userID = c.defaultUser(resourceID)
+	}
+
+	u := c.GetUser(userID)
+	if u == nil {
+		return nil
+	}
+
+	t := &UserTarget{ID: u.ID, Name: u.Name, Email: u.Email}
+	if !resourceID.IsEmpty() {
+		t.Role, _ = c.role(u.ID, resourceID)
+	}
+
+	return t
+}
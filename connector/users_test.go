@@ -0,0 +1,171 @@
+package connector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	gm "github.com/onsi/gomega"
+)
+
+func TestParseMember(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	m, err := ParseMember("name=Ada Lovelace,email=ada@example.com,team=Design,role=admin")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(m).To(gm.Equal(Member{
+		Name:  "Ada Lovelace",
+		Email: "ada@example.com",
+		Team:  "Design",
+		Role:  UserTargetRoleAdmin,
+	}))
+
+	_, err = ParseMember("name=Ada Lovelace")
+	gm.Expect(err).To(gm.MatchError("email is required"))
+
+	_, err = ParseMember("email=ada@example.com,role=superuser")
+	gm.Expect(err).To(gm.MatchError("role must be owner, admin or member"))
+
+	_, err = ParseMember("email=ada@example.com,age=36")
+	gm.Expect(err).To(gm.MatchError(`unknown user option "age"`))
+}
+
+func TestUsers(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	c, err := New(0, clientID, clientSecret, product)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	srv := httptest.NewServer(ValidHandler(c))
+	defer srv.Close()
+
+	r := makeResource(t, "high", "aws::us-east-1")
+	c.AddResource(r)
+
+	owner := c.GetUsers()[0]
+
+	var ada User
+	rsp := adminRequest(t, "POST", srv.URL+"/_grafton/users",
+		`{"name": "Ada Lovelace", "email": "ada@example.com", "role": "admin"}`, &ada)
+	gm.Expect(rsp.StatusCode).To(gm.Equal(201))
+
+	var grace User
+	rsp = adminRequest(t, "POST", srv.URL+"/_grafton/users",
+		`{"name": "Grace Hopper", "email": "grace@example.com", "team": "Navy"}`, &grace)
+	gm.Expect(rsp.StatusCode).To(gm.Equal(201))
+
+	rsp = adminRequest(t, "POST", srv.URL+"/_grafton/users", `{"name": "Nobody"}`, nil)
+	gm.Expect(rsp.StatusCode).To(gm.Equal(400))
+
+	// signIn returns the access token granted to the user signing in to the
+	// resource.
+	signIn := func(u User) string {
+		code, err := c.CreateCodeForUser(r.ID, u.ID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		return getToken(t, srv.URL, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code.Code},
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+		})
+	}
+
+	get := func(path, token string, v interface{}) int {
+		req, err := http.NewRequest("GET", srv.URL+path, nil)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rsp, err := http.DefaultClient.Do(req)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		defer rsp.Body.Close()
+
+		if v != nil && rsp.StatusCode == 200 {
+			gm.Expect(json.NewDecoder(rsp.Body).Decode(v)).To(gm.Succeed())
+		}
+		return rsp.StatusCode
+	}
+
+	t.Run("starts with a team owned by a single user", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		gm.Expect(owner.Name).To(gm.Equal(defaultUserName))
+
+		teams := c.GetTeams()
+		gm.Expect(teams).To(gm.HaveLen(2))
+		gm.Expect(teams[0].Name).To(gm.Equal(defaultTeamName))
+		gm.Expect(teams[0].Members).To(gm.ConsistOf(
+			TeamMember{UserID: owner.ID, Role: UserTargetRoleOwner},
+			TeamMember{UserID: ada.ID, Role: UserTargetRoleAdmin},
+		))
+	})
+
+	t.Run("returns the user signed in on /v1/self", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		self := UserProfile{}
+		gm.Expect(get("/v1/self", signIn(ada), &self)).To(gm.Equal(200))
+		gm.Expect(self.Target).To(gm.Equal(&UserTarget{
+			ID:    ada.ID,
+			Name:  "Ada Lovelace",
+			Email: "ada@example.com",
+			Role:  UserTargetRoleAdmin,
+		}))
+
+		code, err := c.CreateCodeFor(r.ID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(code.UserID).To(gm.Equal(owner.ID), "the owner signs in by default")
+	})
+
+	t.Run("lists the members of the team owning the resource", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		var users []UserTarget
+		gm.Expect(get("/v1/resources/"+r.ID.String()+"/users", signIn(owner), &users)).To(gm.Equal(200))
+		gm.Expect(users).To(gm.ConsistOf(
+			UserTarget{ID: owner.ID, Name: defaultUserName, Email: defaultUserEmail, Role: UserTargetRoleOwner},
+			UserTarget{ID: ada.ID, Name: "Ada Lovelace", Email: "ada@example.com", Role: UserTargetRoleAdmin},
+		))
+	})
+
+	t.Run("keeps users out of the resources of other teams", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		token := signIn(grace)
+		gm.Expect(get("/v1/resources/"+r.ID.String(), token, nil)).To(gm.Equal(404))
+
+		var navy Team
+		for _, team := range c.GetTeams() {
+			if team.Name == "Navy" {
+				navy = team
+			}
+		}
+
+		rsp := adminRequest(t, "PUT", srv.URL+"/_grafton/resources/"+r.ID.String()+"/team",
+			`{"team_id": "`+navy.ID.String()+`"}`, nil)
+		gm.Expect(rsp.StatusCode).To(gm.Equal(200))
+
+		gm.Expect(get("/v1/resources/"+r.ID.String(), token, nil)).To(gm.Equal(200))
+		gm.Expect(get("/v1/resources/"+r.ID.String(), signIn(ada), nil)).To(gm.Equal(404))
+
+		var users []UserTarget
+		gm.Expect(get("/v1/resources/"+r.ID.String()+"/users", token, &users)).To(gm.Equal(200))
+		gm.Expect(users).To(gm.HaveLen(1))
+		gm.Expect(users[0].Role).To(gm.Equal(UserTargetRoleMember))
+	})
+
+	t.Run("changes the role of existing members", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		u, err := c.AddMember(Member{Email: "GRACE@example.com", Team: "Navy", Role: UserTargetRoleOwner})
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(u.ID).To(gm.Equal(grace.ID))
+		gm.Expect(c.GetUsers()).To(gm.HaveLen(3))
+
+		role, ok := c.role(grace.ID, r.ID)
+		gm.Expect(ok).To(gm.BeTrue())
+		gm.Expect(role).To(gm.Equal(UserTargetRoleOwner))
+	})
+}
@@ -0,0 +1,378 @@
+// Package contract validates the requests and responses of an API against
+// its OpenAPI spec, such as the responses of a provider against
+// specs/provider.yaml, or the requests a provider makes to the Connector
+// against specs/connector.yaml.
+//
+// Responses are validated as they go through a Spec's Transport, with their
+// violations collected for the requests made with a context from
+// WithCollector:
+//
+//	spec, err := contract.Provider()
+//	client := grafton.NewClient(grafton.ClientOptions{Transport: spec.Transport(nil), ...})
+//
+//	ctx, c := contract.WithCollector(ctx)
+//	client.ProvisionResource(ctx, ...)
+//	for _, v := range c.Violations() {
+//		// ...
+//	}
+//
+// Requests are validated by the server receiving them, with ValidateRequest.
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/errors"
+	"github.com/go-openapi/loads"
+	"github.com/go-openapi/spec"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/swag"
+	"github.com/go-openapi/validate"
+	"github.com/gobuffalo/packr"
+)
+
+var specs packr.Box
+
+func init() {
+	specs = packr.NewBox("../specs")
+}
+
+// Violation is a way a request or response did not match the spec.
+type Violation struct {
+	// Method and Route identify the operation the request was made to, with
+	// the route as written in the spec, such as /resources/{id}. Requests
+	// to routes missing from the spec have the path they were made to.
+	Method string
+	Route  string
+
+	// Status is the status code of the response, or zero for violations of
+	// the request itself.
+	Status  int
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Status == 0 {
+		return fmt.Sprintf("%s %s: %s", v.Method, v.Route, v.Message)
+	}
+
+	return fmt.Sprintf("%s %s responded with %d: %s", v.Method, v.Route, v.Status, v.Message)
+}
+
+// Spec is an OpenAPI 2.0 spec which requests and responses are validated
+// against.
+type Spec struct {
+	doc    *loads.Document
+	routes []route
+}
+
+type route struct {
+	path    string
+	pattern *regexp.Regexp
+	params  []string
+	item    spec.PathItem
+}
+
+// Provider returns the spec of the provider API, bundled with grafton.
+func Provider() (*Spec, error) {
+	b, err := specs.Find("provider.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(b)
+}
+
+// Connector returns the spec of the Connector API, bundled with grafton.
+func Connector() (*Spec, error) {
+	b, err := specs.Find("connector.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(b)
+}
+
+// Parse parses an OpenAPI 2.0 spec from YAML or JSON.
+func Parse(b []byte) (*Spec, error) {
+	y, err := swag.BytesToYAMLDoc(b)
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := swag.YAMLToJSON(y)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := loads.Analyzed(j, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// References are resolved once, so schemas can be validated against
+	// on their own.
+	doc, err = doc.Expanded()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spec{doc: doc}
+	base := strings.TrimSuffix(doc.BasePath(), "/")
+	for path, item := range doc.Spec().Paths.Paths {
+		pattern, params := routePattern(base + path)
+		s.routes = append(s.routes, route{
+			path:    path,
+			pattern: pattern,
+			params:  params,
+			item:    item,
+		})
+	}
+
+	// Routes with fewer parameters are more specific, and are matched
+	// first.
+	sort.Slice(s.routes, func(i, j int) bool {
+		pi, pj := strings.Count(s.routes[i].path, "{"), strings.Count(s.routes[j].path, "{")
+		if pi != pj {
+			return pi < pj
+		}
+		return s.routes[i].path < s.routes[j].path
+	})
+
+	return s, nil
+}
+
+var paramPattern = regexp.MustCompile(`\\\{([^}]+)\\\}`)
+
+// routePattern matches the paths of requests made to the route, capturing
+// the values of the path parameters it returns the names of. APIs may be
+// served under a prefix, so paths are only matched on their end, and the
+// trailing slash of routes such as /sso/ may be left out, as it is from the
+// urls built by grafton.CreateSsoURL.
+func routePattern(path string) (*regexp.Regexp, []string) {
+	quoted := regexp.QuoteMeta(path)
+
+	var params []string
+	for _, m := range paramPattern.FindAllStringSubmatch(quoted, -1) {
+		params = append(params, m[1])
+	}
+
+	p := strings.TrimPrefix(paramPattern.ReplaceAllString(quoted, `([^/]+)`), "/")
+	if strings.HasSuffix(p, "/") {
+		p += "?"
+	}
+
+	return regexp.MustCompile(`(?:^|/)` + p + `$`), params
+}
+
+// operation returns the route and operation a request was made to.
+func (s *Spec) operation(method, path string) (string, *spec.Operation) {
+	r := s.match(path)
+	if r == nil {
+		return path, nil
+	}
+
+	return r.path, r.operation(method)
+}
+
+// match returns the route a request to the path was made to, or nil if it
+// is missing from the spec.
+func (s *Spec) match(path string) *route {
+	for i, r := range s.routes {
+		if r.pattern.MatchString(path) {
+			return &s.routes[i]
+		}
+	}
+
+	return nil
+}
+
+// operation returns the route's operation for the method, or nil if it has
+// none.
+func (r *route) operation(method string) *spec.Operation {
+	var op *spec.Operation
+	switch method {
+	case http.MethodGet:
+		op = r.item.Get
+	case http.MethodPut:
+		op = r.item.Put
+	case http.MethodPost:
+		op = r.item.Post
+	case http.MethodPatch:
+		op = r.item.Patch
+	case http.MethodDelete:
+		op = r.item.Delete
+	case http.MethodHead:
+		op = r.item.Head
+	case http.MethodOptions:
+		op = r.item.Options
+	}
+
+	return op
+}
+
+// ValidateResponse validates a response to a request made with the given
+// method to the given path: its status code must be one of the operation's,
+// with the headers it describes, and a JSON body matching its schema if it
+// has one.
+func (s *Spec) ValidateResponse(method, path string, status int, header http.Header, body []byte) []Violation {
+	route, op := s.operation(method, path)
+
+	var out []Violation
+	violation := func(format string, args ...interface{}) {
+		out = append(out, Violation{
+			Method:  method,
+			Route:   route,
+			Status:  status,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if op == nil {
+		violation("the operation is not described by the spec")
+		return out
+	}
+
+	rsp, ok := op.Responses.StatusCodeResponses[status]
+	if !ok {
+		if op.Responses.Default == nil {
+			violation("the status code is not one of %s", statusCodes(op))
+			return out
+		}
+		rsp = *op.Responses.Default
+	}
+
+	names := make([]string, 0, len(rsp.Headers))
+	for name := range rsp.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if header.Get(name) == "" {
+			violation("the %s header is missing", name)
+		}
+	}
+
+	if rsp.Schema == nil {
+		return out
+	}
+
+	produces := op.Produces
+	if len(produces) == 0 {
+		produces = s.doc.Spec().Produces
+	}
+
+	ct := header.Get("Content-Type")
+	if mt, _, err := mime.ParseMediaType(ct); err != nil || !contains(produces, mt) {
+		violation("the Content-Type is %q, not one of %s", ct, strings.Join(produces, ", "))
+	}
+
+	for _, msg := range s.validateJSON(rsp.Schema, body) {
+		violation("%s", msg)
+	}
+
+	return out
+}
+
+// validateJSON validates a JSON body against the schema.
+func (s *Spec) validateJSON(schema *spec.Schema, body []byte) []string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return []string{"the body is not valid JSON: " + err.Error()}
+	}
+
+	return s.validateValue(schema, v)
+}
+
+// validateValue validates a decoded body against the schema, or against the
+// schema of its subtype when the schema has a discriminator.
+func (s *Spec) validateValue(schema *spec.Schema, v interface{}) []string {
+	err := validate.AgainstSchema(s.discriminated(schema, v), v, strfmt.Default)
+	if err == nil {
+		return nil
+	}
+
+	out := messages(err)
+	sort.Strings(out)
+	return out
+}
+
+// discriminated returns the definition named by the value of the schema's
+// discriminator property, with the properties of the schemas it's composed
+// of merged, as validate does not follow discriminators. The schema is
+// returned as is if it has no discriminator, or the value names no
+// definition.
+func (s *Spec) discriminated(schema *spec.Schema, v interface{}) *spec.Schema {
+	if schema.Discriminator == "" {
+		return schema
+	}
+
+	obj, _ := v.(map[string]interface{})
+	name, _ := obj[schema.Discriminator].(string)
+	sub, ok := s.doc.Spec().Definitions[name]
+	if !ok {
+		return schema
+	}
+
+	merged := &spec.Schema{}
+	merged.Type = spec.StringOrArray{"object"}
+	merged.Properties = make(map[string]spec.Schema)
+	for _, part := range append([]spec.Schema{sub}, sub.AllOf...) {
+		for k, prop := range part.Properties {
+			merged.Properties[k] = prop
+		}
+		merged.Required = append(merged.Required, part.Required...)
+
+		if part.AdditionalProperties != nil && !part.AdditionalProperties.Allows {
+			merged.AdditionalProperties = &spec.SchemaOrBool{Allows: false}
+		}
+	}
+
+	return merged
+}
+
+// statusCodes lists the status codes an operation responds with.
+func statusCodes(op *spec.Operation) string {
+	codes := make([]int, 0, len(op.Responses.StatusCodeResponses))
+	for code := range op.Responses.StatusCodeResponses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	out := make([]string, len(codes))
+	for i, c := range codes {
+		out[i] = strconv.Itoa(c)
+	}
+
+	return strings.Join(out, ", ")
+}
+
+// messages flattens validation errors into their messages.
+func messages(err error) []string {
+	if c, ok := err.(*errors.CompositeError); ok {
+		var out []string
+		for _, e := range c.Errors {
+			out = append(out, messages(e)...)
+		}
+		return out
+	}
+
+	return []string{strings.TrimPrefix(err.Error(), ".")}
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+
+	return false
+}
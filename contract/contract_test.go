@@ -0,0 +1,241 @@
+package contract
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gm "github.com/onsi/gomega"
+)
+
+func jsonHeader() http.Header {
+	return http.Header{"Content-Type": {"application/json; charset=utf-8"}}
+}
+
+func TestValidateResponse(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	s, err := Provider()
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	const resource = "/v1/resources/2000000000000000000000000000a"
+
+	tcs := []struct {
+		name     string
+		method   string
+		path     string
+		status   int
+		header   http.Header
+		body     string
+		messages []string
+	}{
+		{
+			name: "valid response", method: "PUT", path: resource, status: 201,
+			header: jsonHeader(), body: `{"message": "Provisioned"}`,
+		},
+		{
+			name: "empty response without a schema", method: "PUT", path: resource, status: 204,
+		},
+		{
+			name: "under a prefix", method: "PUT", path: "/api" + resource, status: 201,
+			header: jsonHeader(), body: `{"message": "Provisioned"}`,
+		},
+		{
+			name: "extra and missing fields", method: "PUT", path: resource, status: 202,
+			header: jsonHeader(), body: `{"msg": "Provisioning"}`,
+			messages: []string{"message in body is required", "msg in body is a forbidden property"},
+		},
+		{
+			name: "missing message on an error", method: "PUT", path: resource, status: 409,
+			header: jsonHeader(), body: `{}`,
+			messages: []string{"message in body is required"},
+		},
+		{
+			name: "non-JSON error", method: "DELETE", path: resource, status: 404,
+			header: http.Header{"Content-Type": {"text/plain"}}, body: `Not Found`,
+			messages: []string{
+				`the Content-Type is "text/plain", not one of application/json`,
+				"the body is not valid JSON: invalid character 'N' looking for beginning of value",
+			},
+		},
+		{
+			name: "status code not allowed", method: "PUT", path: resource, status: 200,
+			header: jsonHeader(), body: `{"message": "Provisioned"}`,
+			messages: []string{"the status code is not one of 201, 202, 204, 400, 401, 409, 500"},
+		},
+		{
+			name: "wrong types", method: "GET", path: resource + "/measures", status: 200,
+			header: jsonHeader(),
+			body: `{"resource_id": "2000000000000000000000000000a", "period_start": "2020-01-01T00:00:00Z",
+				"period_end": "2020-01-31T23:59:59Z", "measures": {"storage": "lots"}}`,
+			messages: []string{`measures.storage in body must be of type integer: "string"`},
+		},
+		{
+			name: "missing header", method: "GET", path: "/v1/sso/", status: 303,
+			messages: []string{"the Location header is missing"},
+		},
+		{
+			name: "without a trailing slash", method: "GET", path: "/v1/sso", status: 303,
+			header: http.Header{"Location": {"https://bonnets.example.com/dashboard"}},
+		},
+		{
+			name: "unknown operation", method: "POST", path: resource, status: 201,
+			messages: []string{"the operation is not described by the spec"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			gm.RegisterTestingT(t)
+
+			vs := s.ValidateResponse(tc.method, tc.path, tc.status, tc.header, []byte(tc.body))
+
+			messages := []string{}
+			for _, v := range vs {
+				messages = append(messages, v.Message)
+				gm.Expect(v.Method).To(gm.Equal(tc.method))
+				gm.Expect(v.Status).To(gm.Equal(tc.status))
+			}
+			if tc.messages == nil {
+				tc.messages = []string{}
+			}
+			gm.Expect(messages).To(gm.Equal(tc.messages))
+		})
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	s, err := Connector()
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	const callback = "/v1/callbacks/2000000000000000000000000000a"
+	const form = "application/x-www-form-urlencoded"
+
+	tcs := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		messages    []string
+	}{
+		{
+			name: "valid request", method: "PUT", path: callback,
+			contentType: "application/json", body: `{"state": "done", "message": "Provisioned"}`,
+		},
+		{
+			name: "unknown state and extra fields", method: "PUT", path: callback,
+			contentType: "application/json", body: `{"state": "finished", "message": "Provisioned", "extra": 1}`,
+			messages: []string{
+				"extra in body is a forbidden property",
+				"state in body should be one of [done error]",
+			},
+		},
+		{
+			name: "invalid path parameter", method: "PUT", path: "/v1/callbacks/123",
+			contentType: "application/json", body: `{"state": "done", "message": "Provisioned"}`,
+			messages: []string{"id in path should match '^[0-9abcdefghjkmnpqrtuvwxyz]{29}$'"},
+		},
+		{
+			name: "wrong content type", method: "PUT", path: callback,
+			contentType: "text/plain", body: `{"state": "done", "message": "Provisioned"}`,
+			messages: []string{`the Content-Type is "text/plain", not one of application/json`},
+		},
+		{
+			name: "missing body", method: "PUT", path: callback,
+			messages: []string{"the body is missing"},
+		},
+		{
+			name: "form in place of a body", method: "POST", path: "/v1/oauth/tokens",
+			contentType: form, body: "grant_type=client_credentials",
+		},
+		{
+			name: "fields of the discriminated type", method: "POST", path: "/v1/oauth/tokens",
+			contentType: "application/json", body: `{"grant_type": "authorization_code"}`,
+			messages: []string{"code in body is required"},
+		},
+		{
+			name: "invalid query parameter", method: "GET",
+			path:     "/v1/resources/2000000000000000000000000000a/measures?period_start=2020",
+			messages: []string{`period_start in query must be of type datetime: "2020"`},
+		},
+		{
+			name: "unknown operation", method: "DELETE", path: "/v1/self",
+			messages: []string{"the operation is not described by the spec"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			gm.RegisterTestingT(t)
+
+			req, err := http.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			gm.Expect(err).ToNot(gm.HaveOccurred())
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+
+			vs := s.ValidateRequest(req, []byte(tc.body))
+
+			messages := []string{}
+			for _, v := range vs {
+				messages = append(messages, v.Message)
+				gm.Expect(v.Status).To(gm.BeZero())
+			}
+			if tc.messages == nil {
+				tc.messages = []string{}
+			}
+			gm.Expect(messages).To(gm.Equal(tc.messages))
+		})
+	}
+
+	v := Violation{Method: "PUT", Route: "/callbacks/{id}", Message: "the body is missing"}
+	gm.Expect(v.String()).To(gm.Equal("PUT /callbacks/{id}: the body is missing"))
+}
+
+func TestTransport(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	s, err := Provider()
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write([]byte(`{"message": "Provisioned", "extra": true}`))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: s.Transport(nil)}
+	put := func(ctx context.Context) string {
+		req, err := http.NewRequest("PUT", srv.URL+"/v1/resources/2000000000000000000000000000a", strings.NewReader(`{}`))
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		rsp, err := client.Do(req.WithContext(ctx))
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		defer rsp.Body.Close()
+
+		b, err := ioutil.ReadAll(rsp.Body)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		return string(b)
+	}
+
+	ctx, c := WithCollector(context.Background())
+	gm.Expect(put(ctx)).To(gm.ContainSubstring("Provisioned"), "responses are left untouched")
+	gm.Expect(put(context.Background())).To(gm.ContainSubstring("Provisioned"))
+
+	gm.Expect(c.Checked()).To(gm.Equal(1), "only requests made with a collector are checked")
+	gm.Expect(c.Violations()).To(gm.Equal([]Violation{{
+		Method:  "PUT",
+		Route:   "/resources/{id}",
+		Status:  http.StatusCreated,
+		Message: "extra in body is a forbidden property",
+	}}))
+	gm.Expect(c.Violations()[0].String()).To(gm.Equal(
+		"PUT /resources/{id} responded with 201: extra in body is a forbidden property"))
+}
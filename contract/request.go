@@ -0,0 +1,193 @@
+package contract
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-openapi/errors"
+	"github.com/go-openapi/spec"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/validate"
+)
+
+const formContentType = "application/x-www-form-urlencoded"
+
+// ValidateRequest validates a request made to the API, given its body as it
+// has already been read: its path, query and header parameters must match
+// their description, and its body must be sent with one of the operation's
+// content types, matching its schema.
+//
+// Only parameters of type string are validated beyond their presence.
+func (s *Spec) ValidateRequest(r *http.Request, body []byte) []Violation {
+	rt := s.match(r.URL.Path)
+
+	var out []Violation
+	violation := func(route string, format string, args ...interface{}) {
+		out = append(out, Violation{
+			Method:  r.Method,
+			Route:   route,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	var op *spec.Operation
+	if rt != nil {
+		op = rt.operation(r.Method)
+	}
+	if op == nil {
+		violation(r.URL.Path, "the operation is not described by the spec")
+		return out
+	}
+
+	values := pathValues(rt, r.URL.Path)
+	query := r.URL.Query()
+
+	var bodyParam *spec.Parameter
+	var formParams []spec.Parameter
+	for _, p := range parameters(rt.item, op) {
+		var v []string
+		switch p.In {
+		case "path":
+			if value, ok := values[p.Name]; ok {
+				v = []string{value}
+			}
+		case "query":
+			v = query[p.Name]
+		case "header":
+			v = r.Header[http.CanonicalHeaderKey(p.Name)]
+		case "body":
+			bp := p
+			bodyParam = &bp
+			continue
+		case "formData":
+			formParams = append(formParams, p)
+			continue
+		}
+
+		for _, msg := range validateParam(p, v) {
+			violation(rt.path, "%s", msg)
+		}
+	}
+
+	if bodyParam == nil && len(formParams) == 0 {
+		return out
+	}
+
+	if len(body) == 0 {
+		if bodyParam != nil && bodyParam.Required {
+			violation(rt.path, "the body is missing")
+		}
+		return out
+	}
+
+	consumes := op.Consumes
+	if len(consumes) == 0 {
+		consumes = s.doc.Spec().Consumes
+	}
+
+	ct := r.Header.Get("Content-Type")
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil || !contains(consumes, mt) {
+		violation(rt.path, "the Content-Type is %q, not one of %s", ct, strings.Join(consumes, ", "))
+	}
+
+	if mt != formContentType {
+		if bodyParam != nil && bodyParam.Schema != nil {
+			for _, msg := range s.validateJSON(bodyParam.Schema, body) {
+				violation(rt.path, "%s", msg)
+			}
+		}
+		return out
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		violation(rt.path, "the body is not a valid form: %s", err)
+		return out
+	}
+
+	for _, p := range formParams {
+		for _, msg := range validateParam(p, form[p.Name]) {
+			violation(rt.path, "%s", msg)
+		}
+	}
+
+	// A form may also be sent in place of a JSON body, such as to request
+	// access tokens, with its fields validated as properties of the schema.
+	if bodyParam != nil && bodyParam.Schema != nil {
+		obj := make(map[string]interface{}, len(form))
+		for k := range form {
+			obj[k] = form.Get(k)
+		}
+
+		for _, msg := range s.validateValue(bodyParam.Schema, obj) {
+			violation(rt.path, "%s", msg)
+		}
+	}
+
+	return out
+}
+
+// pathValues returns the values of the route's path parameters in path.
+func pathValues(rt *route, path string) map[string]string {
+	m := rt.pattern.FindStringSubmatch(path)
+
+	values := make(map[string]string, len(rt.params))
+	for i, name := range rt.params {
+		if i+1 < len(m) {
+			values[name] = m[i+1]
+		}
+	}
+
+	return values
+}
+
+// parameters returns the parameters of the operation, along with those of
+// its path it does not override.
+func parameters(item spec.PathItem, op *spec.Operation) []spec.Parameter {
+	params := append([]spec.Parameter(nil), op.Parameters...)
+	for _, p := range item.Parameters {
+		overridden := false
+		for _, o := range op.Parameters {
+			if o.Name == p.Name && o.In == p.In {
+				overridden = true
+				break
+			}
+		}
+
+		if !overridden {
+			params = append(params, p)
+		}
+	}
+
+	return params
+}
+
+// validateParam validates the values a parameter was sent with, of which
+// only the first is used.
+func validateParam(p spec.Parameter, values []string) []string {
+	if len(values) == 0 {
+		if p.Required {
+			return []string{errors.Required(p.Name, p.In).Error()}
+		}
+		return nil
+	}
+
+	if p.Type != "string" {
+		return nil
+	}
+
+	res := validate.NewParamValidator(&p, strfmt.Default).Validate(values[0])
+	if res == nil {
+		return nil
+	}
+
+	var out []string
+	for _, err := range res.Errors {
+		out = append(out, messages(err)...)
+	}
+	return out
+}
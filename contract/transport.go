@@ -0,0 +1,89 @@
+package contract
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// Collector holds the violations of the responses to requests made with its
+// context.
+type Collector struct {
+	mu         sync.Mutex
+	checked    int
+	violations []Violation
+}
+
+type collectorKey struct{}
+
+// WithCollector returns a context collecting the violations of the
+// responses to requests made with it, when they're sent through a Spec's
+// Transport.
+func WithCollector(ctx context.Context) (context.Context, *Collector) {
+	c := &Collector{}
+	return context.WithValue(ctx, collectorKey{}, c), c
+}
+
+// Checked returns the number of responses validated so far.
+func (c *Collector) Checked() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.checked
+}
+
+// Violations returns the violations found so far, in the order the
+// responses were received.
+func (c *Collector) Violations() []Violation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Violation(nil), c.violations...)
+}
+
+func (c *Collector) add(vs []Violation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checked++
+	c.violations = append(c.violations, vs...)
+}
+
+// Transport returns an http.RoundTripper validating the responses to the
+// requests sent through rt, or http.DefaultTransport if it is nil. Only the
+// responses to requests made with a context from WithCollector are
+// validated.
+func (s *Spec) Transport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	return &transport{spec: s, rt: rt}
+}
+
+type transport struct {
+	spec *Spec
+	rt   http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rsp, err := t.rt.RoundTrip(req)
+
+	c, ok := req.Context().Value(collectorKey{}).(*Collector)
+	if err != nil || !ok {
+		return rsp, err
+	}
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	rsp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	c.add(t.spec.ValidateResponse(req.Method, req.URL.Path, rsp.StatusCode, rsp.Header, body))
+	return rsp, nil
+}
@@ -1,36 +1,213 @@
 package db
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	manifold "github.com/manifoldco/go-manifold"
+	"github.com/sirupsen/logrus"
 )
 
-// DB functions as an in-memory database of marketplace entities
+const (
+	resourcesBucket   = "resources"
+	credentialsBucket = "credentials"
+	measuresBucket    = "measures"
+	operationsBucket  = "operations"
+)
+
+// DB functions as an in-memory database of marketplace entities, written
+// through to its Store. Its methods are safe for concurrent use.
 type DB struct {
+	mu    sync.RWMutex
+	store Store
+
 	ResourcesByID         map[manifold.ID]Resource
 	CredentialsByResource map[manifold.ID][]Credential
 	CredentialsByID       map[manifold.ID]Credential
 	MeasuresByResource    map[manifold.ID][]Measure
+	OperationsByID        map[manifold.ID]Operation
+}
+
+// resourceRecord, credentialRecord and measureRecord are the documents
+// written to the Store, which keep the internal fields hidden from the API.
+type resourceRecord struct {
+	Resource
+	State ResourceState `json:"state"`
+}
+
+type credentialRecord struct {
+	Credential
+	ResourceID manifold.ID `json:"resource_id"`
+}
+
+type measureRecord struct {
+	Measure
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // New creates a new DB instance in-memory
 func New() *DB {
+	return newDB(NewMemoryStore())
+}
+
+// Open creates a new DB instance backed by the given Store, loading every
+// entity it holds.
+func Open(s Store) (*DB, error) {
+	db := newDB(s)
+
+	resources, err := s.All(resourcesBucket)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range resources {
+		var rec resourceRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return nil, fmt.Errorf("could not load resource %s: %s", k, err)
+		}
+		rec.Resource.State = rec.State
+		db.ResourcesByID[rec.ID] = rec.Resource
+	}
+
+	credentials, err := s.All(credentialsBucket)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range credentials {
+		var rec credentialRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return nil, fmt.Errorf("could not load credential %s: %s", k, err)
+		}
+		rec.Credential.ResourceID = rec.ResourceID
+		db.CredentialsByID[rec.ID] = rec.Credential
+		db.CredentialsByResource[rec.ResourceID] = append(
+			db.CredentialsByResource[rec.ResourceID], rec.Credential)
+	}
+	for _, cs := range db.CredentialsByResource {
+		sort.Slice(cs, func(i, j int) bool {
+			if cs[i].CreatedOn.Equal(cs[j].CreatedOn) {
+				return cs[i].ID.String() < cs[j].ID.String()
+			}
+			return cs[i].CreatedOn.Before(cs[j].CreatedOn)
+		})
+	}
+
+	measures, err := s.All(measuresBucket)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(measures))
+	for k := range measures {
+		keys = append(keys, k)
+	}
+	// Measure keys end with their position, padded so they sort in order.
+	sort.Strings(keys)
+	for _, k := range keys {
+		var rec measureRecord
+		if err := json.Unmarshal(measures[k], &rec); err != nil {
+			return nil, fmt.Errorf("could not load measure %s: %s", k, err)
+		}
+		rec.Measure.UpdatedAt = rec.UpdatedAt
+		db.MeasuresByResource[rec.ResourceID] = append(
+			db.MeasuresByResource[rec.ResourceID], rec.Measure)
+	}
+
+	operations, err := s.All(operationsBucket)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range operations {
+		var op Operation
+		if err := json.Unmarshal(v, &op); err != nil {
+			return nil, fmt.Errorf("could not load operation %s: %s", k, err)
+		}
+		db.OperationsByID[op.ID] = op
+	}
+
+	return db, nil
+}
+
+func newDB(s Store) *DB {
 	return &DB{
+		store:                 s,
 		ResourcesByID:         make(map[manifold.ID]Resource),
 		CredentialsByResource: make(map[manifold.ID][]Credential),
 		CredentialsByID:       make(map[manifold.ID]Credential),
 		MeasuresByResource:    make(map[manifold.ID][]Measure),
+		OperationsByID:        make(map[manifold.ID]Operation),
+	}
+}
+
+// Store returns the Store the DB writes through to, so other fakes can keep
+// their state alongside it.
+func (db *DB) Store() Store {
+	return db.store
+}
+
+// Close closes the underlying Store
+func (db *DB) Close() error {
+	return db.store.Close()
+}
+
+// put writes the document to the store. The DB keeps serving from memory if
+// the write fails, so the error is only logged.
+func (db *DB) put(bucket, key string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err == nil {
+		err = db.store.Put(bucket, key, b)
+	}
+	if err != nil {
+		logrus.WithError(err).Errorf("could not persist %s %s", bucket, key)
+	}
+}
+
+func (db *DB) delete(bucket, key string) {
+	if err := db.store.Delete(bucket, key); err != nil {
+		logrus.WithError(err).Errorf("could not delete %s %s", bucket, key)
 	}
 }
 
 // PutResource stores the provided resource in the database
 func (db *DB) PutResource(r Resource) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	db.ResourcesByID[r.ID] = r
+	db.put(resourcesBucket, r.ID.String(), resourceRecord{Resource: r, State: r.State})
+}
+
+// TransitionResource moves a resource to the given state, if it is in one of
+// the states it may move from, as a single change. It returns the resource as
+// it was before, or nil if it can't be found, and whether its state changed.
+func (db *DB) TransitionResource(id manifold.ID, to ResourceState, from ...ResourceState) (*Resource, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	r, ok := db.ResourcesByID[id]
+	if !ok {
+		return nil, false
+	}
+
+	for _, state := range from {
+		if r.State == state {
+			next := r
+			next.State = to
+			db.ResourcesByID[id] = next
+			db.put(resourcesBucket, id.String(), resourceRecord{Resource: next, State: to})
+			return &r, true
+		}
+	}
+
+	return &r, false
 }
 
 // GetResource returns a resource based on it's id or nil, if it can't be found
 func (db *DB) GetResource(id manifold.ID) *Resource {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	r, ok := db.ResourcesByID[id]
 	if ok {
 		return &r
@@ -38,15 +215,36 @@ func (db *DB) GetResource(id manifold.ID) *Resource {
 	return nil
 }
 
-// DeleteResource removes a resource and returns true, false if there was no resource
+// GetResources returns every resource in the database
+func (db *DB) GetResources() []Resource {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	rs := make([]Resource, 0, len(db.ResourcesByID))
+	for _, r := range db.ResourcesByID {
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+// DeleteResource removes a resource, along with its credentials and measures,
+// and returns true, false if there was no resource
 func (db *DB) DeleteResource(id manifold.ID) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	_, ok := db.ResourcesByID[id]
 	if ok {
 		cs := db.CredentialsByResource[id]
 		for _, c := range cs {
-			db.DeleteCredential(c.ID)
+			db.deleteCredential(c.ID)
+		}
+		for i := range db.MeasuresByResource[id] {
+			db.delete(measuresBucket, measureKey(id, i))
 		}
+		delete(db.MeasuresByResource, id)
 		delete(db.ResourcesByID, id)
+		db.delete(resourcesBucket, id.String())
 		return true
 	}
 	return false
@@ -57,13 +255,21 @@ func (db *DB) PutCredential(c Credential) {
 	if c.ResourceID.IsEmpty() {
 		panic("Supplied credential did not have a resource ID specified")
 	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	db.CredentialsByID[c.ID] = c
 	db.CredentialsByResource[c.ResourceID] = append(
 		db.CredentialsByResource[c.ResourceID], c)
+	db.put(credentialsBucket, c.ID.String(), credentialRecord{Credential: c, ResourceID: c.ResourceID})
 }
 
 // GetCredential returns a credential based on it's id or nil, if it can't be found
 func (db *DB) GetCredential(id manifold.ID) *Credential {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	c, ok := db.CredentialsByID[id]
 	if ok {
 		return &c
@@ -73,15 +279,25 @@ func (db *DB) GetCredential(id manifold.ID) *Credential {
 
 // GetCredentialsByResource returns a list of credentials or nil, for a ResourceID
 func (db *DB) GetCredentialsByResource(id manifold.ID) []Credential {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	c, ok := db.CredentialsByResource[id]
 	if ok {
-		return c
+		return append([]Credential(nil), c...)
 	}
 	return nil
 }
 
 // DeleteCredential removes a credential and returns true, false if there was no credential
 func (db *DB) DeleteCredential(id manifold.ID) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.deleteCredential(id)
+}
+
+func (db *DB) deleteCredential(id manifold.ID) bool {
 	c, ok := db.CredentialsByID[id]
 	if !ok {
 		return false
@@ -99,6 +315,7 @@ func (db *DB) DeleteCredential(id manifold.ID) bool {
 	db.CredentialsByResource[c.ResourceID] = cs
 	// Finally remove the key
 	delete(db.CredentialsByID, id)
+	db.delete(credentialsBucket, id.String())
 	return true
 }
 
@@ -107,16 +324,87 @@ func (db *DB) PutMeasure(m Measure) {
 	if m.ResourceID.IsEmpty() {
 		panic("Supplied measure did not have a resource ID specified")
 	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	m.UpdatedAt = time.Now()
+	key := measureKey(m.ResourceID, len(db.MeasuresByResource[m.ResourceID]))
 	db.MeasuresByResource[m.ResourceID] = append(
 		db.MeasuresByResource[m.ResourceID], m)
+	db.put(measuresBucket, key, measureRecord{Measure: m, UpdatedAt: m.UpdatedAt})
 }
 
 // GetMeasuresByResource returns a list of measures or nil, for a ResourceID
 func (db *DB) GetMeasuresByResource(id manifold.ID) []Measure {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	m, ok := db.MeasuresByResource[id]
 	if ok {
-		return m
+		return append([]Measure(nil), m...)
 	}
 	return nil
 }
+
+// PutOperation stores the provided operation in the database
+func (db *DB) PutOperation(op Operation) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.OperationsByID[op.ID] = op
+	db.put(operationsBucket, op.ID.String(), op)
+}
+
+// GetOperation returns an operation based on it's id or nil, if it can't be found
+func (db *DB) GetOperation(id manifold.ID) *Operation {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	op, ok := db.OperationsByID[id]
+	if ok {
+		return &op
+	}
+	return nil
+}
+
+// GetOperationsByResource returns the operations for a ResourceID, oldest first
+func (db *DB) GetOperationsByResource(id manifold.ID) []Operation {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var ops []Operation
+	for _, op := range db.OperationsByID {
+		if op.ResourceID == id {
+			ops = append(ops, op)
+		}
+	}
+	sortOperations(ops)
+	return ops
+}
+
+// GetPendingOperations returns every operation still waiting on the provider,
+// oldest first
+func (db *DB) GetPendingOperations() []Operation {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var ops []Operation
+	for _, op := range db.OperationsByID {
+		if op.State == OperationStatePending {
+			ops = append(ops, op)
+		}
+	}
+	sortOperations(ops)
+	return ops
+}
+
+func sortOperations(ops []Operation) {
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].CreatedAt.Before(ops[j].CreatedAt)
+	})
+}
+
+func measureKey(id manifold.ID, i int) string {
+	return fmt.Sprintf("%s/%08d", id, i)
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	logFile      = "wal.log"
+
+	// compactAfter is the number of changes appended to the log before it is
+	// folded into a new snapshot.
+	compactAfter = 1000
+)
+
+// fileStore is a Store persisting its documents in a directory, as a JSON
+// snapshot and a write-ahead log of the changes made since the snapshot was
+// taken.
+//
+// Every change is synced to the log before it is applied, so a restart loses
+// none of the changes which were acknowledged.
+type fileStore struct {
+	mu      sync.RWMutex
+	dir     string
+	buckets map[string]map[string][]byte
+	log     *os.File
+	changes int
+}
+
+type logEntry struct {
+	Bucket string          `json:"bucket"`
+	Key    string          `json:"key"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	Delete bool            `json:"delete,omitempty"`
+}
+
+// OpenFileStore opens the Store persisted in dir, creating it if needed.
+func OpenFileStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &fileStore{
+		dir:     dir,
+		buckets: make(map[string]map[string][]byte),
+	}
+
+	if err := s.readSnapshot(); err != nil {
+		return nil, errors.Wrap(err, "could not read snapshot")
+	}
+
+	if err := s.replayLog(); err != nil {
+		return nil, errors.Wrap(err, "could not replay write-ahead log")
+	}
+
+	// Start every run from a fresh snapshot, so the log only ever holds the
+	// changes of a single run.
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *fileStore) Put(bucket, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(logEntry{Bucket: bucket, Key: key, Value: value}); err != nil {
+		return err
+	}
+
+	putDocument(s.buckets, bucket, key, value)
+	return s.compactIfNeeded()
+}
+
+func (s *fileStore) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucket][key]; !ok {
+		return nil
+	}
+
+	if err := s.append(logEntry{Bucket: bucket, Key: key, Delete: true}); err != nil {
+		return err
+	}
+
+	delete(s.buckets[bucket], key)
+	return s.compactIfNeeded()
+}
+
+func (s *fileStore) All(bucket string) (map[string][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return copyBucket(s.buckets[bucket]), nil
+}
+
+func (s *fileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.log.Close()
+}
+
+func (s *fileStore) append(e logEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.log.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	s.changes++
+	return s.log.Sync()
+}
+
+func (s *fileStore) readSnapshot() error {
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	snapshot := map[string]map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return err
+	}
+
+	for bucket, docs := range snapshot {
+		for key, value := range docs {
+			putDocument(s.buckets, bucket, key, value)
+		}
+	}
+
+	return nil
+}
+
+func (s *fileStore) replayLog() error {
+	f, err := os.Open(filepath.Join(s.dir, logFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var e logEntry
+		err := dec.Decode(&e)
+		switch {
+		case err == io.EOF, err == io.ErrUnexpectedEOF:
+			// A change cut short by a crash was never acknowledged, so it
+			// is safe to drop.
+			return nil
+		case err != nil:
+			return err
+		}
+
+		if e.Delete {
+			delete(s.buckets[e.Bucket], e.Key)
+		} else {
+			putDocument(s.buckets, e.Bucket, e.Key, e.Value)
+		}
+	}
+}
+
+func (s *fileStore) compactIfNeeded() error {
+	if s.changes < compactAfter {
+		return nil
+	}
+
+	return s.compact()
+}
+
+// compact writes all documents to a new snapshot, and empties the log.
+func (s *fileStore) compact() error {
+	snapshot := make(map[string]map[string]json.RawMessage, len(s.buckets))
+	for bucket, docs := range s.buckets {
+		snapshot[bucket] = make(map[string]json.RawMessage, len(docs))
+		for key, value := range docs {
+			snapshot[bucket][key] = value
+		}
+	}
+
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.dir, snapshotFile+".tmp")
+	if err := writeFileSync(tmp, b); err != nil {
+		return errors.Wrap(err, "could not write snapshot")
+	}
+
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return errors.Wrap(err, "could not replace snapshot")
+	}
+
+	if s.log != nil {
+		s.log.Close()
+	}
+
+	s.log, err = os.OpenFile(filepath.Join(s.dir, logFile), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "could not open write-ahead log")
+	}
+
+	s.changes = 0
+	return nil
+}
+
+func writeFileSync(name string, b []byte) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gm "github.com/onsi/gomega"
+
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/idtype"
+)
+
+func TestFileStore(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "grafton-db")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	t.Run("reloads changes from the write-ahead log", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		s, err := OpenFileStore(dir)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(s.Put("things", "a", []byte(`{"v":1}`))).To(gm.Succeed())
+		gm.Expect(s.Put("things", "b", []byte(`{"v":2}`))).To(gm.Succeed())
+		gm.Expect(s.Delete("things", "a")).To(gm.Succeed())
+		// Closing without compacting, like a crash would
+		gm.Expect(s.Close()).To(gm.Succeed())
+
+		s, err = OpenFileStore(dir)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		defer s.Close()
+
+		docs, err := s.All("things")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(docs).To(gm.Equal(map[string][]byte{"b": []byte(`{"v":2}`)}))
+	})
+
+	t.Run("ignores a change cut short", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_APPEND|os.O_WRONLY, 0600)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		_, err = f.WriteString(`{"bucket":"things","key":"c","val`)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		f.Close()
+
+		s, err := OpenFileStore(dir)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		defer s.Close()
+
+		docs, err := s.All("things")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(docs).To(gm.HaveLen(1))
+		gm.Expect(docs).To(gm.HaveKey("b"))
+	})
+
+	t.Run("compacts the log into the snapshot", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		s, err := OpenFileStore(dir)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		for i := 0; i < compactAfter; i++ {
+			gm.Expect(s.Put("things", "b", []byte(`{"v":3}`))).To(gm.Succeed())
+		}
+		gm.Expect(s.Close()).To(gm.Succeed())
+
+		info, err := os.Stat(filepath.Join(dir, logFile))
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(info.Size()).To(gm.BeZero())
+
+		s, err = OpenFileStore(dir)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		defer s.Close()
+
+		docs, err := s.All("things")
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(string(docs["b"])).To(gm.Equal(`{"v":3}`))
+	})
+
+	t.Run("forgets everything of a deleted resource", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		s, err := OpenFileStore(dir)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		d, err := Open(s)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		resourceID, err := manifold.NewID(idtype.Resource)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		credID, err := manifold.NewID(idtype.Credential)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		d.PutResource(Resource{ID: resourceID, Plan: "small", State: ResourceStateProvisioned})
+		d.PutCredential(Credential{ID: credID, Keys: map[string]string{"A": "B"}, ResourceID: resourceID})
+		d.PutMeasure(Measure{ResourceID: resourceID, Measures: map[string]int64{"calls": 1}})
+		d.PutMeasure(Measure{ResourceID: resourceID, Measures: map[string]int64{"calls": 2}})
+
+		gm.Expect(d.DeleteResource(resourceID)).To(gm.BeTrue())
+		gm.Expect(d.GetMeasuresByResource(resourceID)).To(gm.BeEmpty())
+		gm.Expect(s.Close()).To(gm.Succeed())
+
+		s, err = OpenFileStore(dir)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		defer s.Close()
+		reopened, err := Open(s)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		gm.Expect(reopened.GetResource(resourceID)).To(gm.BeNil())
+		gm.Expect(reopened.GetCredential(credID)).To(gm.BeNil())
+		gm.Expect(reopened.GetMeasuresByResource(resourceID)).To(gm.BeEmpty())
+
+		measures, err := s.All(measuresBucket)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(measures).To(gm.BeEmpty())
+	})
+}
+
+func TestOpen(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	s := NewMemoryStore()
+	d, err := Open(s)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	resourceID, err := manifold.NewID(idtype.Resource)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	credID, err := manifold.NewID(idtype.Credential)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	d.PutResource(Resource{ID: resourceID, Plan: "small", State: ResourceStateProvisioning})
+	d.PutCredential(Credential{ID: credID, Keys: map[string]string{"A": "B"}, ResourceID: resourceID})
+	d.PutMeasure(Measure{ResourceID: resourceID, Measures: map[string]int64{"calls": 1}})
+	d.PutMeasure(Measure{ResourceID: resourceID, Measures: map[string]int64{"calls": 2}})
+
+	reopened, err := Open(s)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	r := reopened.GetResource(resourceID)
+	gm.Expect(r).ToNot(gm.BeNil())
+	gm.Expect(r.State).To(gm.Equal(ResourceStateProvisioning))
+
+	creds := reopened.GetCredentialsByResource(resourceID)
+	gm.Expect(creds).To(gm.HaveLen(1))
+	gm.Expect(creds[0].ResourceID).To(gm.Equal(resourceID))
+
+	measures := reopened.GetMeasuresByResource(resourceID)
+	gm.Expect(measures).To(gm.HaveLen(2))
+	gm.Expect(measures[1].Measures["calls"]).To(gm.Equal(int64(2)))
+	gm.Expect(measures[1].UpdatedAt).ToNot(gm.BeZero())
+
+	opID, err := manifold.NewID(idtype.Operation)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	d.PutOperation(Operation{ID: opID, Type: OperationResize, State: OperationStatePending, ResourceID: resourceID})
+
+	reopened, err = Open(s)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(reopened.GetPendingOperations()).To(gm.HaveLen(1))
+	gm.Expect(reopened.GetOperationsByResource(resourceID)[0].Type).To(gm.Equal(OperationResize))
+
+	gm.Expect(reopened.DeleteResource(resourceID)).To(gm.BeTrue())
+	reopened, err = Open(s)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(reopened.GetResource(resourceID)).To(gm.BeNil())
+	gm.Expect(reopened.GetCredential(credID)).To(gm.BeNil())
+}
@@ -0,0 +1,77 @@
+package db
+
+import "sync"
+
+// Store is the storage backend of a DB. It holds JSON documents by key,
+// grouped in buckets. Implementations must be safe for concurrent use.
+type Store interface {
+	// Put stores the JSON document under the key of the bucket, replacing any
+	// document stored under it.
+	Put(bucket, key string, value []byte) error
+
+	// Delete removes the document stored under the key of the bucket, if any.
+	Delete(bucket, key string) error
+
+	// All returns every document of the bucket, by key.
+	All(bucket string) (map[string][]byte, error)
+
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// memoryStore is a Store keeping its documents in memory, which are lost when
+// the process exits.
+type memoryStore struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemoryStore returns a Store which holds its documents in memory.
+func NewMemoryStore() Store {
+	return &memoryStore{buckets: make(map[string]map[string][]byte)}
+}
+
+func (s *memoryStore) Put(bucket, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	putDocument(s.buckets, bucket, key, value)
+	return nil
+}
+
+func (s *memoryStore) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.buckets[bucket], key)
+	return nil
+}
+
+func (s *memoryStore) All(bucket string) (map[string][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return copyBucket(s.buckets[bucket]), nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+func putDocument(buckets map[string]map[string][]byte, bucket, key string, value []byte) {
+	b, ok := buckets[bucket]
+	if !ok {
+		b = make(map[string][]byte)
+		buckets[bucket] = b
+	}
+
+	b[key] = append([]byte(nil), value...)
+}
+
+func copyBucket(b map[string][]byte) map[string][]byte {
+	docs := make(map[string][]byte, len(b))
+	for k, v := range b {
+		docs[k] = append([]byte(nil), v...)
+	}
+	return docs
+}
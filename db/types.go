@@ -16,6 +16,8 @@ const (
 	ResourceStateProvisioned ResourceState = "provisioned"
 	// ResourceStateProvisionFailed defines the state for the resource when it has failed provisioning
 	ResourceStateProvisionFailed ResourceState = "provision-failed"
+	// ResourceStateResizing defines the state for the resource when its plan is being changed
+	ResourceStateResizing ResourceState = "resizing"
 	// ResourceStateDerovisioning defines the state for the resource when its "deprovisioning"
 	ResourceStateDerovisioning ResourceState = "deprovisioning"
 	// ResourceStateDeprovisioned defines the state for the resource when its "deprovisioned"
@@ -56,3 +58,47 @@ type Measure struct {
 	// Internal Fields
 	UpdatedAt time.Time `json:"-"`
 }
+
+// OperationType defines the action an operation carries out against the provider
+type OperationType string
+
+const (
+	// OperationProvision provisions a resource
+	OperationProvision OperationType = "provision"
+	// OperationDeprovision deprovisions a resource
+	OperationDeprovision OperationType = "deprovision"
+	// OperationResize changes the plan of a resource
+	OperationResize OperationType = "resize"
+	// OperationCredentialProvision creates a credential set for a resource
+	OperationCredentialProvision OperationType = "credential-provision"
+	// OperationCredentialDeprovision deletes a credential set of a resource
+	OperationCredentialDeprovision OperationType = "credential-deprovision"
+)
+
+// OperationState defines the current state of an operation
+type OperationState string
+
+const (
+	// OperationStatePending defines the state for an operation waiting on the provider
+	OperationStatePending OperationState = "pending"
+	// OperationStateDone defines the state for an operation which succeeded
+	OperationStateDone OperationState = "done"
+	// OperationStateError defines the state for an operation which failed
+	OperationStateError OperationState = "error"
+)
+
+// Operation represents an action carried out against the provider on behalf
+// of the marketplace, which may complete asynchronously through a callback
+type Operation struct {
+	ID           manifold.ID         `json:"id"`
+	Type         OperationType       `json:"type"`
+	State        OperationState      `json:"state"`
+	Message      string              `json:"message,omitempty"`
+	ResourceID   manifold.ID         `json:"resource_id"`
+	CredentialID *manifold.ID        `json:"credential_id,omitempty"`
+	CallbackID   manifold.ID         `json:"callback_id"`
+	Plan         manifold.Label      `json:"plan,omitempty"`
+	Features     manifold.FeatureMap `json:"features,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+}
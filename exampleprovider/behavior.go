@@ -0,0 +1,136 @@
+package exampleprovider
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/manifoldco/go-manifold/errors"
+
+	"github.com/manifoldco/grafton"
+)
+
+var errSimulatedFailure = grafton.NewError(errors.InternalServerError, "The provider is failing on purpose")
+
+// Behavior changes how the provider answers requests, to simulate providers
+// which don't implement the provider API correctly. It applies to requests
+// completed right away as well as through callbacks, which are set apart
+// with Config.Async.
+type Behavior string
+
+// Behaviors a provider can be switched to.
+const (
+	// BehaviorCorrect implements the provider API as described by the spec.
+	BehaviorCorrect Behavior = "correct"
+
+	// BehaviorFail answers every request with 500 Internal Server Error.
+	BehaviorFail Behavior = "fail"
+
+	// BehaviorSlow waits for Config.Latency before handling each request.
+	BehaviorSlow Behavior = "slow"
+
+	// BehaviorWrongStatus completes requests changing resources and
+	// credentials right away with 200 OK, which the spec only allows when
+	// changing a resource's plan.
+	BehaviorWrongStatus Behavior = "wrong-status"
+
+	// BehaviorMissingMessage leaves the message out of successful responses
+	// and callbacks.
+	BehaviorMissingMessage Behavior = "missing-message"
+
+	// BehaviorNoBackoff retries callbacks the Connector fails to handle right
+	// away, instead of waiting longer after each attempt.
+	BehaviorNoBackoff Behavior = "no-backoff"
+
+	// BehaviorConflictingCallbacks follows every callback completed as done
+	// with another one, reporting an error instead.
+	BehaviorConflictingCallbacks Behavior = "conflicting-callbacks"
+
+	// BehaviorStaleRequests accepts signed requests whatever their date,
+	// instead of rejecting those outside of the permitted time skew.
+	BehaviorStaleRequests Behavior = "stale-requests"
+
+	// BehaviorTrustingSSO signs users in to the resource they ask for,
+	// without checking with the Connector they have access to it.
+	BehaviorTrustingSSO Behavior = "trusting-sso"
+)
+
+// Behaviors lists every behavior a provider can be switched to.
+var Behaviors = []Behavior{
+	BehaviorCorrect,
+	BehaviorFail,
+	BehaviorSlow,
+	BehaviorWrongStatus,
+	BehaviorMissingMessage,
+	BehaviorNoBackoff,
+	BehaviorConflictingCallbacks,
+	BehaviorStaleRequests,
+	BehaviorTrustingSSO,
+}
+
+// Valid returns whether b is one of the known behaviors.
+func (b Behavior) Valid() bool {
+	for _, v := range Behaviors {
+		if b == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Behavior returns the behavior the provider is currently switched to.
+func (p *Provider) Behavior() Behavior {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.behavior == "" {
+		return BehaviorCorrect
+	}
+
+	return p.behavior
+}
+
+// SetBehavior switches the provider to the given behavior, applying to
+// requests received from then on.
+func (p *Provider) SetBehavior(b Behavior) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.behavior = b
+}
+
+// simulate applies the current behavior to requests before they reach the
+// provider's handlers.
+func (p *Provider) simulate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch p.Behavior() {
+		case BehaviorFail:
+			respondWithError(rw, errSimulatedFailure)
+			return
+		case BehaviorSlow:
+			select {
+			case <-time.After(p.Config.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// verify verifies the signature of requests before passing them to the given
+// handler, ignoring their date when switched to BehaviorStaleRequests.
+func (p *Provider) verify(next http.Handler) http.Handler {
+	strict := p.verifier.Middleware(next)
+	lenient := p.lenientVerifier.Middleware(next)
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if p.Behavior() == BehaviorStaleRequests {
+			lenient.ServeHTTP(rw, r)
+			return
+		}
+
+		strict.ServeHTTP(rw, r)
+	})
+}
@@ -0,0 +1,176 @@
+package exampleprovider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/manifoldco/go-manifold/errors"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/generated/provider/models"
+)
+
+var (
+	errInvalidID   = grafton.NewError(errors.BadRequestError, "Invalid ID provided")
+	errBadReqBody  = grafton.NewError(errors.BadRequestError, "Could not parse request")
+	errInvalidBody = grafton.NewError(errors.BadRequestError, "Invalid request")
+)
+
+// callbackAttempts is how many times a callback is sent before giving up.
+// The wait between attempts starts at callbackBackoff, and doubles each time.
+const (
+	callbackAttempts = 5
+	callbackBackoff  = 500 * time.Millisecond
+)
+
+var jsonProducer = runtime.JSONProducer()
+
+// outcome describes how a request changing resources or credentials was
+// completed.
+type outcome struct {
+	// status is the status code answered with when completing the request
+	// right away.
+	status int
+
+	// accepted is the message answered with when completing the request
+	// through a callback, with the message of the callback.
+	accepted string
+	message  string
+
+	credentials map[string]string
+}
+
+// complete answers the request with the given outcome, either right away or,
+// when asynchronous, by accepting it and sending the outcome through its
+// callback later on.
+func (p *Provider) complete(rw http.ResponseWriter, r *http.Request, o outcome) {
+	callbackURL := r.Header.Get("X-Callback-URL")
+	async := p.Config.Async && callbackURL != ""
+
+	switch p.Behavior() {
+	case BehaviorWrongStatus:
+		o.status = http.StatusOK
+		async = false
+	case BehaviorMissingMessage:
+		o.accepted = ""
+		o.message = ""
+	}
+
+	if !async {
+		switch {
+		case o.status == http.StatusNoContent:
+			respondWithJSON(rw, nil, o.status)
+		case o.credentials != nil:
+			respondWithJSON(rw, &models.CredentialResponse{
+				Message:     models.Message(o.message),
+				Credentials: o.credentials,
+			}, o.status)
+		default:
+			respondWithJSON(rw, successMessage(o.message), o.status)
+		}
+
+		return
+	}
+
+	respondWithJSON(rw, successMessage(o.accepted), http.StatusAccepted)
+
+	p.callbacks.Add(1)
+	go func() {
+		defer p.callbacks.Done()
+
+		time.Sleep(p.Config.CallbackDelay)
+		p.sendCallback(callbackURL, &callbackRequest{
+			State:       "done",
+			Message:     o.message,
+			Credentials: o.credentials,
+		})
+
+		if p.Behavior() == BehaviorConflictingCallbacks {
+			p.sendCallback(callbackURL, &callbackRequest{
+				State:   "error",
+				Message: "The provider changed its mind on purpose",
+			})
+		}
+	}()
+}
+
+// sendCallback sends the callback, retrying with an exponential backoff
+// while the Connector can't be reached or fails to handle it. The Connector
+// may ask to wait for longer through the Retry-After header.
+func (p *Provider) sendCallback(url string, cb *callbackRequest) {
+	log := p.Config.Log.WithField("callback_url", url)
+	wait := callbackBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := p.connector.callback(context.Background(), url, cb)
+		if err == nil {
+			log.Info("Sent callback")
+			return
+		}
+
+		log := log.WithError(err).WithField("attempt", attempt)
+		if !retryable(err) || attempt == callbackAttempts {
+			log.Error("Could not send callback")
+			return
+		}
+
+		delay := wait
+		if p.Behavior() == BehaviorNoBackoff {
+			delay = 0
+		}
+		if e, ok := err.(*statusError); ok && e.RetryAfter > delay {
+			delay = e.RetryAfter
+		}
+
+		log.WithField("retry_in", delay).Warn("Could not send callback, retrying")
+		time.Sleep(delay)
+		wait *= 2
+	}
+}
+
+func successMessage(m string) *models.SuccessMessage {
+	return &models.SuccessMessage{Message: models.Message(m)}
+}
+
+type validatable interface {
+	Validate(strfmt.Registry) error
+}
+
+func decodeBody(r *http.Request, v validatable) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return errBadReqBody
+	}
+
+	if err := v.Validate(strfmt.Default); err != nil {
+		return errInvalidBody
+	}
+
+	return nil
+}
+
+// respondWithError answers with the error's message, leaving its type out as
+// the spec's ProviderError has no other field.
+func respondWithError(rw http.ResponseWriter, err error) {
+	e := grafton.ToError(err)
+	respondWithJSON(rw, map[string]string{"message": e.Error()}, e.StatusCode())
+}
+
+func respondWithJSON(rw http.ResponseWriter, v interface{}, code int) {
+	if v == nil {
+		rw.WriteHeader(code)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+
+	if err := jsonProducer.Produce(rw, v); err != nil {
+		logrus.WithError(err).Error("Could not write response")
+	}
+}
@@ -0,0 +1,257 @@
+package exampleprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	nurl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/manifoldco/go-manifold"
+)
+
+// connectorClient talks to the Connector API on behalf of the provider.
+type connectorClient struct {
+	url          *nurl.URL
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// statusError is returned when the Connector answers with an unexpected
+// status code.
+type statusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+
+	// RetryAfter is how long the Connector asked to wait before sending the
+	// request again, if it did.
+	RetryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s: received status code %d", e.Method, e.URL, e.StatusCode)
+}
+
+// retryable returns whether a request failing with err may succeed if sent
+// again.
+func retryable(err error) bool {
+	e, ok := err.(*statusError)
+	if !ok {
+		// The Connector could not be reached
+		return true
+	}
+
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusUnauthorized
+}
+
+type accessToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type callbackRequest struct {
+	State       string            `json:"state"`
+	Message     string            `json:"message"`
+	Credentials map[string]string `json:"credentials,omitempty"`
+}
+
+// userProfile is the profile of the user a token was granted for.
+type userProfile struct {
+	Type   string `json:"type"`
+	Target struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	} `json:"target"`
+}
+
+func newConnectorClient(u *nurl.URL, clientID, clientSecret string) *connectorClient {
+	return &connectorClient{
+		url:          u,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// exchangeCode exchanges the code a user signed in with for an access token
+// acting on their behalf.
+func (c *connectorClient) exchangeCode(ctx context.Context, code string) (string, error) {
+	t, err := c.requestToken(ctx, nurl.Values{
+		"grant_type": {"authorization_code"},
+		"code":       {code},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return t.AccessToken, nil
+}
+
+// providerToken returns an access token acting on behalf of the provider,
+// which is needed to send callbacks. Tokens are reused until shortly before
+// they expire.
+func (c *connectorClient) providerToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	t, err := c.requestToken(ctx, nurl.Values{"grant_type": {"client_credentials"}})
+	if err != nil {
+		return "", err
+	}
+
+	c.token = t.AccessToken
+	c.expires = time.Now().Add(time.Duration(t.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+func (c *connectorClient) forgetProviderToken() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = ""
+}
+
+// requestToken requests an access token, authenticating with the client id
+// and secret through basic authentication, as preferred by the Connector.
+func (c *connectorClient) requestToken(ctx context.Context, form nurl.Values) (*accessToken, error) {
+	req, err := http.NewRequest(http.MethodPost, c.endpoint("oauth/tokens"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.clientID, c.clientSecret)
+
+	t := &accessToken{}
+	if err := c.do(ctx, req, http.StatusCreated, t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// getResource succeeds if the user the token was granted for has access to
+// the resource.
+func (c *connectorClient) getResource(ctx context.Context, token string, id manifold.ID) error {
+	req, err := http.NewRequest(http.MethodGet, c.endpoint("resources/"+id.String()), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return c.do(ctx, req, http.StatusOK, nil)
+}
+
+// getSelf returns the profile of the user the token was granted for.
+func (c *connectorClient) getSelf(ctx context.Context, token string) (*userProfile, error) {
+	req, err := http.NewRequest(http.MethodGet, c.endpoint("self"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	profile := &userProfile{}
+	if err := c.do(ctx, req, http.StatusOK, profile); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// callback sends the outcome of a request to the callback URL Manifold sent
+// along with it.
+func (c *connectorClient) callback(ctx context.Context, url string, cb *callbackRequest) error {
+	token, err := c.providerToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(cb)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	err = c.do(ctx, req, http.StatusNoContent, nil)
+	if e, ok := err.(*statusError); ok && e.StatusCode == http.StatusUnauthorized {
+		// The token may have been revoked; request a new one next time.
+		c.forgetProviderToken()
+	}
+
+	return err
+}
+
+// startRotation asks the Connector to rotate a credential set, which it
+// accepts before rotating it in the background.
+func (c *connectorClient) startRotation(ctx context.Context, id manifold.ID, rot *rotationRequest) error {
+	token, err := c.providerToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(rot)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, c.endpoint("credential-rotations/"+id.String()), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return c.do(ctx, req, http.StatusAccepted, nil)
+}
+
+func (c *connectorClient) endpoint(p string) string {
+	if c.url == nil {
+		return p
+	}
+
+	return strings.TrimSuffix(c.url.String(), "/") + "/" + p
+}
+
+func (c *connectorClient) do(ctx context.Context, req *http.Request, status int, v interface{}) error {
+	rsp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != status {
+		e := &statusError{Method: req.Method, URL: req.URL.String(), StatusCode: rsp.StatusCode}
+		if secs, err := strconv.Atoi(rsp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			e.RetryAfter = time.Duration(secs) * time.Second
+		}
+
+		return e
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(rsp.Body).Decode(v)
+}
@@ -0,0 +1,142 @@
+package exampleprovider
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/errors"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/generated/provider/models"
+)
+
+var (
+	errCredentialNotFound = grafton.NewError(errors.NotFoundError, "Credential not found")
+	errCredentialConflict = grafton.NewError(errors.ConflictError, "The credential was already provisioned for another resource")
+	errCredentialMismatch = grafton.NewError(errors.BadRequestError, "The credential ID does not match the one in the path")
+)
+
+type credential struct {
+	ID         manifold.ID
+	ResourceID manifold.ID
+	Values     map[string]string
+}
+
+func provisionCredentialsHandler(p *Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := idFromRequest(r)
+		if err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		body := &models.CredentialRequest{}
+		if err := decodeBody(r, body); err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		if body.ID != id {
+			respondWithError(rw, errCredentialMismatch)
+			return
+		}
+
+		values, err := newCredentialValues(id, body.ResourceID)
+		if err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		p.mu.Lock()
+		_, hasResource := p.resources[body.ResourceID]
+		existing := p.credentials[id]
+		_, rotating := p.rotating[body.ResourceID]
+		if hasResource && existing == nil {
+			p.credentials[id] = &credential{
+				ID:         id,
+				ResourceID: body.ResourceID,
+				Values:     values,
+			}
+		}
+		p.mu.Unlock()
+
+		if hasResource && existing == nil && !rotating && p.Config.RotateAfter > 0 {
+			time.AfterFunc(p.Config.RotateAfter, func() { p.rotateCredential(id) })
+		}
+
+		switch {
+		case !hasResource:
+			respondWithError(rw, errResourceNotFound)
+		case existing == nil:
+			p.Config.Log.WithFields(logrus.Fields{
+				"resource_id":   body.ResourceID,
+				"credential_id": id,
+			}).Info("Provisioned credentials")
+
+			p.complete(rw, r, outcome{
+				status:      http.StatusCreated,
+				accepted:    "We're generating your credentials!",
+				message:     "Your credentials are ready to use!",
+				credentials: values,
+			})
+		case existing.ResourceID == body.ResourceID:
+			// Repeating the request returns the credentials provisioned the
+			// first time.
+			respondWithJSON(rw, &models.CredentialResponse{
+				Message:     "Your credentials are ready to use!",
+				Credentials: existing.Values,
+			}, http.StatusCreated)
+		default:
+			respondWithError(rw, errCredentialConflict)
+		}
+	}
+}
+
+func deprovisionCredentialsHandler(p *Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := idFromRequest(r)
+		if err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		p.mu.Lock()
+		cred, ok := p.credentials[id]
+		delete(p.credentials, id)
+		if ok && p.rotating[cred.ResourceID] == id {
+			delete(p.rotating, cred.ResourceID)
+		}
+		p.mu.Unlock()
+
+		if !ok {
+			respondWithError(rw, errCredentialNotFound)
+			return
+		}
+
+		p.Config.Log.WithField("credential_id", id).Info("Deprovisioned credentials")
+		p.complete(rw, r, outcome{
+			status:   http.StatusNoContent,
+			accepted: "We're revoking your credentials!",
+			message:  "Your credentials were revoked",
+		})
+	}
+}
+
+// newCredentialValues returns the credentials of a new credential set, in
+// the URL form Manifold recommends, with a random password.
+func newCredentialValues(id, resourceID manifold.ID) (map[string]string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"EXAMPLE_URL": fmt.Sprintf("https://%s:%s@example.test/%s", id, hex.EncodeToString(b), resourceID),
+	}, nil
+}
@@ -0,0 +1,181 @@
+// Package exampleprovider is a reference implementation of the provider side
+// of Manifold's provider API, as described by specs/provider.yaml.
+//
+// It keeps its resources and credentials in memory, verifies the signature of
+// every request it receives from Manifold, completes requests either right
+// away or through a callback to the Connector, and signs users in through the
+// Connector's OAuth 2 flow. It passes `grafton test`, and is served by
+// `grafton example-provider`.
+package exampleprovider
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	nurl "net/url"
+	"sync"
+	"time"
+
+	"github.com/go-zoo/bone"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/manifoldco/go-manifold"
+
+	"github.com/manifoldco/grafton/verify"
+)
+
+// Config holds the configuration of a Provider.
+type Config struct {
+	// Port is the local port the provider is served on.
+	Port uint
+
+	// Product is the label of the only product resources can be provisioned
+	// for, while Plans and Regions list the labels they can be provisioned
+	// with.
+	Product string
+	Plans   []string
+	Regions []string
+
+	// MasterKey is the public key which endorses the keys requests are
+	// signed with; the one in masterkey.json for requests sent by grafton.
+	// Keys endorsed by any of OtherMasterKeys are accepted as well, such as
+	// while a master key is being rotated out.
+	MasterKey       ed25519.PublicKey
+	OtherMasterKeys []ed25519.PublicKey
+
+	// ConnectorURL is the base URL of the Connector API, ending in /v1, which
+	// is authenticated with using ClientID and ClientSecret.
+	ConnectorURL *nurl.URL
+	ClientID     string
+	ClientSecret string
+
+	// Async completes requests changing resources and credentials through a
+	// callback, sent CallbackDelay after answering with 202 Accepted.
+	Async         bool
+	CallbackDelay time.Duration
+
+	// RotateAfter rotates every credential set through the Connector once it
+	// has been provisioned for that long, except those provisioned by a
+	// rotation. Credentials aren't rotated if it is zero.
+	RotateAfter time.Duration
+
+	// Measures are reported as the usage of every resource. Resources report
+	// no usage if it is empty.
+	Measures map[string]int64
+
+	// Behavior is the behavior the provider starts with, which can be
+	// switched with SetBehavior. Latency is how long BehaviorSlow waits before
+	// handling each request.
+	Behavior Behavior
+	Latency  time.Duration
+
+	Log *logrus.Entry
+}
+
+// Provider is an in-memory provider serving Manifold's provider API.
+type Provider struct {
+	Config Config
+	Server *http.Server
+
+	verifier  *verify.Verifier
+	connector *connectorClient
+
+	// lenientVerifier verifies requests when switched to
+	// BehaviorStaleRequests, allowing any time skew.
+	lenientVerifier *verify.Verifier
+
+	mu          sync.Mutex
+	resources   map[manifold.ID]*resource
+	credentials map[manifold.ID]*credential
+	sessions    map[string]*session
+	behavior    Behavior
+
+	// rotating holds the credential being rotated for each resource, so the
+	// credential replacing it isn't rotated in turn.
+	rotating map[manifold.ID]manifold.ID
+
+	// callbacks tracks the callbacks which have yet to be sent
+	callbacks sync.WaitGroup
+}
+
+// New returns a Provider with the given configuration.
+func New(cfg Config) *Provider {
+	if cfg.Log == nil {
+		l := logrus.New()
+		l.Out = ioutil.Discard
+		cfg.Log = logrus.NewEntry(l)
+	}
+
+	lenient := verify.New(cfg.MasterKey, cfg.OtherMasterKeys...)
+	lenient.Skew = 100 * 365 * 24 * time.Hour
+
+	return &Provider{
+		Config:      cfg,
+		verifier:    verify.New(cfg.MasterKey, cfg.OtherMasterKeys...),
+		connector:   newConnectorClient(cfg.ConnectorURL, cfg.ClientID, cfg.ClientSecret),
+		resources:   make(map[manifold.ID]*resource),
+		credentials: make(map[manifold.ID]*credential),
+		sessions:    make(map[string]*session),
+		rotating:    make(map[manifold.ID]manifold.ID),
+		behavior:    cfg.Behavior,
+
+		lenientVerifier: lenient,
+	}
+}
+
+// Handler returns the routes of the provider API, along with the dashboard
+// users are sent to after signing in.
+//
+// Every route called by Manifold has its signature verified; the single
+// sign-on route is called by the user's browser instead, and isn't signed.
+// Every route is subject to the provider's current Behavior.
+func (p *Provider) Handler() http.Handler {
+	signed := p.verify
+
+	mux := bone.New()
+	mux.Put("/v1/resources/:id", signed(provisionResourceHandler(p)))
+	mux.Patch("/v1/resources/:id", signed(changePlanHandler(p)))
+	mux.Delete("/v1/resources/:id", signed(deprovisionResourceHandler(p)))
+	mux.Get("/v1/resources/:id/measures", signed(resourceMeasuresHandler(p)))
+	mux.Put("/v1/credentials/:id", signed(provisionCredentialsHandler(p)))
+	mux.Delete("/v1/credentials/:id", signed(deprovisionCredentialsHandler(p)))
+	mux.GetFunc("/v1/sso", ssoHandler(p))
+	mux.GetFunc("/dashboard/:id", dashboardHandler(p))
+	return p.simulate(mux)
+}
+
+// StartSync starts the server or returns an error if it couldn't be started
+func (p *Provider) StartSync() error {
+	p.Server = &http.Server{
+		Addr:    fmt.Sprintf("localhost:%d", p.Config.Port),
+		Handler: p.Handler(),
+	}
+
+	return p.Server.ListenAndServe()
+}
+
+// Start the server in the background
+func (p *Provider) Start() {
+	p.Server = &http.Server{
+		Addr:    fmt.Sprintf("localhost:%d", p.Config.Port),
+		Handler: p.Handler(),
+	}
+
+	go p.Server.ListenAndServe()
+}
+
+// Stop the server or return an error if it couldn't be stopped
+func (p *Provider) Stop() error {
+	if p.Server == nil {
+		return errors.New("Cannot not stop a server that has not started")
+	}
+
+	return p.Server.Close()
+}
+
+// Wait blocks until every callback the provider owes the Connector was sent.
+func (p *Provider) Wait() {
+	p.callbacks.Wait()
+}
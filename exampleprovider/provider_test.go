@@ -0,0 +1,340 @@
+package exampleprovider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	nurl "net/url"
+	"testing"
+	"time"
+
+	gm "github.com/onsi/gomega"
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/manifoldco/go-base64"
+	"github.com/manifoldco/go-manifold"
+	merrors "github.com/manifoldco/go-manifold/errors"
+	"github.com/manifoldco/go-manifold/idtype"
+	"github.com/manifoldco/go-signature"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/connector"
+	"github.com/manifoldco/grafton/db"
+)
+
+const (
+	clientID     = "21jtaatqj8y5t0kctb2ejr6jev5w8"
+	clientSecret = "3yTKSiJ6f5V5Bq-kWF0hmdrEUep3m3HKPTcPX7CdBZw"
+)
+
+// testSigner signs requests with a live key endorsed by its master key.
+type testSigner struct {
+	master      ed25519.PublicKey
+	live        ed25519.PrivateKey
+	endorsement []byte
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	masterPub, masterPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	livePub, livePriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testSigner{
+		master:      masterPub,
+		live:        livePriv,
+		endorsement: ed25519.Sign(masterPriv, livePub),
+	}
+}
+
+func (s *testSigner) Sign(b []byte) (*signature.Signature, error) {
+	return &signature.Signature{
+		Value:       base64.New(ed25519.Sign(s.live, b)),
+		PublicKey:   base64.New([]byte(s.live.Public().(ed25519.PublicKey))),
+		Endorsement: base64.New(s.endorsement),
+	}, nil
+}
+
+type testEnv struct {
+	provider  *Provider
+	connector *connector.FakeConnector
+	api       *grafton.Client
+	apiURL    *nurl.URL
+	url       string
+	close     func()
+}
+
+func newTestEnv(t *testing.T, async bool) *testEnv {
+	signer := newTestSigner(t)
+
+	fc, err := connector.New(0, clientID, clientSecret, "bonnets")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	cs := httptest.NewServer(connector.ValidHandler(fc))
+
+	cu, err := nurl.Parse(cs.URL + "/v1")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	p := New(Config{
+		Product:      "bonnets",
+		Plans:        []string{"small", "large"},
+		Regions:      []string{"aws::us-east-1"},
+		MasterKey:    signer.master,
+		ConnectorURL: cu,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Async:        async,
+	})
+	ps := httptest.NewServer(p.Handler())
+
+	pu, err := nurl.Parse(ps.URL + "/v1")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	return &testEnv{
+		provider:  p,
+		connector: fc,
+		api: grafton.NewClient(grafton.ClientOptions{
+			URL:          pu,
+			ConnectorURL: cu,
+			Signer:       signer,
+		}),
+		apiURL: pu,
+		url:    ps.URL,
+		close: func() {
+			ps.Close()
+			cs.Close()
+		},
+	}
+}
+
+func newID(t idtype.Type) manifold.ID {
+	id, err := manifold.NewID(t)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	return id
+}
+
+func errorType(err error) merrors.Type {
+	gm.Expect(err).To(gm.BeAssignableToTypeOf(&grafton.Error{}))
+	return err.(*grafton.Error).Type
+}
+
+func TestProvider(t *testing.T) {
+	ctx := context.Background()
+	body := grafton.ResourceBody{
+		Product: "bonnets",
+		Plan:    "small",
+		Region:  "aws::us-east-1",
+	}
+
+	t.Run("completes requests right away", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		env := newTestEnv(t, false)
+		defer env.close()
+
+		body := body
+		body.ID = newID(idtype.Resource)
+
+		_, async, err := env.api.ProvisionResource(ctx, newID(idtype.Callback), body)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(async).To(gm.BeFalse())
+
+		_, async, err = env.api.ProvisionResource(ctx, newID(idtype.Callback), body)
+		gm.Expect(err).ToNot(gm.HaveOccurred(), "repeating a request succeeds")
+		gm.Expect(async).To(gm.BeFalse())
+
+		conflict := body
+		conflict.Plan = "large"
+		_, _, err = env.api.ProvisionResource(ctx, newID(idtype.Callback), conflict)
+		gm.Expect(errorType(err)).To(gm.Equal(merrors.ConflictError))
+
+		credID := newID(idtype.Credential)
+		creds, _, async, err := env.api.ProvisionCredentials(ctx, newID(idtype.Callback), body.ID, credID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(async).To(gm.BeFalse())
+		gm.Expect(creds).To(gm.HaveKey("EXAMPLE_URL"))
+
+		repeated, _, _, err := env.api.ProvisionCredentials(ctx, newID(idtype.Callback), body.ID, credID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(repeated).To(gm.Equal(creds))
+
+		_, _, _, err = env.api.ProvisionCredentials(ctx, newID(idtype.Callback), newID(idtype.Resource), newID(idtype.Credential))
+		gm.Expect(errorType(err)).To(gm.Equal(merrors.NotFoundError))
+
+		_, _, err = env.api.ChangePlan(ctx, newID(idtype.Callback), body.ID, "large", nil)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		_, _, err = env.api.ChangePlan(ctx, newID(idtype.Callback), body.ID, "huge", nil)
+		gm.Expect(errorType(err)).To(gm.Equal(merrors.BadRequestError))
+
+		_, _, err = env.api.DeprovisionResource(ctx, newID(idtype.Callback), body.ID)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		_, _, err = env.api.DeprovisionCredentials(ctx, newID(idtype.Callback), credID)
+		gm.Expect(errorType(err)).To(gm.Equal(merrors.NotFoundError), "credentials are deprovisioned with their resource")
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		env := newTestEnv(t, false)
+		defer env.close()
+
+		for _, invalid := range []grafton.ResourceBody{
+			{Product: "hoods", Plan: "small", Region: "aws::us-east-1"},
+			{Product: "bonnets", Plan: "huge", Region: "aws::us-east-1"},
+			{Product: "bonnets", Plan: "small", Region: "aws::eu-west-1"},
+		} {
+			invalid.ID = newID(idtype.Resource)
+			_, _, err := env.api.ProvisionResource(ctx, newID(idtype.Callback), invalid)
+			gm.Expect(errorType(err)).To(gm.Equal(merrors.BadRequestError))
+		}
+
+		unsigned := grafton.NewClient(grafton.ClientOptions{
+			URL:          env.apiURL,
+			ConnectorURL: env.apiURL,
+			Signer:       newTestSigner(t),
+		})
+
+		body := body
+		body.ID = newID(idtype.Resource)
+		_, _, err := unsigned.ProvisionResource(ctx, newID(idtype.Callback), body)
+		gm.Expect(errorType(err)).To(gm.Equal(merrors.UnauthorizedError))
+	})
+
+	t.Run("answers errors with a message alone", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		// The spec's ProviderError has no other field
+		rw := httptest.NewRecorder()
+		respondWithError(rw, grafton.NewError(merrors.BadRequestError, "Invalid plan"))
+		gm.Expect(rw.Code).To(gm.Equal(400))
+		gm.Expect(rw.Body.String()).To(gm.MatchJSON(`{"message": "Invalid plan"}`))
+	})
+
+	t.Run("completes requests through callbacks", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		env := newTestEnv(t, true)
+		defer env.close()
+
+		body := body
+		body.ID = newID(idtype.Resource)
+
+		cb, err := env.connector.AddCallback(connector.ResourceProvisionCallback)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		_, async, err := env.api.ProvisionResource(ctx, cb.ID, body)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(async).To(gm.BeTrue())
+
+		cb, err = env.connector.WaitForCallback(cb.ID, 5*time.Second)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(cb.State).To(gm.Equal(connector.DoneCallbackState))
+
+		cb, err = env.connector.AddCallback(connector.CredentialProvisionCallback)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		_, _, async, err = env.api.ProvisionCredentials(ctx, cb.ID, body.ID, newID(idtype.Credential))
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(async).To(gm.BeTrue())
+
+		cb, err = env.connector.WaitForCallback(cb.ID, 5*time.Second)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(cb.State).To(gm.Equal(connector.DoneCallbackState))
+		gm.Expect(cb.Credentials).To(gm.HaveKey("EXAMPLE_URL"))
+
+		env.provider.Wait()
+	})
+}
+
+func TestRotation(t *testing.T) {
+	gm.RegisterTestingT(t)
+	env := newTestEnv(t, false)
+	defer env.close()
+
+	ctx := context.Background()
+	env.provider.Config.RotateAfter = 50 * time.Millisecond
+	env.connector.Provider = env.api
+
+	body := grafton.ResourceBody{
+		ID:      newID(idtype.Resource),
+		Product: "bonnets",
+		Plan:    "small",
+		Region:  "aws::us-east-1",
+	}
+	_, _, err := env.api.ProvisionResource(ctx, newID(idtype.Callback), body)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	env.connector.AddResource(&db.Resource{ID: body.ID, Product: "bonnets", Plan: "small", Region: "aws::us-east-1"})
+
+	credID := newID(idtype.Credential)
+	creds, _, _, err := env.api.ProvisionCredentials(ctx, newID(idtype.Callback), body.ID, credID)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	env.connector.DB.PutCredential(db.Credential{ID: credID, Keys: creds, ResourceID: body.ID})
+
+	rot, err := env.connector.WaitForRotationOf(credID, 5*time.Second)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(rot.Request.ResourceID).To(gm.Equal(body.ID))
+
+	rot, err = env.connector.WaitForRotation(rot.ID, 5*time.Second)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(rot.State).To(gm.Equal(connector.DoneRotationState), rot.Message)
+	gm.Expect(env.connector.DB.GetCredential(rot.NewCredentialID)).ToNot(gm.BeNil())
+
+	// The credential replacing the rotated one isn't rotated in turn
+	_, err = env.connector.WaitForRotationOf(rot.NewCredentialID, 200*time.Millisecond)
+	gm.Expect(err).To(gm.Equal(connector.ErrRotationTimeout))
+}
+
+func TestSSO(t *testing.T) {
+	gm.RegisterTestingT(t)
+	env := newTestEnv(t, false)
+	defer env.close()
+
+	body := grafton.ResourceBody{
+		ID:      newID(idtype.Resource),
+		Product: "bonnets",
+		Plan:    "small",
+		Region:  "aws::us-east-1",
+	}
+	_, _, err := env.api.ProvisionResource(context.Background(), newID(idtype.Callback), body)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	env.connector.AddResource(&db.Resource{ID: body.ID, Product: "bonnets", Plan: "small", Region: "aws::us-east-1"})
+
+	client := &http.Client{
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	signIn := func(resourceID manifold.ID) *http.Response {
+		code, err := env.connector.CreateCode()
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		rsp, err := client.Get(env.api.CreateSsoURL(code.Code, resourceID).String())
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		rsp.Body.Close()
+
+		return rsp
+	}
+
+	rsp := signIn(body.ID)
+	gm.Expect(rsp.StatusCode).To(gm.Equal(http.StatusSeeOther))
+	gm.Expect(rsp.Header.Get("Location")).To(gm.Equal("/dashboard/" + body.ID.String()))
+	gm.Expect(rsp.Cookies()).To(gm.HaveLen(1))
+
+	req, err := http.NewRequest(http.MethodGet, env.url+"/dashboard/"+body.ID.String(), nil)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	req.AddCookie(rsp.Cookies()[0])
+
+	dashboard, err := client.Do(req)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	dashboard.Body.Close()
+	gm.Expect(dashboard.StatusCode).To(gm.Equal(http.StatusOK))
+
+	rsp = signIn(newID(idtype.Resource))
+	gm.Expect(rsp.StatusCode).To(gm.Equal(http.StatusUnauthorized), "users can't sign in to resources they can't access")
+}
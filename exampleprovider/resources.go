@@ -0,0 +1,247 @@
+package exampleprovider
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/go-zoo/bone"
+	"github.com/sirupsen/logrus"
+
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/errors"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/generated/provider/models"
+)
+
+var (
+	errResourceNotFound = grafton.NewError(errors.NotFoundError, "Resource not found")
+	errResourceConflict = grafton.NewError(errors.ConflictError, "A different resource was already provisioned with this ID")
+	errResourceMismatch = grafton.NewError(errors.BadRequestError, "The resource ID does not match the one in the path")
+	errUnknownProduct   = grafton.NewError(errors.BadRequestError, "Unknown product")
+	errUnknownPlan      = grafton.NewError(errors.BadRequestError, "Unknown plan")
+	errUnknownRegion    = grafton.NewError(errors.BadRequestError, "Unknown region")
+	errInvalidPeriod    = grafton.NewError(errors.BadRequestError, "Invalid period_start or period_end")
+)
+
+type resource struct {
+	ID        manifold.ID
+	Product   string
+	Plan      string
+	Region    string
+	Features  manifold.FeatureMap
+	CreatedAt time.Time
+}
+
+// matches returns whether the resource was provisioned from the given
+// request, so repeating it can succeed.
+func (r *resource) matches(req *models.ResourceRequest) bool {
+	return r.Product == string(req.Product) && r.Plan == string(req.Plan) &&
+		r.Region == string(req.Region) && reflect.DeepEqual(r.Features, req.Features)
+}
+
+func provisionResourceHandler(p *Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := idFromRequest(r)
+		if err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		body := &models.ResourceRequest{}
+		if err := decodeBody(r, body); err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		if body.ID != id {
+			respondWithError(rw, errResourceMismatch)
+			return
+		}
+
+		switch {
+		case string(body.Product) != p.Config.Product:
+			respondWithError(rw, errUnknownProduct)
+			return
+		case !contains(p.Config.Plans, string(body.Plan)):
+			respondWithError(rw, errUnknownPlan)
+			return
+		case !contains(p.Config.Regions, string(body.Region)):
+			respondWithError(rw, errUnknownRegion)
+			return
+		}
+
+		p.mu.Lock()
+		existing := p.resources[id]
+		if existing == nil {
+			p.resources[id] = &resource{
+				ID:        id,
+				Product:   string(body.Product),
+				Plan:      string(body.Plan),
+				Region:    string(body.Region),
+				Features:  body.Features,
+				CreatedAt: time.Now().UTC(),
+			}
+		}
+		p.mu.Unlock()
+
+		switch {
+		case existing == nil:
+			p.Config.Log.WithField("resource_id", id).Info("Provisioned resource")
+			p.complete(rw, r, outcome{
+				status:   http.StatusCreated,
+				accepted: "We're setting up your resource!",
+				message:  "Your resource is ready to use!",
+			})
+		case existing.matches(body):
+			respondWithJSON(rw, successMessage("Your resource is ready to use!"), http.StatusCreated)
+		default:
+			respondWithError(rw, errResourceConflict)
+		}
+	}
+}
+
+func changePlanHandler(p *Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := idFromRequest(r)
+		if err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		body := &models.ResourcePlanChangeRequest{}
+		if err := decodeBody(r, body); err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		if !contains(p.Config.Plans, string(body.Plan)) {
+			respondWithError(rw, errUnknownPlan)
+			return
+		}
+
+		p.mu.Lock()
+		res := p.resources[id]
+		unchanged := res != nil && res.Plan == string(body.Plan) && reflect.DeepEqual(res.Features, body.Features)
+		if res != nil {
+			res.Plan = string(body.Plan)
+			res.Features = body.Features
+		}
+		p.mu.Unlock()
+
+		switch {
+		case res == nil:
+			respondWithError(rw, errResourceNotFound)
+		case unchanged:
+			respondWithJSON(rw, nil, http.StatusNoContent)
+		default:
+			p.Config.Log.WithFields(logrus.Fields{
+				"resource_id": id,
+				"plan":        body.Plan,
+			}).Info("Changed the plan of resource")
+
+			p.complete(rw, r, outcome{
+				status:   http.StatusOK,
+				accepted: "We're moving your resource to its new plan!",
+				message:  "Your resource is now on the " + string(body.Plan) + " plan",
+			})
+		}
+	}
+}
+
+func deprovisionResourceHandler(p *Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := idFromRequest(r)
+		if err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		p.mu.Lock()
+		_, ok := p.resources[id]
+		if ok {
+			// Deprovisioning a resource deprovisions its credentials too
+			delete(p.resources, id)
+			for credID, c := range p.credentials {
+				if c.ResourceID == id {
+					delete(p.credentials, credID)
+				}
+			}
+		}
+		p.mu.Unlock()
+
+		if !ok {
+			respondWithError(rw, errResourceNotFound)
+			return
+		}
+
+		p.Config.Log.WithField("resource_id", id).Info("Deprovisioned resource")
+		p.complete(rw, r, outcome{
+			status:   http.StatusNoContent,
+			accepted: "We're tearing down your resource!",
+			message:  "Your resource was deprovisioned",
+		})
+	}
+}
+
+func resourceMeasuresHandler(p *Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := idFromRequest(r)
+		if err != nil {
+			respondWithError(rw, err)
+			return
+		}
+
+		q := r.URL.Query()
+		start, err := strfmt.ParseDateTime(q.Get("period_start"))
+		if err != nil {
+			respondWithError(rw, errInvalidPeriod)
+			return
+		}
+
+		end, err := strfmt.ParseDateTime(q.Get("period_end"))
+		if err != nil {
+			respondWithError(rw, errInvalidPeriod)
+			return
+		}
+
+		p.mu.Lock()
+		_, ok := p.resources[id]
+		p.mu.Unlock()
+
+		switch {
+		case !ok:
+			respondWithError(rw, errResourceNotFound)
+		case len(p.Config.Measures) == 0:
+			respondWithJSON(rw, nil, http.StatusNoContent)
+		default:
+			respondWithJSON(rw, &models.ResourceMeasures{
+				ResourceID:  id,
+				PeriodStart: &start,
+				PeriodEnd:   &end,
+				Measures:    p.Config.Measures,
+			}, http.StatusOK)
+		}
+	}
+}
+
+func idFromRequest(r *http.Request) (manifold.ID, error) {
+	id, err := manifold.DecodeIDFromString(bone.GetValue(r, "id"))
+	if err != nil {
+		return id, errInvalidID
+	}
+
+	return id, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,73 @@
+package exampleprovider
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/idtype"
+)
+
+// rotationRequest asks the Connector to replace a credential set with a new
+// one, provisioned through the provider API.
+type rotationRequest struct {
+	ResourceID   manifold.ID `json:"resource_id"`
+	CredentialID manifold.ID `json:"credential_id"`
+	Reason       string      `json:"reason"`
+}
+
+// rotateCredential asks the Connector to rotate the credential, unless it was
+// deprovisioned in the meantime, or another credential of its resource is
+// being rotated. The Connector then provisions the credential replacing it and
+// deprovisions it, which ends the rotation.
+func (p *Provider) rotateCredential(id manifold.ID) {
+	p.mu.Lock()
+	cred, ok := p.credentials[id]
+	rotating := false
+	if ok {
+		_, rotating = p.rotating[cred.ResourceID]
+	}
+	if ok && !rotating {
+		p.rotating[cred.ResourceID] = id
+	}
+	p.mu.Unlock()
+
+	if !ok || rotating {
+		return
+	}
+
+	log := p.Config.Log.WithFields(logrus.Fields{
+		"resource_id":   cred.ResourceID,
+		"credential_id": id,
+	})
+
+	err := p.startRotation(cred)
+	if err != nil {
+		p.mu.Lock()
+		delete(p.rotating, cred.ResourceID)
+		p.mu.Unlock()
+
+		log.WithError(err).Error("Could not rotate credentials")
+		return
+	}
+
+	log.Info("Rotating credentials")
+}
+
+func (p *Provider) startRotation(cred *credential) error {
+	rotationID, err := manifold.NewID(idtype.Operation)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return p.connector.startRotation(ctx, rotationID, &rotationRequest{
+		ResourceID:   cred.ResourceID,
+		CredentialID: cred.ID,
+		Reason:       "Rotated by the example provider",
+	})
+}
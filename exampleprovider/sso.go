@@ -0,0 +1,169 @@
+package exampleprovider
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+
+	"github.com/go-zoo/bone"
+	"github.com/sirupsen/logrus"
+
+	"github.com/manifoldco/go-manifold"
+)
+
+const sessionCookie = "example-provider-session"
+
+// session is the session of a user signed in through the Connector, which
+// may only access the resource they signed in to.
+type session struct {
+	ResourceID manifold.ID
+	User       *userProfile
+
+	// token acts on behalf of the user, and must be kept secret.
+	token string
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Resource.ID}}</title></head>
+<body>
+<h1>Welcome, {{.User.Target.Name}}</h1>
+<p>Signed in as {{.User.Target.Email}}.</p>
+<dl>
+<dt>Resource</dt><dd>{{.Resource.ID}}</dd>
+<dt>Product</dt><dd>{{.Resource.Product}}</dd>
+<dt>Plan</dt><dd>{{.Resource.Plan}}</dd>
+<dt>Region</dt><dd>{{.Resource.Region}}</dd>
+<dt>Credential sets</dt><dd>{{.Credentials}}</dd>
+</dl>
+</body>
+</html>
+`))
+
+// ssoHandler signs the user in through the Connector, then sends them to the
+// dashboard of the resource they are signing in to.
+//
+// The request comes from the user's browser, and isn't signed, so the
+// resource ID can't be trusted until the Connector confirms the user has
+// access to it.
+func ssoHandler(p *Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		q := r.URL.Query()
+
+		id, err := manifold.DecodeIDFromString(q.Get("resource_id"))
+		if err != nil {
+			http.Error(rw, "Invalid resource_id", http.StatusBadRequest)
+			return
+		}
+
+		log := p.Config.Log.WithField("resource_id", id)
+
+		token, err := p.connector.exchangeCode(ctx, q.Get("code"))
+		if err != nil {
+			log.WithError(err).Info("Could not exchange the code for an access token")
+			http.Error(rw, "Could not sign in", http.StatusUnauthorized)
+			return
+		}
+
+		if p.Behavior() != BehaviorTrustingSSO {
+			if err := p.connector.getResource(ctx, token, id); err != nil {
+				log.WithError(err).Info("The user does not have access to the resource")
+				http.Error(rw, "Could not sign in", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		user, err := p.connector.getSelf(ctx, token)
+		if err != nil {
+			log.WithError(err).Info("Could not look up the user")
+			http.Error(rw, "Could not sign in", http.StatusUnauthorized)
+			return
+		}
+
+		sid, err := newSessionID()
+		if err != nil {
+			http.Error(rw, "Could not sign in", http.StatusInternalServerError)
+			return
+		}
+
+		p.mu.Lock()
+		p.sessions[sid] = &session{ResourceID: id, User: user, token: token}
+		p.mu.Unlock()
+
+		log.WithFields(logrus.Fields{
+			"name":  user.Target.Name,
+			"email": user.Target.Email,
+		}).Info("Signed in user")
+
+		http.SetCookie(rw, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    sid,
+			Path:     "/dashboard/",
+			HttpOnly: true,
+		})
+		http.Redirect(rw, r, "/dashboard/"+id.String(), http.StatusSeeOther)
+	}
+}
+
+type dashboardData struct {
+	Resource    resource
+	User        *userProfile
+	Credentials int
+}
+
+// dashboardHandler shows the resource to the user signed in to it.
+func dashboardHandler(p *Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := manifold.DecodeIDFromString(bone.GetValue(r, "id"))
+		if err != nil {
+			http.NotFound(rw, r)
+			return
+		}
+
+		var sid string
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			sid = cookie.Value
+		}
+
+		p.mu.Lock()
+		s := p.sessions[sid]
+		res := p.resources[id]
+		d := dashboardData{}
+		if s != nil && res != nil {
+			// Copy the resource, as it may change once the lock is released
+			d.Resource = *res
+			d.User = s.User
+			for _, c := range p.credentials {
+				if c.ResourceID == id {
+					d.Credentials++
+				}
+			}
+		}
+		p.mu.Unlock()
+
+		switch {
+		case s == nil || s.ResourceID != id:
+			http.Error(rw, "Sign in through Manifold to access this resource", http.StatusUnauthorized)
+			return
+		case res == nil:
+			http.NotFound(rw, r)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardTemplate.Execute(rw, d); err != nil {
+			p.Config.Log.WithError(err).Error("Could not render dashboard")
+		}
+	}
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -10,9 +10,9 @@ require (
 	github.com/go-openapi/inflect v0.0.0-20130829110746-b1f6470ffb9c // indirect
 	github.com/go-openapi/jsonpointer v0.0.0-20170102174223-779f45308c19 // indirect
 	github.com/go-openapi/jsonreference v0.0.0-20161105162150-36d33bfe519e // indirect
-	github.com/go-openapi/loads v0.0.0-20170520182102-a80dea3052f0 // indirect
+	github.com/go-openapi/loads v0.0.0-20170520182102-a80dea3052f0
 	github.com/go-openapi/runtime v0.0.0-20170303002511-e66a4c440602
-	github.com/go-openapi/spec v0.0.0-20170928160009-48c2a7185575 // indirect
+	github.com/go-openapi/spec v0.0.0-20170928160009-48c2a7185575
 	github.com/go-openapi/strfmt v0.19.4
 	github.com/go-openapi/swag v0.19.8
 	github.com/go-openapi/validate v0.0.0-20170921144055-dc8a684882cf
@@ -45,6 +45,7 @@ require (
 	golang.org/x/crypto v0.0.0-20191122220453-ac88ee75c92c
 	golang.org/x/lint v0.0.0-20190313153728-d0100b6bd8b3
 	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b
+	gopkg.in/yaml.v2 v2.2.8
 )
 
 go 1.13
@@ -0,0 +1,232 @@
+// Package har records HTTP traffic to HAR 1.2 files, as read by browsers'
+// developer tools and most HTTP debugging tools.
+//
+// A Recorder captures requests sent through its Transport and received by
+// handlers wrapped with its Middleware, redacting credentials and secrets:
+//
+//	rec := har.NewRecorder()
+//	client := &http.Client{Transport: rec.Transport("provider", nil)}
+//	http.Handle("/", rec.Middleware("connector", handler))
+//	...
+//	err := rec.WriteFile("traffic.har")
+package har
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Version is the version of the HAR format written by a Recorder.
+const Version = "1.2"
+
+// HAR is the root of a HAR file.
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+// Log holds the recorded entries, oldest first.
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+}
+
+// Creator describes the application which recorded the traffic.
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry is a single recorded request, along with its response.
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         Timings   `json:"timings"`
+
+	// Comment is the label of the Transport or Middleware which recorded
+	// the entry, such as "provider" or "connector".
+	Comment string `json:"comment,omitempty"`
+}
+
+// Request describes a recorded request.
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []NameValue `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// Response describes a recorded response.
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []NameValue `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// NameValue is a header, cookie or query string parameter.
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PostData is the body of a recorded request.
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// Content is the body of a recorded response.
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+// Timings break down the time taken by a request, in milliseconds. Phases
+// which don't apply, or weren't measured, are -1.
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// Recorder records HTTP traffic, and writes it out as a HAR file. It is safe
+// for concurrent use.
+type Recorder struct {
+	// Creator is written as the creator of the HAR file.
+	Creator Creator
+
+	// Redactor hides credentials and secrets from the recorded traffic.
+	Redactor *Redactor
+
+	mu      sync.Mutex
+	entries []Entry
+	path    string
+
+	// saving serializes writing the HAR file after each request, so the
+	// last write holds every entry.
+	saving sync.Mutex
+}
+
+// NewRecorder returns a Recorder which redacts the headers and fields of
+// DefaultRedactor.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		Creator:  Creator{Name: "grafton", Version: "dev"},
+		Redactor: DefaultRedactor,
+	}
+}
+
+// SaveTo writes the HAR file at path every time a request is recorded, so it
+// is complete even if the process never stops cleanly.
+func (r *Recorder) SaveTo(path string) error {
+	r.mu.Lock()
+	r.path = path
+	r.mu.Unlock()
+
+	return r.WriteFile(path)
+}
+
+// Entries returns a copy of the recorded entries, oldest first.
+func (r *Recorder) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Entry(nil), r.entries...)
+}
+
+// HAR returns the recorded traffic as a HAR file.
+func (r *Recorder) HAR() *HAR {
+	entries := r.Entries()
+	if entries == nil {
+		entries = []Entry{}
+	}
+
+	return &HAR{
+		Log: Log{
+			Version: Version,
+			Creator: r.Creator,
+			Entries: entries,
+		},
+	}
+}
+
+// Write writes the recorded traffic to w as a HAR file.
+func (r *Recorder) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.HAR())
+}
+
+// WriteFile writes the recorded traffic to a HAR file at path, only readable
+// by its owner. The file is replaced at once, so it is never left half
+// written.
+func (r *Recorder) WriteFile(path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".har")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := r.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// record redacts and stores the entry, writing out the HAR file if saving.
+func (r *Recorder) record(e Entry) {
+	r.Redactor.redactEntry(&e)
+
+	r.mu.Lock()
+	r.entries = append(r.entries, e)
+
+	// Requests finish out of order, but entries are kept in the order they
+	// started.
+	sort.SliceStable(r.entries, func(i, j int) bool {
+		return r.entries[i].StartedDateTime.Before(r.entries[j].StartedDateTime)
+	})
+	path := r.path
+	r.mu.Unlock()
+
+	if path != "" {
+		// Recording must not fail requests; the file is written again with
+		// the next one.
+		r.saving.Lock()
+		_ = r.WriteFile(path)
+		r.saving.Unlock()
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
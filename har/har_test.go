@@ -0,0 +1,152 @@
+package har
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gm "github.com/onsi/gomega"
+)
+
+func header(headers []NameValue, name string) string {
+	for _, h := range headers {
+		if h.Name == name {
+			return h.Value
+		}
+	}
+
+	return ""
+}
+
+func TestTransport(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sso" {
+			http.Redirect(rw, r, "/dashboard?code="+r.URL.Query().Get("code"), http.StatusSeeOther)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"message": "ok", "credentials": {"PASSWORD": "hunter2"}}`))
+	}))
+	defer srv.Close()
+
+	rec := NewRecorder()
+	client := &http.Client{Transport: rec.Transport("provider", nil)}
+
+	rsp, err := client.PostForm(srv.URL+"/sso?code=abc123&resource_id=1234",
+		url.Values{"client_secret": {"s3cret"}, "grant_type": {"authorization_code"}})
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(string(body)).To(gm.ContainSubstring("hunter2"), "responses are left untouched")
+
+	entries := rec.Entries()
+	gm.Expect(entries).To(gm.HaveLen(2), "each redirect is recorded")
+
+	sso := entries[0]
+	gm.Expect(sso.Comment).To(gm.Equal("provider"))
+	gm.Expect(sso.Request.Method).To(gm.Equal("POST"))
+	gm.Expect(sso.Request.URL).ToNot(gm.ContainSubstring("abc123"))
+	gm.Expect(sso.Request.QueryString).To(gm.ContainElement(NameValue{Name: "code", Value: Redacted}))
+	gm.Expect(sso.Request.QueryString).To(gm.ContainElement(NameValue{Name: "resource_id", Value: "1234"}))
+	gm.Expect(sso.Request.PostData.Text).ToNot(gm.ContainSubstring("s3cret"))
+	gm.Expect(sso.Request.PostData.Text).To(gm.ContainSubstring("grant_type=authorization_code"))
+	gm.Expect(sso.Response.Status).To(gm.Equal(http.StatusSeeOther))
+	gm.Expect(sso.Response.RedirectURL).To(gm.Equal("/dashboard?code=" + url.QueryEscape(Redacted)))
+	gm.Expect(sso.Time).To(gm.BeNumerically(">", 0))
+	gm.Expect(sso.Timings.Wait).To(gm.BeNumerically(">=", 0))
+
+	dashboard := entries[1]
+	gm.Expect(dashboard.Request.Method).To(gm.Equal("GET"))
+	gm.Expect(dashboard.Response.Content.Text).To(gm.ContainSubstring(`"PASSWORD":"[REDACTED]"`))
+	gm.Expect(dashboard.Response.Content.Text).To(gm.ContainSubstring(`"message":"ok"`))
+	gm.Expect(dashboard.StartedDateTime).To(gm.BeTemporally(">=", sso.StartedDateTime))
+}
+
+func TestMiddleware(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	rec := NewRecorder()
+	srv := httptest.NewServer(rec.Middleware("connector", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/abort" {
+			panic(http.ErrAbortHandler)
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write([]byte(`{"access_token": "t0ken", "token_type": "bearer"}`))
+	})))
+	defer srv.Close()
+
+	req, err := http.NewRequest("PUT", srv.URL+"/v1/callbacks/1", strings.NewReader(`{"state": "done"}`))
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer t0ken")
+
+	rsp, err := http.DefaultClient.Do(req)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	rsp.Body.Close()
+
+	_, err = http.Get(srv.URL + "/abort")
+	gm.Expect(err).To(gm.HaveOccurred())
+
+	entries := rec.Entries()
+	gm.Expect(entries).To(gm.HaveLen(1), "aborted requests are left out")
+
+	e := entries[0]
+	gm.Expect(e.Comment).To(gm.Equal("connector"))
+	gm.Expect(e.Request.URL).To(gm.Equal(srv.URL + "/v1/callbacks/1"))
+	gm.Expect(e.Request.PostData.Text).To(gm.MatchJSON(`{"state": "done"}`))
+	gm.Expect(header(e.Request.Headers, "Authorization")).To(gm.Equal(Redacted))
+	gm.Expect(e.Response.Status).To(gm.Equal(http.StatusCreated))
+	gm.Expect(e.Response.Content.Text).To(gm.MatchJSON(`{"access_token": "[REDACTED]", "token_type": "bearer"}`))
+}
+
+func TestWriteFile(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "har")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "traffic.har")
+
+	rec := NewRecorder()
+	gm.Expect(rec.SaveTo(path)).To(gm.Succeed())
+
+	srv := httptest.NewServer(rec.Middleware("connector", http.NotFoundHandler()))
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	rsp.Body.Close()
+
+	info, err := os.Stat(path)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(info.Mode().Perm()).To(gm.Equal(os.FileMode(0600)))
+
+	b, err := ioutil.ReadFile(path)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	var out struct {
+		Log struct {
+			Version string                   `json:"version"`
+			Entries []map[string]interface{} `json:"entries"`
+		} `json:"log"`
+	}
+	gm.Expect(json.Unmarshal(b, &out)).To(gm.Succeed())
+	gm.Expect(out.Log.Version).To(gm.Equal("1.2"))
+	gm.Expect(out.Log.Entries).To(gm.HaveLen(1), "the file is saved after every request")
+	gm.Expect(out.Log.Entries[0]).To(gm.HaveKey("timings"))
+	gm.Expect(out.Log.Entries[0]).To(gm.HaveKey("cache"))
+}
@@ -0,0 +1,168 @@
+package har
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Middleware returns an http.Handler recording the requests received by h,
+// with the given label as their comment. The time taken by h is recorded as
+// waiting for the response.
+func (r *Recorder) Middleware(label string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var body []byte
+		if req.Body != nil {
+			var err error
+			body, err = ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				http.Error(rw, "Could not read request body", http.StatusBadRequest)
+				return
+			}
+
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		start := time.Now()
+		cw := &capturingWriter{ResponseWriter: rw}
+
+		defer func() {
+			// Requests aborted by the handler got no answer, and are left
+			// out, as with the Transport.
+			if p := recover(); p != nil {
+				panic(p)
+			}
+
+			end := time.Now()
+			if cw.status == 0 {
+				cw.status = http.StatusOK
+			}
+
+			// Inbound requests have no scheme or host in their URL.
+			u := *req.URL
+			u.Host = req.Host
+			u.Scheme = "http"
+			if req.TLS != nil {
+				u.Scheme = "https"
+			}
+
+			rec := req.Clone(req.Context())
+			rec.URL = &u
+
+			e := Entry{
+				StartedDateTime: start,
+				Time:            millis(end.Sub(start)),
+				Request:         newRequest(rec, body),
+				Response:        newResponse(req.Proto, cw.status, cw.Header(), cw.body.Bytes()),
+				Timings: Timings{
+					Blocked: -1,
+					DNS:     -1,
+					Connect: -1,
+					Wait:    millis(end.Sub(start)),
+				},
+				Comment: label,
+			}
+			e.Request.Cookies = cookies(req.Cookies())
+			e.Response.Cookies = cookies((&http.Response{Header: cw.Header()}).Cookies())
+
+			r.record(e)
+		}()
+
+		h.ServeHTTP(cw, req)
+	})
+}
+
+// capturingWriter keeps a copy of the status code and body written through
+// it.
+type capturingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *capturingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func newRequest(req *http.Request, body []byte) Request {
+	r := Request{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: proto(req.Proto),
+		Cookies:     []NameValue{},
+		Headers:     pairs(req.Header),
+		QueryString: pairs(req.URL.Query()),
+		HeadersSize: -1,
+		BodySize:    len(body),
+	}
+
+	if len(body) > 0 {
+		r.PostData = &PostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     string(body),
+		}
+	}
+
+	return r
+}
+
+func newResponse(protocol string, status int, header http.Header, body []byte) Response {
+	return Response{
+		Status:      status,
+		StatusText:  http.StatusText(status),
+		HTTPVersion: proto(protocol),
+		Cookies:     []NameValue{},
+		Headers:     pairs(header),
+		Content: Content{
+			Size:     len(body),
+			MimeType: header.Get("Content-Type"),
+			Text:     string(body),
+		},
+		RedirectURL: header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(body),
+	}
+}
+
+// pairs lists the headers or query string parameters sorted by name.
+func pairs(h map[string][]string) []NameValue {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := []NameValue{}
+	for _, name := range names {
+		for _, v := range h[name] {
+			out = append(out, NameValue{Name: name, Value: v})
+		}
+	}
+
+	return out
+}
+
+// proto returns the HTTP version of a request or response, defaulting to
+// HTTP/1.1 for those made without one, as in tests.
+func proto(p string) string {
+	if p == "" || !strings.HasPrefix(p, "HTTP/") {
+		return "HTTP/1.1"
+	}
+
+	return p
+}
@@ -0,0 +1,172 @@
+package har
+
+import (
+	"encoding/json"
+	nurl "net/url"
+	"strings"
+)
+
+// Redacted replaces the values hidden from recorded traffic.
+const Redacted = "[REDACTED]"
+
+// Redactor hides credentials and secrets from recorded traffic, keeping the
+// names they're sent under.
+type Redactor struct {
+	// Headers are the names of the headers whose values are hidden.
+	Headers []string
+
+	// Fields are the names of the query string parameters, form values and
+	// JSON fields whose values are hidden. JSON objects under these fields
+	// keep their keys, with every value hidden.
+	Fields []string
+}
+
+// DefaultRedactor hides authorization headers, cookies, OAuth secrets and
+// codes, and credential values.
+var DefaultRedactor = &Redactor{
+	Headers: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"},
+	Fields: []string{
+		"credentials",
+		"client_secret",
+		"access_token",
+		"refresh_token",
+		"code",
+		"password",
+		"secret",
+	},
+}
+
+func (r *Redactor) redactEntry(e *Entry) {
+	if r == nil {
+		return
+	}
+
+	e.Request.URL = r.redactURL(e.Request.URL)
+	e.Request.Headers = r.redactHeaders(e.Request.Headers)
+	e.Request.QueryString = r.redactPairs(e.Request.QueryString)
+	e.Request.Cookies = redactAll(e.Request.Cookies)
+	if e.Request.PostData != nil {
+		e.Request.PostData.Text = r.redactBody(e.Request.PostData.MimeType, e.Request.PostData.Text)
+	}
+
+	e.Response.Headers = r.redactHeaders(e.Response.Headers)
+	e.Response.Cookies = redactAll(e.Response.Cookies)
+	e.Response.RedirectURL = r.redactURL(e.Response.RedirectURL)
+	e.Response.Content.Text = r.redactBody(e.Response.Content.MimeType, e.Response.Content.Text)
+}
+
+func (r *Redactor) redactHeaders(headers []NameValue) []NameValue {
+	for i, h := range headers {
+		switch {
+		case contains(r.Headers, h.Name):
+			headers[i].Value = Redacted
+		case strings.EqualFold(h.Name, "Location"):
+			headers[i].Value = r.redactURL(h.Value)
+		}
+	}
+
+	return headers
+}
+
+func (r *Redactor) redactPairs(pairs []NameValue) []NameValue {
+	for i, p := range pairs {
+		if contains(r.Fields, p.Name) {
+			pairs[i].Value = Redacted
+		}
+	}
+
+	return pairs
+}
+
+func (r *Redactor) redactURL(s string) string {
+	u, err := nurl.Parse(s)
+	if err != nil || u.RawQuery == "" {
+		return s
+	}
+
+	u.RawQuery = r.redactValues(u.Query()).Encode()
+	return u.String()
+}
+
+func (r *Redactor) redactValues(values nurl.Values) nurl.Values {
+	for k, vs := range values {
+		if contains(r.Fields, k) {
+			for i := range vs {
+				vs[i] = Redacted
+			}
+		}
+	}
+
+	return values
+}
+
+// redactBody hides fields of JSON and form encoded bodies. Bodies of other
+// types are left alone.
+func (r *Redactor) redactBody(mimeType, text string) string {
+	switch {
+	case text == "":
+		return text
+	case strings.Contains(mimeType, "json"):
+		var v interface{}
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			return text
+		}
+
+		b, err := json.Marshal(r.redactJSON(v, false))
+		if err != nil {
+			return text
+		}
+
+		return string(b)
+	case strings.HasPrefix(mimeType, "application/x-www-form-urlencoded"):
+		values, err := nurl.ParseQuery(text)
+		if err != nil {
+			return text
+		}
+
+		return r.redactValues(values).Encode()
+	}
+
+	return text
+}
+
+// redactJSON hides the values of fields to redact, or every value if hide is
+// set.
+func (r *Redactor) redactJSON(v interface{}, hide bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, f := range v {
+			v[k] = r.redactJSON(f, hide || contains(r.Fields, k))
+		}
+		return v
+	case []interface{}:
+		for i, e := range v {
+			v[i] = r.redactJSON(e, hide)
+		}
+		return v
+	}
+
+	if hide && v != nil {
+		return Redacted
+	}
+
+	return v
+}
+
+func redactAll(pairs []NameValue) []NameValue {
+	for i := range pairs {
+		pairs[i].Value = Redacted
+	}
+
+	return pairs
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+
+	return false
+}
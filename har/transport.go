@@ -0,0 +1,160 @@
+package har
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Transport returns an http.RoundTripper recording the requests sent through
+// rt, or http.DefaultTransport if it is nil, with the given label as their
+// comment.
+//
+// Redirects followed by an http.Client go through the Transport one by one,
+// so each of them is recorded.
+func (r *Recorder) Transport(label string, rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	return &transport{rec: r, label: label, rt: rt}
+}
+
+type transport struct {
+	rec   *Recorder
+	label string
+	rt    http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	var p phases
+	start := time.Now()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), p.trace()))
+
+	rsp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		// Requests which never got an answer are left out, as HAR has no way
+		// to tell them apart from answered ones.
+		return nil, err
+	}
+
+	rspBody, err := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	rsp.Body = ioutil.NopCloser(bytes.NewReader(rspBody))
+	if err != nil {
+		return nil, err
+	}
+	end := time.Now()
+
+	e := Entry{
+		StartedDateTime: start,
+		Time:            millis(end.Sub(start)),
+		Request:         newRequest(req, body),
+		Response:        newResponse(rsp.Proto, rsp.StatusCode, rsp.Header, rspBody),
+		Timings:         p.timings(start, end),
+		Comment:         t.label,
+	}
+	e.Request.Cookies = cookies(req.Cookies())
+	e.Response.Cookies = cookies(rsp.Cookies())
+
+	t.rec.record(e)
+	return rsp, nil
+}
+
+// phases holds when each phase of a request started and ended, as traced.
+// Phases are traced from the transport's own goroutines.
+type phases struct {
+	mu                        sync.Mutex
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	wrote, firstByte          time.Time
+}
+
+func (p *phases) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { p.now(&p.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { p.now(&p.dnsDone) },
+		ConnectStart:         func(_, _ string) { p.now(&p.connectStart) },
+		ConnectDone:          func(_, _ string, _ error) { p.now(&p.connectDone) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { p.now(&p.connectDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { p.now(&p.wrote) },
+		GotFirstResponseByte: func() { p.now(&p.firstByte) },
+	}
+}
+
+func (p *phases) now(t *time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	*t = time.Now()
+}
+
+// timings breaks down the time taken by a request which started and ended at
+// the given times. The time spent setting up a connection is split between
+// DNS and connecting, with the rest of it spent blocked, before sending.
+func (p *phases) timings(start, end time.Time) Timings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t := Timings{DNS: -1, Connect: -1}
+
+	sending := start
+	var setup time.Duration
+	if !p.dnsStart.IsZero() && !p.dnsDone.IsZero() {
+		setup += p.dnsDone.Sub(p.dnsStart)
+		t.DNS = millis(p.dnsDone.Sub(p.dnsStart))
+	}
+	if !p.connectStart.IsZero() && !p.connectDone.IsZero() {
+		setup += p.connectDone.Sub(p.connectStart)
+		t.Connect = millis(p.connectDone.Sub(p.connectStart))
+		sending = p.connectDone
+	}
+
+	wrote, firstByte := p.wrote, p.firstByte
+	if wrote.IsZero() {
+		wrote = sending
+	}
+	if firstByte.IsZero() {
+		firstByte = wrote
+	}
+
+	t.Send = millis(wrote.Sub(sending))
+	t.Wait = millis(firstByte.Sub(wrote))
+	t.Receive = millis(end.Sub(firstByte))
+
+	// The blocked time covers the rest of the request, so the timings add
+	// up to its total time.
+	blocked := sending.Sub(start) - setup
+	if blocked < 0 {
+		blocked = 0
+	}
+	t.Blocked = millis(blocked)
+
+	return t
+}
+
+func cookies(cs []*http.Cookie) []NameValue {
+	out := []NameValue{}
+	for _, c := range cs {
+		out = append(out, NameValue{Name: c.Name, Value: c.Value})
+	}
+
+	return out
+}
@@ -25,12 +25,24 @@ type FakeMarketplace struct {
 	Connector *connector.FakeConnector
 	GC        *grafton.Client
 	Server    *http.Server
+
+	// Middleware, if set, wraps the handler serving the marketplace once
+	// started, such as to record the requests it receives.
+	Middleware func(http.Handler) http.Handler
 }
 
 // New creates a new FakeMarketplace based on the passed parameters
 func New(connector *connector.FakeConnector, port uint, pAPI *url.URL,
 	signer grafton.Signer, data *primitives.FakeProductData) *FakeMarketplace {
 
+	return NewWithTransport(connector, port, pAPI, signer, data, nil)
+}
+
+// NewWithTransport creates a new FakeMarketplace sending requests to the
+// provider through the given http.RoundTripper, such as to record them.
+func NewWithTransport(connector *connector.FakeConnector, port uint, pAPI *url.URL,
+	signer grafton.Signer, data *primitives.FakeProductData, rt http.RoundTripper) *FakeMarketplace {
+
 	fm := &FakeMarketplace{
 		Port:      port,
 		Product:   data,
@@ -42,16 +54,28 @@ func New(connector *connector.FakeConnector, port uint, pAPI *url.URL,
 	if err != nil {
 		panic("Failed to parse connector url for Grafton client: " + err.Error())
 	}
-	fm.GC = grafton.New(pAPI, cURL, signer, nil)
+	fm.GC = grafton.NewClient(grafton.ClientOptions{
+		URL:          pAPI,
+		ConnectorURL: cURL,
+		Signer:       signer,
+		Retry:        grafton.DefaultRetryPolicy,
+		Transport:    rt,
+	})
 
 	return fm
 }
 
+// Resume settles the operations which were still waiting on the provider when
+// the marketplace last stopped.
+func (m *FakeMarketplace) Resume() {
+	routes.ResumeOperations(m.DB, m.Connector)
+}
+
 // StartSync starts the server or returns an error if it couldn't be started
 func (m *FakeMarketplace) StartSync() error {
 	m.Server = &http.Server{
 		Addr:    fmt.Sprintf("localhost:%d", m.Port),
-		Handler: Routes(m),
+		Handler: m.handler(),
 	}
 
 	return m.Server.ListenAndServe()
@@ -61,12 +85,21 @@ func (m *FakeMarketplace) StartSync() error {
 func (m *FakeMarketplace) Start() {
 	m.Server = &http.Server{
 		Addr:    fmt.Sprintf("localhost:%d", m.Port),
-		Handler: Routes(m),
+		Handler: m.handler(),
 	}
 
 	go m.Server.ListenAndServe()
 }
 
+func (m *FakeMarketplace) handler() http.Handler {
+	h := http.Handler(Routes(m))
+	if m.Middleware != nil {
+		return m.Middleware(h)
+	}
+
+	return h
+}
+
 // Stop the server or return an error if it couldn't be stopped
 func (m *FakeMarketplace) Stop() error {
 	if m.Server == nil {
@@ -83,13 +116,30 @@ func Routes(m *FakeMarketplace) *bone.Mux {
 
 	mux.GetFunc("/resources", routes.GetResourcesHandler(m.DB))
 	mux.PostFunc("/resources", routes.PostResourcesHandler(m.DB, m.GC, m.Connector, m.Product))
-	mux.PostFunc("/resources/:id", routes.PutResourcesHandler(m.DB))
+	mux.GetFunc("/resources/:id", routes.GetResourceHandler(m.DB, m.Connector))
+	mux.PostFunc("/resources/:id", routes.PutResourcesHandler(m.DB, m.GC, m.Connector))
 	mux.GetFunc("/resources/:id/delete", routes.DeleteResourcesHandler(m.DB, m.GC, m.Connector))
 	mux.GetFunc("/resources/:id/sso", routes.SSOResourcesHandler(m.DB, m.GC, m.Connector))
-
-	// TODO: Core funcs
-	// mux.GetFunc("/resources/:id/sso", getResourcesSSOHandler(c))
-	// mux.GetFunc("/resources/:id/measures", getResourcesMeasuresHandler(c))
+	mux.GetFunc("/resources/:id/measures", routes.GetMeasuresHandler(m.DB, m.GC))
+	mux.PostFunc("/resources/:id/credentials", routes.PostCredentialsHandler(m.DB, m.GC, m.Connector))
+	mux.GetFunc("/resources/:id/credentials/:credential_id/delete",
+		routes.DeleteCredentialsHandler(m.DB, m.GC, m.Connector))
+
+	// JSON API, described by specs/marketplace.yaml
+	mux.GetFunc("/v1/resources", routes.APIGetResourcesHandler(m.DB))
+	mux.PostFunc("/v1/resources", routes.APIPostResourcesHandler(m.DB, m.GC, m.Connector, m.Product))
+	mux.GetFunc("/v1/resources/:id", routes.APIGetResourceHandler(m.DB))
+	mux.PatchFunc("/v1/resources/:id", routes.APIPatchResourceHandler(m.DB, m.GC, m.Connector))
+	mux.DeleteFunc("/v1/resources/:id", routes.APIDeleteResourceHandler(m.DB, m.GC, m.Connector))
+	mux.GetFunc("/v1/resources/:id/credentials", routes.APIGetCredentialsHandler(m.DB))
+	mux.PostFunc("/v1/resources/:id/credentials", routes.APIPostCredentialsHandler(m.DB, m.GC, m.Connector))
+	mux.DeleteFunc("/v1/resources/:id/credentials/:credential_id",
+		routes.APIDeleteCredentialHandler(m.DB, m.GC, m.Connector))
+	mux.GetFunc("/v1/resources/:id/measures", routes.APIGetMeasuresHandler(m.DB, m.GC))
+	mux.PostFunc("/v1/resources/:id/sso", routes.APIPostSSOHandler(m.DB, m.GC, m.Connector))
+	mux.GetFunc("/v1/resources/:id/operations", routes.APIGetResourceOperationsHandler(m.DB))
+	mux.GetFunc("/v1/operations/:id", routes.APIGetOperationHandler(m.DB))
+	mux.GetFunc("/v1/callbacks/:id", routes.APIGetCallbackHandler(m.Connector))
 
 	// TODO: Future funcs
 	// mux.GetFunc("/users", getUsersHandler(c))
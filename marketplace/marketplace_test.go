@@ -0,0 +1,264 @@
+package marketplace
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gm "github.com/onsi/gomega"
+
+	"github.com/manifoldco/go-signature"
+
+	"github.com/manifoldco/grafton/connector"
+	"github.com/manifoldco/grafton/db"
+	"github.com/manifoldco/grafton/marketplace/primitives"
+)
+
+type stubSigner struct{}
+
+func (stubSigner) Sign([]byte) (*signature.Signature, error) { return &signature.Signature{}, nil }
+
+func TestAPI(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	provider := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		b, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.Method == "PUT" && strings.Contains(string(b), `"broken"`):
+			rw.WriteHeader(500)
+			io.WriteString(rw, `{"message": "broken"}`)
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/v1/credentials/"):
+			rw.WriteHeader(201)
+			io.WriteString(rw, `{"message": "ok", "credentials": {"PASSWORD": "secret"}}`)
+		case r.Method == "PUT":
+			rw.WriteHeader(201)
+			io.WriteString(rw, `{"message": "ok"}`)
+		case r.Method == "PATCH":
+			rw.WriteHeader(200)
+			io.WriteString(rw, `{"message": "ok"}`)
+		default:
+			rw.WriteHeader(204)
+		}
+	}))
+	defer provider.Close()
+
+	fc, err := connector.New(0, "client", "secret", "bonnets")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	pAPI, _ := url.Parse(provider.URL + "/v1/")
+	m := New(fc, 0, pAPI, stubSigner{}, &primitives.FakeProductData{
+		Product: "bonnets",
+		Plan:    "small",
+		Region:  "aws::us-east-1",
+	})
+
+	srv := httptest.NewServer(Routes(m))
+	defer srv.Close()
+
+	var created struct {
+		Resource  map[string]interface{} `json:"resource"`
+		Operation db.Operation           `json:"operation"`
+	}
+
+	t.Run("provisions a resource", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		apiRequest(t, "POST", srv.URL+"/v1/resources", `{"plan": "medium"}`, 202, &created)
+		gm.Expect(created.Resource["plan"]).To(gm.Equal("medium"))
+		gm.Expect(created.Resource["state"]).To(gm.Equal("provisioning"))
+
+		op := pollOperation(t, srv.URL, created.Operation.ID.String())
+		gm.Expect(op.State).To(gm.Equal(db.OperationStateDone))
+
+		var r map[string]interface{}
+		apiRequest(t, "GET", srv.URL+"/v1/resources/"+created.Operation.ResourceID.String(), "", 200, &r)
+		gm.Expect(r["state"]).To(gm.Equal("provisioned"))
+	})
+
+	resourceURL := srv.URL + "/v1/resources/" + created.Operation.ResourceID.String()
+
+	t.Run("manages credentials", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		var op db.Operation
+		apiRequest(t, "POST", resourceURL+"/credentials", "", 202, &op)
+		gm.Expect(pollOperation(t, srv.URL, op.ID.String()).State).To(gm.Equal(db.OperationStateDone))
+
+		var creds []db.Credential
+		apiRequest(t, "GET", resourceURL+"/credentials", "", 200, &creds)
+		gm.Expect(creds).To(gm.HaveLen(1))
+		gm.Expect(creds[0].ID).To(gm.Equal(*op.CredentialID))
+		gm.Expect(creds[0].Keys).To(gm.Equal(map[string]string{"PASSWORD": "secret"}))
+
+		apiRequest(t, "DELETE", resourceURL+"/credentials/"+creds[0].ID.String(), "", 202, &op)
+		gm.Expect(pollOperation(t, srv.URL, op.ID.String()).State).To(gm.Equal(db.OperationStateDone))
+
+		apiRequest(t, "GET", resourceURL+"/credentials", "", 200, &creds)
+		gm.Expect(creds).To(gm.BeEmpty())
+	})
+
+	t.Run("changes the plan", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		var op db.Operation
+		apiRequest(t, "PATCH", resourceURL, `{"plan": "large"}`, 202, &op)
+		gm.Expect(pollOperation(t, srv.URL, op.ID.String()).State).To(gm.Equal(db.OperationStateDone))
+
+		var r map[string]interface{}
+		apiRequest(t, "GET", resourceURL, "", 200, &r)
+		gm.Expect(r["plan"]).To(gm.Equal("large"))
+
+		var e map[string]interface{}
+		apiRequest(t, "PATCH", resourceURL, `{"plan": "NOT A LABEL"}`, 400, &e)
+		gm.Expect(e["type"]).To(gm.Equal("bad_request"))
+	})
+
+	t.Run("creates sso codes", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		var sso struct {
+			Code   string `json:"code"`
+			UserID string `json:"user_id"`
+			URL    string `json:"url"`
+		}
+		apiRequest(t, "POST", resourceURL+"/sso", "", 201, &sso)
+		gm.Expect(sso.Code).ToNot(gm.BeEmpty())
+		gm.Expect(sso.URL).To(gm.ContainSubstring("code=" + sso.Code))
+
+		owner := fc.GetUsers()[0]
+		gm.Expect(sso.UserID).To(gm.Equal(owner.ID.String()))
+
+		ada, err := fc.AddMember(connector.Member{Name: "Ada", Email: "ada@example.com"})
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		apiRequest(t, "POST", resourceURL+"/sso", `{"user_id": "`+ada.ID.String()+`"}`, 201, &sso)
+		gm.Expect(sso.UserID).To(gm.Equal(ada.ID.String()))
+
+		var e map[string]interface{}
+		apiRequest(t, "POST", resourceURL+"/sso", `{"user_id": "`+created.Operation.ID.String()+`"}`, 400, &e)
+		gm.Expect(e["type"]).To(gm.Equal("bad_request"))
+	})
+
+	t.Run("queries callbacks", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		var cb map[string]interface{}
+		apiRequest(t, "GET", srv.URL+"/v1/callbacks/"+created.Operation.CallbackID.String(), "", 200, &cb)
+		gm.Expect(cb["type"]).To(gm.Equal("resource:provision"))
+		gm.Expect(cb["resource_id"]).To(gm.Equal(created.Operation.ResourceID.String()))
+	})
+
+	t.Run("deprovisions the resource", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		var op db.Operation
+		apiRequest(t, "DELETE", resourceURL, "", 202, &op)
+		gm.Expect(pollOperation(t, srv.URL, op.ID.String()).State).To(gm.Equal(db.OperationStateDone))
+
+		var e map[string]interface{}
+		apiRequest(t, "DELETE", resourceURL, "", 409, &e)
+		gm.Expect(e["type"]).To(gm.Equal("conflict"))
+
+		var ops []db.Operation
+		apiRequest(t, "GET", resourceURL+"/operations", "", 200, &ops)
+		gm.Expect(ops).To(gm.HaveLen(5))
+		gm.Expect(ops[0].Type).To(gm.Equal(db.OperationProvision))
+	})
+
+	t.Run("deletes resources which failed to provision", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		var failed struct {
+			Operation db.Operation `json:"operation"`
+		}
+		apiRequest(t, "POST", srv.URL+"/v1/resources", `{"plan": "broken"}`, 202, &failed)
+		gm.Expect(pollOperation(t, srv.URL, failed.Operation.ID.String()).State).To(gm.Equal(db.OperationStateError))
+
+		failedURL := srv.URL + "/v1/resources/" + failed.Operation.ResourceID.String()
+		var r map[string]interface{}
+		apiRequest(t, "GET", failedURL, "", 200, &r)
+		gm.Expect(r["state"]).To(gm.Equal("provision-failed"))
+
+		apiRequest(t, "DELETE", failedURL, "", 204, nil)
+
+		var e map[string]interface{}
+		apiRequest(t, "GET", failedURL, "", 404, &e)
+	})
+
+	t.Run("deprovisions a resource once when deleted concurrently", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		var other struct {
+			Operation db.Operation `json:"operation"`
+		}
+		apiRequest(t, "POST", srv.URL+"/v1/resources", `{"plan": "medium"}`, 202, &other)
+		gm.Expect(pollOperation(t, srv.URL, other.Operation.ID.String()).State).To(gm.Equal(db.OperationStateDone))
+
+		otherURL := srv.URL + "/v1/resources/" + other.Operation.ResourceID.String()
+
+		var wg sync.WaitGroup
+		codes := make(chan int, 5)
+		for i := 0; i < cap(codes); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				req, _ := http.NewRequest("DELETE", otherURL, nil)
+				rsp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					codes <- 0
+					return
+				}
+				rsp.Body.Close()
+				codes <- rsp.StatusCode
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		accepted := 0
+		for code := range codes {
+			gm.Expect(code).To(gm.BeElementOf(202, 409))
+			if code == 202 {
+				accepted++
+			}
+		}
+		gm.Expect(accepted).To(gm.Equal(1))
+
+		var ops []db.Operation
+		apiRequest(t, "GET", otherURL+"/operations", "", 200, &ops)
+		gm.Expect(ops).To(gm.HaveLen(2))
+	})
+}
+
+func apiRequest(t *testing.T, method, u, body string, code int, v interface{}) {
+	req, err := http.NewRequest(method, u, strings.NewReader(body))
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := http.DefaultClient.Do(req)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer rsp.Body.Close()
+
+	gm.Expect(rsp.StatusCode).To(gm.Equal(code))
+	if v != nil {
+		gm.Expect(json.NewDecoder(rsp.Body).Decode(v)).To(gm.Succeed())
+	}
+}
+
+func pollOperation(t *testing.T, base, id string) db.Operation {
+	var op db.Operation
+	gm.Eventually(func() db.OperationState {
+		apiRequest(t, "GET", base+"/v1/operations/"+id, "", 200, &op)
+		return op.State
+	}, 5*time.Second, 10*time.Millisecond).ShouldNot(gm.Equal(db.OperationStatePending))
+	return op
+}
@@ -0,0 +1,261 @@
+package routes
+
+import (
+	"context"
+	"time"
+
+	"github.com/manifoldco/go-manifold"
+	merrors "github.com/manifoldco/go-manifold/errors"
+	"github.com/manifoldco/go-manifold/idtype"
+	"github.com/manifoldco/go-manifold/names"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/connector"
+	"github.com/manifoldco/grafton/db"
+)
+
+// The actions below are shared by the HTML pages and the JSON API. Their
+// errors are manifold HTTP errors, carrying the status code to respond with.
+
+// lookupResource returns the resource with the given ID
+func lookupResource(d *db.DB, idString string) (*db.Resource, error) {
+	if idString == "" {
+		return nil, manifold.NewError(merrors.BadRequestError, "No ID provided!")
+	}
+
+	id, err := manifold.DecodeIDFromString(idString)
+	if err != nil {
+		return nil, manifold.NewError(merrors.BadRequestError, "Provided ID was not a Manifold ID")
+	} else if id.Type() != idtype.Resource {
+		return nil, manifold.NewError(merrors.BadRequestError, "Provided ID is not for Resource")
+	}
+
+	r := d.GetResource(id)
+	if r == nil {
+		return nil, manifold.NewError(merrors.NotFoundError, "Resource does not exist")
+	}
+
+	return r, nil
+}
+
+// lookupProvisionedResource works like lookupResource, but also fails if the
+// resource is not provisioned, as no other operation can be carried out
+// against it in the meantime.
+func lookupProvisionedResource(d *db.DB, idString string) (*db.Resource, error) {
+	r, err := lookupResource(d, idString)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.State != db.ResourceStateProvisioned {
+		return nil, manifold.NewError(merrors.ConflictError,
+			"Resource is "+string(r.State)+", not provisioned")
+	}
+
+	return r, nil
+}
+
+// provisionResource stores a new resource as provisioning, and starts
+// provisioning it with the provider
+func provisionResource(d *db.DB, gc *grafton.Client, fc *connector.FakeConnector,
+	plan manifold.Label, product manifold.Label, region string,
+	features manifold.FeatureMap) (*db.Resource, *db.Operation, error) {
+
+	id, err := manifold.NewID(idtype.Resource)
+	if err != nil {
+		return nil, nil, manifold.NewError(merrors.InternalServerError,
+			"Failed to generate ID for resource - "+err.Error())
+	}
+
+	name := names.ForResource(manifold.Label("grafton"), id)
+
+	// Store in a provisioning state
+	r := &db.Resource{
+		ID:        id,
+		Name:      manifold.Name(name),
+		Label:     name,
+		Plan:      plan,
+		Product:   product,
+		Region:    region,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		State:     db.ResourceStateProvisioning,
+		Features:  features,
+	}
+	d.PutResource(*r)
+
+	// Request to provision
+	op, err := startOperation(d, fc, db.Operation{
+		Type:       db.OperationProvision,
+		ResourceID: r.ID,
+	}, func(ctx context.Context, cbID manifold.ID) (map[string]string, bool, error) {
+		_, callback, err := gc.ProvisionResource(ctx, cbID, grafton.ResourceBody{
+			ID:       r.ID,
+			Product:  string(r.Product),
+			Plan:     string(r.Plan),
+			Region:   r.Region,
+			Features: r.Features,
+		})
+		return nil, callback, err
+	})
+	if err != nil {
+		r.State = db.ResourceStateProvisionFailed
+		d.PutResource(*r)
+		return nil, nil, manifold.NewError(merrors.InternalServerError,
+			"Failed to register callback for resource provision - "+err.Error())
+	}
+
+	return r, op, nil
+}
+
+// resizeResource starts changing the plan of a provisioned resource
+func resizeResource(d *db.DB, gc *grafton.Client, fc *connector.FakeConnector,
+	r *db.Resource, plan manifold.Label, features manifold.FeatureMap) (*db.Operation, error) {
+
+	if plan.Validate(nil) != nil {
+		return nil, manifold.NewError(merrors.BadRequestError, "Provided plan is not a valid label")
+	}
+
+	originalState := r.State
+	r.State = db.ResourceStateResizing
+	d.PutResource(*r)
+
+	// Request to change plan
+	op, err := startOperation(d, fc, db.Operation{
+		Type:       db.OperationResize,
+		ResourceID: r.ID,
+		Plan:       plan,
+		Features:   features,
+	}, func(ctx context.Context, cbID manifold.ID) (map[string]string, bool, error) {
+		_, callback, err := gc.ChangePlan(ctx, cbID, r.ID, string(plan), features)
+		return nil, callback, err
+	})
+	if err != nil {
+		r.State = originalState
+		d.PutResource(*r)
+		return nil, manifold.NewError(merrors.InternalServerError,
+			"Failed to register callback for resource resize - "+err.Error())
+	}
+
+	return op, nil
+}
+
+// deprovisionResource starts deprovisioning a provisioned resource. A
+// resource which failed to provision, or was left provisioning with no
+// operation to finish it, has nothing to deprovision with the provider, and
+// is deleted right away instead, in which case no operation is returned.
+func deprovisionResource(d *db.DB, gc *grafton.Client, fc *connector.FakeConnector,
+	id manifold.ID) (*db.Operation, error) {
+
+	from := []db.ResourceState{db.ResourceStateProvisioned, db.ResourceStateProvisionFailed}
+	if !provisionPending(d, id) {
+		from = append(from, db.ResourceStateProvisioning)
+	}
+
+	// Set resource as deprovisioning, unless another request got there first
+	r, ok := d.TransitionResource(id, db.ResourceStateDerovisioning, from...)
+	if r == nil {
+		return nil, manifold.NewError(merrors.NotFoundError, "Resource does not exist")
+	}
+	if !ok {
+		return nil, manifold.NewError(merrors.ConflictError,
+			"Resource is "+string(r.State)+", and can't be deprovisioned")
+	}
+
+	if r.State != db.ResourceStateProvisioned {
+		fc.RemoveResource(r.ID)
+		return nil, nil
+	}
+
+	// Request to deprovision
+	op, err := startOperation(d, fc, db.Operation{
+		Type:       db.OperationDeprovision,
+		ResourceID: r.ID,
+	}, func(ctx context.Context, cbID manifold.ID) (map[string]string, bool, error) {
+		_, callback, err := gc.DeprovisionResource(ctx, cbID, r.ID)
+		return nil, callback, err
+	})
+	if err != nil {
+		// Restore state and error
+		d.TransitionResource(r.ID, r.State, db.ResourceStateDerovisioning)
+		return nil, manifold.NewError(merrors.InternalServerError,
+			"Failed to register callback for resource deprovision - "+err.Error())
+	}
+
+	return op, nil
+}
+
+// provisionPending returns whether the resource is still waiting on the
+// provider to finish provisioning it.
+func provisionPending(d *db.DB, id manifold.ID) bool {
+	for _, op := range d.GetOperationsByResource(id) {
+		if op.Type == db.OperationProvision && op.State == db.OperationStatePending {
+			return true
+		}
+	}
+
+	return false
+}
+
+// provisionCredentials starts provisioning a new credential set for a
+// provisioned resource. The credential is stored once provisioned.
+func provisionCredentials(d *db.DB, gc *grafton.Client, fc *connector.FakeConnector,
+	r *db.Resource) (*db.Operation, error) {
+
+	credID, err := manifold.NewID(idtype.Credential)
+	if err != nil {
+		return nil, manifold.NewError(merrors.InternalServerError,
+			"Failed to generate ID for credential - "+err.Error())
+	}
+
+	op, err := startOperation(d, fc, db.Operation{
+		Type:         db.OperationCredentialProvision,
+		ResourceID:   r.ID,
+		CredentialID: &credID,
+	}, func(ctx context.Context, cbID manifold.ID) (map[string]string, bool, error) {
+		creds, _, callback, err := gc.ProvisionCredentials(ctx, cbID, r.ID, credID)
+		return creds, callback, err
+	})
+	if err != nil {
+		return nil, manifold.NewError(merrors.InternalServerError,
+			"Failed to register callback for credential provision - "+err.Error())
+	}
+
+	return op, nil
+}
+
+// deprovisionCredentials starts deprovisioning a credential set of a
+// provisioned resource. The credential is removed once deprovisioned.
+func deprovisionCredentials(d *db.DB, gc *grafton.Client, fc *connector.FakeConnector,
+	r *db.Resource, credIDString string) (*db.Operation, error) {
+
+	credID, err := manifold.DecodeIDFromString(credIDString)
+	if err != nil {
+		return nil, manifold.NewError(merrors.BadRequestError, "Provided credential ID was not a Manifold ID")
+	}
+
+	c := d.GetCredential(credID)
+	if c == nil || c.ResourceID != r.ID {
+		return nil, manifold.NewError(merrors.NotFoundError, "Credential does not exist")
+	}
+
+	op, err := startOperation(d, fc, db.Operation{
+		Type:         db.OperationCredentialDeprovision,
+		ResourceID:   r.ID,
+		CredentialID: &credID,
+	}, func(ctx context.Context, cbID manifold.ID) (map[string]string, bool, error) {
+		_, callback, err := gc.DeprovisionCredentials(ctx, cbID, credID)
+		return nil, callback, err
+	})
+	if err != nil {
+		return nil, manifold.NewError(merrors.InternalServerError,
+			"Failed to register callback for credential deprovision - "+err.Error())
+	}
+
+	return op, nil
+}
+
+// statusCode returns the status code to respond with for an action's error
+func statusCode(err error) int {
+	return manifold.ToError(err).StatusCode()
+}
@@ -0,0 +1,387 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-zoo/bone"
+
+	"github.com/manifoldco/go-manifold"
+	merrors "github.com/manifoldco/go-manifold/errors"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/connector"
+	"github.com/manifoldco/grafton/db"
+	"github.com/manifoldco/grafton/marketplace/primitives"
+)
+
+// The JSON API lets tests and scripts drive the marketplace, as described by
+// specs/marketplace.yaml. Actions carried out against the provider respond
+// with an operation straight away, which can be polled until it is settled.
+
+var jsonProducer = runtime.JSONProducer()
+
+// apiResource is a resource along with its internal state
+type apiResource struct {
+	db.Resource
+	State db.ResourceState `json:"state"`
+}
+
+type apiResourceCreateRequest struct {
+	Plan     manifold.Label      `json:"plan"`
+	Region   string              `json:"region"`
+	Features manifold.FeatureMap `json:"features"`
+}
+
+type apiResourceCreateResponse struct {
+	Resource  apiResource   `json:"resource"`
+	Operation *db.Operation `json:"operation"`
+}
+
+type apiPlanChangeRequest struct {
+	Plan     manifold.Label      `json:"plan"`
+	Features manifold.FeatureMap `json:"features"`
+}
+
+type apiSSORequest struct {
+	UserID manifold.ID `json:"user_id"`
+}
+
+type apiSSOResponse struct {
+	Code      string      `json:"code"`
+	UserID    manifold.ID `json:"user_id"`
+	ExpiresAt time.Time   `json:"expires_at"`
+	URL       string      `json:"url"`
+}
+
+type apiCallback struct {
+	ID         manifold.ID             `json:"id"`
+	Type       connector.CallbackType  `json:"type"`
+	State      connector.CallbackState `json:"state"`
+	Message    string                  `json:"message"`
+	ResourceID *manifold.ID            `json:"resource_id,omitempty"`
+}
+
+// APIGetResourcesHandler lists every resource
+func APIGetResourcesHandler(d *db.DB) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		rs := d.GetResources()
+		resources := make([]apiResource, 0, len(rs))
+		for _, r := range rs {
+			resources = append(resources, apiResource{Resource: r, State: r.State})
+		}
+
+		respondWithJSON(rw, resources, 200)
+	}
+}
+
+// APIPostResourcesHandler starts provisioning a new resource. The plan and
+// region default to the ones grafton serve was started with.
+func APIPostResourcesHandler(d *db.DB, gc *grafton.Client,
+	fc *connector.FakeConnector, data *primitives.FakeProductData) http.HandlerFunc {
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		body := apiResourceCreateRequest{}
+		if !decodeAPIRequest(rw, req, &body) {
+			return
+		}
+
+		if body.Plan == "" {
+			body.Plan = manifold.Label(data.Plan)
+		}
+		if body.Region == "" {
+			body.Region = data.Region
+		}
+		if body.Plan.Validate(nil) != nil {
+			respondWithAPIError(rw, manifold.NewError(merrors.BadRequestError, "Provided plan is not a valid label"))
+			return
+		}
+
+		r, op, err := provisionResource(d, gc, fc, body.Plan, manifold.Label(data.Product),
+			body.Region, body.Features)
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		respondWithJSON(rw, apiResourceCreateResponse{
+			Resource:  apiResource{Resource: *r, State: r.State},
+			Operation: op,
+		}, 202)
+	}
+}
+
+// APIGetResourceHandler returns a single resource
+func APIGetResourceHandler(d *db.DB) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r, err := lookupResource(d, bone.GetValue(req, "id"))
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		respondWithJSON(rw, apiResource{Resource: *r, State: r.State}, 200)
+	}
+}
+
+// APIPatchResourceHandler starts changing the plan of a resource
+func APIPatchResourceHandler(d *db.DB, gc *grafton.Client, fc *connector.FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r, err := lookupProvisionedResource(d, bone.GetValue(req, "id"))
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		body := apiPlanChangeRequest{}
+		if !decodeAPIRequest(rw, req, &body) {
+			return
+		}
+
+		op, err := resizeResource(d, gc, fc, r, body.Plan, body.Features)
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		respondWithJSON(rw, op, 202)
+	}
+}
+
+// APIDeleteResourceHandler starts deprovisioning a resource, or deletes it
+// right away if it was never provisioned
+func APIDeleteResourceHandler(d *db.DB, gc *grafton.Client, fc *connector.FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r, err := lookupResource(d, bone.GetValue(req, "id"))
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		op, err := deprovisionResource(d, gc, fc, r.ID)
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		if op == nil {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		respondWithJSON(rw, op, 202)
+	}
+}
+
+// APIGetCredentialsHandler lists the credentials of a resource
+func APIGetCredentialsHandler(d *db.DB) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r, err := lookupResource(d, bone.GetValue(req, "id"))
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		creds := d.GetCredentialsByResource(r.ID)
+		if creds == nil {
+			creds = []db.Credential{}
+		}
+
+		respondWithJSON(rw, creds, 200)
+	}
+}
+
+// APIPostCredentialsHandler starts provisioning a credential set for a
+// resource
+func APIPostCredentialsHandler(d *db.DB, gc *grafton.Client, fc *connector.FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r, err := lookupProvisionedResource(d, bone.GetValue(req, "id"))
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		op, err := provisionCredentials(d, gc, fc, r)
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		respondWithJSON(rw, op, 202)
+	}
+}
+
+// APIDeleteCredentialHandler starts deprovisioning a credential set of a
+// resource
+func APIDeleteCredentialHandler(d *db.DB, gc *grafton.Client, fc *connector.FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r, err := lookupProvisionedResource(d, bone.GetValue(req, "id"))
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		op, err := deprovisionCredentials(d, gc, fc, r, bone.GetValue(req, "credential_id"))
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		respondWithJSON(rw, op, 202)
+	}
+}
+
+// APIGetMeasuresHandler pulls the measures of a resource from the provider
+func APIGetMeasuresHandler(d *db.DB, gc *grafton.Client) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r, err := lookupResource(d, bone.GetValue(req, "id"))
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		start, end, err := parsePeriod(req.URL.Query())
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		measures, err := gc.PullResourceMeasures(req.Context(), r.ID, start, end)
+		if err != nil {
+			respondWithAPIError(rw, manifold.NewError(merrors.InternalServerError,
+				"Failed to pull measures from provider - "+err.Error()))
+			return
+		}
+
+		respondWithJSON(rw, measures, 200)
+	}
+}
+
+// APIPostSSOHandler creates an authorization code for the resource, signing
+// in as the user picked in the body or the resource's default user, along
+// with the provider's SSO url to exchange it at
+func APIPostSSOHandler(d *db.DB, gc *grafton.Client, fc *connector.FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r, err := lookupResource(d, bone.GetValue(req, "id"))
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		body := apiSSORequest{}
+		if !decodeAPIRequest(rw, req, &body) {
+			return
+		}
+
+		code, err := fc.CreateCodeForUser(r.ID, body.UserID)
+		if err == connector.ErrUserNotFound {
+			respondWithAPIError(rw, manifold.NewError(merrors.BadRequestError,
+				"Provided user does not exist"))
+			return
+		} else if err != nil {
+			respondWithAPIError(rw, manifold.NewError(merrors.InternalServerError,
+				"Failed to create auth code - "+err.Error()))
+			return
+		}
+
+		respondWithJSON(rw, apiSSOResponse{
+			Code:      code.Code,
+			UserID:    code.UserID,
+			ExpiresAt: code.ExpiresAt,
+			URL:       gc.CreateSsoURL(code.Code, r.ID).String(),
+		}, 201)
+	}
+}
+
+// APIGetResourceOperationsHandler lists the operations of a resource, oldest
+// first
+func APIGetResourceOperationsHandler(d *db.DB) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r, err := lookupResource(d, bone.GetValue(req, "id"))
+		if err != nil {
+			respondWithAPIError(rw, err)
+			return
+		}
+
+		ops := d.GetOperationsByResource(r.ID)
+		if ops == nil {
+			ops = []db.Operation{}
+		}
+
+		respondWithJSON(rw, ops, 200)
+	}
+}
+
+// APIGetOperationHandler returns a single operation, to poll until it is no
+// longer pending
+func APIGetOperationHandler(d *db.DB) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		id, err := manifold.DecodeIDFromString(bone.GetValue(req, "id"))
+		if err != nil {
+			respondWithAPIError(rw, manifold.NewError(merrors.BadRequestError, "Provided ID was not a Manifold ID"))
+			return
+		}
+
+		op := d.GetOperation(id)
+		if op == nil {
+			respondWithAPIError(rw, manifold.NewError(merrors.NotFoundError, "Operation does not exist"))
+			return
+		}
+
+		respondWithJSON(rw, op, 200)
+	}
+}
+
+// APIGetCallbackHandler returns the state of a callback held by the
+// connector
+func APIGetCallbackHandler(fc *connector.FakeConnector) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		id, err := manifold.DecodeIDFromString(bone.GetValue(req, "id"))
+		if err != nil {
+			respondWithAPIError(rw, manifold.NewError(merrors.BadRequestError, "Provided ID was not a Manifold ID"))
+			return
+		}
+
+		cb := fc.GetCallback(id)
+		if cb == nil {
+			respondWithAPIError(rw, manifold.NewError(merrors.NotFoundError, "Callback does not exist"))
+			return
+		}
+
+		cb.Mutex.Lock()
+		body := apiCallback{
+			ID:      cb.ID,
+			Type:    cb.Type,
+			State:   cb.State,
+			Message: cb.Message,
+		}
+		if !cb.ResourceID.IsEmpty() {
+			resourceID := cb.ResourceID
+			body.ResourceID = &resourceID
+		}
+		cb.Mutex.Unlock()
+
+		respondWithJSON(rw, body, 200)
+	}
+}
+
+// decodeAPIRequest decodes the request's JSON body into v, if there is one,
+// or responds with an error and returns false.
+func decodeAPIRequest(rw http.ResponseWriter, req *http.Request, v interface{}) bool {
+	if req.ContentLength == 0 {
+		return true
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		respondWithAPIError(rw, manifold.NewError(merrors.BadRequestError, "Failed to parse body - "+err.Error()))
+		return false
+	}
+
+	return true
+}
+
+func respondWithAPIError(rw http.ResponseWriter, err error) {
+	manifold.ToError(err).WriteResponse(rw, jsonProducer)
+}
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/go-zoo/bone"
+
+	"github.com/manifoldco/grafton"
+
+	"github.com/manifoldco/grafton/connector"
+	"github.com/manifoldco/grafton/db"
+)
+
+// PostCredentialsHandler attempts to provision a new credential set for an
+// existing resource
+func PostCredentialsHandler(d *db.DB, gc *grafton.Client,
+	fc *connector.FakeConnector) http.HandlerFunc {
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r := provisionedResourceFromRequest(d, rw, req)
+		if r == nil {
+			return
+		}
+
+		if _, err := provisionCredentials(d, gc, fc, r); err != nil {
+			respondError(rw, req, err.Error(), statusCode(err))
+			return
+		}
+
+		http.Redirect(rw, req, resourcePath(r.ID), http.StatusFound)
+	}
+}
+
+// DeleteCredentialsHandler attempts to deprovision a credential set of an
+// existing resource
+func DeleteCredentialsHandler(d *db.DB, gc *grafton.Client,
+	fc *connector.FakeConnector) http.HandlerFunc {
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r := provisionedResourceFromRequest(d, rw, req)
+		if r == nil {
+			return
+		}
+
+		_, err := deprovisionCredentials(d, gc, fc, r, bone.GetValue(req, "credential_id"))
+		if err != nil {
+			respondError(rw, req, err.Error(), statusCode(err))
+			return
+		}
+
+		http.Redirect(rw, req, resourcePath(r.ID), http.StatusFound)
+	}
+}
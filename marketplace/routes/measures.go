@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/manifoldco/go-manifold"
+	merrors "github.com/manifoldco/go-manifold/errors"
+
+	"github.com/manifoldco/grafton"
+	"github.com/manifoldco/grafton/db"
+	"github.com/manifoldco/grafton/generated/provider/models"
+)
+
+// periodLayout is the layout of the period dates picked on the measures page
+const periodLayout = "2006-01-02"
+
+// GetMeasuresHandler pulls the measures of a resource from the provider for
+// the period picked, defaulting to the current month
+func GetMeasuresHandler(d *db.DB, gc *grafton.Client) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r := resourceFromRequest(d, rw, req)
+		if r == nil {
+			return
+		}
+
+		start, end, err := parsePeriod(req.URL.Query())
+		if err != nil {
+			respondError(rw, req, err.Error(), statusCode(err))
+			return
+		}
+
+		content := struct {
+			Resource    *db.Resource
+			PeriodStart string
+			PeriodEnd   string
+			Measures    *models.ResourceMeasures
+			Error       string
+		}{
+			Resource:    r,
+			PeriodStart: start.Format(periodLayout),
+			PeriodEnd:   end.Format(periodLayout),
+		}
+
+		measures, err := gc.PullResourceMeasures(req.Context(), r.ID, start, end)
+		if err != nil {
+			content.Error = err.Error()
+		}
+		content.Measures = measures
+
+		respond(rw, req, "measures", content, 200)
+	}
+}
+
+// parsePeriod returns the measures period picked in the query, defaulting to
+// the current month
+func parsePeriod(query url.Values) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	var err error
+	if s := query.Get("period_start"); s != "" {
+		start, err = time.Parse(periodLayout, s)
+		if err != nil {
+			return start, end, manifold.NewError(merrors.BadRequestError, "Provided period start is not a date")
+		}
+	}
+	if s := query.Get("period_end"); s != "" {
+		end, err = time.Parse(periodLayout, s)
+		if err != nil {
+			return start, end, manifold.NewError(merrors.BadRequestError, "Provided period end is not a date")
+		}
+	}
+	if !end.After(start) {
+		return start, end, manifold.NewError(merrors.BadRequestError, "Provided period must end after it starts")
+	}
+
+	return start, end, nil
+}
@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"context"
+	"time"
+
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/idtype"
+
+	"github.com/manifoldco/grafton/connector"
+	"github.com/manifoldco/grafton/db"
+)
+
+// providerCall calls the provider for an operation, returning the
+// credentials provisioned synchronously, if any, and whether the provider
+// will complete the operation through the callback.
+type providerCall func(ctx context.Context, cbID manifold.ID) (map[string]string, bool, error)
+
+var callbackTypes = map[db.OperationType]connector.CallbackType{
+	db.OperationProvision:             connector.ResourceProvisionCallback,
+	db.OperationDeprovision:           connector.ResourceDeprovisionCallback,
+	db.OperationResize:                connector.ResourceResizeCallback,
+	db.OperationCredentialProvision:   connector.CredentialProvisionCallback,
+	db.OperationCredentialDeprovision: connector.CredentialDeprovisionCallback,
+}
+
+// startOperation stores the operation as pending and calls the provider in
+// the background, so requests return straight away while the operation's
+// progress is shown on the resource page.
+func startOperation(d *db.DB, fc *connector.FakeConnector, op db.Operation, call providerCall) (*db.Operation, error) {
+	ID, err := manifold.NewID(idtype.Operation)
+	if err != nil {
+		return nil, err
+	}
+
+	cb, err := fc.AddCallbackFor(callbackTypes[op.Type], op.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	op.ID = ID
+	op.CallbackID = cb.ID
+	op.State = db.OperationStatePending
+	op.CreatedAt = time.Now()
+	op.UpdatedAt = op.CreatedAt
+	d.PutOperation(op)
+
+	go runOperation(d, fc, op, call)
+
+	return &op, nil
+}
+
+func runOperation(d *db.DB, fc *connector.FakeConnector, op db.Operation, call providerCall) {
+	// The request which started the operation may be long gone, so the
+	// provider is called outside of its context.
+	creds, callback, err := call(context.Background(), op.CallbackID)
+	switch {
+	case callback:
+		waitForOperation(d, fc, op)
+	case err != nil:
+		finishOperation(d, op, db.OperationStateError, err.Error(), nil)
+	default:
+		finishOperation(d, op, db.OperationStateDone, "", creds)
+	}
+}
+
+// ResumeOperations waits, in the background, on the callbacks of the
+// operations left pending by a previous run, settling them once the provider
+// calls back.
+func ResumeOperations(d *db.DB, fc *connector.FakeConnector) {
+	for _, op := range d.GetPendingOperations() {
+		go waitForOperation(d, fc, op)
+	}
+}
+
+func waitForOperation(d *db.DB, fc *connector.FakeConnector, op db.Operation) {
+	cb, err := fc.WaitForCallback(op.CallbackID, callbackTimeout)
+	if err != nil {
+		finishOperation(d, op, db.OperationStateError, "Provider did not call back: "+err.Error(), nil)
+		return
+	}
+
+	cb.Mutex.Lock()
+	state, msg := cb.State, cb.Message
+	creds := make(map[string]string, len(cb.Credentials))
+	for k, v := range cb.Credentials {
+		creds[k] = v
+	}
+	cb.Mutex.Unlock()
+
+	if state == connector.DoneCallbackState {
+		finishOperation(d, op, db.OperationStateDone, msg, creds)
+	} else {
+		finishOperation(d, op, db.OperationStateError, msg, nil)
+	}
+}
+
+// finishOperation records the outcome of the operation, and applies it to
+// the resource or credential it was carried out for.
+func finishOperation(d *db.DB, op db.Operation, state db.OperationState, msg string, creds map[string]string) {
+	op.State = state
+	op.Message = msg
+	op.UpdatedAt = time.Now()
+	d.PutOperation(op)
+
+	done := state == db.OperationStateDone
+
+	switch op.Type {
+	case db.OperationCredentialProvision:
+		if done {
+			d.PutCredential(db.Credential{
+				ID:         *op.CredentialID,
+				Keys:       creds,
+				CreatedOn:  op.UpdatedAt,
+				ResourceID: op.ResourceID,
+			})
+		}
+		return
+	case db.OperationCredentialDeprovision:
+		if done {
+			d.DeleteCredential(*op.CredentialID)
+		}
+		return
+	}
+
+	r := d.GetResource(op.ResourceID)
+	if r == nil {
+		return
+	}
+
+	switch {
+	case op.Type == db.OperationProvision && done:
+		r.State = db.ResourceStateProvisioned
+	case op.Type == db.OperationProvision:
+		r.State = db.ResourceStateProvisionFailed
+	case op.Type == db.OperationDeprovision && done:
+		r.State = db.ResourceStateDeprovisioned
+	case op.Type == db.OperationResize && done:
+		r.Plan = op.Plan
+		r.Features = op.Features
+		r.State = db.ResourceStateProvisioned
+	default:
+		// Failing to deprovision or resize leaves the resource as it was,
+		// and only provisioned resources can be deprovisioned or resized.
+		r.State = db.ResourceStateProvisioned
+	}
+	r.UpdatedAt = op.UpdatedAt
+	d.PutResource(*r)
+}
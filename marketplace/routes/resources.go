@@ -2,8 +2,8 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"time"
 
 	"github.com/go-zoo/bone"
 
@@ -11,7 +11,6 @@ import (
 	"github.com/manifoldco/grafton"
 
 	"github.com/manifoldco/go-manifold"
-	"github.com/manifoldco/go-manifold/names"
 
 	"github.com/manifoldco/grafton/connector"
 	"github.com/manifoldco/grafton/db"
@@ -20,12 +19,7 @@ import (
 
 func respondResourcePage(d *db.DB, rw http.ResponseWriter, req *http.Request, code int, features string) {
 	// Get all resources
-	rs := make([]db.Resource, len(d.ResourcesByID))
-	i := 0
-	for _, r := range d.ResourcesByID {
-		rs[i] = r
-		i++
-	}
+	rs := d.GetResources()
 
 	content := struct {
 		Resources []db.Resource
@@ -52,167 +46,132 @@ func GetResourcesHandler(d *db.DB) http.HandlerFunc {
 	}
 }
 
-// PostResourcesHandler attempts to provision a new resource
-func PostResourcesHandler(d *db.DB, gc *grafton.Client,
-	fc *connector.FakeConnector, data *primitives.FakeProductData) http.HandlerFunc {
-
+// GetResourceHandler displays a resource along with its credentials, the
+// progress of the operations carried out for it, and the users who can sign
+// in to it
+func GetResourceHandler(d *db.DB, fc *connector.FakeConnector) http.HandlerFunc {
 	return func(rw http.ResponseWriter, req *http.Request) {
-		id, err := manifold.NewID(idtype.Resource)
-		if err != nil {
-			respondError(rw, req, "Failed to generate ID for resource - "+err.Error(), 500)
+		r := resourceFromRequest(d, rw, req)
+		if r == nil {
 			return
 		}
 
-		err = req.ParseForm()
-		if err != nil {
-			respondError(rw, req, "Failed to parse form - "+err.Error(), 500)
-			return
+		ops := d.GetOperationsByResource(r.ID)
+		pending := false
+		for _, op := range ops {
+			pending = pending || op.State == db.OperationStatePending
 		}
 
-		var features manifold.FeatureMap
-
-		featuresTxt := req.Form.Get("features")
-		if featuresTxt != "" {
-			err = json.Unmarshal([]byte(featuresTxt), &features)
-
-			if err != nil {
-				respondError(rw, req, "Failed to parse features - "+err.Error(), 500)
-				return
-			}
+		// Newest first
+		for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+			ops[i], ops[j] = ops[j], ops[i]
 		}
 
-		name := names.ForResource(manifold.Label("grafton"), id)
+		respond(rw, req, "resource", struct {
+			Resource    *db.Resource
+			Credentials []db.Credential
+			Operations  []db.Operation
+			Pending     bool
+			Users       []connector.User
+		}{
+			Resource:    r,
+			Credentials: d.GetCredentialsByResource(r.ID),
+			Operations:  ops,
+			Pending:     pending,
+			Users:       fc.GetUsers(),
+		}, 200)
+	}
+}
 
-		// Store in a provisioning state
-		r := &db.Resource{
-			ID:        id,
-			Name:      manifold.Name(name),
-			Label:     name,
-			Plan:      manifold.Label(data.Plan),
-			Product:   manifold.Label(data.Product),
-			Region:    data.Region,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-			State:     db.ResourceStateProvisioning,
-			Features:  features,
-		}
-		d.PutResource(*r)
+// PostResourcesHandler attempts to provision a new resource
+func PostResourcesHandler(d *db.DB, gc *grafton.Client,
+	fc *connector.FakeConnector, data *primitives.FakeProductData) http.HandlerFunc {
 
-		failedToProvision := func(m string) {
-			r.State = db.ResourceStateProvisionFailed
-			d.PutResource(*r)
-			respondError(rw, req, m, 500)
+	return func(rw http.ResponseWriter, req *http.Request) {
+		err := req.ParseForm()
+		if err != nil {
+			respondError(rw, req, "Failed to parse form - "+err.Error(), 500)
+			return
 		}
 
-		// Request to provision
-		cb, err := fc.AddCallback(connector.ResourceProvisionCallback)
+		features, err := parseFeatures(req.Form.Get("features"))
 		if err != nil {
-			failedToProvision("Failed to register callback for resource provision - " + err.Error())
+			respondError(rw, req, "Failed to parse features - "+err.Error(), 500)
 			return
 		}
 
-		_, callback, err := gc.ProvisionResource(req.Context(), cb.ID, grafton.ResourceBody{
-			ID:       r.ID,
-			Product:  string(r.Product),
-			Plan:     string(r.Plan),
-			Region:   r.Region,
-			Features: r.Features,
-		})
-
-		if callback {
-			waitForCallback(fc, cb.ID)
-			if cb.State != connector.DoneCallbackState {
-				failedToProvision("Failed to provision resource from provider - " + cb.Message)
-				return
-			}
-			// else all-good fall-through
-		} else if err != nil {
-			failedToProvision("Failed to provision resource from provider - " + err.Error())
+		r, _, err := provisionResource(d, gc, fc, manifold.Label(data.Plan),
+			manifold.Label(data.Product), data.Region, features)
+		if err != nil {
+			respondError(rw, req, err.Error(), statusCode(err))
 			return
 		}
 
-		// Provisioned!
-		r.State = db.ResourceStateProvisioned
-		d.PutResource(*r)
-
-		http.Redirect(rw, req, "/", http.StatusFound)
+		http.Redirect(rw, req, resourcePath(r.ID), http.StatusFound)
 	}
 }
 
-// PutResourcesHandler attempts to update an existing resource
-func PutResourcesHandler(d *db.DB) http.HandlerFunc {
-	return nil
-}
-
-// DeleteResourcesHandler attempts to update an existing resource
-func DeleteResourcesHandler(d *db.DB, gc *grafton.Client,
+// PutResourcesHandler attempts to change the plan of an existing resource
+func PutResourcesHandler(d *db.DB, gc *grafton.Client,
 	fc *connector.FakeConnector) http.HandlerFunc {
 
 	return func(rw http.ResponseWriter, req *http.Request) {
-
-		idString := bone.GetValue(req, "id")
-		if idString == "" {
-			respondError(rw, req, "No ID provided!", 400)
+		r := provisionedResourceFromRequest(d, rw, req)
+		if r == nil {
 			return
 		}
 
-		id, err := manifold.DecodeIDFromString(idString)
+		err := req.ParseForm()
 		if err != nil {
-			respondError(rw, req, "Provided ID was not a Manifold ID", 400)
-			return
-		} else if id.Type() != idtype.Resource {
-			respondError(rw, req, "Provided ID is not for Resource", 400)
+			respondError(rw, req, "Failed to parse form - "+err.Error(), 500)
 			return
 		}
 
-		r := d.GetResource(id)
-		if r == nil {
-			respondError(rw, req, "Resource does not exist", 404)
+		features, err := parseFeatures(req.Form.Get("features"))
+		if err != nil {
+			respondError(rw, req, "Failed to parse features - "+err.Error(), 400)
 			return
 		}
 
-		originalState := r.State
-		failedToDeprovision := func(m string) {
-			// Restore state and error
-			r.State = originalState
-			d.PutResource(*r)
-			respondError(rw, req, m, 500)
+		_, err = resizeResource(d, gc, fc, r, manifold.Label(req.Form.Get("plan")), features)
+		if err != nil {
+			respondError(rw, req, err.Error(), statusCode(err))
+			return
 		}
 
-		// Set resource as deprovisioning
-		r.State = db.ResourceStateDerovisioning
-		d.PutResource(*r)
+		http.Redirect(rw, req, resourcePath(r.ID), http.StatusFound)
+	}
+}
 
-		// Request to deprovision
-		cb, err := fc.AddCallback(connector.ResourceDeprovisionCallback)
-		if err != nil {
-			failedToDeprovision("Failed to register callback for resource deprovision - " + err.Error())
+// DeleteResourcesHandler attempts to deprovision an existing resource, or
+// deletes it if it was never provisioned
+func DeleteResourcesHandler(d *db.DB, gc *grafton.Client,
+	fc *connector.FakeConnector) http.HandlerFunc {
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		r := resourceFromRequest(d, rw, req)
+		if r == nil {
 			return
 		}
 
-		_, callback, err := gc.DeprovisionResource(req.Context(), cb.ID, id)
-
-		if callback {
-			waitForCallback(fc, cb.ID)
-			if cb.State != connector.DoneCallbackState {
-				failedToDeprovision("Failed to deprovision resource from provider - " + cb.Message)
-				return
-			}
-			// else all-good fall-through
-		} else if err != nil {
-			failedToDeprovision("Failed to deprovision resource from provider - " + err.Error())
+		op, err := deprovisionResource(d, gc, fc, r.ID)
+		if err != nil {
+			respondError(rw, req, err.Error(), statusCode(err))
 			return
 		}
 
-		// Deprovisioned!
-		r.State = db.ResourceStateDeprovisioned
-		d.PutResource(*r)
+		// Resources deleted right away have no page left to show
+		if op == nil {
+			http.Redirect(rw, req, "/resources", http.StatusFound)
+			return
+		}
 
-		http.Redirect(rw, req, "/", http.StatusFound)
+		http.Redirect(rw, req, resourcePath(r.ID), http.StatusFound)
 	}
 }
 
-// SSOResourcesHandler attempts to update an existing resource
+// SSOResourcesHandler redirects to the provider's SSO url, signed in as the
+// user picked with the user_id query parameter, or the resource's default user
 func SSOResourcesHandler(d *db.DB, gc *grafton.Client,
 	fc *connector.FakeConnector) http.HandlerFunc {
 
@@ -233,8 +192,17 @@ func SSOResourcesHandler(d *db.DB, gc *grafton.Client,
 			return
 		}
 
-		authCode, err := fc.CreateCode()
+		userID, err := parseUserID(req.URL.Query().Get("user_id"))
 		if err != nil {
+			respondError(rw, req, err.Error(), 400)
+			return
+		}
+
+		authCode, err := fc.CreateCodeForUser(id, userID)
+		if err == connector.ErrUserNotFound {
+			respondError(rw, req, "Provided user does not exist", 400)
+			return
+		} else if err != nil {
 			respondError(rw, req, "Failed to create auth code: "+err.Error(), 500)
 			return
 		}
@@ -246,3 +214,58 @@ func SSOResourcesHandler(d *db.DB, gc *grafton.Client,
 		rw.WriteHeader(302)
 	}
 }
+
+// resourceFromRequest returns the resource identified in the request's path,
+// or responds with an error and returns nil.
+func resourceFromRequest(d *db.DB, rw http.ResponseWriter, req *http.Request) *db.Resource {
+	r, err := lookupResource(d, bone.GetValue(req, "id"))
+	if err != nil {
+		respondError(rw, req, err.Error(), statusCode(err))
+		return nil
+	}
+
+	return r
+}
+
+// provisionedResourceFromRequest works like resourceFromRequest, but also
+// responds with an error if the resource is not provisioned.
+func provisionedResourceFromRequest(d *db.DB, rw http.ResponseWriter, req *http.Request) *db.Resource {
+	r, err := lookupProvisionedResource(d, bone.GetValue(req, "id"))
+	if err != nil {
+		respondError(rw, req, err.Error(), statusCode(err))
+		return nil
+	}
+
+	return r
+}
+
+func parseFeatures(txt string) (manifold.FeatureMap, error) {
+	if txt == "" {
+		return nil, nil
+	}
+
+	var features manifold.FeatureMap
+	err := json.Unmarshal([]byte(txt), &features)
+	return features, err
+}
+
+func resourcePath(id manifold.ID) string {
+	return "/resources/" + id.String()
+}
+
+// parseUserID parses the ID of the user picked to sign in, which is empty if
+// none was picked.
+func parseUserID(s string) (manifold.ID, error) {
+	if s == "" {
+		return manifold.ID{}, nil
+	}
+
+	id, err := manifold.DecodeIDFromString(s)
+	if err != nil {
+		return id, errors.New("Provided user ID was not a Manifold ID")
+	} else if id.Type() != idtype.User {
+		return id, errors.New("Provided ID is not for User")
+	}
+
+	return id, nil
+}
@@ -9,9 +9,6 @@ import (
 	"time"
 
 	"github.com/gobuffalo/packr"
-
-	manifold "github.com/manifoldco/go-manifold"
-	"github.com/manifoldco/grafton/connector"
 )
 
 const callbackTimeout = time.Minute * 5
@@ -102,19 +99,3 @@ func respondError(rw http.ResponseWriter, req *http.Request, message string, cod
 		Code:    code,
 	}, code)
 }
-
-func waitForCallback(fc *connector.FakeConnector, ID manifold.ID) bool {
-	timeout := time.After(callbackTimeout)
-waitForCallback:
-	select {
-	case cb := <-fc.OnCallback:
-		if cb.ID != ID {
-			goto waitForCallback
-		} else if cb.State == connector.PendingCallbackState {
-			goto waitForCallback
-		}
-		return true
-	case <-timeout:
-		return false
-	}
-}
@@ -0,0 +1,229 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// callbackAttempts is how many times a Player tries to send a callback before
+// giving up on it.
+const callbackAttempts = 3
+
+// Player answers requests with the responses recorded in a session, and
+// sends the callbacks recorded with them to the Connector.
+type Player struct {
+	// ClientID and ClientSecret are the OAuth credentials used to send
+	// callbacks to the Connector, as the provider would.
+	ClientID     string
+	ClientSecret string
+
+	// Log is used to report callbacks which could not be sent.
+	Log *logrus.Entry
+
+	// Client sends callbacks to the Connector.
+	Client *http.Client
+
+	mu        sync.Mutex
+	exchanges []Exchange
+	used      []bool
+
+	pending sync.WaitGroup
+}
+
+// NewPlayer returns a Player replaying the session, sending callbacks with
+// the given OAuth credentials.
+func NewPlayer(s *Session, clientID, clientSecret string) *Player {
+	return &Player{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Client:       http.DefaultClient,
+		exchanges:    s.Exchanges,
+		used:         make([]bool, len(s.Exchanges)),
+	}
+}
+
+// Transport returns an http.RoundTripper answering requests with recorded
+// responses, without sending them anywhere.
+//
+// Each request is answered with the first unused exchange recorded for the
+// same method, path and body, so repeated requests get their responses in the
+// order they were recorded. Requests which were never recorded fail.
+func (p *Player) Transport() http.RoundTripper {
+	return playerTransport{p}
+}
+
+// Wait waits for the callbacks of the requests answered so far to be sent.
+func (p *Player) Wait() {
+	p.pending.Wait()
+}
+
+type playerTransport struct {
+	p *Player
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t playerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r, ids := normalize(req.Method, req.URL.Path, body)
+	e, ok := t.p.next(r)
+	if !ok {
+		return nil, fmt.Errorf("no recorded response for %s %s", r.Method, r.Path)
+	}
+
+	if len(e.Callbacks) > 0 {
+		t.p.pending.Add(1)
+		go t.p.sendCallbacks(req.Header.Get("X-Callback-URL"), e.Callbacks)
+	}
+
+	header := http.Header{}
+	for k, vs := range e.Response.Header {
+		for _, v := range vs {
+			header.Add(k, derefIDs(v, ids))
+		}
+	}
+	rspBody := derefIDs(e.Response.Body, ids)
+
+	return &http.Response{
+		Status:        strconv.Itoa(e.Response.Status) + " " + http.StatusText(e.Response.Status),
+		StatusCode:    e.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(rspBody)),
+		ContentLength: int64(len(rspBody)),
+		Request:       req,
+	}, nil
+}
+
+// next returns the first unused exchange recorded for the request, marking
+// it as used.
+func (p *Player) next(r Request) (Exchange, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, e := range p.exchanges {
+		if !p.used[i] && e.Request == r {
+			p.used[i] = true
+			return e, true
+		}
+	}
+
+	return Exchange{}, false
+}
+
+// sendCallbacks sends the callbacks to the callback URL, each one after its
+// recorded delay.
+func (p *Player) sendCallbacks(callbackURL string, cbs []Callback) {
+	defer p.pending.Done()
+
+	log := p.Log
+	if log == nil {
+		log = logrus.NewEntry(logrus.StandardLogger())
+	}
+	log = log.WithField("callback_url", callbackURL)
+
+	start := time.Now()
+	for _, cb := range cbs {
+		time.Sleep(time.Until(start.Add(time.Duration(cb.Delay))))
+
+		var err error
+		for attempt := 1; attempt <= callbackAttempts; attempt++ {
+			if err = p.sendCallback(callbackURL, cb); err == nil {
+				break
+			}
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+
+		if err != nil {
+			log.WithError(err).WithField("state", cb.State).Error("Could not replay callback")
+		}
+	}
+}
+
+func (p *Player) sendCallback(callbackURL string, cb Callback) error {
+	// Callbacks are sent to /v1/callbacks/{id}, next to the Connector's
+	// token endpoint.
+	i := strings.LastIndex(callbackURL, "/callbacks/")
+	if i < 0 {
+		return fmt.Errorf("unexpected callback URL %q", callbackURL)
+	}
+
+	token, err := p.token(callbackURL[:i] + "/oauth/tokens")
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"state":       cb.State,
+		"message":     cb.Message,
+		"credentials": cb.Credentials,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rsp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return fmt.Errorf("callback was rejected with %s", rsp.Status)
+	}
+
+	return nil
+}
+
+// token gets an access token from the Connector with the client credentials
+// grant.
+func (p *Player) token(tokenURL string) (string, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(p.ClientID, p.ClientSecret)
+
+	rsp, err := p.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusCreated && rsp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get an access token: %s", rsp.Status)
+	}
+
+	var out struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+
+	return out.AccessToken, nil
+}
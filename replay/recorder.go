@@ -0,0 +1,229 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// callbacksPath is the path under which the Connector receives callbacks.
+const callbacksPath = "/v1/callbacks/"
+
+// Recorder records the requests made to a provider, along with the callbacks
+// it sends to complete them, into a session.
+type Recorder struct {
+	mu        sync.Mutex
+	exchanges []*Exchange
+	path      string
+
+	// early holds the callbacks received before the response to the request
+	// they complete, by callback ID.
+	early map[string][]Callback
+
+	// saving serializes writing the session file after each request, so
+	// the last write holds every exchange.
+	saving sync.Mutex
+}
+
+// NewRecorder returns a Recorder with an empty session.
+func NewRecorder() *Recorder {
+	return &Recorder{early: map[string][]Callback{}}
+}
+
+// SaveTo writes the session to a file at path every time a request or
+// callback is recorded, so it is complete even if the process never stops
+// cleanly.
+func (r *Recorder) SaveTo(path string) error {
+	r.mu.Lock()
+	r.path = path
+	r.mu.Unlock()
+
+	return r.WriteFile(path)
+}
+
+// Session returns the session recorded so far.
+func (r *Recorder) Session() *Session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := &Session{Exchanges: make([]Exchange, 0, len(r.exchanges))}
+	for _, e := range r.exchanges {
+		c := *e
+		c.Callbacks = append([]Callback(nil), e.Callbacks...)
+		s.Exchanges = append(s.Exchanges, c)
+	}
+
+	return s
+}
+
+// WriteFile writes the session recorded so far to a file at path.
+func (r *Recorder) WriteFile(path string) error {
+	return r.Session().WriteFile(path)
+}
+
+// Transport returns an http.RoundTripper recording the requests sent through
+// rt, or http.DefaultTransport if it is nil.
+func (r *Recorder) Transport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	return &recordingTransport{rec: r, rt: rt}
+}
+
+type recordingTransport struct {
+	rec *Recorder
+	rt  http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		// Requests which never got an answer can't be replayed.
+		return nil, err
+	}
+
+	rspBody, err := readBody(&rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r, ids := normalize(req.Method, req.URL.Path, body)
+	e := &Exchange{
+		Request: r,
+		Response: Response{
+			Status: rsp.StatusCode,
+			Header: http.Header{},
+			Body:   refIDs(string(rspBody), ids),
+		},
+		callbackID: req.Header.Get("X-Callback-ID"),
+		answered:   time.Now(),
+	}
+	for _, h := range recordedHeaders {
+		for _, v := range rsp.Header[h] {
+			e.Response.Header.Add(h, refIDs(v, ids))
+		}
+	}
+
+	t.rec.mu.Lock()
+	if e.callbackID != "" {
+		e.Callbacks = t.rec.early[e.callbackID]
+		delete(t.rec.early, e.callbackID)
+	}
+	t.rec.exchanges = append(t.rec.exchanges, e)
+	t.rec.mu.Unlock()
+
+	t.rec.save()
+	return rsp, nil
+}
+
+// Middleware returns an http.Handler recording the callbacks accepted by h,
+// which receives the Connector's requests, with the requests they complete.
+// Callbacks rejected by h are left out, as they are sent again.
+func (r *Recorder) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPut || !strings.HasPrefix(req.URL.Path, callbacksPath) {
+			h.ServeHTTP(rw, req)
+			return
+		}
+
+		body, err := readBody(&req.Body)
+		if err != nil {
+			http.Error(rw, "Could not read request body", http.StatusBadRequest)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: rw}
+		h.ServeHTTP(sw, req)
+
+		if sw.status < 200 || sw.status > 299 {
+			return
+		}
+
+		cb := Callback{}
+		if err := json.Unmarshal(body, &cb); err != nil {
+			return
+		}
+
+		r.addCallback(strings.TrimPrefix(req.URL.Path, callbacksPath), cb)
+	})
+}
+
+// addCallback attaches the callback to the latest request made with the
+// given callback ID. Providers may send callbacks before their response to
+// the request arrives, in which case they're kept until it does, and are
+// replayed right away.
+func (r *Recorder) addCallback(id string, cb Callback) {
+	r.mu.Lock()
+	defer r.save()
+	defer r.mu.Unlock()
+
+	for i := len(r.exchanges) - 1; i >= 0; i-- {
+		e := r.exchanges[i]
+		if e.callbackID == id {
+			cb.Delay = Duration(time.Since(e.answered))
+			e.Callbacks = append(e.Callbacks, cb)
+			return
+		}
+	}
+
+	r.early[id] = append(r.early[id], cb)
+}
+
+// save writes out the session file, if saving.
+func (r *Recorder) save() {
+	r.mu.Lock()
+	path := r.path
+	r.mu.Unlock()
+
+	if path != "" {
+		// Recording must not fail requests; the file is written again with
+		// the next one.
+		r.saving.Lock()
+		_ = r.WriteFile(path)
+		r.saving.Unlock()
+	}
+}
+
+// statusWriter keeps the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// readBody reads the body, replacing it with a copy so it can be read again.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	*body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, err
+}
@@ -0,0 +1,186 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gm "github.com/onsi/gomega"
+)
+
+const (
+	firstID  = "2000000000000000000000000000a"
+	secondID = "2000000000000000000000000000b"
+)
+
+// fakeConnector accepts callbacks sent with a token from its token endpoint,
+// sending the callbacks it accepts on the channel.
+func fakeConnector(callbacks chan<- string) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/oauth/tokens":
+			if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			rw.WriteHeader(http.StatusCreated)
+			rw.Write([]byte(`{"access_token": "t0ken", "token_type": "bearer"}`))
+		case strings.HasPrefix(r.URL.Path, "/v1/callbacks/"):
+			if r.Header.Get("Authorization") != "Bearer t0ken" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			b, _ := ioutil.ReadAll(r.Body)
+			rw.WriteHeader(http.StatusNoContent)
+			callbacks <- r.URL.Path + " " + string(b)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func provision(client *http.Client, providerURL, connectorURL, id string) *http.Response {
+	req, err := http.NewRequest("PUT", providerURL+"/v1/resources/"+id,
+		strings.NewReader(`{"plan": "small", "id": "`+id+`", "product": "bonnets"}`))
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", "sig-"+id)
+	req.Header.Set("X-Callback-ID", id)
+	req.Header.Set("X-Callback-URL", connectorURL+"/v1/callbacks/"+id)
+
+	rsp, err := client.Do(req)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	return rsp
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	rec := NewRecorder()
+
+	recorded := make(chan string, 1)
+	conn := httptest.NewServer(rec.Middleware(fakeConnector(recorded)))
+	defer conn.Close()
+
+	provider := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		cbURL := r.Header.Get("X-Callback-URL")
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			p := NewPlayer(&Session{}, "client", "secret")
+			p.pending.Add(1)
+			p.sendCallbacks(cbURL, []Callback{{State: "done", Message: "Provisioned"}})
+		}()
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("X-Request-ID", "dropped")
+		rw.WriteHeader(http.StatusAccepted)
+		rw.Write([]byte(`{"message": "Provisioning ` + strings.TrimPrefix(r.URL.Path, "/v1/resources/") + `"}`))
+	}))
+	defer provider.Close()
+
+	client := &http.Client{Transport: rec.Transport(nil)}
+	rsp := provision(client, provider.URL, conn.URL, firstID)
+	rsp.Body.Close()
+	gm.Expect(rsp.StatusCode).To(gm.Equal(http.StatusAccepted))
+	gm.Eventually(recorded).Should(gm.Receive())
+
+	s := rec.Session()
+	gm.Expect(s.Exchanges).To(gm.HaveLen(1))
+
+	e := s.Exchanges[0]
+	gm.Expect(e.Request.Path).To(gm.Equal("/v1/resources/{id}"))
+	gm.Expect(e.Request.Body).To(gm.Equal(`{"id":"{id}","plan":"small","product":"bonnets"}`))
+	gm.Expect(e.Response.Body).To(gm.MatchJSON(`{"message": "Provisioning {id:0}"}`))
+	gm.Expect(e.Response.Header).To(gm.HaveKey("Content-Type"))
+	gm.Expect(e.Response.Header).ToNot(gm.HaveKey("X-Request-Id"))
+	gm.Expect(e.Callbacks).To(gm.HaveLen(1))
+	gm.Expect(e.Callbacks[0].State).To(gm.Equal("done"))
+	gm.Expect(time.Duration(e.Callbacks[0].Delay)).To(gm.BeNumerically(">=", 50*time.Millisecond))
+
+	// The provider is gone when replaying, and IDs differ.
+	provider.Close()
+
+	replayed := make(chan string, 1)
+	replayConn := httptest.NewServer(fakeConnector(replayed))
+	defer replayConn.Close()
+
+	player := NewPlayer(s, "client", "secret")
+	client = &http.Client{Transport: player.Transport()}
+
+	rsp = provision(client, provider.URL, replayConn.URL, secondID)
+	body, err := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(rsp.StatusCode).To(gm.Equal(http.StatusAccepted))
+	gm.Expect(body).To(gm.MatchJSON(`{"message": "Provisioning `+secondID+`"}`),
+		"IDs are taken from the replayed request")
+
+	var cb string
+	gm.Eventually(replayed).Should(gm.Receive(&cb))
+	gm.Expect(cb).To(gm.HavePrefix("/v1/callbacks/" + secondID + " "))
+	gm.Expect(cb).To(gm.ContainSubstring(`"state":"done"`))
+	player.Wait()
+
+	_, err = client.Do(mustRequest("PUT", provider.URL+"/v1/resources/"+secondID))
+	gm.Expect(err).To(gm.MatchError(gm.ContainSubstring("no recorded response for PUT /v1/resources/{id}")),
+		"each exchange is replayed once")
+}
+
+func mustRequest(method, url string) *http.Request {
+	req, err := http.NewRequest(method, url, bytes.NewReader([]byte(`{"plan": "small"}`)))
+	if err != nil {
+		panic(err)
+	}
+	return req
+}
+
+func TestSessionFile(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "replay")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "session.json")
+
+	rec := NewRecorder()
+	gm.Expect(rec.SaveTo(path)).To(gm.Succeed())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: rec.Transport(nil)}
+	rsp, err := client.Do(mustRequest("DELETE", srv.URL+"/v1/credentials/"+firstID))
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	rsp.Body.Close()
+
+	info, err := os.Stat(path)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(info.Mode().Perm()).To(gm.Equal(os.FileMode(0600)))
+
+	s, err := LoadSession(path)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(s.Exchanges).To(gm.HaveLen(1), "the file is saved after every request")
+	gm.Expect(s.Exchanges[0].Request).To(gm.Equal(Request{
+		Method: "DELETE",
+		Path:   "/v1/credentials/{id}",
+		Body:   `{"plan":"small"}`,
+	}))
+	gm.Expect(s.Exchanges[0].Response.Status).To(gm.Equal(http.StatusNoContent))
+
+	b, err := ioutil.ReadFile(path)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	var out map[string]interface{}
+	gm.Expect(json.Unmarshal(b, &out)).To(gm.Succeed())
+	gm.Expect(out).To(gm.HaveKey("exchanges"))
+}
@@ -0,0 +1,198 @@
+// Package replay records the requests a grafton.Client makes to a provider
+// into a session, and replays them later on without the provider.
+//
+// A Recorder records the requests sent through its Transport, along with the
+// callbacks the provider sends for them, received by a Connector wrapped with
+// its Middleware. A Player answers requests sent through its Transport with
+// the recorded responses, and sends the recorded callbacks to the Connector:
+//
+//	rec := replay.NewRecorder()
+//	client := grafton.NewClient(grafton.ClientOptions{Transport: rec.Transport(nil), ...})
+//	fakeConnector.Middleware = rec.Middleware
+//	...
+//	err := rec.WriteFile("session.json")
+//
+//	session, err := replay.LoadSession("session.json")
+//	player := replay.NewPlayer(session, clientID, clientSecret)
+//	client := grafton.NewClient(grafton.ClientOptions{Transport: player.Transport(), ...})
+//
+// Requests are matched by method, path and body, ignoring signatures, as
+// well as IDs, which are generated anew on every run.
+package replay
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Session is a recorded series of exchanges with a provider.
+type Session struct {
+	Exchanges []Exchange `json:"exchanges"`
+}
+
+// Exchange is a request made to the provider, along with its response and
+// the callbacks the provider sent to complete it.
+type Exchange struct {
+	Request   Request    `json:"request"`
+	Response  Response   `json:"response"`
+	Callbacks []Callback `json:"callbacks,omitempty"`
+
+	// callbackID is the callback the request was made with, if any, to
+	// match the callbacks the provider sends while recording.
+	callbackID string
+	answered   time.Time
+}
+
+// Request is a recorded request, with its IDs replaced by IDPlaceholder. The
+// query string is left out, as it only holds the period of usage measures,
+// which depends on when the request is made.
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Body   string `json:"body,omitempty"`
+}
+
+// Response is a recorded response. The IDs of its request found in its body
+// and headers are referenced by position, such as {id:0} for the first one.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Callback is a callback the provider sent to complete a request, Delay after
+// answering it.
+type Callback struct {
+	Delay       Duration          `json:"delay"`
+	State       string            `json:"state"`
+	Message     string            `json:"message"`
+	Credentials map[string]string `json:"credentials,omitempty"`
+}
+
+// Duration is a time.Duration expressed as a string such as "1.5s" in JSON.
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes the duration from a string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+// recordedHeaders are the response headers kept in a session.
+var recordedHeaders = []string{"Content-Type", "Location", "Retry-After"}
+
+// LoadSession reads a session from the file at path.
+func LoadSession(path string) (*Session, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// WriteFile writes the session to a file at path, only readable by its owner.
+// The file is replaced at once, so it is never left half written.
+func (s *Session) WriteFile(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".session")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// IDPlaceholder replaces IDs in recorded requests.
+const IDPlaceholder = "{id}"
+
+// idPattern matches IDs generated by Manifold, which are 29 characters long
+// in base32.
+var idPattern = regexp.MustCompile(`\b[0-9a-z]{29}\b`)
+
+// idRefPattern matches the references to the IDs of a request which replace
+// them in recorded responses, such as {id:0} for the first one.
+var idRefPattern = regexp.MustCompile(`\{id:(\d+)\}`)
+
+// normalize returns the request with its IDs replaced, and its body encoded
+// with sorted keys if it is JSON, so requests made on different runs compare
+// equal. The IDs are returned in the order they appear.
+func normalize(method, path string, body []byte) (Request, []string) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err == nil {
+		if b, err := json.Marshal(v); err == nil {
+			body = b
+		}
+	}
+
+	r := Request{
+		Method: method,
+		Path:   idPattern.ReplaceAllString(path, IDPlaceholder),
+		Body:   idPattern.ReplaceAllString(string(body), IDPlaceholder),
+	}
+
+	return r, idPattern.FindAllString(path+"\n"+string(body), -1)
+}
+
+// refIDs replaces the given IDs of a request in a recorded response with
+// references to their position, so they can be filled in with the IDs of
+// another request when replaying it.
+func refIDs(s string, ids []string) string {
+	return idPattern.ReplaceAllStringFunc(s, func(id string) string {
+		for i, v := range ids {
+			if v == id {
+				return "{id:" + strconv.Itoa(i) + "}"
+			}
+		}
+
+		return id
+	})
+}
+
+// derefIDs fills in the references to the IDs of a request left by refIDs.
+func derefIDs(s string, ids []string) string {
+	return idRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		i, err := strconv.Atoi(idRefPattern.FindStringSubmatch(ref)[1])
+		if err != nil || i >= len(ids) {
+			return ref
+		}
+
+		return ids[i]
+	})
+}
@@ -0,0 +1,244 @@
+package grafton
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RetryPolicy describes how requests to the provider are retried when they
+// fail with a transient error.
+//
+// Every attempt is signed again, with the same callback ID, so the provider
+// can recognize retried requests as the same request. Attempts are sent at
+// least a second apart, as their signature would otherwise be the same.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is sent before giving up,
+	// including the first attempt. Requests are sent once if it is 0 or 1.
+	MaxAttempts int
+
+	// Backoff is the wait before the first retry, doubling with each
+	// following retry up to MaxBackoff, if set. The provider may ask to wait
+	// for longer through the Retry-After header.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter is the share of each wait, between 0 and 1, which is randomly
+	// taken off it, so clients don't all retry at the same time.
+	Jitter float64
+
+	// RetryStatusCodes are the status codes requests are retried on.
+	// Requests are always retried when the provider can't be reached.
+	RetryStatusCodes []int
+
+	// AttemptTimeout is how long to wait for the provider to answer each
+	// attempt, if set.
+	AttemptTimeout time.Duration
+}
+
+// DefaultRetryPolicy retries requests up to three times on server errors
+// which are usually temporary.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	Backoff:     500 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+	Jitter:      0.2,
+	RetryStatusCodes: []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+	AttemptTimeout: 30 * time.Second,
+}
+
+// enabled returns whether the policy changes how requests are sent.
+func (p *RetryPolicy) enabled() bool {
+	return p.MaxAttempts > 1 || p.AttemptTimeout > 0
+}
+
+func (p *RetryPolicy) retryStatus(code int) bool {
+	for _, c := range p.RetryStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wait returns how long to wait before the given retry, starting at 1.
+func (p *RetryPolicy) wait(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+
+	if p.MaxBackoff != 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+
+	return d
+}
+
+// retryRoundTripper implements http.RoundTripper, sending requests again
+// through the given RoundTripper as set by its policy.
+type retryRoundTripper struct {
+	rt     http.RoundTripper
+	policy RetryPolicy
+	log    *logrus.Entry
+}
+
+// newRetryRoundTripper returns an http.RoundTripper that retries requests
+// failing with a transient error. The given RoundTripper is expected to sign
+// requests, as each attempt must be signed again.
+func newRetryRoundTripper(rt http.RoundTripper, policy RetryPolicy, log *logrus.Entry) *retryRoundTripper {
+	return &retryRoundTripper{
+		rt:     rt,
+		policy: policy,
+		log:    log,
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rt *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := req.Context()
+	var signed time.Time
+
+	for attempt := 1; ; attempt++ {
+		// Signatures only change with the Date header, which is precise to
+		// the second. Attempts are sent a second apart at least, so they
+		// aren't rejected as replays of the previous one.
+		if next := signed.Add(time.Second); time.Now().Before(next) {
+			if err := sleep(ctx, time.Until(next)); err != nil {
+				return nil, err
+			}
+		}
+
+		var rsp *http.Response
+		var err error
+		rsp, signed, err = rt.attempt(ctx, req, body)
+		if attempt >= rt.policy.MaxAttempts || ctx.Err() != nil {
+			return rsp, err
+		}
+
+		log := rt.log.WithFields(logrus.Fields{
+			"method":  req.Method,
+			"url":     req.URL.String(),
+			"attempt": attempt,
+		})
+
+		wait := rt.policy.wait(attempt)
+		switch {
+		case err != nil:
+			log = log.WithError(err)
+		case rt.policy.retryStatus(rsp.StatusCode):
+			if ra := retryAfter(rsp); ra > wait {
+				wait = ra
+			}
+
+			log = log.WithField("status", rsp.StatusCode)
+			drain(rsp)
+		default:
+			return rsp, nil
+		}
+
+		log.WithField("retry_in", wait).Warn("Request to provider failed, retrying")
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends a copy of the request with the given body, within the
+// policy's attempt timeout, returning when it was signed.
+func (rt *retryRoundTripper) attempt(ctx context.Context, req *http.Request,
+	body []byte) (*http.Response, time.Time, error) {
+
+	cancel := func() {}
+	if rt.policy.AttemptTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, rt.policy.AttemptTimeout)
+	}
+
+	r := req.Clone(ctx)
+	if body != nil {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+
+	rsp, err := rt.rt.RoundTrip(r)
+
+	// The Date header is set when signing the request
+	signed, _ := time.Parse(time.RFC3339, r.Header.Get("Date"))
+
+	if err != nil {
+		cancel()
+		return nil, signed, err
+	}
+
+	// The attempt's context must outlive reading the response.
+	rsp.Body = &cancelBody{ReadCloser: rsp.Body, cancel: cancel}
+	return rsp, signed, nil
+}
+
+// cancelBody cancels the context of a request once its response is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// retryAfter returns how long the provider asked to wait before retrying the
+// request, in seconds, if at all.
+func retryAfter(rsp *http.Response) time.Duration {
+	s, err := strconv.Atoi(rsp.Header.Get("Retry-After"))
+	if err != nil || s < 0 {
+		return 0
+	}
+
+	return time.Duration(s) * time.Second
+}
+
+// drain reads the rest of a response which is thrown away, so its connection
+// can be reused.
+func drain(rsp *http.Response) {
+	defer rsp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, rsp.Body)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,176 @@
+package grafton
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	gm "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"github.com/manifoldco/go-manifold"
+	"github.com/manifoldco/go-manifold/idtype"
+	"github.com/manifoldco/go-signature"
+)
+
+// countingSigner counts the requests it signs.
+type countingSigner struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (s *countingSigner) Sign([]byte) (*signature.Signature, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.count++
+	return &signature.Signature{}, nil
+}
+
+// attemptServer answers requests with the given status codes in turn, and
+// the last one once they run out, recording the headers of each request.
+type attemptServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	headers []http.Header
+}
+
+func newAttemptServer(delay time.Duration, statuses ...int) *attemptServer {
+	s := &attemptServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		n := len(s.headers)
+		s.headers = append(s.headers, r.Header)
+		s.mu.Unlock()
+
+		if n == 0 {
+			time.Sleep(delay)
+		}
+
+		if n >= len(statuses) {
+			n = len(statuses) - 1
+		}
+		rw.WriteHeader(statuses[n])
+	}))
+
+	return s
+}
+
+func (s *attemptServer) attempts() []http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]http.Header(nil), s.headers...)
+}
+
+func provisionWithRetries(srv *attemptServer, signer Signer, policy RetryPolicy) error {
+	u, _ := url.Parse(srv.URL)
+	c := NewClient(ClientOptions{
+		URL:          u,
+		ConnectorURL: &url.URL{},
+		Signer:       signer,
+		Log:          logrus.NewEntry(nullLogger),
+		Retry:        policy,
+	})
+
+	cbID, err := manifold.NewID(idtype.Callback)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = c.ProvisionResource(context.Background(), cbID, ResourceBody{
+		Product: "my-product",
+		Plan:    "my-plan",
+		Region:  "aws::us-east-1",
+	})
+	return err
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:      3,
+		Backoff:          10 * time.Millisecond,
+		RetryStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+
+	t.Run("retries transient errors, signing every attempt", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		srv := newAttemptServer(0, 503, 503, 204)
+		defer srv.Close()
+
+		signer := &countingSigner{}
+		err := provisionWithRetries(srv, signer, policy)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+
+		attempts := srv.attempts()
+		gm.Expect(attempts).To(gm.HaveLen(3))
+		gm.Expect(signer.count).To(gm.Equal(3))
+
+		for i := 1; i < len(attempts); i++ {
+			gm.Expect(attempts[i].Get("X-Callback-ID")).To(gm.Equal(attempts[0].Get("X-Callback-ID")))
+			gm.Expect(attempts[i].Get("Date")).ToNot(gm.Equal(attempts[i-1].Get("Date")),
+				"attempts are signed with a different date")
+		}
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		srv := newAttemptServer(0, 503)
+		defer srv.Close()
+
+		policy := policy
+		policy.MaxAttempts = 2
+
+		err := provisionWithRetries(srv, &countingSigner{}, policy)
+		gm.Expect(err).To(gm.HaveOccurred())
+		gm.Expect(srv.attempts()).To(gm.HaveLen(2))
+	})
+
+	t.Run("doesn't retry other errors", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		srv := newAttemptServer(0, 500)
+		defer srv.Close()
+
+		err := provisionWithRetries(srv, &countingSigner{}, policy)
+		gm.Expect(err).To(gm.HaveOccurred())
+		gm.Expect(srv.attempts()).To(gm.HaveLen(1))
+	})
+
+	t.Run("retries attempts which time out", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		srv := newAttemptServer(200*time.Millisecond, 204)
+		defer srv.Close()
+
+		policy := policy
+		policy.AttemptTimeout = 50 * time.Millisecond
+
+		err := provisionWithRetries(srv, &countingSigner{}, policy)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(srv.attempts()).To(gm.HaveLen(2))
+	})
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	gm.Expect(p.wait(1)).To(gm.Equal(time.Second))
+	gm.Expect(p.wait(2)).To(gm.Equal(2 * time.Second))
+	gm.Expect(p.wait(3)).To(gm.Equal(4 * time.Second))
+	gm.Expect(p.wait(4)).To(gm.Equal(5*time.Second), "waits are capped")
+	gm.Expect(p.wait(40)).To(gm.Equal(5 * time.Second))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		gm.Expect(p.wait(1)).To(gm.BeNumerically("~", 750*time.Millisecond, 250*time.Millisecond))
+	}
+}
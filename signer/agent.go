@@ -0,0 +1,153 @@
+package signer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/manifoldco/go-signature"
+)
+
+// Agents speak a protocol modeled on ssh-agent's: every message is a 4 byte
+// big-endian length, followed by a type byte and its payload. A client sends
+// a signRequest holding the canonical bytes to sign, which the agent answers
+// with a signResponse holding the X-Signature header value, or a failure
+// holding the reason it couldn't sign. Several requests may be sent over the
+// same connection.
+const (
+	signRequest  byte = 1
+	signResponse byte = 2
+	failure      byte = 3
+)
+
+// maxMessageSize bounds the messages agents and their clients accept.
+const maxMessageSize = 16 << 20
+
+var errMessageTooLarge = errors.New("message is too large")
+
+// Agent signs requests through an agent listening on a Unix socket.
+type Agent struct {
+	// Socket is the path of the Unix socket the agent listens on.
+	Socket string
+
+	// Timeout is how long signing a request may take, including connecting
+	// to the agent; DefaultTimeout if zero.
+	Timeout time.Duration
+}
+
+// Sign asks the agent to sign the canonical bytes.
+func (a *Agent) Sign(b []byte) (*signature.Signature, error) {
+	d := timeout(a.Timeout)
+	conn, err := net.DialTimeout("unix", a.Socket, d)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to the signing agent: %s", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(d)); err != nil {
+		return nil, err
+	}
+
+	if err := writeMessage(conn, signRequest, b); err != nil {
+		return nil, fmt.Errorf("could not send to the signing agent: %s", err)
+	}
+
+	t, payload, err := readMessage(conn)
+	if err != nil {
+		return nil, fmt.Errorf("could not read from the signing agent: %s", err)
+	}
+
+	switch t {
+	case signResponse:
+		return parse(string(payload))
+	case failure:
+		return nil, fmt.Errorf("signing agent failed: %s", payload)
+	default:
+		return nil, fmt.Errorf("unexpected message from the signing agent: %d", t)
+	}
+}
+
+// Serve accepts connections on the listener, answering the requests to sign
+// sent through each of them with the given signer. It returns once the
+// listener fails to accept a connection, such as when it is closed.
+func Serve(l net.Listener, s Signer) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go serveConn(conn, s)
+	}
+}
+
+func serveConn(conn net.Conn, s Signer) {
+	defer conn.Close()
+
+	for {
+		t, payload, err := readMessage(conn)
+		if err != nil {
+			if err == errMessageTooLarge {
+				writeMessage(conn, failure, []byte(err.Error()))
+			}
+			return
+		}
+
+		if t != signRequest {
+			msg := fmt.Sprintf("unknown message type %d", t)
+			if err := writeMessage(conn, failure, []byte(msg)); err != nil {
+				return
+			}
+			continue
+		}
+
+		sig, err := s.Sign(payload)
+		if err != nil {
+			err = writeMessage(conn, failure, []byte(err.Error()))
+		} else {
+			err = writeMessage(conn, signResponse, []byte(sig.String()))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeMessage(w io.Writer, t byte, payload []byte) error {
+	if len(payload)+1 > maxMessageSize {
+		return errMessageTooLarge
+	}
+
+	b := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(len(payload)+1))
+	b[4] = t
+	copy(b[5:], payload)
+
+	_, err := w.Write(b)
+	return err
+}
+
+func readMessage(r io.Reader) (byte, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	n := binary.BigEndian.Uint32(header[:])
+	if n == 0 {
+		return 0, nil, errors.New("empty message")
+	}
+	if n > maxMessageSize {
+		return 0, nil, errMessageTooLarge
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+
+	return b[0], b[1:], nil
+}
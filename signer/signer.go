@@ -0,0 +1,105 @@
+// Package signer provides grafton.Signer implementations which delegate
+// signing to another process, so the master private key never has to be
+// loaded by grafton itself.
+//
+// A Command runs an external command for every request, writing the
+// canonical bytes to sign to its standard input, and reading the X-Signature
+// header value from its standard output:
+//
+//	s := signer.NewCommand("/usr/local/bin/sign-request", "--key", "grafton")
+//
+// An Agent asks an agent listening on a Unix socket, such as one started with
+// `grafton signing-agent` or served by Serve:
+//
+//	s := &signer.Agent{Socket: "/run/user/1000/grafton.sock"}
+//	client := grafton.NewClient(grafton.ClientOptions{Signer: s, ...})
+//
+// Either way, the signature returned must hold a live key endorsed by the
+// master key the provider verifies requests with.
+package signer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/go-signature"
+)
+
+// DefaultTimeout is how long signing a single request may take, unless a
+// signer is given a timeout of its own.
+const DefaultTimeout = 10 * time.Second
+
+// Signer signs the canonical form of requests. It has the same method set as
+// grafton.Signer.
+type Signer interface {
+	Sign([]byte) (*signature.Signature, error)
+}
+
+// Command signs requests by running an external command.
+type Command struct {
+	// Path and Args are the command run for every request, as with
+	// exec.Command.
+	Path string
+	Args []string
+
+	// Timeout is how long the command may run for; DefaultTimeout if zero.
+	Timeout time.Duration
+}
+
+// NewCommand returns a Command running the named program with the given
+// arguments.
+func NewCommand(name string, args ...string) *Command {
+	return &Command{Path: name, Args: args}
+}
+
+// Sign runs the command with the canonical bytes on its standard input,
+// returning the signature it writes to its standard output. The command
+// fails signing by exiting with a non-zero status, with the reason on its
+// standard error.
+func (c *Command) Sign(b []byte) (*signature.Signature, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout(c.Timeout))
+	defer cancel()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("signing command failed: %s: %s", err, msg)
+		}
+		return nil, fmt.Errorf("signing command failed: %s", err)
+	}
+
+	return parse(stdout.String())
+}
+
+// parse parses a signature as written in the X-Signature header.
+func parse(s string) (*signature.Signature, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("no signature was returned")
+	}
+
+	sig, err := signature.ParseSignature(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature returned: %s", err)
+	}
+
+	return sig, nil
+}
+
+func timeout(d time.Duration) time.Duration {
+	if d <= 0 {
+		return DefaultTimeout
+	}
+
+	return d
+}
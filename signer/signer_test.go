@@ -0,0 +1,164 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gm "github.com/onsi/gomega"
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/manifoldco/go-base64"
+	"github.com/manifoldco/go-signature"
+)
+
+// testSigner signs with a live key endorsed by a master key of its own.
+type testSigner struct {
+	master      ed25519.PublicKey
+	live        ed25519.PrivateKey
+	endorsement []byte
+	err         error
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	masterPub, masterPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	livePub, livePriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testSigner{
+		master:      masterPub,
+		live:        livePriv,
+		endorsement: ed25519.Sign(masterPriv, livePub),
+	}
+}
+
+func (s *testSigner) Sign(b []byte) (*signature.Signature, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return &signature.Signature{
+		Value:       base64.New(ed25519.Sign(s.live, b)),
+		PublicKey:   base64.New([]byte(s.live.Public().(ed25519.PublicKey))),
+		Endorsement: base64.New(s.endorsement),
+	}, nil
+}
+
+// TestHelperCommand isn't a test, but the signing command run by
+// TestCommand, which answers with SIGNER_HELPER_OUTPUT, or fails when it is
+// empty.
+func TestHelperCommand(t *testing.T) {
+	if os.Getenv("SIGNER_HELPER") != "1" {
+		return
+	}
+
+	out := os.Getenv("SIGNER_HELPER_OUTPUT")
+	if out == "" {
+		fmt.Fprintln(os.Stderr, "the key is locked")
+		os.Exit(2)
+	}
+
+	b, err := ioutil.ReadAll(os.Stdin)
+	if err != nil || string(b) != "canonical" {
+		fmt.Fprintf(os.Stderr, "unexpected input %q\n", b)
+		os.Exit(3)
+	}
+
+	fmt.Println(out)
+	os.Exit(0)
+}
+
+func TestCommand(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	s := newTestSigner(t)
+	sig, err := s.Sign([]byte("canonical"))
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	cmd := NewCommand(os.Args[0], "-test.run=TestHelperCommand")
+	defer os.Unsetenv("SIGNER_HELPER")
+	defer os.Unsetenv("SIGNER_HELPER_OUTPUT")
+	os.Setenv("SIGNER_HELPER", "1")
+
+	t.Run("returns the signature written by the command", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		os.Setenv("SIGNER_HELPER_OUTPUT", sig.String())
+
+		got, err := cmd.Sign([]byte("canonical"))
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(got.String()).To(gm.Equal(sig.String()))
+		gm.Expect(got.Validate(s.master, []byte("canonical"))).To(gm.Succeed())
+	})
+
+	t.Run("fails with the reason the command gave", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		os.Setenv("SIGNER_HELPER_OUTPUT", "")
+
+		_, err := cmd.Sign([]byte("canonical"))
+		gm.Expect(err).To(gm.MatchError("signing command failed: exit status 2: the key is locked"))
+	})
+
+	t.Run("fails on output which isn't a signature", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		os.Setenv("SIGNER_HELPER_OUTPUT", "not a signature")
+
+		_, err := cmd.Sign([]byte("canonical"))
+		gm.Expect(err).To(gm.HaveOccurred())
+	})
+}
+
+func TestAgent(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "grafton-signer")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", socket)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer l.Close()
+
+	s := newTestSigner(t)
+	go Serve(l, s)
+
+	agent := &Agent{Socket: socket}
+
+	t.Run("returns the signature of the agent", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		for _, msg := range []string{"canonical", "another request"} {
+			sig, err := agent.Sign([]byte(msg))
+			gm.Expect(err).ToNot(gm.HaveOccurred())
+			gm.Expect(sig.Validate(s.master, []byte(msg))).To(gm.Succeed())
+		}
+	})
+
+	t.Run("fails with the reason the agent gave", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		s.err = errors.New("the key is locked")
+		defer func() { s.err = nil }()
+
+		_, err := agent.Sign([]byte("canonical"))
+		gm.Expect(err).To(gm.MatchError("signing agent failed: the key is locked"))
+	})
+
+	t.Run("fails when the agent isn't running", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+
+		missing := &Agent{Socket: filepath.Join(dir, "missing.sock")}
+		_, err := missing.Sign([]byte("canonical"))
+		gm.Expect(err).To(gm.HaveOccurred())
+	})
+}
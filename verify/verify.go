@@ -0,0 +1,308 @@
+// Package verify provides verification of requests signed by Manifold, or by
+// grafton when testing a provider.
+//
+// Requests are verified against the master public key, which endorses the live
+// key used to sign each request. Use signature.ManifoldKey for requests sent
+// by Manifold, or the public key from grafton's masterkey.json for requests
+// sent by grafton.
+//
+// Using the included middleware:
+//
+//	key, err := verify.LoadMasterKey("masterkey.json")
+//	v := verify.New(key)
+//	http.Handle("/v1/", v.Middleware(handler))
+//
+// Verifying a request manually:
+//
+//	if err := v.Verify(req); err == verify.ErrReplayedRequest {
+//		// ...
+//	}
+package verify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+
+	merrors "github.com/manifoldco/go-manifold/errors"
+	"github.com/manifoldco/go-signature"
+)
+
+// Error is returned when a request could not be verified. Every reason a
+// request is rejected for has its own Error value, which can be compared
+// against.
+type Error struct {
+	Type    merrors.Type
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the status code a request failing verification should
+// be answered with.
+func (e *Error) StatusCode() int {
+	return int(e.Type.Code())
+}
+
+// The errors returned when verifying a request.
+var (
+	ErrMissingSignature      = &Error{merrors.BadRequestError, "Missing X-Signature header"}
+	ErrMalformedSignature    = &Error{merrors.BadRequestError, "Could not parse X-Signature header"}
+	ErrMissingSignedHeaders  = &Error{merrors.BadRequestError, "Missing X-Signed-Headers header"}
+	ErrMalformedDate         = &Error{merrors.BadRequestError, "Unable to read request date"}
+	ErrUnreadableBody        = &Error{merrors.BadRequestError, "Unable to read request body"}
+	ErrUnsignedHeader        = &Error{merrors.UnauthorizedError, "A required header was not signed"}
+	ErrStaleRequest          = &Error{merrors.UnauthorizedError, "Request time skew is too great"}
+	ErrReplayedRequest       = &Error{merrors.UnauthorizedError, "Request has already been received"}
+	ErrUnendorsedKey         = &Error{merrors.UnauthorizedError, "Request Public Key was not endorsed by the master key"}
+	ErrInvalidSignature      = &Error{merrors.UnauthorizedError, "Request was not signed by included Public Key"}
+	errInvalidMasterKey      = &Error{merrors.BadRequestError, "The provided master public key is not valid"}
+	errMissingMasterKeyField = &Error{merrors.BadRequestError, "The master key file has no public key"}
+)
+
+// requiredHeaders must always be signed, while conditionalHeaders must be
+// signed whenever they are present.
+var (
+	requiredHeaders    = []string{"host", "date"}
+	conditionalHeaders = []string{"x-callback-id", "x-callback-url", "content-type", "content-length"}
+)
+
+// Verifier verifies signed requests, remembering the signatures it has seen
+// to reject requests which are replayed.
+//
+// A Verifier is safe for concurrent use.
+type Verifier struct {
+	// Skew is the largest difference allowed between the Date of a request
+	// and the time it is verified at.
+	Skew time.Duration
+
+	keys []ed25519.PublicKey
+	now  func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// New returns a Verifier for requests signed by live keys endorsed by the
+// given master public key, or any of the others, such as a master key being
+// rotated out.
+func New(masterKey ed25519.PublicKey, others ...ed25519.PublicKey) *Verifier {
+	return &Verifier{
+		Skew: signature.PermittedTimeSkew,
+		keys: append([]ed25519.PublicKey{masterKey}, others...),
+		now:  time.Now,
+		seen: make(map[string]time.Time),
+	}
+}
+
+// ParseMasterKey parses a base64 encoded master public key, in either the
+// standard or the URL safe encoding, padded or not.
+func ParseMasterKey(s string) (ed25519.PublicKey, error) {
+	s = strings.TrimRight(s, "=")
+	s = strings.Replace(s, "+", "-", -1)
+	s = strings.Replace(s, "/", "_", -1)
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, errInvalidMasterKey
+	}
+
+	return ed25519.PublicKey(b), nil
+}
+
+// LoadMasterKey reads the master public key from a masterkey.json file, as
+// written by `grafton generate`.
+func LoadMasterKey(file string) (ed25519.PublicKey, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	k := struct {
+		PublicKey string `json:"public_key"`
+	}{}
+	if err := json.Unmarshal(b, &k); err != nil {
+		return nil, err
+	}
+
+	if k.PublicKey == "" {
+		return nil, errMissingMasterKeyField
+	}
+
+	return ParseMasterKey(k.PublicKey)
+}
+
+// Verify verifies the signature of the given request, returning an *Error if
+// it is invalid. The request body is read, and replaced so it can be read
+// again by the caller.
+//
+// A request is rejected if its Date is outside the Verifier's Skew, if it
+// was already verified, or if any of the headers identifying it was left out
+// of X-Signed-Headers.
+func (v *Verifier) Verify(req *http.Request) error {
+	sigHeader := req.Header.Get("X-Signature")
+	if sigHeader == "" {
+		return ErrMissingSignature
+	}
+
+	sig, err := signature.ParseSignature(sigHeader)
+	if err != nil {
+		return ErrMalformedSignature
+	}
+
+	headerList := req.Header.Get("X-Signed-Headers")
+	if headerList == "" {
+		return ErrMissingSignedHeaders
+	}
+
+	if !signsHeaders(req, strings.Split(strings.ToLower(headerList), " ")) {
+		return ErrUnsignedHeader
+	}
+
+	date, err := time.Parse(time.RFC3339, req.Header.Get("Date"))
+	if err != nil {
+		return ErrMalformedDate
+	}
+
+	now := v.now()
+	delta := now.Sub(date)
+	if delta < 0 {
+		delta = -delta
+	}
+
+	if delta > v.Skew {
+		return ErrStaleRequest
+	}
+
+	body := &bytes.Buffer{}
+	if req.Body != nil {
+		if _, err := body.ReadFrom(req.Body); err != nil {
+			return ErrUnreadableBody
+		}
+
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body.Bytes()))
+	}
+
+	canonical, err := signature.Canonize(req, body)
+	if err != nil {
+		return ErrUnreadableBody
+	}
+
+	if !v.endorsed([]byte(*sig.PublicKey), []byte(*sig.Endorsement)) {
+		return ErrUnendorsedKey
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(*sig.PublicKey), canonical, []byte(*sig.Value)) {
+		return ErrInvalidSignature
+	}
+
+	// Only signatures which are valid are remembered, so forged requests
+	// can't fill up the cache. A signature is forgotten once its request
+	// would be rejected as stale anyway.
+	return v.remember(sig.Value.String(), date.Add(v.Skew), now)
+}
+
+// endorsed returns whether the live key was endorsed by one of the master
+// keys.
+func (v *Verifier) endorsed(liveKey, endorsement []byte) bool {
+	for _, k := range v.keys {
+		if ed25519.Verify(k, liveKey, endorsement) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *Verifier) remember(sig string, expires, now time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for s, exp := range v.seen {
+		if now.After(exp) {
+			delete(v.seen, s)
+		}
+	}
+
+	if _, ok := v.seen[sig]; ok {
+		return ErrReplayedRequest
+	}
+
+	v.seen[sig] = expires
+	return nil
+}
+
+// Middleware returns an http.Handler which verifies requests before passing
+// them to the given handler. Requests which fail verification are answered
+// with an error message, and never reach the handler.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if err := v.Verify(req); err != nil {
+			e, ok := err.(*Error)
+			if !ok {
+				e = &Error{merrors.UnauthorizedError, "Could not validate authenticity of the request"}
+			}
+
+			writeError(rw, e)
+			return
+		}
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// writeError responds with the error body providers return to Manifold, as
+// described by the ProviderError definition of the provider API.
+func writeError(rw http.ResponseWriter, e *Error) {
+	b, err := json.Marshal(struct {
+		Message string `json:"message"`
+	}{e.Message})
+	if err != nil {
+		panic(err)
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(e.StatusCode())
+	rw.Write(b)
+}
+
+func signsHeaders(req *http.Request, signed []string) bool {
+	has := make(map[string]bool, len(signed))
+	for _, h := range signed {
+		has[h] = true
+	}
+
+	for _, h := range requiredHeaders {
+		if !has[h] {
+			return false
+		}
+	}
+
+	for _, h := range conditionalHeaders {
+		if hasHeader(req, h) && !has[h] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasHeader returns whether the request has the header. Servers receive the
+// Content-Length of requests as their ContentLength, not as a header.
+func hasHeader(req *http.Request, h string) bool {
+	if h == "content-length" && req.ContentLength > 0 {
+		return true
+	}
+
+	return req.Header.Get(h) != ""
+}
@@ -0,0 +1,262 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	gm "github.com/onsi/gomega"
+	"golang.org/x/crypto/ed25519"
+
+	mbase64 "github.com/manifoldco/go-base64"
+	"github.com/manifoldco/go-signature"
+)
+
+type testKeys struct {
+	master      ed25519.PublicKey
+	live        ed25519.PrivateKey
+	livePublic  ed25519.PublicKey
+	endorsement []byte
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	masterPub, masterPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	livePub, livePriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testKeys{
+		master:      masterPub,
+		live:        livePriv,
+		livePublic:  livePub,
+		endorsement: ed25519.Sign(masterPriv, livePub),
+	}
+}
+
+// signedRequest builds a request signed the same way grafton signs requests
+// sent to providers.
+func (k *testKeys) signedRequest(t *testing.T, method, body string, date time.Time) *http.Request {
+	req := httptest.NewRequest(method, "http://provider.test/v1/resources/123?b=2&a=1", bytes.NewBufferString(body))
+	req.Header.Set("Date", date.UTC().Format(time.RFC3339))
+	req.Header.Set("X-Callback-ID", "2345")
+	req.Header.Set("X-Callback-URL", "http://connector.test/v1/callbacks/2345")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	req.Header.Set("X-Signed-Headers", "host date x-callback-id x-callback-url content-type content-length")
+
+	k.sign(t, req, body)
+	return req
+}
+
+func (k *testKeys) sign(t *testing.T, req *http.Request, body string) {
+	canonical, err := signature.Canonize(req, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := &signature.Signature{
+		Value:       mbase64.New(ed25519.Sign(k.live, canonical)),
+		PublicKey:   mbase64.New(k.livePublic),
+		Endorsement: mbase64.New(k.endorsement),
+	}
+	req.Header.Set("X-Signature", sig.String())
+}
+
+func TestVerify(t *testing.T) {
+	body := `{"plan":"small"}`
+
+	t.Run("accepts a signed request", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		k := newTestKeys(t)
+		req := k.signedRequest(t, http.MethodPut, body, time.Now())
+
+		gm.Expect(New(k.master).Verify(req)).To(gm.Succeed())
+
+		b, err := ioutil.ReadAll(req.Body)
+		gm.Expect(err).ToNot(gm.HaveOccurred())
+		gm.Expect(string(b)).To(gm.Equal(body))
+	})
+
+	t.Run("rejects a replayed request", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		k := newTestKeys(t)
+		v := New(k.master)
+		req := k.signedRequest(t, http.MethodPut, body, time.Now())
+
+		gm.Expect(v.Verify(req)).To(gm.Succeed())
+
+		replay := k.signedRequest(t, http.MethodPut, body, time.Now())
+		replay.Header = req.Header
+		gm.Expect(v.Verify(replay)).To(gm.Equal(ErrReplayedRequest))
+	})
+
+	t.Run("forgets signatures once they are stale", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		k := newTestKeys(t)
+		v := New(k.master)
+		now := time.Now()
+		v.now = func() time.Time { return now }
+
+		gm.Expect(v.Verify(k.signedRequest(t, http.MethodPut, body, now))).To(gm.Succeed())
+		gm.Expect(v.seen).To(gm.HaveLen(1))
+
+		now = now.Add(v.Skew + time.Second)
+		gm.Expect(v.Verify(k.signedRequest(t, http.MethodPut, body, now))).To(gm.Succeed())
+		gm.Expect(v.seen).To(gm.HaveLen(1))
+	})
+
+	t.Run("rejects a stale request", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		k := newTestKeys(t)
+
+		old := k.signedRequest(t, http.MethodPut, body, time.Now().Add(-6*time.Minute))
+		gm.Expect(New(k.master).Verify(old)).To(gm.Equal(ErrStaleRequest))
+
+		future := k.signedRequest(t, http.MethodPut, body, time.Now().Add(6*time.Minute))
+		gm.Expect(New(k.master).Verify(future)).To(gm.Equal(ErrStaleRequest))
+	})
+
+	t.Run("rejects a tampered body", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		k := newTestKeys(t)
+		req := k.signedRequest(t, http.MethodPut, body, time.Now())
+		req.Body = ioutil.NopCloser(bytes.NewBufferString(`{"plan":"large"}`))
+
+		gm.Expect(New(k.master).Verify(req)).To(gm.Equal(ErrInvalidSignature))
+	})
+
+	t.Run("rejects a tampered callback url", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		k := newTestKeys(t)
+		req := k.signedRequest(t, http.MethodPut, body, time.Now())
+		req.Header.Set("X-Callback-URL", "http://evil.test/v1/callbacks/2345")
+
+		gm.Expect(New(k.master).Verify(req)).To(gm.Equal(ErrInvalidSignature))
+	})
+
+	t.Run("rejects a request leaving headers unsigned", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		k := newTestKeys(t)
+		req := k.signedRequest(t, http.MethodPut, body, time.Now())
+		req.Header.Set("X-Signed-Headers", "host date content-type content-length")
+		k.sign(t, req, body)
+
+		gm.Expect(New(k.master).Verify(req)).To(gm.Equal(ErrUnsignedHeader))
+	})
+
+	t.Run("rejects a request with a body leaving content-length unsigned", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		k := newTestKeys(t)
+		req := k.signedRequest(t, http.MethodPut, body, time.Now())
+
+		// As received by a server, which moves Content-Length out of the
+		// headers.
+		req.Header.Del("Content-Length")
+		req.Header.Set("X-Signed-Headers", "host date x-callback-id x-callback-url content-type")
+		k.sign(t, req, body)
+
+		gm.Expect(req.ContentLength).To(gm.Equal(int64(len(body))))
+		gm.Expect(New(k.master).Verify(req)).To(gm.Equal(ErrUnsignedHeader))
+	})
+
+	t.Run("rejects a key endorsed by another master key", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		k := newTestKeys(t)
+		other := newTestKeys(t)
+		req := k.signedRequest(t, http.MethodPut, body, time.Now())
+
+		gm.Expect(New(other.master).Verify(req)).To(gm.Equal(ErrUnendorsedKey))
+	})
+
+	t.Run("accepts keys endorsed by any of the master keys", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		k := newTestKeys(t)
+		other := newTestKeys(t)
+		v := New(other.master, k.master)
+
+		gm.Expect(v.Verify(k.signedRequest(t, http.MethodPut, body, time.Now()))).To(gm.Succeed())
+		gm.Expect(v.Verify(other.signedRequest(t, http.MethodPut, body, time.Now()))).To(gm.Succeed())
+	})
+
+	t.Run("rejects malformed requests", func(t *testing.T) {
+		gm.RegisterTestingT(t)
+		k := newTestKeys(t)
+		v := New(k.master)
+
+		req := k.signedRequest(t, http.MethodPut, body, time.Now())
+		req.Header.Del("X-Signature")
+		gm.Expect(v.Verify(req)).To(gm.Equal(ErrMissingSignature))
+
+		req.Header.Set("X-Signature", "not a signature chain")
+		gm.Expect(v.Verify(req)).To(gm.Equal(ErrMalformedSignature))
+
+		req = k.signedRequest(t, http.MethodPut, body, time.Now())
+		req.Header.Del("X-Signed-Headers")
+		gm.Expect(v.Verify(req)).To(gm.Equal(ErrMissingSignedHeaders))
+
+		req = k.signedRequest(t, http.MethodPut, body, time.Now())
+		req.Header.Set("Date", "yesterday")
+		gm.Expect(v.Verify(req)).To(gm.Equal(ErrMalformedDate))
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	gm.RegisterTestingT(t)
+	k := newTestKeys(t)
+
+	called := 0
+	h := New(k.master).Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		called++
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := k.signedRequest(t, http.MethodDelete, "", time.Now())
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	gm.Expect(rw.Code).To(gm.Equal(http.StatusNoContent))
+
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	gm.Expect(rw.Code).To(gm.Equal(http.StatusUnauthorized))
+	gm.Expect(rw.Body.String()).To(gm.MatchJSON(`{"message":"Request has already been received"}`))
+	gm.Expect(called).To(gm.Equal(1))
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	gm.RegisterTestingT(t)
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+
+	dir, err := ioutil.TempDir("", "grafton-verify")
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "masterkey.json")
+	contents := `{"public_key":"` + base64.StdEncoding.EncodeToString(pub) + `","private_key":"unused"}`
+	gm.Expect(ioutil.WriteFile(file, []byte(contents), 0600)).To(gm.Succeed())
+
+	key, err := LoadMasterKey(file)
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(key).To(gm.Equal(pub))
+
+	key, err = ParseMasterKey(base64.RawURLEncoding.EncodeToString(pub))
+	gm.Expect(err).ToNot(gm.HaveOccurred())
+	gm.Expect(key).To(gm.Equal(pub))
+
+	_, err = ParseMasterKey("too-short")
+	gm.Expect(err).To(gm.HaveOccurred())
+}